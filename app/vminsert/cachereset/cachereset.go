@@ -0,0 +1,119 @@
+package cachereset
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	selectNodes = flagutil.NewArray("selectNode", "Addresses of vmselect nodes for resetting rollup result cache after ingesting log lines "+
+		"with timestamps older than -search.cacheTimestampOffset; usage: -selectNode=vmselect-host1:8481 -selectNode=vmselect-host2:8481")
+	cacheTimestampOffset = flag.Duration("search.cacheTimestampOffset", 5*time.Minute, "Log lines with timestamps older than the given duration since the current time "+
+		"reset rollup result cache at -selectNode. It must match -search.cacheTimestampOffset at vmselect")
+	resetCacheAuthKey = flag.String("search.resetCacheAuthKey", "", "authKey, which is passed to /internal/resetRollupResultCache at -selectNode. "+
+		"It must match -search.resetCacheAuthKey at vmselect")
+	resetCacheInterval = flag.Duration("search.resetCacheInterval", 10*time.Second, "The interval for resetting rollup result cache at -selectNode after ingesting late log lines")
+)
+
+// RegisterTimestamp registers the timestamp in milliseconds for the ingested log line.
+//
+// Rollup result cache at -selectNode is reset during the next -search.resetCacheInterval
+// if the timestamp is older than -search.cacheTimestampOffset, since the cache may miss the log line.
+func RegisterTimestamp(timestamp int64) {
+	if len(*selectNodes) == 0 {
+		return
+	}
+	deadline := int64(fasttime.UnixTimestamp())*1000 - cacheTimestampOffset.Milliseconds()
+	if timestamp >= deadline {
+		return
+	}
+	if atomic.LoadUint32(&needReset) == 0 {
+		atomic.StoreUint32(&needReset, 1)
+	}
+	lateRows.Inc()
+}
+
+// needReset is set to 1 if rollup result cache at -selectNode must be reset.
+var needReset uint32
+
+// Init starts resetting rollup result cache at -selectNode after ingesting late log lines.
+//
+// Stop must be called for stopping the reset.
+func Init() {
+	if len(*selectNodes) == 0 {
+		return
+	}
+	resetWorkerWG.Add(1)
+	go func() {
+		defer resetWorkerWG.Done()
+		resetWorker(resetWorkerStopCh)
+	}()
+}
+
+// Stop stops resetting rollup result cache at -selectNode.
+func Stop() {
+	close(resetWorkerStopCh)
+	resetWorkerWG.Wait()
+}
+
+var (
+	resetWorkerWG     sync.WaitGroup
+	resetWorkerStopCh = make(chan struct{})
+)
+
+func resetWorker(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(*resetCacheInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		if atomic.CompareAndSwapUint32(&needReset, 1, 0) {
+			resetRollupResultCaches()
+		}
+	}
+}
+
+func resetRollupResultCaches() {
+	for _, selectNode := range *selectNodes {
+		callURL := fmt.Sprintf("http://%s/internal/resetRollupResultCache", selectNode)
+		if len(*resetCacheAuthKey) > 0 {
+			callURL += "?authKey=" + url.QueryEscape(*resetCacheAuthKey)
+		}
+		resp, err := httpClient.Get(callURL)
+		if err != nil {
+			logger.Errorf("cannot reset rollup result cache at %q: %s", selectNode, err)
+			resetRollupResultCacheErrors.Inc()
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			logger.Errorf("unexpected status code when resetting rollup result cache at %q; got %d; want %d", selectNode, resp.StatusCode, http.StatusOK)
+			resetRollupResultCacheErrors.Inc()
+			continue
+		}
+	}
+	resetRollupResultCacheCalls.Inc()
+}
+
+var (
+	lateRows                     = metrics.NewCounter(`vm_late_rows_total`)
+	resetRollupResultCacheErrors = metrics.NewCounter(`vm_reset_rollup_result_cache_errors_total`)
+	resetRollupResultCacheCalls  = metrics.NewCounter(`vm_reset_rollup_result_cache_calls_total`)
+)
+
+var httpClient = &http.Client{
+	Timeout: time.Second * 5,
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/leveldetect"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/netstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/relabel"
 	parser "github.com/VictoriaMetrics/VictoriaLogs/lib/protoparser/importer"
@@ -36,6 +37,7 @@ func insertRows(at *auth.Token, rows []parser.Row) error {
 	ctx.Reset() // This line is required for initializing ctx internals.
 	atCopy := *at
 	hasRelabeling := relabel.HasRelabeling()
+	detectLevel := leveldetect.Enabled()
 	for i := range rows {
 		r := &rows[i]
 		ctx.Labels = ctx.Labels[:0]
@@ -61,6 +63,9 @@ func insertRows(at *auth.Token, rows []parser.Row) error {
 			// Skip metric without labels.
 			continue
 		}
+		if detectLevel {
+			ctx.Labels = leveldetect.AppendLabel(ctx.Labels, leveldetect.GetLevel(ctx.Labels, r.Value))
+		}
 		if err := ctx.WriteDataPoint(&atCopy, ctx.Labels, r.Timestamp, r.Value); err != nil {
 			return err
 		}
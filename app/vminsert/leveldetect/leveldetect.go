@@ -0,0 +1,66 @@
+package leveldetect
+
+import (
+	"flag"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/loglevel"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var detectLevel = flag.Bool("detectLevel", false, "Whether to detect log level for every ingested log line and to store it in `detected_level` label. "+
+	"The level is detected from JSON and logfmt fields, syslog priority and bracketed tokens such as `[WARN]`. "+
+	"Log lines with distinct levels are stored in distinct streams")
+
+// labelName is the name of the label containing the detected log level.
+const labelName = "detected_level"
+
+var labelNameBytes = []byte(labelName)
+
+// Enabled returns true if log level detection is enabled via -detectLevel.
+func Enabled() bool {
+	return *detectLevel
+}
+
+// GetLevel returns log level for the given line in the stream with the given labels.
+//
+// An empty string is returned if labels already contain `detected_level` label.
+// If labels contain `level` label, then its value is used instead of detecting the level from line.
+func GetLevel(labels []storage.Label, line []byte) string {
+	var streamLevel []byte
+	for i := range labels {
+		label := &labels[i]
+		if string(label.Name) == labelName {
+			return ""
+		}
+		if string(label.Name) == "level" {
+			streamLevel = label.Value
+		}
+	}
+	if streamLevel != nil {
+		if level := loglevel.Normalize(bytesutil.ToUnsafeString(streamLevel)); level != loglevel.Unknown {
+			return level
+		}
+	}
+	level := loglevel.Detect(line)
+	if level == loglevel.Unknown {
+		unknownLevelLines.Inc()
+	}
+	return level
+}
+
+var unknownLevelLines = metrics.NewCounter(`vm_detect_level_unknown_lines_total`)
+
+// AppendLabel appends `detected_level` label with the given level to labels and returns the result.
+//
+// labels are returned as is if level is empty.
+func AppendLabel(labels []storage.Label, level string) []storage.Label {
+	if len(level) == 0 {
+		return labels
+	}
+	return append(labels, storage.Label{
+		Name:  labelNameBytes,
+		Value: bytesutil.ToUnsafeBytes(level),
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/cachereset"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/importer"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/netstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/relabel"
@@ -52,6 +53,7 @@ func main() {
 	logger.Infof("successfully initialized netstorage in %.3f seconds", time.Since(startTime).Seconds())
 
 	relabel.Init()
+	cachereset.Init()
 	storage.SetMaxLabelsPerTimeseries(*maxLabelsPerTimeseries)
 	common.StartUnmarshalWorkers()
 	writeconcurrencylimiter.Init()
@@ -74,6 +76,7 @@ func main() {
 	logger.Infof("successfully shut down http service in %.3f seconds", time.Since(startTime).Seconds())
 
 	common.StopUnmarshalWorkers()
+	cachereset.Stop()
 
 	logger.Infof("shutting down neststorage...")
 	startTime = time.Now()
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/leveldetect"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/netstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vminsert/relabel"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/lokipb"
@@ -38,6 +39,7 @@ func insertRows(at *auth.Token, timeseries []lokipb.Stream) error {
 	ctx.Reset() // This line is required for initializing ctx internals.
 	rowsTotal := 0
 	hasRelabeling := relabel.HasRelabeling()
+	detectLevel := leveldetect.Enabled()
 
 	var err error
 	var tail []byte
@@ -58,15 +60,27 @@ func insertRows(at *auth.Token, timeseries []lokipb.Stream) error {
 			// Skip metric without labels.
 			continue
 		}
+		streamLabelsLen := len(ctx.Labels)
 		storageNodeIdx := ctx.GetStorageNodeIdx(at, ctx.Labels)
 		ctx.MetricNameBuf = ctx.MetricNameBuf[:0]
+		prevLevel := ""
 		entries := ts.Entries
 		for i := range entries {
 			r := &entries[i]
+			line := bytesutil.ToUnsafeBytes(r.Line)
+			if detectLevel {
+				// Log lines with distinct levels go to distinct streams.
+				if level := leveldetect.GetLevel(ctx.Labels[:streamLabelsLen], line); level != prevLevel {
+					prevLevel = level
+					ctx.Labels = leveldetect.AppendLabel(ctx.Labels[:streamLabelsLen], level)
+					storageNodeIdx = ctx.GetStorageNodeIdx(at, ctx.Labels)
+					ctx.MetricNameBuf = ctx.MetricNameBuf[:0]
+				}
+			}
 			if len(ctx.MetricNameBuf) == 0 {
 				ctx.MetricNameBuf = storage.MarshalMetricNameRaw(ctx.MetricNameBuf[:0], at.AccountID, at.ProjectID, ctx.Labels)
 			}
-			if err := ctx.WriteDataPointExt(at, storageNodeIdx, ctx.MetricNameBuf, r.Timestamp.UnixNano()/1e6, bytesutil.ToUnsafeBytes(r.Line)); err != nil {
+			if err := ctx.WriteDataPointExt(at, storageNodeIdx, ctx.MetricNameBuf, r.Timestamp.UnixNano()/1e6, line); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+)
+
+// tenantLabel is the label with the tenant for results obtained from multiple tenants.
+const tenantLabel = "__tenant_id__"
+
+const usage = `vmlogcli is a command line client for vmselect.
+
+Usage:
+  vmlogcli <command> [flags] [args]
+
+Commands:
+  query <query>          Run range query. Log entries are fetched in batches of -batch entries until -limit entries are fetched
+  instant-query <query>  Run instant query
+  labels [<name>]        Show label names or values for the given label name
+  series <matcher>...    Show series matching the given selectors
+  tail <query>           Show live log entries for the given query
+  version                Show vmlogcli version
+
+Run 'vmlogcli <command> -help' for command flags.
+Flags may be set before or after args. -addr, -tenant, -username and -password flags default to
+VMLOGCLI_ADDR, VMLOGCLI_TENANT, VMLOGCLI_USERNAME and VMLOGCLI_PASSWORD environment variables.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	var err error
+	switch cmd {
+	case "query":
+		err = runQuery(args, os.Stdout)
+	case "instant-query":
+		err = runInstantQuery(args, os.Stdout)
+	case "labels":
+		err = runLabels(args, os.Stdout)
+	case "series":
+		err = runSeries(args, os.Stdout)
+	case "tail":
+		err = runTail(args, os.Stdout)
+	case "version":
+		fmt.Println(buildinfo.Version)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// commonFlags contains flags shared by all the commands.
+type commonFlags struct {
+	addr     string
+	tenants  string
+	username string
+	password string
+	timeout  time.Duration
+	output   string
+	colored  bool
+	timezone string
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	var cf commonFlags
+	fs.StringVar(&cf.addr, "addr", getEnv("VMLOGCLI_ADDR", "http://localhost:8481"), "vmselect address")
+	fs.StringVar(&cf.tenants, "tenant", getEnv("VMLOGCLI_TENANT", "0"), "Comma-separated list of tenants in the form accountID[:projectID]. "+
+		"Results for multiple tenants are merged, while every result gets "+tenantLabel+" label")
+	fs.StringVar(&cf.username, "username", os.Getenv("VMLOGCLI_USERNAME"), "Optional username for basic auth")
+	fs.StringVar(&cf.password, "password", os.Getenv("VMLOGCLI_PASSWORD"), "Optional password for basic auth")
+	fs.DurationVar(&cf.timeout, "timeout", time.Minute, "Timeout for requests to vmselect. It isn't applied to tail")
+	fs.StringVar(&cf.output, "output", outputDefault, "Output mode for log entries: "+outputDefault+" (timestamp, labels and line), "+
+		outputRaw+" (line only) or "+outputJSONL+" (JSON object per line)")
+	fs.BoolVar(&cf.colored, "colored-output", isTerminal(os.Stdout), "Whether to show labels in colors in the default output. "+
+		"Enabled by default if stdout is a terminal")
+	fs.StringVar(&cf.timezone, "timezone", "Local", "Timezone for timestamps in the output, for example UTC")
+	return &cf
+}
+
+func (cf *commonFlags) newClients(withTimeout bool) ([]*client.Client, error) {
+	hc := &http.Client{}
+	if withTimeout {
+		hc.Timeout = cf.timeout
+	}
+	var cs []*client.Client
+	for _, tenant := range strings.Split(cf.tenants, ",") {
+		c, err := client.NewClient(&client.Config{
+			Addr:       cf.addr,
+			Tenant:     strings.TrimSpace(tenant),
+			Username:   cf.username,
+			Password:   cf.password,
+			HTTPClient: hc,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid -tenant=%q: %w", cf.tenants, err)
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+func (cf *commonFlags) newPrinter(w io.Writer) (*printer, error) {
+	loc, err := time.LoadLocation(cf.timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -timezone=%q: %w", cf.timezone, err)
+	}
+	return newPrinter(w, cf.output, cf.colored, loc)
+}
+
+// timeRangeFlags contains flags for the time range of the query.
+type timeRangeFlags struct {
+	since time.Duration
+	from  string
+	to    string
+}
+
+func addTimeRangeFlags(fs *flag.FlagSet, defaultSince time.Duration) *timeRangeFlags {
+	var tf timeRangeFlags
+	fs.DurationVar(&tf.since, "since", defaultSince, "Lookback window for the query if -from isn't set")
+	fs.StringVar(&tf.from, "from", "", "Start of the time range in RFC3339 format or unix timestamp in seconds. Overrides -since")
+	fs.StringVar(&tf.to, "to", "", "End of the time range in RFC3339 format or unix timestamp in seconds. The current time by default")
+	return &tf
+}
+
+func (tf *timeRangeFlags) getTimeRange(now time.Time) (time.Time, time.Time, error) {
+	end := now
+	if len(tf.to) > 0 {
+		t, err := parseTime(tf.to)
+		if err != nil {
+			return end, end, fmt.Errorf("invalid -to: %w", err)
+		}
+		end = t
+	}
+	start := end.Add(-tf.since)
+	if len(tf.from) > 0 {
+		t, err := parseTime(tf.from)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid -from: %w", err)
+		}
+		start = t
+	}
+	if start.After(end) {
+		return start, end, fmt.Errorf("the start of the time range %s cannot exceed the end %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+// parseTime parses s in RFC3339 format or as unix timestamp in seconds.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q as RFC3339 time or unix timestamp", s)
+	}
+	return time.Unix(0, int64(secs*1e9)), nil
+}
+
+// parseArgs parses flags from args, which may be mixed with positional args, and returns the positional args.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runQuery(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	cf := addCommonFlags(fs)
+	tf := addTimeRangeFlags(fs, time.Hour)
+	limit := fs.Int("limit", 30, "The maximum number of log entries to return")
+	batch := fs.Int("batch", 1000, "The maximum number of log entries to fetch per request")
+	forward := fs.Bool("forward", false, "Return the oldest log entries first instead of the newest ones")
+	step := fs.Duration("step", 0, "Step for metric queries. It is calculated by vmselect if isn't set")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("expecting a single query arg; got %d args", len(positional))
+	}
+	if *limit <= 0 || *batch <= 0 {
+		return fmt.Errorf("-limit and -batch must be positive; got %d and %d", *limit, *batch)
+	}
+	start, end, err := tf.getTimeRange(time.Now())
+	if err != nil {
+		return err
+	}
+	cs, err := cf.newClients(true)
+	if err != nil {
+		return err
+	}
+	p, err := cf.newPrinter(w)
+	if err != nil {
+		return err
+	}
+
+	var entries []entry
+	for _, c := range cs {
+		es, series, err := queryRange(c, positional[0], start, end, *step, *limit, *batch, *forward)
+		if err != nil {
+			return err
+		}
+		for i := range series {
+			s := &series[i]
+			s.Labels = addTenantLabel(s.Labels, c, len(cs))
+			p.printSeries(s, false)
+		}
+		for i := range es {
+			es[i].labels = addTenantLabel(es[i].labels, c, len(cs))
+		}
+		entries = append(entries, es...)
+	}
+	entries = sortEntries(entries, *forward)
+	if len(entries) > *limit {
+		entries = entries[:*limit]
+	}
+	for i := range entries {
+		p.printEntry(&entries[i])
+	}
+	return p.flush()
+}
+
+// queryRange returns up to limit log entries or time series for the query on the time range [start..end].
+//
+// Log entries are fetched in batches of up to batchSize entries. Every batch is resumed from the previous one via nextToken.
+func queryRange(c *client.Client, query string, start, end time.Time, step time.Duration, limit, batchSize int, forward bool) ([]entry, []client.Series, error) {
+	var entries []entry
+	token := ""
+	for len(entries) < limit {
+		n := batchSize
+		if remaining := limit - len(entries); remaining < n {
+			n = remaining
+		}
+		qr, err := c.QueryRange(context.Background(), &client.QueryRangeArgs{
+			Query:   query,
+			Start:   start,
+			End:     end,
+			Step:    step,
+			Limit:   n,
+			Forward: forward,
+			Token:   token,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if qr.ResultType != client.ResultTypeStreams {
+			return nil, qr.Series, nil
+		}
+		prevLen := len(entries)
+		entries = getEntries(entries, qr.Streams)
+		if len(qr.NextToken) == 0 || len(entries) == prevLen {
+			// There are no more log entries.
+			break
+		}
+		token = qr.NextToken
+	}
+	return entries, nil, nil
+}
+
+func runInstantQuery(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("instant-query", flag.ContinueOnError)
+	cf := addCommonFlags(fs)
+	now := fs.String("now", "", "Evaluation time in RFC3339 format or unix timestamp in seconds. The current time by default")
+	limit := fs.Int("limit", 30, "The maximum number of log entries to return")
+	forward := fs.Bool("forward", false, "Return the oldest log entries first instead of the newest ones")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("expecting a single query arg; got %d args", len(positional))
+	}
+	t := time.Now()
+	if len(*now) > 0 {
+		t, err = parseTime(*now)
+		if err != nil {
+			return fmt.Errorf("invalid -now: %w", err)
+		}
+	}
+	cs, err := cf.newClients(true)
+	if err != nil {
+		return err
+	}
+	p, err := cf.newPrinter(w)
+	if err != nil {
+		return err
+	}
+
+	var entries []entry
+	for _, c := range cs {
+		qr, err := c.Query(context.Background(), &client.QueryArgs{
+			Query:   positional[0],
+			Time:    t,
+			Limit:   *limit,
+			Forward: *forward,
+		})
+		if err != nil {
+			return err
+		}
+		if qr.ResultType != client.ResultTypeStreams {
+			for i := range qr.Series {
+				s := &qr.Series[i]
+				s.Labels = addTenantLabel(s.Labels, c, len(cs))
+				p.printSeries(s, true)
+			}
+			continue
+		}
+		for i := range qr.Streams {
+			qr.Streams[i].Labels = addTenantLabel(qr.Streams[i].Labels, c, len(cs))
+		}
+		entries = getEntries(entries, qr.Streams)
+	}
+	entries = sortEntries(entries, *forward)
+	if len(entries) > *limit {
+		entries = entries[:*limit]
+	}
+	for i := range entries {
+		p.printEntry(&entries[i])
+	}
+	return p.flush()
+}
+
+func runLabels(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("labels", flag.ContinueOnError)
+	cf := addCommonFlags(fs)
+	tf := addTimeRangeFlags(fs, time.Hour)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return fmt.Errorf("expecting zero or one label name arg; got %d args", len(positional))
+	}
+	start, end, err := tf.getTimeRange(time.Now())
+	if err != nil {
+		return err
+	}
+	cs, err := cf.newClients(true)
+	if err != nil {
+		return err
+	}
+	p, err := cf.newPrinter(w)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]struct{})
+	for _, c := range cs {
+		var a []string
+		if len(positional) == 0 {
+			a, err = c.Labels(context.Background(), start, end)
+		} else {
+			a, err = c.LabelValues(context.Background(), positional[0], start, end)
+		}
+		if err != nil {
+			return err
+		}
+		for _, s := range a {
+			m[s] = struct{}{}
+		}
+	}
+	a := make([]string, 0, len(m))
+	for s := range m {
+		a = append(a, s)
+	}
+	sort.Strings(a)
+	for _, s := range a {
+		p.printString(s)
+	}
+	return p.flush()
+}
+
+func runSeries(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("series", flag.ContinueOnError)
+	cf := addCommonFlags(fs)
+	tf := addTimeRangeFlags(fs, time.Hour)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("expecting at least a single series selector arg")
+	}
+	start, end, err := tf.getTimeRange(time.Now())
+	if err != nil {
+		return err
+	}
+	cs, err := cf.newClients(true)
+	if err != nil {
+		return err
+	}
+	p, err := cf.newPrinter(w)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cs {
+		series, err := c.Series(context.Background(), positional, start, end)
+		if err != nil {
+			return err
+		}
+		for _, labels := range series {
+			p.printLabels(addTenantLabel(labels, c, len(cs)))
+		}
+	}
+	return p.flush()
+}
+
+func runTail(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	cf := addCommonFlags(fs)
+	since := fs.Duration("since", time.Hour, "Lookback window for log entries shown before live log entries")
+	limit := fs.Int("limit", 30, "The maximum number of log entries shown before live log entries")
+	delayFor := fs.Int("delay-for", 0, "Delay in seconds for live log entries, so entries arriving late are shown in the order of their timestamps")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("expecting a single query arg; got %d args", len(positional))
+	}
+	cs, err := cf.newClients(false)
+	if err != nil {
+		return err
+	}
+	p, err := cf.newPrinter(w)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	errCh := make(chan error, len(cs))
+	ta := &client.TailArgs{
+		Query:    positional[0],
+		Start:    time.Now().Add(-*since),
+		Limit:    *limit,
+		DelayFor: time.Duration(*delayFor) * time.Second,
+	}
+	for _, c := range cs {
+		go func(c *client.Client) {
+			errCh <- c.Tail(context.Background(), ta, func(tr *client.TailResponse) error {
+				for i := range tr.Streams {
+					tr.Streams[i].Labels = addTenantLabel(tr.Streams[i].Labels, c, len(cs))
+				}
+				entries := getEntries(nil, tr.Streams)
+				entries = sortEntries(entries, true)
+
+				mu.Lock()
+				defer mu.Unlock()
+				for i := range entries {
+					p.printEntry(&entries[i])
+				}
+				if n := len(tr.DroppedEntries); n > 0 {
+					fmt.Fprintf(os.Stderr, "warning: %d log entries were dropped by vmselect for tenant %s, since the client doesn't keep up\n", n, c.Tenant())
+				}
+				return p.flush()
+			})
+		}(c)
+	}
+	for range cs {
+		if err := <-errCh; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entry is a log entry obtained from a stream.
+type entry struct {
+	labels    map[string]string
+	timestamp int64 // in nanoseconds
+	line      string
+}
+
+// getEntries appends log entries from streams to dst and returns the result.
+func getEntries(dst []entry, streams []client.Stream) []entry {
+	for i := range streams {
+		s := &streams[i]
+		for _, e := range s.Entries {
+			dst = append(dst, entry{
+				labels:    s.Labels,
+				timestamp: e.Timestamp.UnixNano(),
+				line:      e.Line,
+			})
+		}
+	}
+	return dst
+}
+
+// sortEntries sorts entries by timestamp in ascending order if forward is set. Otherwise entries are sorted in descending order.
+func sortEntries(entries []entry, forward bool) []entry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if forward {
+			return entries[i].timestamp < entries[j].timestamp
+		}
+		return entries[i].timestamp > entries[j].timestamp
+	})
+	return entries
+}
+
+// addTenantLabel returns labels with tenantLabel set to c tenant if results are obtained from multiple tenants.
+func addTenantLabel(labels map[string]string, c *client.Client, tenantsCount int) map[string]string {
+	if tenantsCount <= 1 {
+		return labels
+	}
+	m := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		m[k] = v
+	}
+	m[tenantLabel] = c.Tenant()
+	return m
+}
+
+func getEnv(key, defaultValue string) string {
+	if v := os.Getenv(key); len(v) > 0 {
+		return v
+	}
+	return defaultValue
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
+)
+
+func newTestClient(t *testing.T, s *httptest.Server, tenant string) *client.Client {
+	t.Helper()
+	c, err := client.NewClient(&client.Config{
+		Addr:       s.URL,
+		Tenant:     tenant,
+		HTTPClient: s.Client(),
+	})
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	return c
+}
+
+func TestParseArgs(t *testing.T) {
+	f := func(args []string, positionalExpected []string, limitExpected int) {
+		t.Helper()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		limit := fs.Int("limit", 30, "")
+		positional, err := parseArgs(fs, args)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(positional, positionalExpected) {
+			t.Fatalf("unexpected positional args; got %q; want %q", positional, positionalExpected)
+		}
+		if *limit != limitExpected {
+			t.Fatalf("unexpected -limit; got %d; want %d", *limit, limitExpected)
+		}
+	}
+	f(nil, nil, 30)
+	f([]string{`{job="api"}`}, []string{`{job="api"}`}, 30)
+	f([]string{"-limit=10", `{job="api"}`}, []string{`{job="api"}`}, 10)
+	f([]string{`{job="api"}`, "--limit", "10"}, []string{`{job="api"}`}, 10)
+	f([]string{"a", "-limit=5", "b"}, []string{"a", "b"}, 5)
+	f([]string{"a", "--", "-limit=5"}, []string{"a", "-limit=5"}, 30)
+}
+
+func TestTimeRangeFlags(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	f := func(tf *timeRangeFlags, startExpected, endExpected int64) {
+		t.Helper()
+		start, end, err := tf.getTimeRange(now)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if start.Unix() != startExpected || end.Unix() != endExpected {
+			t.Fatalf("unexpected time range; got [%d..%d]; want [%d..%d]", start.Unix(), end.Unix(), startExpected, endExpected)
+		}
+	}
+	f(&timeRangeFlags{since: time.Hour}, 1600000000-3600, 1600000000)
+	f(&timeRangeFlags{since: time.Hour, to: "1500000000"}, 1500000000-3600, 1500000000)
+	f(&timeRangeFlags{since: time.Hour, from: "2020-09-13T00:00:00Z"}, 1599955200, 1600000000)
+	f(&timeRangeFlags{from: "1500000000.5", to: "2020-09-13T00:00:00Z"}, 1500000000, 1599955200)
+
+	for _, tf := range []*timeRangeFlags{
+		{from: "foo"},
+		{to: "bar"},
+		{from: "1600000001"},
+	} {
+		if _, _, err := tf.getTimeRange(now); err == nil {
+			t.Fatalf("expecting non-nil error for %+v", tf)
+		}
+	}
+}
+
+func TestQueryRangeBatches(t *testing.T) {
+	// The server returns a single log entry per stream per request in backward direction starting from the token.
+	var requests []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/select/1:2/loki/api/v1/query_range" {
+			t.Errorf("unexpected path: %q", r.URL.Path)
+		}
+		requests = append(requests, r.FormValue("limit")+"/"+r.FormValue("token"))
+		limit, _ := strconv.Atoi(r.FormValue("limit"))
+		next := 10
+		if token := r.FormValue("token"); len(token) > 0 {
+			next, _ = strconv.Atoi(token)
+		}
+		var values string
+		for i := 0; i < limit && next > 0; i++ {
+			if i > 0 {
+				values += ","
+			}
+			values += fmt.Sprintf(`["%d","line %d"]`, next, next)
+			next--
+		}
+		nextToken := ""
+		if next > 0 {
+			nextToken = fmt.Sprintf(`,"nextToken":"%d"`, next)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[%s]}],"stats":{}%s}}`, values, nextToken)
+	}))
+	defer s.Close()
+
+	c := newTestClient(t, s, "1:2")
+	f := func(limit, batchSize int, requestsExpected []string, entriesExpected int) {
+		t.Helper()
+		requests = nil
+		entries, series, err := queryRange(c, `{job="api"}`, time.Unix(0, 0), time.Unix(100, 0), 0, limit, batchSize, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(series) > 0 {
+			t.Fatalf("unexpected metric results: %d", len(series))
+		}
+		if !reflect.DeepEqual(requests, requestsExpected) {
+			t.Fatalf("unexpected requests; got %q; want %q", requests, requestsExpected)
+		}
+		if len(entries) != entriesExpected {
+			t.Fatalf("unexpected number of entries; got %d; want %d", len(entries), entriesExpected)
+		}
+		for i := range entries {
+			if ts := entries[i].timestamp; ts != int64(10-i) {
+				t.Fatalf("unexpected timestamp for entry #%d; got %d; want %d", i, ts, 10-i)
+			}
+		}
+	}
+	f(3, 100, []string{"3/"}, 3)
+	f(7, 3, []string{"3/", "3/7", "1/4"}, 7)
+	f(100, 4, []string{"4/", "4/6", "4/2"}, 10)
+}
+
+func TestClientError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, `{"status":"error","errorType":"422","error":"cannot parse query"}`)
+	}))
+	defer s.Close()
+
+	c := newTestClient(t, s, "0")
+	if _, err := c.Labels(context.Background(), time.Unix(0, 0), time.Unix(100, 0)); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestAddTenantLabel(t *testing.T) {
+	c, err := client.NewClient(&client.Config{
+		Addr:   "http://localhost:8481",
+		Tenant: "1:2",
+	})
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	labels := map[string]string{"job": "api"}
+	if m := addTenantLabel(labels, c, 1); !reflect.DeepEqual(m, labels) {
+		t.Fatalf("unexpected labels for a single tenant: %v", m)
+	}
+	m := addTenantLabel(labels, c, 2)
+	mExpected := map[string]string{"job": "api", tenantLabel: "1:2"}
+	if !reflect.DeepEqual(m, mExpected) {
+		t.Fatalf("unexpected labels; got %v; want %v", m, mExpected)
+	}
+	if len(labels) != 1 {
+		t.Fatalf("the original labels mustn't be modified; got %v", labels)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
+)
+
+// Supported values for -output flag.
+const (
+	outputDefault = "default"
+	outputRaw     = "raw"
+	outputJSONL   = "jsonl"
+)
+
+// timestampFormat is the format for timestamps in the default output.
+const timestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// labelColors contains ANSI colors for stream labels in the colored output.
+var labelColors = []int{31, 32, 33, 34, 35, 36, 91, 92, 93, 94, 95, 96}
+
+// printer writes query results in the given output mode.
+type printer struct {
+	bw      *bufio.Writer
+	mode    string
+	colored bool
+	loc     *time.Location
+}
+
+func newPrinter(w io.Writer, mode string, colored bool, loc *time.Location) (*printer, error) {
+	switch mode {
+	case outputDefault, outputRaw, outputJSONL:
+	default:
+		return nil, fmt.Errorf("unsupported output mode %q; supported modes: %s, %s, %s", mode, outputDefault, outputRaw, outputJSONL)
+	}
+	return &printer{
+		bw:      bufio.NewWriter(w),
+		mode:    mode,
+		colored: colored && mode == outputDefault,
+		loc:     loc,
+	}, nil
+}
+
+// printEntry prints log entry e.
+//
+// The default output contains the timestamp, the stream labels and the line, while the raw output contains only the line.
+func (p *printer) printEntry(e *entry) {
+	switch p.mode {
+	case outputRaw:
+		_, _ = p.bw.WriteString(e.line)
+	case outputJSONL:
+		data, _ := json.Marshal(&struct {
+			Timestamp string            `json:"timestamp"`
+			Labels    map[string]string `json:"labels"`
+			Line      string            `json:"line"`
+		}{
+			Timestamp: time.Unix(0, e.timestamp).In(p.loc).Format(time.RFC3339Nano),
+			Labels:    e.labels,
+			Line:      e.line,
+		})
+		_, _ = p.bw.Write(data)
+	default:
+		_, _ = p.bw.WriteString(time.Unix(0, e.timestamp).In(p.loc).Format(timestampFormat))
+		_ = p.bw.WriteByte(' ')
+		p.writeLabels(e.labels)
+		_ = p.bw.WriteByte(' ')
+		_, _ = p.bw.WriteString(e.line)
+	}
+	_ = p.bw.WriteByte('\n')
+}
+
+// printLabels prints a label set such as a series.
+func (p *printer) printLabels(labels map[string]string) {
+	if p.mode == outputJSONL {
+		data, _ := json.Marshal(labels)
+		_, _ = p.bw.Write(data)
+	} else {
+		p.writeLabels(labels)
+	}
+	_ = p.bw.WriteByte('\n')
+}
+
+// printSeries prints time series from metric query results as a JSON line.
+//
+// The line contains `value` field for instant query results and `values` field for range query results.
+func (p *printer) printSeries(s *client.Series, instant bool) {
+	data, _ := json.Marshal(s.Labels)
+	_, _ = p.bw.WriteString(`{"metric":`)
+	_, _ = p.bw.Write(data)
+	if instant {
+		_, _ = p.bw.WriteString(`,"value":`)
+		if len(s.Samples) > 0 {
+			p.writeSample(&s.Samples[0])
+		} else {
+			_, _ = p.bw.WriteString("null")
+		}
+	} else {
+		_, _ = p.bw.WriteString(`,"values":[`)
+		for i := range s.Samples {
+			if i > 0 {
+				_ = p.bw.WriteByte(',')
+			}
+			p.writeSample(&s.Samples[i])
+		}
+		_ = p.bw.WriteByte(']')
+	}
+	_, _ = p.bw.WriteString("}\n")
+}
+
+// writeSample writes sm as [unix_seconds,"value"] pair.
+func (p *printer) writeSample(sm *client.Sample) {
+	ms := sm.Timestamp.UnixNano() / 1e6
+	fmt.Fprintf(p.bw, "[%s,%q]", strconv.FormatFloat(float64(ms)/1e3, 'f', -1, 64), strconv.FormatFloat(sm.Value, 'g', -1, 64))
+}
+
+// printString prints s on a separate line, such as a label name or a label value.
+func (p *printer) printString(s string) {
+	if p.mode == outputJSONL {
+		_, _ = p.bw.WriteString(strconv.Quote(s))
+	} else {
+		_, _ = p.bw.WriteString(s)
+	}
+	_ = p.bw.WriteByte('\n')
+}
+
+func (p *printer) flush() error {
+	return p.bw.Flush()
+}
+
+func (p *printer) writeLabels(labels map[string]string) {
+	s := client.FormatLabels(labels)
+	if !p.colored {
+		_, _ = p.bw.WriteString(s)
+		return
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	color := labelColors[h.Sum32()%uint32(len(labelColors))]
+	fmt.Fprintf(p.bw, "\x1b[%dm%s\x1b[0m", color, s)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
+)
+
+func TestPrinterPrintEntry(t *testing.T) {
+	f := func(mode string, colored bool, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		p, err := newPrinter(&bb, mode, colored, time.UTC)
+		if err != nil {
+			t.Fatalf("cannot create printer: %s", err)
+		}
+		p.printEntry(&entry{
+			labels:    map[string]string{"job": "api"},
+			timestamp: 1600000000123456789,
+			line:      "foo bar",
+		})
+		if err := p.flush(); err != nil {
+			t.Fatalf("cannot flush printer: %s", err)
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected result for mode=%q, colored=%v\ngot\n%q\nwant\n%q", mode, colored, result, resultExpected)
+		}
+	}
+	f(outputDefault, false, "2020-09-13T12:26:40.123Z {job=\"api\"} foo bar\n")
+	f(outputDefault, true, "2020-09-13T12:26:40.123Z \x1b[92m{job=\"api\"}\x1b[0m foo bar\n")
+	f(outputRaw, true, "foo bar\n")
+	f(outputJSONL, true, `{"timestamp":"2020-09-13T12:26:40.123456789Z","labels":{"job":"api"},"line":"foo bar"}`+"\n")
+
+	if _, err := newPrinter(&bytes.Buffer{}, "foo", false, time.UTC); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported output mode")
+	}
+}
+
+func TestPrinterPrintSeries(t *testing.T) {
+	f := func(s *client.Series, instant bool, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		p, err := newPrinter(&bb, outputDefault, true, time.UTC)
+		if err != nil {
+			t.Fatalf("cannot create printer: %s", err)
+		}
+		p.printSeries(s, instant)
+		if err := p.flush(); err != nil {
+			t.Fatalf("cannot flush printer: %s", err)
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	s := &client.Series{
+		Labels: map[string]string{"job": "api"},
+		Samples: []client.Sample{
+			{Timestamp: time.Unix(1600000000, 0), Value: 1},
+			{Timestamp: time.Unix(1600000015, 500e6), Value: 2.5},
+		},
+	}
+	f(s, false, `{"metric":{"job":"api"},"values":[[1600000000,"1"],[1600000015.5,"2.5"]]}`+"\n")
+	f(s, true, `{"metric":{"job":"api"},"value":[1600000000,"1"]}`+"\n")
+	f(&client.Series{Labels: map[string]string{}}, false, `{"metric":{},"values":[]}`+"\n")
+}
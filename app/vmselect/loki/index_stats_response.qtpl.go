@@ -0,0 +1,72 @@
+// Code generated by qtc from "index_stats_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/loki/index_stats_response.qtpl:1
+package loki
+
+//line app/vmselect/loki/index_stats_response.qtpl:1
+import "github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+
+// IndexStatsResponse generates response for /loki/api/v1/index/stats .
+
+//line app/vmselect/loki/index_stats_response.qtpl:5
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/loki/index_stats_response.qtpl:5
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/loki/index_stats_response.qtpl:5
+func StreamIndexStatsResponse(qw422016 *qt422016.Writer, stats *storage.IndexStats) {
+//line app/vmselect/loki/index_stats_response.qtpl:5
+	qw422016.N().S(`{"streams":`)
+//line app/vmselect/loki/index_stats_response.qtpl:7
+	qw422016.N().DUL(stats.Streams)
+//line app/vmselect/loki/index_stats_response.qtpl:7
+	qw422016.N().S(`,"chunks":`)
+//line app/vmselect/loki/index_stats_response.qtpl:8
+	qw422016.N().DUL(stats.Chunks)
+//line app/vmselect/loki/index_stats_response.qtpl:8
+	qw422016.N().S(`,"entries":`)
+//line app/vmselect/loki/index_stats_response.qtpl:9
+	qw422016.N().DUL(stats.Entries)
+//line app/vmselect/loki/index_stats_response.qtpl:9
+	qw422016.N().S(`,"bytes":`)
+//line app/vmselect/loki/index_stats_response.qtpl:10
+	qw422016.N().DUL(stats.Bytes)
+//line app/vmselect/loki/index_stats_response.qtpl:10
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/index_stats_response.qtpl:12
+}
+
+//line app/vmselect/loki/index_stats_response.qtpl:12
+func WriteIndexStatsResponse(qq422016 qtio422016.Writer, stats *storage.IndexStats) {
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	StreamIndexStatsResponse(qw422016, stats)
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/loki/index_stats_response.qtpl:12
+}
+
+//line app/vmselect/loki/index_stats_response.qtpl:12
+func IndexStatsResponse(stats *storage.IndexStats) string {
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	WriteIndexStatsResponse(qb422016, stats)
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	qs422016 := string(qb422016.B)
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/loki/index_stats_response.qtpl:12
+	return qs422016
+//line app/vmselect/loki/index_stats_response.qtpl:12
+}
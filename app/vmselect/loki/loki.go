@@ -4,19 +4,25 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"net/http"
+	"net/url"
 	"runtime"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/querier"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/ruler"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/websocket"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
@@ -29,6 +35,7 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson/fastfloat"
 	"github.com/valyala/quicktemplate"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -42,9 +49,65 @@ var (
 		"By default it is automatically calculated from the median interval between samples. This flag could be useful for tuning "+
 		"Prometheus data model closer to Influx-style data model. See https://prometheus.io/docs/prometheus/latest/querying/basics/#staleness for details. "+
 		"See also '-search.maxLookback' flag, which has the same meaning due to historical reasons")
-	selectNodes = flagutil.NewArray("selectNode", "Addresses of vmselect nodes; usage: -selectNode=vmselect-host1:8481 -selectNode=vmselect-host2:8481")
+	cancelQueryAuthKey = flag.String("search.cancelQueryAuthKey", "", "authKey, which must be passed in query string to /loki/api/v1/status/active_queries/cancel "+
+		"in order to cancel queries for any tenant. Queries may be canceled only for the tenant from the request path if it isn't set")
+	selectNodes        = flagutil.NewArray("selectNode", "Addresses of vmselect nodes; usage: -selectNode=vmselect-host1:8481 -selectNode=vmselect-host2:8481")
+	resetCacheAuthKey  = flag.String("search.resetCacheAuthKey", "", "Optional authKey for resetting rollup result cache via /internal/resetRollupResultCache call")
+	maxTailDuration    = flag.Duration("search.maxTailDuration", time.Hour, "The maximum duration for /loki/api/v1/tail requests")
+	maxConcurrentTails = flag.Int("search.maxConcurrentTails", 100, "The maximum number of concurrent /loki/api/v1/tail and /loki/api/v1/tail/stream requests. "+
+		"Live tailing doesn't occupy -search.maxConcurrentRequests slots, since it may last up to -search.maxTailDuration")
+	maxTailPendingRows = flag.Int("search.maxTailPendingRows", 10000, "The maximum number of live log rows buffered per /loki/api/v1/tail request until they are sent to the client. "+
+		"Rows exceeding the limit are dropped and reported in `dropped_entries`")
+	maxContextLines  = flag.Int("search.maxContextLines", 1000, "The maximum number of log lines, which may be requested via `before` and `after` args at /loki/api/v1/context")
+	maxPatternsLines = flag.Int("search.maxPatternsLines", 1e6, "The maximum number of the newest log lines, which may be processed by a single /loki/api/v1/patterns query")
+	maxPatterns      = flag.Int("search.maxPatterns", 1000, "The maximum number of patterns tracked by a single /loki/api/v1/patterns query. "+
+		"The least recently seen patterns are evicted when the limit is reached")
 )
 
+// ResetRollupResultCacheHandler processes /internal/resetRollupResultCache request.
+//
+// It resets rollup result cache and stream result cache. It is called by other vmselect nodes after deleting log streams
+// and by vminsert nodes after ingesting late log lines.
+func ResetRollupResultCacheHandler(w http.ResponseWriter, r *http.Request) error {
+	if len(*resetCacheAuthKey) > 0 && r.FormValue("authKey") != *resetCacheAuthKey {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("invalid authKey=%q; it must match -search.resetCacheAuthKey", r.FormValue("authKey")),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	querier.ResetRollupResultCache()
+	querier.ResetStreamResultCache()
+	return nil
+}
+
+// CancelQueryHandler processes /loki/api/v1/status/active_queries/cancel request.
+//
+// It cancels the active query with the given `id` from /loki/api/v1/status/active_queries.
+func CancelQueryHandler(at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	idStr := r.FormValue("id")
+	if len(idStr) == 0 {
+		return fmt.Errorf("missing `id` arg")
+	}
+	qid, err := strconv.ParseUint(idStr, 16, 64)
+	if err != nil {
+		return fmt.Errorf("cannot parse `id` arg %q: %w", idStr, err)
+	}
+	authKey := r.FormValue("authKey")
+	isAdmin := len(*cancelQueryAuthKey) > 0 && authKey == *cancelQueryAuthKey
+	if len(authKey) > 0 && !isAdmin {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("invalid authKey %q. It must match the value from -search.cancelQueryAuthKey command line flag", authKey),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+	if err := querier.CancelActiveQuery(at, qid, isAdmin); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"success"}`)
+	return nil
+}
+
 // Default step used if not set.
 const defaultStep = 5 * 60 * 1000
 
@@ -88,7 +151,7 @@ func FederateHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter,
 		MaxTimestamp: end,
 		TagFilterss:  tagFilterss,
 	}
-	rss, isPartial, err := netstorage.ProcessSearchQuery(at, sq, 2, deadline)
+	rss, isPartial, err := netstorage.ProcessSearchQuery(nil, at, sq, 2, nil, nil, netstorage.NewQueryLimiter(at), deadline)
 	if err != nil {
 		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
@@ -324,7 +387,7 @@ func exportHandler(at *auth.Token, w http.ResponseWriter, r *http.Request, match
 	resultsCh := make(chan *quicktemplate.ByteBuffer, runtime.GOMAXPROCS(-1))
 	doneCh := make(chan error)
 	if !reduceMemUsage {
-		rss, isPartial, err := netstorage.ProcessSearchQuery(at, sq, 2, deadline)
+		rss, isPartial, err := netstorage.ProcessSearchQuery(nil, at, sq, 2, nil, nil, netstorage.NewQueryLimiter(at), deadline)
 		if err != nil {
 			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 		}
@@ -454,10 +517,17 @@ var deleteDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/
 
 func resetRollupResultCaches() {
 	if len(*selectNodes) == 0 {
-		logger.Panicf("BUG: missing -selectNode flag")
+		// There are no other vmselect nodes, so reset only the local caches.
+		querier.ResetRollupResultCache()
+		querier.ResetStreamResultCache()
+		resetRollupResultCacheCalls.Inc()
+		return
 	}
 	for _, selectNode := range *selectNodes {
 		callURL := fmt.Sprintf("http://%s/internal/resetRollupResultCache", selectNode)
+		if len(*resetCacheAuthKey) > 0 {
+			callURL += "?authKey=" + url.QueryEscape(*resetCacheAuthKey)
+		}
 		resp, err := httpClient.Get(callURL)
 		if err != nil {
 			logger.Errorf("error when accessing %q: %s", callURL, err)
@@ -569,7 +639,7 @@ func labelValuesWithMatches(at *auth.Token, labelName string, matches []string,
 		MaxTimestamp: end,
 		TagFilterss:  tagFilterss,
 	}
-	rss, isPartial, err := netstorage.ProcessSearchQuery(at, sq, 0, deadline)
+	rss, isPartial, err := netstorage.ProcessSearchQuery(nil, at, sq, 0, nil, nil, netstorage.NewQueryLimiter(at), deadline)
 	if err != nil {
 		return nil, false, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
@@ -747,7 +817,7 @@ func labelsWithMatches(at *auth.Token, matches []string, start, end int64, deadl
 		MaxTimestamp: end,
 		TagFilterss:  tagFilterss,
 	}
-	rss, isPartial, err := netstorage.ProcessSearchQuery(at, sq, 0, deadline)
+	rss, isPartial, err := netstorage.ProcessSearchQuery(nil, at, sq, 0, nil, nil, netstorage.NewQueryLimiter(at), deadline)
 	if err != nil {
 		return nil, false, fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
@@ -844,7 +914,7 @@ func SeriesHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r
 		MaxTimestamp: end,
 		TagFilterss:  tagFilterss,
 	}
-	rss, isPartial, err := netstorage.ProcessSearchQuery(at, sq, 0, deadline)
+	rss, isPartial, err := netstorage.ProcessSearchQuery(nil, at, sq, 0, nil, nil, netstorage.NewQueryLimiter(at), deadline)
 	if err != nil {
 		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
 	}
@@ -886,6 +956,297 @@ func SeriesHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r
 
 var seriesDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/series"}`)
 
+// IndexStatsHandler processes /loki/api/v1/index/stats request.
+//
+// It returns the number of streams, chunks, entries and bytes for the selector from `query` arg on the time range [start..end].
+// The stats are calculated by vmstorage nodes from block headers without reading log lines.
+func IndexStatsHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	start, err := searchutils.GetTime(r, "start", end-defaultStep)
+	if err != nil {
+		return err
+	}
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+
+	tagFilters, err := querier.ParseMetricSelector(query)
+	if err != nil {
+		return fmt.Errorf("cannot parse query %q: %w", query, err)
+	}
+	if start >= end {
+		end = start + defaultStep
+	}
+	sq := &storage.SearchQuery{
+		AccountID:    at.AccountID,
+		ProjectID:    at.ProjectID,
+		MinTimestamp: start,
+		MaxTimestamp: end,
+		TagFilterss:  [][]storage.TagFilter{tagFilters},
+	}
+	qid, err := beginIndexQuery(at, r, query, start, end, deadline)
+	if err != nil {
+		return err
+	}
+	defer querier.EndQuery(qid)
+	stats, isPartial, err := netstorage.GetIndexStats(at, sq, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain index stats for %q: %w", sq, err)
+	}
+	if isPartial && searchutils.GetDenyPartialResponse(r) {
+		return fmt.Errorf("cannot return full response, since some of vmstorage nodes are unavailable")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteIndexStatsResponse(bw, stats)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	indexStatsDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var indexStatsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/loki/api/v1/index/stats"}`)
+
+// beginIndexQuery verifies per-tenant limits for the index query on the time range [start..end] and registers it in active queries.
+//
+// querier.EndQuery must be called with the returned qid when the query is finished.
+func beginIndexQuery(at *auth.Token, r *http.Request, query string, start, end int64, deadline searchutils.Deadline) (uint64, error) {
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            start,
+		End:              end,
+		Step:             defaultStep,
+		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
+		Deadline:         deadline,
+	}
+	return querier.BeginQuery(&ec, query)
+}
+
+// Default number of groups returned by /loki/api/v1/index/volume and /loki/api/v1/index/volume_range.
+const defaultVolumeLimit = 100
+
+// IndexVolumeHandler processes /loki/api/v1/index/volume request.
+//
+// It returns the total volume of log lines for the selector from `query` arg grouped by `targetLabels`.
+func IndexVolumeHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	if err := indexVolumeHandler(startTime, at, w, r, false); err != nil {
+		return err
+	}
+	indexVolumeDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var indexVolumeDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/loki/api/v1/index/volume"}`)
+
+// IndexVolumeRangeHandler processes /loki/api/v1/index/volume_range request.
+//
+// It returns the volume of log lines for the selector from `query` arg grouped by `targetLabels` per every `step`.
+func IndexVolumeRangeHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	if err := indexVolumeHandler(startTime, at, w, r, true); err != nil {
+		return err
+	}
+	indexVolumeRangeDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var indexVolumeRangeDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/loki/api/v1/index/volume_range"}`)
+
+func indexVolumeHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request, isRange bool) error {
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	start, err := searchutils.GetTime(r, "start", end-defaultStep)
+	if err != nil {
+		return err
+	}
+	if start >= end {
+		end = start + defaultStep
+	}
+	step := int64(0)
+	if isRange {
+		step, err = searchutils.GetDuration(r, "step", defaultStep)
+		if err != nil {
+			return err
+		}
+		if err := querier.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
+			return err
+		}
+	}
+	limit, err := searchutils.GetInt64(r, "limit", defaultVolumeLimit)
+	if err != nil {
+		return err
+	}
+	volumeType := searchutils.GetString(r, "type", "bytes")
+	if volumeType != "bytes" && volumeType != "entries" {
+		return fmt.Errorf("unsupported `type` arg: %q; supported values: bytes, entries", volumeType)
+	}
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+
+	tagFilters, err := querier.ParseMetricSelector(query)
+	if err != nil {
+		return fmt.Errorf("cannot parse query %q: %w", query, err)
+	}
+	targetLabels := getVolumeTargetLabels(r.FormValue("targetLabels"), tagFilters)
+	sq := &storage.SearchQuery{
+		AccountID:    at.AccountID,
+		ProjectID:    at.ProjectID,
+		MinTimestamp: start,
+		MaxTimestamp: end,
+		TagFilterss:  [][]storage.TagFilter{tagFilters},
+	}
+	qid, err := beginIndexQuery(at, r, query, start, end, deadline)
+	if err != nil {
+		return err
+	}
+	defer querier.EndQuery(qid)
+	ivs, isPartial, err := netstorage.GetIndexVolume(at, sq, targetLabels, step, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain index volume for %q: %w", sq, err)
+	}
+	if isPartial && searchutils.GetDenyPartialResponse(r) {
+		return fmt.Errorf("cannot return full response, since some of vmstorage nodes are unavailable")
+	}
+	timestamp := int64(0)
+	if !isRange {
+		timestamp = end
+	}
+	rs := getIndexVolumeResults(ivs, volumeType, timestamp, int(limit))
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	if isRange {
+		WriteVectorQueryRangeResponse(bw, rs, nil, nil)
+	} else {
+		WriteVectorQueryResponse(bw, rs, nil, nil)
+	}
+	return bw.Flush()
+}
+
+// getVolumeTargetLabels returns labels from comma-separated s.
+//
+// If s is empty, then labels from tagFilters are returned like Loki does.
+func getVolumeTargetLabels(s string, tagFilters []storage.TagFilter) []string {
+	var labels []string
+	if len(s) > 0 {
+		for _, label := range strings.Split(s, ",") {
+			label = strings.TrimSpace(label)
+			if len(label) > 0 {
+				labels = append(labels, label)
+			}
+		}
+		return labels
+	}
+	m := make(map[string]bool, len(tagFilters))
+	for i := range tagFilters {
+		label := string(tagFilters[i].Key)
+		if len(label) == 0 {
+			label = "__name__"
+		}
+		if !m[label] {
+			m[label] = true
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// getIndexVolumeResults converts ivs to results containing bytes or entries depending on volumeType.
+//
+// If timestamp is non-zero, then it is used as a timestamp for every result, since ivs contain total volume.
+// Otherwise ivs contain volume per time bucket, which is put into results sorted by timestamps.
+// Results are sorted by the total volume in descending order and limited by limit.
+func getIndexVolumeResults(ivs []storage.IndexVolume, volumeType string, timestamp int64, limit int) []netstorage.Result {
+	var rs []netstorage.Result
+	var totals []float64
+	m := make(map[string]int)
+	var key []byte
+	for i := range ivs {
+		iv := &ivs[i]
+		key = iv.MetricName.Marshal(key[:0])
+		idx, ok := m[string(key)]
+		if !ok {
+			idx = len(rs)
+			m[string(key)] = idx
+			rs = append(rs, netstorage.Result{})
+			rs[idx].MetricName.CopyFrom(&iv.MetricName)
+			totals = append(totals, 0)
+		}
+		v := float64(iv.Bytes)
+		if volumeType == "entries" {
+			v = float64(iv.Entries)
+		}
+		r := &rs[idx]
+		if timestamp > 0 {
+			if len(r.Values) == 0 {
+				r.Values = append(r.Values, 0)
+				r.Timestamps = append(r.Timestamps, timestamp)
+			}
+			r.Values[0] += v
+		} else {
+			r.Values = append(r.Values, v)
+			r.Timestamps = append(r.Timestamps, iv.Timestamp)
+		}
+		totals[idx] += v
+	}
+	for i := range rs {
+		r := &rs[i]
+		sort.Sort(&valuesSorter{r: r})
+	}
+	idxs := make([]int, len(rs))
+	for i := range idxs {
+		idxs[i] = i
+	}
+	sort.Slice(idxs, func(i, j int) bool {
+		a, b := idxs[i], idxs[j]
+		if totals[a] != totals[b] {
+			return totals[a] > totals[b]
+		}
+		return rs[a].MetricName.String() < rs[b].MetricName.String()
+	})
+	if limit > 0 && len(idxs) > limit {
+		idxs = idxs[:limit]
+	}
+	result := make([]netstorage.Result, len(idxs))
+	for i, idx := range idxs {
+		result[i] = rs[idx]
+	}
+	return result
+}
+
+type valuesSorter struct {
+	r *netstorage.Result
+}
+
+func (vs *valuesSorter) Len() int {
+	return len(vs.r.Timestamps)
+}
+
+func (vs *valuesSorter) Less(i, j int) bool {
+	return vs.r.Timestamps[i] < vs.r.Timestamps[j]
+}
+
+func (vs *valuesSorter) Swap(i, j int) {
+	r := vs.r
+	r.Timestamps[i], r.Timestamps[j] = r.Timestamps[j], r.Timestamps[i]
+	r.Values[i], r.Values[j] = r.Values[j], r.Values[i]
+}
+
 // QueryHandler processes /api/v1/query request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#instant-queries
@@ -960,7 +1321,7 @@ func QueryHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r
 		start = end - window
 
 		w.Header().Set("Content-Type", "application/json")
-		if _, err := queryRangeHandler(startTime, at, w, childQuery, start, end, step, limit, forward, r, ct, false, nil); err != nil {
+		if _, err := queryRangeHandler(startTime, at, w, childQuery, start, end, step, limit, forward, nil, r, ct); err != nil {
 			return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, step=%d): %w", childQuery, start, end, step, err)
 		}
 
@@ -978,6 +1339,7 @@ func QueryHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r
 	} else {
 		queryOffset = 0
 	}
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/loki/api/v1/query: query=%q, time=%d, step=%d", query, start, step)
 	ec := querier.EvalConfig{
 		AuthToken:        at,
 		Start:            start,
@@ -986,6 +1348,7 @@ func QueryHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r
 		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
 		Deadline:         deadline,
 		LookbackDelta:    lookbackDelta,
+		Tracer:           qt,
 
 		DenyPartialResponse: searchutils.GetDenyPartialResponse(r),
 	}
@@ -1007,10 +1370,10 @@ func QueryHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r
 	defer bufferedwriter.Put(bw)
 
 	switch e.(type) {
-	case *logql.BinaryOpExpr, *logql.MetricExpr:
-		WriteStreamsQueryResponse(bw, result)
+	case *logql.BinaryOpExpr, *logql.MetricExpr, *logql.PipelineExpr:
+		WriteStreamsQueryResponse(bw, result, ec.QueryStats, qt)
 	default:
-		WriteVectorQueryResponse(bw, result)
+		WriteVectorQueryResponse(bw, result, ec.QueryStats, qt)
 	}
 
 	if err := bw.Flush(); err != nil {
@@ -1065,138 +1428,874 @@ func QueryRangeHandler(startTime time.Time, at *auth.Token, w http.ResponseWrite
 		return err
 	}
 	forward := searchutils.GetString(r, "direction", "backward") == "forward"
+	cursor, err := getQueryRangeCursor(r, query, forward)
+	if err != nil {
+		return err
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if _, err := queryRangeHandler(startTime, at, w, query, start, end, step, limit, forward, r, ct, false, nil); err != nil {
+	if _, err := queryRangeHandler(startTime, at, w, query, start, end, step, limit, forward, cursor, r, ct); err != nil {
 		return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, step=%d): %w", query, start, end, step, err)
 	}
 	queryRangeDuration.UpdateDuration(startTime)
 	return nil
 }
 
-func TailHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+// Default number of log lines returned before and after the requested log line by /loki/api/v1/context.
+const defaultContextLines = 10
+
+// Default time range for searching log lines around the requested log line at /loki/api/v1/context.
+const defaultContextWindow = 7 * 24 * 3600 * 1000
+
+// ContextHandler processes /loki/api/v1/context request.
+//
+// It returns `before` log lines before and `after` log lines after the log line with the given `time` in the given `stream`.
+// `offset` is the index of the log line among log lines with the same timestamp in the stream.
+// Only the blocks for the given stream are read from vmstorage nodes.
+func ContextHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
 	ct := startTime.UnixNano() / 1e6
-	query := r.FormValue("query")
-	if len(query) == 0 {
-		return fmt.Errorf("missing `query` arg")
+	stream := r.FormValue("stream")
+	if len(stream) == 0 {
+		return fmt.Errorf("missing `stream` arg")
 	}
-	start, err := searchutils.GetTime(r, "start", ct-defaultStep)
+	if len(stream) > maxQueryLen.N {
+		return fmt.Errorf("too long stream; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(stream), maxQueryLen.N)
+	}
+	if len(r.FormValue("time")) == 0 {
+		return fmt.Errorf("missing `time` arg")
+	}
+	timestamp, err := searchutils.GetTime(r, "time", ct)
 	if err != nil {
 		return err
 	}
-	limit, err := searchutils.GetInt64(r, "limit", defaultLimit)
+	offset, err := searchutils.GetInt64(r, "offset", 0)
 	if err != nil {
 		return err
 	}
-
-	conn, err := websocket.TryUpgrade(w, r)
+	before, err := searchutils.GetInt64(r, "before", defaultContextLines)
 	if err != nil {
 		return err
 	}
-
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
-	var lastTs, end int64
-	filter := make(map[uint64]int64)
-
-	for ; true; <-ticker.C {
-		startTime = time.Now()
-		end = startTime.UnixNano() / 1e6
-		result, err := queryRangeHandler(startTime, at, conn, query, start, end, 60, limit, false, r, end, true, filter)
-		if err != nil {
-			return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, limit=%d): %w", query, start, end, limit, err)
-		}
-		for _, rs := range result {
-			lastTs = rs.Timestamps[len(rs.Timestamps)-1]
-			if lastTs > start {
-				start = lastTs
-			}
-			filter[rs.MetricNameHash] = lastTs
-			limit -= int64(len(rs.Timestamps))
-		}
-		for hashKey, lastTs := range filter {
-			if end-lastTs > defaultStep {
-				delete(filter, hashKey)
-			}
-		}
-		if limit <= 0 {
-			break
-		}
+	after, err := searchutils.GetInt64(r, "after", defaultContextLines)
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-func queryRangeHandler(startTime time.Time, at *auth.Token, w io.Writer, query string, start, end, step, limit int64,
-	forward bool, r *http.Request, ct int64, tail bool, filter map[uint64]int64) ([]netstorage.Result, error) {
-	deadline := searchutils.GetDeadlineForQuery(r, startTime)
-	mayCache := !searchutils.GetBool(r, "nocache")
-	lookbackDelta, err := getMaxLookback(r)
+	if before > int64(*maxContextLines) || after > int64(*maxContextLines) {
+		return fmt.Errorf("too many log lines requested; before=%d, after=%d; mustn't exceed -search.maxContextLines=%d", before, after, *maxContextLines)
+	}
+	start, err := searchutils.GetTime(r, "start", timestamp-defaultContextWindow)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	// Validate input args.
-	if len(query) > maxQueryLen.N {
-		return nil, fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	end, err := searchutils.GetTime(r, "end", timestamp+defaultContextWindow)
+	if err != nil {
+		return err
 	}
-	if start > end {
-		end = start + defaultStep
+	if end > ct {
+		end = ct
 	}
-	if err := querier.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
-		return nil, err
+	if start > timestamp {
+		start = timestamp
 	}
-	if mayCache {
-		start, end = querier.AdjustStartEnd(start, end, step)
+	if end < timestamp {
+		end = timestamp
+	}
+	var mn storage.MetricName
+	if err := querier.ParseStreamLabels(&mn, stream); err != nil {
+		return err
 	}
 
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/loki/api/v1/context: stream=%q, time=%d, offset=%d, before=%d, after=%d, start=%d, end=%d",
+		stream, timestamp, offset, before, after, start, end)
 	ec := querier.EvalConfig{
 		AuthToken:        at,
 		Start:            start,
 		End:              end,
-		Step:             step,
-		Limit:            limit,
-		Forward:          forward,
+		Step:             defaultStep,
 		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
-		Deadline:         deadline,
-		MayCache:         mayCache,
-		LookbackDelta:    lookbackDelta,
+		Deadline:         searchutils.GetDeadlineForQuery(r, startTime),
+		QueryStats:       &netstorage.QueryStats{},
+		Tracer:           qt,
 
 		DenyPartialResponse: searchutils.GetDenyPartialResponse(r),
 	}
-	result, e, err := querier.Exec(&ec, query, false)
+	qid, err := querier.BeginQuery(&ec, stream)
 	if err != nil {
-		return nil, fmt.Errorf("cannot execute query: %w", err)
+		return err
+	}
+	lc, err := querier.GetLogContext(&ec, &mn, timestamp, int(offset), int(before), int(after))
+	querier.EndQuery(qid)
+	if err != nil {
+		return fmt.Errorf("cannot obtain log context for stream=%q, time=%d, offset=%d: %w", stream, timestamp, offset, err)
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
+	WriteContextResponse(bw, lc, ec.QueryStats, qt)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	contextDuration.UpdateDuration(startTime)
+	return nil
+}
 
-	switch e.(type) {
-	case *logql.BinaryOpExpr, *logql.MetricExpr:
-		// Remove NaN values as Prometheus does.
-		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
-		result = removeFilteredValuesAndTimeseries(result, filter)
-
-		if tail {
-			if len(result) > 0 {
-				WriteTailQueryRangeResponse(bw, result)
-			}
-		} else {
-			WriteStreamsQueryRangeResponse(bw, result)
-		}
-	default:
-		queryOffset := getLatencyOffsetMilliseconds()
-		if ct-queryOffset < end {
-			result = adjustLastPoints(result, ct-queryOffset, ct+step)
-		}
+var contextDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/loki/api/v1/context"}`)
 
+// PatternsHandler processes /loki/api/v1/patterns request.
+//
+// It returns patterns extracted from log lines for the log query from `query` arg together with line counts per `step`.
+func PatternsHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.N {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	start, err := searchutils.GetTime(r, "start", ct-defaultStep)
+	if err != nil {
+		return err
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		end = start + defaultStep
+	}
+	step, err := searchutils.GetDuration(r, "step", defaultStep)
+	if err != nil {
+		return err
+	}
+	if step <= 0 {
+		step = defaultStep
+	}
+	if err := querier.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
+		return err
+	}
+	lineLimit, err := searchutils.GetInt64(r, "line_limit", int64(*maxPatternsLines))
+	if err != nil {
+		return err
+	}
+	if lineLimit <= 0 || lineLimit > int64(*maxPatternsLines) {
+		lineLimit = int64(*maxPatternsLines)
+	}
+
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/loki/api/v1/patterns: query=%q, start=%d, end=%d, step=%d, line_limit=%d",
+		query, start, end, step, lineLimit)
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            start,
+		End:              end,
+		Step:             step,
+		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
+		Deadline:         searchutils.GetDeadlineForQuery(r, startTime),
+		Tracer:           qt,
+
+		DenyPartialResponse: searchutils.GetDenyPartialResponse(r),
+	}
+	ps, err := querier.GetPatterns(&ec, query, int(lineLimit), *maxPatterns)
+	if err != nil {
+		return fmt.Errorf("cannot extract patterns for query=%q on the time range (start=%d, end=%d): %w", query, start, end, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WritePatternsResponse(bw, ps)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	patternsDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var patternsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/loki/api/v1/patterns"}`)
+
+// Default limits for /loki/api/v1/detected_fields.
+const (
+	defaultDetectedFieldsLineLimit = 1000
+	defaultDetectedFieldsLimit     = 1000
+)
+
+// DetectedFieldsHandler processes /loki/api/v1/detected_fields request.
+//
+// It returns fields detected in up to `line_limit` newest log lines for the log query from `query` arg.
+func DetectedFieldsHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.N {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	start, err := searchutils.GetTime(r, "start", ct-defaultStep)
+	if err != nil {
+		return err
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		end = start + defaultStep
+	}
+	lineLimit, err := searchutils.GetInt64(r, "line_limit", defaultDetectedFieldsLineLimit)
+	if err != nil {
+		return err
+	}
+	limit, err := searchutils.GetInt64(r, "limit", defaultDetectedFieldsLimit)
+	if err != nil {
+		return err
+	}
+
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/loki/api/v1/detected_fields: query=%q, start=%d, end=%d, line_limit=%d, limit=%d",
+		query, start, end, lineLimit, limit)
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            start,
+		End:              end,
+		Step:             defaultStep,
+		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
+		Deadline:         searchutils.GetDeadlineForQuery(r, startTime),
+		Tracer:           qt,
+
+		DenyPartialResponse: searchutils.GetDenyPartialResponse(r),
+	}
+	dfs, err := querier.GetDetectedFields(&ec, query, int(lineLimit), int(limit))
+	if err != nil {
+		return fmt.Errorf("cannot detect fields for query=%q on the time range (start=%d, end=%d): %w", query, start, end, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteDetectedFieldsResponse(bw, dfs, int(limit))
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	detectedFieldsDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var detectedFieldsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/loki/api/v1/detected_fields"}`)
+
+// ExplainHandler processes /loki/api/v1/explain request.
+//
+// It accepts the same args as /loki/api/v1/query_range, executes the query with enabled tracing
+// and returns the parsed query tree, log stream selectors with filters pushed down to vmstorage,
+// query stats and query trace instead of the query results.
+func ExplainHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.N {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	start, err := searchutils.GetTime(r, "start", ct-defaultStep)
+	if err != nil {
+		return err
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	step, err := searchutils.GetDuration(r, "step", defaultStep)
+	if err != nil {
+		return err
+	}
+	limit, err := searchutils.GetInt64(r, "limit", defaultLimit)
+	if err != nil {
+		return err
+	}
+	forward := searchutils.GetString(r, "direction", "backward") == "forward"
+	lookbackDelta, err := getMaxLookback(r)
+	if err != nil {
+		return err
+	}
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	mayCache := !searchutils.GetBool(r, "nocache")
+	if start > end {
+		end = start + defaultStep
+	}
+	if err := querier.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
+		return err
+	}
+	if mayCache {
+		start, end = querier.AdjustStartEnd(start, end, step)
+	}
+
+	qt := querytracer.New(true, "/loki/api/v1/explain: query=%q, start=%d, end=%d, step=%d, limit=%d, forward=%v",
+		query, start, end, step, limit, forward)
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            start,
+		End:              end,
+		Step:             step,
+		Limit:            limit,
+		Forward:          forward,
+		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
+		Deadline:         deadline,
+		MayCache:         mayCache,
+		LookbackDelta:    lookbackDelta,
+		Tracer:           qt,
+
+		DenyPartialResponse: searchutils.GetDenyPartialResponse(r),
+	}
+	result, e, err := querier.Exec(&ec, query, false)
+	if err != nil {
+		return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, step=%d): %w", query, start, end, step, err)
+	}
+	sels := querier.GetExprSelectors(&ec, e)
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteExplainResponse(bw, query, e, sels, result, ec.QueryStats, qt)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	explainDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var explainDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/explain"}`)
+
+// maxTailDelayFor is the maximum value for `delay_for` arg in seconds at /loki/api/v1/tail.
+const maxTailDelayFor = 5
+
+// tailFlushInterval is the interval for sending live log rows to tail clients.
+const tailFlushInterval = 200 * time.Millisecond
+
+// tailKeepAliveInterval is the interval for sending empty messages to idle /loki/api/v1/tail/stream clients,
+// so proxies don't close the connection.
+const tailKeepAliveInterval = 10 * time.Second
+
+// TailHandler processes /loki/api/v1/tail request.
+//
+// It sends up to `limit` log rows since `start` to the websocket client and then pushes log rows
+// as soon as vmstorage nodes receive them. Rows are delayed by `delay_for` seconds, so rows arriving late
+// are sent in the order of their timestamps. Rows are dropped and reported in `dropped_entries`
+// if the client doesn't keep up with the ingestion rate.
+//
+// releaseQuerySlot is called after the stored log rows are selected, so live tailing doesn't occupy the query slot.
+// The number of concurrent tails is limited by -search.maxConcurrentTails instead.
+func TailHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request, releaseQuerySlot func()) error {
+	tr, err := newTailRequest(startTime, at, r, releaseQuerySlot)
+	if err != nil {
+		return err
+	}
+	if err := acquireTailSlot(); err != nil {
+		return err
+	}
+	defer releaseTailSlot()
+
+	conn, err := websocket.TryUpgrade(w, r)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// The client doesn't send anything, so reading fails when the client closes the connection.
+	clientGoneCh := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, conn)
+		close(clientGoneCh)
+	}()
+
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+	return tr.run(startTime, at, r, clientGoneCh, func(rs []netstorage.Result, dropped []querier.DroppedEntry) error {
+		if len(rs) == 0 && len(dropped) == 0 {
+			// Websocket connections don't need keep-alive messages.
+			return nil
+		}
+		// Every conn.Write call sends a separate websocket message, so the response is buffered.
+		bb.Reset()
+		WriteTailResponse(bb, rs, dropped)
+		_, err := conn.Write(bb.B)
+		return err
+	})
+}
+
+// TailStreamHandler processes /loki/api/v1/tail/stream request.
+//
+// It accepts the same args as /loki/api/v1/tail, but sends log rows in a streaming http response,
+// so it works via proxies without websocket support. Every message is sent as a separate line
+// in NDJSON format or as a server-sent event if `format=sse` arg is set or the client accepts `text/event-stream`.
+//
+// Log rows with timestamps up to `last_seen` arg in nanoseconds aren't sent, so the client may resume the tail after reconnecting.
+// Server-sent events contain `id` field, which uniquely identifies the last sent log row, so log rows up to the row
+// from `Last-Event-ID` header aren't sent, while the remaining log rows with the same timestamp are sent.
+//
+// releaseQuerySlot is called after the stored log rows are selected like in TailHandler.
+func TailStreamHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request, releaseQuerySlot func()) error {
+	tr, err := newTailRequest(startTime, at, r, releaseQuerySlot)
+	if err != nil {
+		return err
+	}
+	if err := acquireTailSlot(); err != nil {
+		return err
+	}
+	defer releaseTailSlot()
+	isSSE, err := isTailSSE(r)
+	if err != nil {
+		return err
+	}
+	lastSeen, err := getTailLastSeen(r)
+	if err != nil {
+		return err
+	}
+	if lastSeen > 0 {
+		tr.lastSeen = lastSeen
+		if start := lastSeen / 1e6; start > tr.start {
+			tr.start = start
+		}
+	}
+	lastEventID, err := getTailLastEventID(r)
+	if err != nil {
+		return err
+	}
+	if lastEventID != nil {
+		tr.lastEventID = lastEventID
+		if lastEventID.Timestamp > tr.start {
+			tr.start = lastEventID.Timestamp
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("BUG: %T doesn't support flushing", w)
+	}
+
+	if isSSE {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+	return tr.run(startTime, at, r, r.Context().Done(), func(rs []netstorage.Result, dropped []querier.DroppedEntry) error {
+		bb.Reset()
+		if isSSE {
+			if len(rs) == 0 && len(dropped) == 0 {
+				bb.B = append(bb.B, ": keep-alive\n\n"...)
+			} else {
+				if lc := querier.GetLastLogCursor(rs, lastEventID); lc != nil {
+					// The id uniquely identifies the last sent log row, so EventSource resumes the tail right after it.
+					lastEventID = lc
+					bb.B = append(bb.B, "id: "...)
+					bb.B = append(bb.B, lc.String()...)
+					bb.B = append(bb.B, '\n')
+				}
+				bb.B = append(bb.B, "data: "...)
+				WriteTailResponse(bb, rs, dropped)
+				bb.B = append(bb.B, "\n\n"...)
+			}
+		} else {
+			WriteTailResponse(bb, rs, dropped)
+			bb.B = append(bb.B, '\n')
+		}
+		if _, err := w.Write(bb.B); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+func isTailSSE(r *http.Request) (bool, error) {
+	switch format := r.FormValue("format"); format {
+	case "":
+		return strings.Contains(r.Header.Get("Accept"), "text/event-stream"), nil
+	case "sse":
+		return true, nil
+	case "ndjson":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported `format` arg: %q; supported values: `ndjson`, `sse`", format)
+	}
+}
+
+// getTailLastSeen returns the timestamp in nanoseconds for the last log row received by the client from `last_seen` arg.
+//
+// 0 is returned if the timestamp isn't set.
+func getTailLastSeen(r *http.Request) (int64, error) {
+	s := r.FormValue("last_seen")
+	if len(s) == 0 {
+		return 0, nil
+	}
+	lastSeen, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || lastSeen < 0 {
+		return 0, fmt.Errorf("cannot parse last seen timestamp %q; it must be a non-negative unix timestamp in nanoseconds", s)
+	}
+	return lastSeen, nil
+}
+
+// getTailLastEventID returns the cursor for the last log row received by the client from `Last-Event-ID` header.
+//
+// nil is returned if the header is missing.
+func getTailLastEventID(r *http.Request) (*querier.LogCursor, error) {
+	s := r.Header.Get("Last-Event-ID")
+	if len(s) == 0 {
+		return nil, nil
+	}
+	lc, err := querier.ParseLogCursor(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse Last-Event-ID: %w", err)
+	}
+	if !lc.Forward {
+		return nil, fmt.Errorf("unexpected Last-Event-ID %q; it must be obtained from /loki/api/v1/tail/stream response", s)
+	}
+	return lc, nil
+}
+
+// tailRequest holds args for /loki/api/v1/tail and /loki/api/v1/tail/stream requests.
+type tailRequest struct {
+	query string
+	start int64
+	limit int64
+
+	// lastSeen is the timestamp in nanoseconds for the last log row received by the client.
+	// Stored log rows with timestamps up to lastSeen aren't sent to the client.
+	lastSeen int64
+
+	// lastEventID is the cursor for the last log row received by the client via server-sent events.
+	// Stored log rows up to lastEventID aren't sent to the client.
+	lastEventID *querier.LogCursor
+
+	// releaseQuerySlot is called after the stored log rows are selected, so live tailing doesn't occupy the query slot.
+	releaseQuerySlot func()
+
+	t *querier.Tailer
+}
+
+var concurrentTails int64
+
+var _ = metrics.NewGauge(`vm_concurrent_tails`, func() float64 {
+	return float64(atomic.LoadInt64(&concurrentTails))
+})
+
+// acquireTailSlot reserves a slot for live tailing. releaseTailSlot must be called when the tailing is finished.
+func acquireTailSlot() error {
+	if n := atomic.AddInt64(&concurrentTails, 1); n > int64(*maxConcurrentTails) {
+		atomic.AddInt64(&concurrentTails, -1)
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot handle more than -search.maxConcurrentTails=%d concurrent tail requests", *maxConcurrentTails),
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+	return nil
+}
+
+func releaseTailSlot() {
+	atomic.AddInt64(&concurrentTails, -1)
+}
+
+func newTailRequest(startTime time.Time, at *auth.Token, r *http.Request, releaseQuerySlot func()) (*tailRequest, error) {
+	ct := startTime.UnixNano() / 1e6
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return nil, fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.N {
+		return nil, fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	start, err := searchutils.GetTime(r, "start", ct-defaultStep)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := searchutils.GetInt64(r, "limit", defaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	delayFor, err := searchutils.GetInt64(r, "delay_for", 0)
+	if err != nil {
+		return nil, err
+	}
+	if delayFor < 0 || delayFor > maxTailDelayFor {
+		return nil, fmt.Errorf("`delay_for` must be in the range [0..%d] seconds; got %d", maxTailDelayFor, delayFor)
+	}
+	t, err := querier.NewTailer(at, query, time.Duration(delayFor)*time.Second, *maxTailPendingRows)
+	if err != nil {
+		return nil, fmt.Errorf("cannot tail query=%q: %w", query, err)
+	}
+	return &tailRequest{
+		query:            query,
+		start:            start,
+		limit:            limit,
+		releaseQuerySlot: releaseQuerySlot,
+		t:                t,
+	}, nil
+}
+
+// run sends up to tr.limit stored log rows and then live log rows to the client via send until clientGoneCh is closed
+// or -search.maxTailDuration is reached.
+//
+// send is called with empty rs and dropped if there were no log rows during tailKeepAliveInterval.
+// An error returned from send means the client is gone.
+func (tr *tailRequest) run(startTime time.Time, at *auth.Token, r *http.Request, clientGoneCh <-chan struct{},
+	send func(rs []netstorage.Result, dropped []querier.DroppedEntry) error) error {
+	// Subscribe to live log rows before querying the stored log rows, so rows added in the meantime aren't missed.
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	tailErrCh := make(chan error, 1)
+	deadline := searchutils.NewDeadline(startTime, *maxTailDuration, "-search.maxTailDuration")
+	go func() {
+		tailErrCh <- tr.t.Run(deadline, stopCh)
+	}()
+
+	ct := startTime.UnixNano() / 1e6
+	result, err := getTailStoredRows(startTime, at, r, tr.query, tr.start, ct, tr.limit)
+	tr.releaseQuerySlot()
+	if err != nil {
+		return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, limit=%d): %w", tr.query, tr.start, ct, tr.limit, err)
+	}
+	tr.t.Skip(result)
+	if tr.lastSeen > 0 {
+		result = removeRowsUpToTimestamp(result, tr.lastSeen/1e6)
+	}
+	if tr.lastEventID != nil {
+		result = querier.RemoveLogRowsUpToCursor(result, tr.lastEventID)
+	}
+	if len(result) > 0 {
+		if err := send(result, nil); err != nil {
+			// The client closed the connection.
+			return nil
+		}
+	}
+
+	// The live tailing is subject to per-tenant limits and may be canceled like any other query.
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            tr.start,
+		End:              ct,
+		Step:             defaultStep,
+		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
+		Deadline:         deadline,
+	}
+	qid, err := querier.BeginQuery(&ec, tr.query)
+	if err != nil {
+		return err
+	}
+	defer querier.EndQuery(qid)
+
+	ticker := time.NewTicker(tailFlushInterval)
+	defer ticker.Stop()
+	lastSendTime := time.Now()
+	for {
+		flush := false
+		select {
+		case <-clientGoneCh:
+			return nil
+		case err := <-tailErrCh:
+			if err != nil {
+				return fmt.Errorf("error when tailing query=%q: %w", tr.query, err)
+			}
+			// The deadline is reached. Send the remaining rows.
+			flush = true
+		case <-ticker.C:
+			if ec.Canceler.IsCanceled() {
+				return fmt.Errorf("error when tailing query=%q: %w", tr.query, netstorage.ErrQueryCanceled)
+			}
+		}
+		rs, dropped := tr.t.Next(time.Now().UnixNano()/1e6, flush)
+		if len(rs) > 0 || len(dropped) > 0 || time.Since(lastSendTime) >= tailKeepAliveInterval {
+			if err := send(rs, dropped); err != nil {
+				// The client closed the connection.
+				return nil
+			}
+			lastSendTime = time.Now()
+		}
+		if flush {
+			return nil
+		}
+	}
+}
+
+// getTailStoredRows returns up to limit oldest log rows for the log query on the time range [start..end].
+func getTailStoredRows(startTime time.Time, at *auth.Token, r *http.Request, query string, start, end, limit int64) ([]netstorage.Result, error) {
+	if start > end {
+		start = end
+	}
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            start,
+		End:              end,
+		Step:             defaultStep,
+		Limit:            limit,
+		Forward:          true,
+		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
+		Deadline:         searchutils.GetDeadlineForQuery(r, startTime),
+
+		DenyPartialResponse: searchutils.GetDenyPartialResponse(r),
+	}
+	result, _, err := querier.Exec(&ec, query, false)
+	if err != nil {
+		return nil, err
+	}
+	// Remove NaN values as Prometheus does.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
+	return removeFilteredValuesAndTimeseries(result), nil
+}
+
+// removeRowsUpToTimestamp removes log rows with timestamps up to the given timestamp in milliseconds from rs.
+func removeRowsUpToTimestamp(rs []netstorage.Result, timestamp int64) []netstorage.Result {
+	dst := rs[:0]
+	for i := range rs {
+		r := &rs[i]
+		n := 0
+		for j, ts := range r.Timestamps {
+			if ts <= timestamp {
+				continue
+			}
+			r.Timestamps[n] = ts
+			r.Values[n] = r.Values[j]
+			r.Datas[n] = r.Datas[j]
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		r.Timestamps = r.Timestamps[:n]
+		r.Values = r.Values[:n]
+		r.Datas = r.Datas[:n]
+		dst = append(dst, *r)
+	}
+	return dst
+}
+
+// getQueryRangeCursor returns the cursor from `token` arg for the given query and direction.
+//
+// nil is returned if the arg is missing.
+func getQueryRangeCursor(r *http.Request, query string, forward bool) (*querier.LogCursor, error) {
+	token := r.FormValue("token")
+	if len(token) == 0 {
+		return nil, nil
+	}
+	cursor, err := querier.ParseLogCursor(token)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `token` arg: %w", err)
+	}
+	if cursor.Forward != forward {
+		return nil, fmt.Errorf("`token` arg was obtained for the opposite `direction`")
+	}
+	if cursor.QueryHash != querier.GetLogCursorQueryHash(query, forward) {
+		return nil, fmt.Errorf("`token` arg was obtained for another `query`")
+	}
+	return cursor, nil
+}
+
+func queryRangeHandler(startTime time.Time, at *auth.Token, w io.Writer, query string, start, end, step, limit int64,
+	forward bool, cursor *querier.LogCursor, r *http.Request, ct int64) ([]netstorage.Result, error) {
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	mayCache := !searchutils.GetBool(r, "nocache")
+	lookbackDelta, err := getMaxLookback(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate input args.
+	if len(query) > maxQueryLen.N {
+		return nil, fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	if start > end {
+		end = start + defaultStep
+	}
+	if cursor != nil {
+		// There is no need in searching for log rows returned before the cursor.
+		if forward && start < cursor.Timestamp {
+			start = cursor.Timestamp
+		}
+		if !forward && end > cursor.Timestamp {
+			end = cursor.Timestamp
+		}
+	}
+	if err := querier.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
+		return nil, err
+	}
+	if mayCache {
+		start, end = querier.AdjustStartEnd(start, end, step)
+	}
+
+	qt := querytracer.New(searchutils.GetBool(r, "trace"), "/loki/api/v1/query_range: query=%q, start=%d, end=%d, step=%d, limit=%d, forward=%v",
+		query, start, end, step, limit, forward)
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            start,
+		End:              end,
+		Step:             step,
+		Limit:            limit,
+		Forward:          forward,
+		Cursor:           cursor,
+		QuotedRemoteAddr: httpserver.GetQuotedRemoteAddr(r),
+		Deadline:         deadline,
+		MayCache:         mayCache,
+		LookbackDelta:    lookbackDelta,
+		Tracer:           qt,
+
+		DenyPartialResponse: searchutils.GetDenyPartialResponse(r),
+	}
+
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+
+	lct := querier.NewLogCursorTracker(cursor, limit, forward)
+	// Write log rows in chunks as they are selected, so they don't occupy memory until the whole query is executed.
+	sw := &streamsQueryRangeWriter{
+		bw:  bw,
+		lct: lct,
+	}
+	ec.LogRowsWriter = sw.write
+	result, e, err := querier.Exec(&ec, query, false)
+	if err != nil {
+		if sw.headerWritten {
+			return nil, fmt.Errorf("cannot execute query after sending %d series to the client; the response is truncated: %w", sw.seriesWritten, err)
+		}
+		return nil, fmt.Errorf("cannot execute query: %w", err)
+	}
+
+	switch e.(type) {
+	case *logql.BinaryOpExpr, *logql.MetricExpr, *logql.PipelineExpr:
 		// Remove NaN values as Prometheus does.
 		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
-		result = removeFilteredValuesAndTimeseries(result, filter)
+		result = removeFilteredValuesAndTimeseries(result)
 
-		WriteVectorQueryRangeResponse(bw, result)
+		lct.Add(result)
+		var nextToken string
+		if nextCursor := lct.Next(); nextCursor != nil {
+			nextCursor.QueryHash = querier.GetLogCursorQueryHash(query, forward)
+			nextToken = nextCursor.String()
+		}
+		if sw.headerWritten {
+			// The log rows are already written by sw.
+			qt.Printf("sent %d series in %d chunks", sw.seriesWritten, sw.chunksWritten)
+			WriteStreamsQueryRangeResponseFooter(bw, nextToken, ec.QueryStats, qt)
+		} else {
+			WriteStreamsQueryRangeResponse(bw, result, nextToken, ec.QueryStats, qt)
+		}
+	default:
+		queryOffset := getLatencyOffsetMilliseconds()
+		if ct-queryOffset < end {
+			result = adjustLastPoints(result, ct-queryOffset, ct+step)
+		}
+
+		// Remove NaN values as Prometheus does.
+		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
+		result = removeFilteredValuesAndTimeseries(result)
+
+		WriteVectorQueryRangeResponse(bw, result, ec.QueryStats, qt)
 	}
 
 	if err := bw.Flush(); err != nil {
@@ -1205,9 +2304,36 @@ func queryRangeHandler(startTime time.Time, at *auth.Token, w io.Writer, query s
 	return result, nil
 }
 
-func removeFilteredValuesAndTimeseries(tss []netstorage.Result, filter map[uint64]int64) []netstorage.Result {
-	var lastTs int64
-	var filtered bool
+// streamsQueryRangeWriter writes log rows for /loki/api/v1/query_range response in chunks.
+type streamsQueryRangeWriter struct {
+	bw  *bufferedwriter.Writer
+	lct *querier.LogCursorTracker
+
+	headerWritten bool
+	seriesWritten int
+	chunksWritten int
+}
+
+func (sw *streamsQueryRangeWriter) write(rs []netstorage.Result) error {
+	// Remove NaN values as Prometheus does.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
+	rs = removeFilteredValuesAndTimeseries(rs)
+	if len(rs) == 0 {
+		return nil
+	}
+	isFirst := !sw.headerWritten
+	if isFirst {
+		WriteStreamsQueryRangeResponseHeader(sw.bw)
+		sw.headerWritten = true
+	}
+	WriteStreamsQueryRangeResponseChunk(sw.bw, rs, isFirst)
+	sw.lct.Add(rs)
+	sw.seriesWritten += len(rs)
+	sw.chunksWritten++
+	return sw.bw.Flush()
+}
+
+func removeFilteredValuesAndTimeseries(tss []netstorage.Result) []netstorage.Result {
 	dst := tss[:0]
 	for i := range tss {
 		ts := &tss[i]
@@ -1218,10 +2344,7 @@ func removeFilteredValuesAndTimeseries(tss []netstorage.Result, filter map[uint6
 				break
 			}
 		}
-		if filter != nil {
-			lastTs, filtered = filter[ts.MetricNameHash]
-		}
-		if !hasNaNs && !filtered {
+		if !hasNaNs {
 			// Fast path: nothing to remove.
 			if len(ts.Values) > 0 {
 				dst = append(dst, *ts)
@@ -1236,7 +2359,7 @@ func removeFilteredValuesAndTimeseries(tss []netstorage.Result, filter map[uint6
 		dstValues := ts.Values[:0]
 		dstTimestamps := ts.Timestamps[:0]
 		for j, v := range ts.Values {
-			if math.IsNaN(v) || srcTimestamps[j] <= lastTs {
+			if math.IsNaN(v) {
 				continue
 			}
 			if srcDatas != nil {
@@ -1289,6 +2412,66 @@ func adjustLastPoints(tss []netstorage.Result, start, end int64) []netstorage.Re
 	return tss
 }
 
+// RulesHandler processes /loki/api/v1/rules request.
+//
+// It returns rule groups for the tenant in YAML keyed by rules file in the same way as Loki does.
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#list-rule-groups
+func RulesHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	groups := ruler.GetGroups(at)
+	if len(groups) == 0 {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("no rule groups found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	m := make(map[string][]ruler.GroupConfig)
+	for _, g := range groups {
+		gc := g.Config()
+		// The tenant is implied by the request path.
+		gc.Tenant = ""
+		m[g.File] = append(m[g.File], gc)
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("cannot marshal rule groups: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	rulesDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var rulesDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/loki/api/v1/rules"}`)
+
+// AlertsHandler processes /prometheus/api/v1/alerts request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#alerts
+func AlertsHandler(startTime time.Time, at *auth.Token, w http.ResponseWriter, r *http.Request) error {
+	alerts := ruler.GetAlerts(at)
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteAlertsResponse(bw, alerts)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	alertsDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var alertsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/prometheus/api/v1/alerts"}`)
+
+func getSortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func getMaxLookback(r *http.Request) (int64, error) {
 	d := maxLookback.Milliseconds()
 	if d == 0 {
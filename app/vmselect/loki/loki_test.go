@@ -1,17 +1,29 @@
 package loki
 
 import (
+	"bytes"
+	"encoding/json"
 	"math"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/patterns"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/querier"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/ruler"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 )
 
 func TestRemoveEmptyValuesAndTimeseries(t *testing.T) {
 	f := func(tss []netstorage.Result, tssExpected []netstorage.Result) {
 		t.Helper()
-		tss = removeFilteredValuesAndTimeseries(tss, nil)
+		tss = removeFilteredValuesAndTimeseries(tss)
 		if !reflect.DeepEqual(tss, tssExpected) {
 			t.Fatalf("unexpected result; got %v; want %v", tss, tssExpected)
 		}
@@ -195,3 +207,659 @@ func TestAdjustLastPoints(t *testing.T) {
 		},
 	})
 }
+
+func TestQueryResponseWithStats(t *testing.T) {
+	f := func(writeResponse func(bb *bytes.Buffer, qs *netstorage.QueryStats)) {
+		t.Helper()
+		var qs netstorage.QueryStats
+		qs.AddLineFilterStats(`|= "foo"`, 10, 3)
+		qs.AddLineFilterStats(`!~ "bar"`, 7, 1)
+		qs.SetExecDuration(1234)
+		var bb bytes.Buffer
+		writeResponse(&bb, &qs)
+		var resp struct {
+			Data struct {
+				Stats struct {
+					Summary struct {
+						ExecTime float64 `json:"execTime"`
+					} `json:"summary"`
+					Eval struct {
+						LineFilters []struct {
+							Filter        string `json:"filter"`
+							LinesFiltered int    `json:"linesFiltered"`
+						} `json:"lineFilters"`
+					} `json:"eval"`
+				} `json:"stats"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(bb.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot parse response: %s\n%s", err, bb.Bytes())
+		}
+		stats := &resp.Data.Stats
+		if stats.Summary.ExecTime != 1234e-9 {
+			t.Fatalf("unexpected execTime; got %v; want %v", stats.Summary.ExecTime, 1234e-9)
+		}
+		if len(stats.Eval.LineFilters) != 2 || stats.Eval.LineFilters[1].Filter != `|= "foo"` || stats.Eval.LineFilters[1].LinesFiltered != 3 {
+			t.Fatalf("unexpected lineFilters: %+v", stats.Eval.LineFilters)
+		}
+	}
+	rs := []netstorage.Result{
+		{
+			Timestamps: []int64{1, 2},
+			Values:     []float64{1, 2},
+			Datas:      [][]byte{[]byte("foo"), []byte("bar")},
+		},
+	}
+	f(func(bb *bytes.Buffer, qs *netstorage.QueryStats) {
+		WriteStreamsQueryRangeResponse(bb, rs, "", qs, nil)
+	})
+	f(func(bb *bytes.Buffer, qs *netstorage.QueryStats) {
+		WriteStreamsQueryRangeResponse(bb, rs, "token", qs, nil)
+	})
+	f(func(bb *bytes.Buffer, qs *netstorage.QueryStats) {
+		WriteVectorQueryRangeResponse(bb, rs, qs, nil)
+	})
+	f(func(bb *bytes.Buffer, qs *netstorage.QueryStats) {
+		WriteStreamsQueryResponse(bb, rs, qs, nil)
+	})
+	f(func(bb *bytes.Buffer, qs *netstorage.QueryStats) {
+		WriteVectorQueryResponse(bb, nil, qs, nil)
+	})
+}
+
+func TestQueryResponseWithTrace(t *testing.T) {
+	f := func(writeResponse func(bb *bytes.Buffer, qt *querytracer.Tracer)) {
+		t.Helper()
+
+		// Disabled tracing
+		var bb bytes.Buffer
+		writeResponse(&bb, nil)
+		if bytes.Contains(bb.Bytes(), []byte(`"trace"`)) {
+			t.Fatalf("unexpected trace in response: %s", bb.Bytes())
+		}
+
+		// Enabled tracing
+		qt := querytracer.New(true, "test query")
+		bb.Reset()
+		writeResponse(&bb, qt)
+		var resp struct {
+			Trace struct {
+				Message  string `json:"message"`
+				Children []struct {
+					Message string `json:"message"`
+				} `json:"children"`
+			} `json:"trace"`
+		}
+		if err := json.Unmarshal(bb.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot parse response: %s\n%s", err, bb.Bytes())
+		}
+		if resp.Trace.Message != "test query" {
+			t.Fatalf("unexpected trace message; got %q; want %q", resp.Trace.Message, "test query")
+		}
+		if len(resp.Trace.Children) != 1 || resp.Trace.Children[0].Message != "generate response for 1 series" {
+			t.Fatalf("unexpected trace children: %+v", resp.Trace.Children)
+		}
+	}
+	rs := []netstorage.Result{
+		{
+			Timestamps: []int64{1, 2},
+			Values:     []float64{1, 2},
+			Datas:      [][]byte{[]byte("foo"), []byte("bar")},
+		},
+	}
+	f(func(bb *bytes.Buffer, qt *querytracer.Tracer) {
+		WriteStreamsQueryRangeResponse(bb, rs, "token", nil, qt)
+	})
+	f(func(bb *bytes.Buffer, qt *querytracer.Tracer) {
+		WriteVectorQueryRangeResponse(bb, rs, nil, qt)
+	})
+	f(func(bb *bytes.Buffer, qt *querytracer.Tracer) {
+		WriteStreamsQueryResponse(bb, rs, nil, qt)
+	})
+	f(func(bb *bytes.Buffer, qt *querytracer.Tracer) {
+		WriteVectorQueryResponse(bb, rs, nil, qt)
+	})
+}
+
+func TestStreamsQueryRangeWriter(t *testing.T) {
+	newResult := func(app string, timestamps ...int64) netstorage.Result {
+		var r netstorage.Result
+		r.MetricName.AddTag("app", app)
+		for _, timestamp := range timestamps {
+			r.Timestamps = append(r.Timestamps, timestamp)
+			r.Values = append(r.Values, 1)
+			r.Datas = append(r.Datas, []byte(app))
+		}
+		return r
+	}
+	f := func(chunks [][]netstorage.Result, streamsExpected int) {
+		t.Helper()
+		var bb bytes.Buffer
+		bw := bufferedwriter.Get(&bb)
+		defer bufferedwriter.Put(bw)
+		sw := &streamsQueryRangeWriter{
+			bw:  bw,
+			lct: querier.NewLogCursorTracker(nil, 0, true),
+		}
+		for _, chunk := range chunks {
+			if err := sw.write(chunk); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if !sw.headerWritten {
+			WriteStreamsQueryRangeResponse(bw, nil, "", nil, nil)
+		} else {
+			WriteStreamsQueryRangeResponseFooter(bw, "token", nil, nil)
+		}
+		if err := bw.Flush(); err != nil {
+			t.Fatalf("cannot flush response: %s", err)
+		}
+		var resp struct {
+			Status string `json:"status"`
+			Data   struct {
+				ResultType string `json:"resultType"`
+				Result     []struct {
+					Stream map[string]string `json:"stream"`
+					Values [][]string        `json:"values"`
+				} `json:"result"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(bb.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot parse response: %s\n%s", err, bb.Bytes())
+		}
+		if resp.Status != "success" || resp.Data.ResultType != "streams" {
+			t.Fatalf("unexpected response: %s", bb.Bytes())
+		}
+		if len(resp.Data.Result) != streamsExpected || sw.seriesWritten != streamsExpected {
+			t.Fatalf("unexpected number of streams; got %d, written %d; want %d", len(resp.Data.Result), sw.seriesWritten, streamsExpected)
+		}
+	}
+	f(nil, 0)
+	f([][]netstorage.Result{{}}, 0)
+	f([][]netstorage.Result{{newResult("foo", 1, 2)}}, 1)
+	f([][]netstorage.Result{{newResult("foo", 1), newResult("bar", 1)}, {}, {newResult("foo", 2)}}, 3)
+}
+
+func TestExplainResponse(t *testing.T) {
+	f := func(query, exprExpected string) {
+		t.Helper()
+		e, err := logql.Parse(query)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", query, err)
+		}
+		ec := &querier.EvalConfig{
+			Limit: 100,
+		}
+		sels := querier.GetExprSelectors(ec, e)
+		qt := querytracer.New(true, "explain")
+		var bb bytes.Buffer
+		WriteExplainResponse(&bb, query, e, sels, nil, nil, qt)
+		var resp struct {
+			Data struct {
+				Query string          `json:"query"`
+				Expr  json.RawMessage `json:"expr"`
+			} `json:"data"`
+			Trace json.RawMessage `json:"trace"`
+		}
+		if err := json.Unmarshal(bb.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot parse response: %s\n%s", err, bb.Bytes())
+		}
+		if resp.Data.Query != query {
+			t.Fatalf("unexpected query; got %q; want %q", resp.Data.Query, query)
+		}
+		if string(resp.Data.Expr) != exprExpected {
+			t.Fatalf("unexpected expr\ngot\n%s\nwant\n%s", resp.Data.Expr, exprExpected)
+		}
+		if len(resp.Trace) == 0 {
+			t.Fatalf("missing trace in response: %s", bb.Bytes())
+		}
+	}
+	f(`{app="api"}`, `{"type":"selector","labelFilters":["app=\"api\""]}`)
+	f(`{app="api"} |= "error" | json`, `{"type":"pipeline","stages":["json"],"children":[{"type":"binaryOp","op":"|=","children":[{"type":"selector","labelFilters":["app=\"api\""]},{"type":"string","value":"error"}]}]}`)
+	f(`sum(rate({app="api"}[5m])) by (host)`, `{"type":"aggrFunc","name":"sum","modifier":"by (host)","children":[{"type":"func","name":"rate","children":[{"type":"rollup","window":"5m","offset":"","step":"","children":[{"type":"selector","labelFilters":["app=\"api\""]}]}]}]}`)
+}
+
+func TestContextResponse(t *testing.T) {
+	f := func(lc *querier.LogContext, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteContextResponse(&bb, lc, nil, nil)
+		var resp struct {
+			Status string          `json:"status"`
+			Data   json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(bb.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot parse response: %s\n%s", err, bb.Bytes())
+		}
+		if resp.Status != "success" {
+			t.Fatalf("unexpected status; got %q; want %q", resp.Status, "success")
+		}
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(resp.Data, &data); err != nil {
+			t.Fatalf("cannot parse data: %s\n%s", err, resp.Data)
+		}
+		delete(data, "stats")
+		result, err := json.Marshal(data)
+		if err != nil {
+			t.Fatalf("cannot marshal data: %s", err)
+		}
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	lc := &querier.LogContext{
+		Timestamps: []int64{10},
+		Datas:      [][]byte{[]byte("foo")},
+	}
+	lc.MetricName.AddTag("app", "api")
+	f(lc, `{"after":[],"before":[],"entry":["10000000","foo"],"stream":{"app":"api"}}`)
+
+	lc = &querier.LogContext{
+		Timestamps: []int64{10, 20, 20, 30},
+		Datas:      [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")},
+		EntryIdx:   2,
+	}
+	lc.MetricName.AddTag("app", "api")
+	f(lc, `{"after":[["30000000","d"]],"before":[["10000000","a"],["20000000","b"]],"entry":["20000000","c"],"stream":{"app":"api"}}`)
+}
+
+func TestIndexStatsResponse(t *testing.T) {
+	f := func(stats *storage.IndexStats, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteIndexStatsResponse(&bb, stats)
+		if !json.Valid(bb.Bytes()) {
+			t.Fatalf("invalid json response: %s", bb.Bytes())
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(&storage.IndexStats{}, `{"streams":0,"chunks":0,"entries":0,"bytes":0}`)
+	f(&storage.IndexStats{
+		Streams: 2,
+		Chunks:  5,
+		Entries: 1234,
+		Bytes:   56789,
+	}, `{"streams":2,"chunks":5,"entries":1234,"bytes":56789}`)
+}
+
+func TestDetectedFieldsResponse(t *testing.T) {
+	f := func(dfs []querier.DetectedField, limit int, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteDetectedFieldsResponse(&bb, dfs, limit)
+		if !json.Valid(bb.Bytes()) {
+			t.Fatalf("invalid json response: %s", bb.Bytes())
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(nil, 1000, `{"fields":[],"limit":1000}`)
+	f([]querier.DetectedField{
+		{Label: "level", Type: "string", Cardinality: 3, Parsers: []string{"json", "logfmt"}},
+		{Label: "took", Type: "duration", Cardinality: 10, Parsers: []string{"logfmt"}},
+	}, 10, `{"fields":[{"label":"level","type":"string","cardinality":3,"parsers":["json","logfmt"]},{"label":"took","type":"duration","cardinality":10,"parsers":["logfmt"]}],"limit":10}`)
+}
+
+func TestAlertsResponse(t *testing.T) {
+	f := func(alerts []*ruler.Alert, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteAlertsResponse(&bb, alerts)
+		if !json.Valid(bb.Bytes()) {
+			t.Fatalf("invalid json response: %s", bb.Bytes())
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(nil, `{"status":"success","data":{"alerts":[]}}`)
+	f([]*ruler.Alert{
+		{
+			Labels: []prompbmarshal.Label{
+				{Name: "alertname", Value: "Foo"},
+				{Name: "job", Value: `a"b`},
+			},
+			Annotations: map[string]string{
+				"summary":     "bar",
+				"description": "baz",
+			},
+			State:    ruler.StateFiring,
+			Value:    1.5,
+			ActiveAt: time.Unix(1600000000, 0).UTC(),
+		},
+		{
+			Labels: []prompbmarshal.Label{
+				{Name: "alertname", Value: "Bar"},
+			},
+			State:    ruler.StatePending,
+			ActiveAt: time.Unix(1600000000, 500e6).UTC(),
+		},
+	}, `{"status":"success","data":{"alerts":[{"labels":{"alertname":"Foo","job":"a\"b"},"annotations":{"description":"baz","summary":"bar"},"state":"firing","activeAt":"2020-09-13T12:26:40Z","value":"1.5"},`+
+		`{"labels":{"alertname":"Bar"},"annotations":{},"state":"pending","activeAt":"2020-09-13T12:26:40.5Z","value":"0"}]}}`)
+}
+
+func TestPatternsResponse(t *testing.T) {
+	f := func(lines []string, timestamps []int64, resultExpected string) {
+		t.Helper()
+		d := patterns.New(patterns.DefaultConfig(60e3))
+		for i, line := range lines {
+			d.Add(line, timestamps[i])
+		}
+		var bb bytes.Buffer
+		WritePatternsResponse(&bb, d.Patterns())
+		if !json.Valid(bb.Bytes()) {
+			t.Fatalf("invalid json response: %s", bb.Bytes())
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(nil, nil, `{"status":"success","data":[]}`)
+	f([]string{
+		`user alice logged in`,
+		`user "bob" logged in`,
+		`disk is full`,
+	}, []int64{
+		1600000000000,
+		1600000090000,
+		1600000100000,
+	}, `{"status":"success","data":[{"pattern":"user \u003c_> logged in","samples":[[1599999960,1],[1600000080,1]]},{"pattern":"disk is full","samples":[[1600000080,1]]}]}`)
+}
+
+func TestTailResponse(t *testing.T) {
+	f := func(rs []netstorage.Result, dropped []querier.DroppedEntry, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		WriteTailResponse(&bb, rs, dropped)
+		if !json.Valid(bb.Bytes()) {
+			t.Fatalf("invalid json response: %s", bb.Bytes())
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(nil, nil, `{"streams":[],"dropped_entries":[]}`)
+
+	var mn storage.MetricName
+	mn.AddTag("app", "api")
+	rs := []netstorage.Result{{
+		MetricName: mn,
+		Timestamps: []int64{1600000000000, 1600000001000},
+		Values:     []float64{1, 1},
+		Datas:      [][]byte{[]byte("foo"), []byte("bar")},
+	}}
+	dropped := []querier.DroppedEntry{
+		{MetricName: mn, Timestamp: 1600000002000},
+		{MetricName: mn, Timestamp: 1600000003000},
+	}
+	f(rs, nil, `{"streams":[{"stream":{"app":"api"},"values":[["1600000000000000000","foo"],["1600000001000000000","bar"]]}],"dropped_entries":[]}`)
+	f(nil, dropped, `{"streams":[],"dropped_entries":[{"labels":{"app":"api"},"timestamp":"1600000002000000000"},{"labels":{"app":"api"},"timestamp":"1600000003000000000"}]}`)
+}
+
+func TestRemoveRowsUpToTimestamp(t *testing.T) {
+	f := func(rs []netstorage.Result, timestamp int64, rsExpected []netstorage.Result) {
+		t.Helper()
+		rs = removeRowsUpToTimestamp(rs, timestamp)
+		if !reflect.DeepEqual(rs, rsExpected) {
+			t.Fatalf("unexpected result; got %v; want %v", rs, rsExpected)
+		}
+	}
+	f(nil, 100, nil)
+	f([]netstorage.Result{
+		{
+			Timestamps: []int64{100, 200, 300},
+			Values:     []float64{1, 1, 1},
+			Datas:      [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+		},
+		{
+			Timestamps: []int64{50, 200},
+			Values:     []float64{1, 1},
+			Datas:      [][]byte{[]byte("d"), []byte("e")},
+		},
+	}, 200, []netstorage.Result{
+		{
+			Timestamps: []int64{300},
+			Values:     []float64{1},
+			Datas:      [][]byte{[]byte("c")},
+		},
+	})
+}
+
+func TestIsTailSSE(t *testing.T) {
+	f := func(format, accept string, resultExpected bool) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/loki/api/v1/tail/stream?format="+format, nil)
+		r.Header.Set("Accept", accept)
+		result, err := isTailSSE(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for format=%q, accept=%q; got %v; want %v", format, accept, result, resultExpected)
+		}
+	}
+	f("", "", false)
+	f("", "text/event-stream", true)
+	f("sse", "", true)
+	f("ndjson", "text/event-stream", false)
+
+	r := httptest.NewRequest("GET", "/loki/api/v1/tail/stream?format=foo", nil)
+	if _, err := isTailSSE(r); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported format")
+	}
+}
+
+func TestGetTailLastSeen(t *testing.T) {
+	f := func(arg, header string, lastSeenExpected int64) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/loki/api/v1/tail/stream?last_seen="+arg, nil)
+		r.Header.Set("Last-Event-ID", header)
+		lastSeen, err := getTailLastSeen(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if lastSeen != lastSeenExpected {
+			t.Fatalf("unexpected last seen timestamp for arg=%q, header=%q; got %d; want %d", arg, header, lastSeen, lastSeenExpected)
+		}
+	}
+	f("", "", 0)
+	f("1600000000000000000", "", 1600000000000000000)
+	// Last-Event-ID header contains a cursor instead of timestamp.
+	f("1600000000000000001", "foo", 1600000000000000001)
+
+	for _, s := range []string{"foo", "-1", "1.5"} {
+		r := httptest.NewRequest("GET", "/loki/api/v1/tail/stream?last_seen="+s, nil)
+		if _, err := getTailLastSeen(r); err == nil {
+			t.Fatalf("expecting non-nil error for last_seen=%q", s)
+		}
+	}
+}
+
+func TestGetTailLastEventID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/loki/api/v1/tail/stream", nil)
+	lc, err := getTailLastEventID(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lc != nil {
+		t.Fatalf("expecting nil cursor for missing Last-Event-ID; got %+v", lc)
+	}
+
+	lcExpected := &querier.LogCursor{
+		Forward:    true,
+		Timestamp:  1600000000000,
+		StreamHash: 123,
+		Offset:     2,
+	}
+	r.Header.Set("Last-Event-ID", lcExpected.String())
+	lc, err = getTailLastEventID(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(lc, lcExpected) {
+		t.Fatalf("unexpected cursor; got %+v; want %+v", lc, lcExpected)
+	}
+
+	backward := &querier.LogCursor{
+		Timestamp: 1600000000000,
+	}
+	for _, s := range []string{"foo", "1600000000000000000", backward.String()} {
+		r.Header.Set("Last-Event-ID", s)
+		if _, err := getTailLastEventID(r); err == nil {
+			t.Fatalf("expecting non-nil error for Last-Event-ID=%q", s)
+		}
+	}
+}
+
+func TestGetQueryRangeCursor(t *testing.T) {
+	query := `{app="foo"}`
+	r := httptest.NewRequest("GET", "/loki/api/v1/query_range", nil)
+	lc, err := getQueryRangeCursor(r, query, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lc != nil {
+		t.Fatalf("expecting nil cursor for missing token; got %+v", lc)
+	}
+
+	lcExpected := &querier.LogCursor{
+		QueryHash:  querier.GetLogCursorQueryHash(query, false),
+		Timestamp:  1600000000000,
+		StreamHash: 123,
+		Offset:     2,
+	}
+	r = httptest.NewRequest("GET", "/loki/api/v1/query_range?token="+lcExpected.String(), nil)
+	lc, err = getQueryRangeCursor(r, query, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(lc, lcExpected) {
+		t.Fatalf("unexpected cursor; got %+v; want %+v", lc, lcExpected)
+	}
+
+	// The token mustn't be used with another query or direction.
+	f := func(q string, forward bool) {
+		t.Helper()
+		if _, err := getQueryRangeCursor(r, q, forward); err == nil {
+			t.Fatalf("expecting non-nil error for query=%q, forward=%v", q, forward)
+		}
+	}
+	f(`{app="bar"}`, false)
+	f(query, true)
+	forward := *lcExpected
+	forward.Forward = true
+	r = httptest.NewRequest("GET", "/loki/api/v1/query_range?token="+forward.String(), nil)
+	f(query, true)
+	r = httptest.NewRequest("GET", "/loki/api/v1/query_range?token=foo", nil)
+	f(query, false)
+}
+
+func TestAcquireTailSlot(t *testing.T) {
+	defer func(n int) {
+		*maxConcurrentTails = n
+	}(*maxConcurrentTails)
+	*maxConcurrentTails = 2
+
+	for i := 0; i < 2; i++ {
+		if err := acquireTailSlot(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := acquireTailSlot(); err == nil {
+		t.Fatalf("expecting non-nil error when -search.maxConcurrentTails is reached")
+	}
+	releaseTailSlot()
+	if err := acquireTailSlot(); err != nil {
+		t.Fatalf("unexpected error after releasing the slot: %s", err)
+	}
+	releaseTailSlot()
+	releaseTailSlot()
+}
+
+func TestGetVolumeTargetLabels(t *testing.T) {
+	f := func(s, query string, labelsExpected []string) {
+		t.Helper()
+		tagFilters, err := querier.ParseMetricSelector(query)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", query, err)
+		}
+		labels := getVolumeTargetLabels(s, tagFilters)
+		if !reflect.DeepEqual(labels, labelsExpected) {
+			t.Fatalf("unexpected labels for targetLabels=%q, query=%q; got %q; want %q", s, query, labels, labelsExpected)
+		}
+	}
+	f("", `{app="api"}`, []string{"app"})
+	f("", `{app="api",env!="dev",app!="foo"}`, []string{"app", "env"})
+	f("", `logs{app="api"}`, []string{"__name__", "app"})
+	f("service", `{app="api"}`, []string{"service"})
+	f("service, namespace,", `{app="api"}`, []string{"service", "namespace"})
+}
+
+func TestGetIndexVolumeResults(t *testing.T) {
+	newIndexVolume := func(service string, timestamp int64, entries, bytes uint64) storage.IndexVolume {
+		var iv storage.IndexVolume
+		iv.MetricName.AddTag("service", service)
+		iv.Timestamp = timestamp
+		iv.Entries = entries
+		iv.Bytes = bytes
+		return iv
+	}
+	newResult := func(service string, timestamps []int64, values []float64) netstorage.Result {
+		var r netstorage.Result
+		r.MetricName.AddTag("service", service)
+		r.Timestamps = timestamps
+		r.Values = values
+		return r
+	}
+	f := func(ivs []storage.IndexVolume, volumeType string, timestamp int64, limit int, rsExpected []netstorage.Result) {
+		t.Helper()
+		rs := getIndexVolumeResults(ivs, volumeType, timestamp, limit)
+		if len(rs) != len(rsExpected) {
+			t.Fatalf("unexpected number of results; got %d; want %d", len(rs), len(rsExpected))
+		}
+		for i := range rs {
+			r, rExpected := &rs[i], &rsExpected[i]
+			if r.MetricName.String() != rExpected.MetricName.String() {
+				t.Fatalf("unexpected metric name for result #%d; got %s; want %s", i, &r.MetricName, &rExpected.MetricName)
+			}
+			if !reflect.DeepEqual(r.Timestamps, rExpected.Timestamps) {
+				t.Fatalf("unexpected timestamps for %s; got %v; want %v", &r.MetricName, r.Timestamps, rExpected.Timestamps)
+			}
+			if !reflect.DeepEqual(r.Values, rExpected.Values) {
+				t.Fatalf("unexpected values for %s; got %v; want %v", &r.MetricName, r.Values, rExpected.Values)
+			}
+		}
+	}
+
+	ivs := []storage.IndexVolume{
+		newIndexVolume("api", 0, 10, 100),
+		newIndexVolume("db", 0, 30, 50),
+		newIndexVolume("api", 0, 5, 20),
+	}
+	f(ivs, "bytes", 1000, 0, []netstorage.Result{
+		newResult("api", []int64{1000}, []float64{120}),
+		newResult("db", []int64{1000}, []float64{50}),
+	})
+	f(ivs, "entries", 1000, 0, []netstorage.Result{
+		newResult("db", []int64{1000}, []float64{30}),
+		newResult("api", []int64{1000}, []float64{15}),
+	})
+	f(ivs, "bytes", 1000, 1, []netstorage.Result{
+		newResult("api", []int64{1000}, []float64{120}),
+	})
+
+	ivs = []storage.IndexVolume{
+		newIndexVolume("api", 200, 10, 100),
+		newIndexVolume("db", 100, 30, 300),
+		newIndexVolume("api", 100, 5, 20),
+	}
+	f(ivs, "bytes", 0, 0, []netstorage.Result{
+		newResult("db", []int64{100}, []float64{300}),
+		newResult("api", []int64{100, 200}, []float64{20, 100}),
+	})
+	f(nil, "bytes", 1000, 0, nil)
+}
@@ -0,0 +1,101 @@
+// Code generated by qtc from "patterns_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/loki/patterns_response.qtpl:1
+package loki
+
+//line app/vmselect/loki/patterns_response.qtpl:1
+import (
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/patterns"
+)
+
+// PatternsResponse generates response for /loki/api/v1/patterns .
+
+//line app/vmselect/loki/patterns_response.qtpl:7
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/loki/patterns_response.qtpl:7
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/loki/patterns_response.qtpl:7
+func StreamPatternsResponse(qw422016 *qt422016.Writer, ps []*patterns.Pattern) {
+//line app/vmselect/loki/patterns_response.qtpl:7
+	qw422016.N().S(`{"status":"success","data":[`)
+//line app/vmselect/loki/patterns_response.qtpl:11
+	for i, p := range ps {
+//line app/vmselect/loki/patterns_response.qtpl:12
+		timestamps, values := p.SortedSamples()
+
+//line app/vmselect/loki/patterns_response.qtpl:12
+		qw422016.N().S(`{"pattern":`)
+//line app/vmselect/loki/patterns_response.qtpl:14
+		qw422016.N().Q(p.String())
+//line app/vmselect/loki/patterns_response.qtpl:14
+		qw422016.N().S(`,"samples":[`)
+//line app/vmselect/loki/patterns_response.qtpl:16
+		for j, ts := range timestamps {
+//line app/vmselect/loki/patterns_response.qtpl:16
+			qw422016.N().S(`[`)
+//line app/vmselect/loki/patterns_response.qtpl:17
+			qw422016.N().DL(ts / 1000)
+//line app/vmselect/loki/patterns_response.qtpl:17
+			qw422016.N().S(`,`)
+//line app/vmselect/loki/patterns_response.qtpl:17
+			qw422016.N().DUL(values[j])
+//line app/vmselect/loki/patterns_response.qtpl:17
+			qw422016.N().S(`]`)
+//line app/vmselect/loki/patterns_response.qtpl:18
+			if j+1 < len(timestamps) {
+//line app/vmselect/loki/patterns_response.qtpl:18
+				qw422016.N().S(`,`)
+//line app/vmselect/loki/patterns_response.qtpl:18
+			}
+//line app/vmselect/loki/patterns_response.qtpl:19
+		}
+//line app/vmselect/loki/patterns_response.qtpl:19
+		qw422016.N().S(`]}`)
+//line app/vmselect/loki/patterns_response.qtpl:22
+		if i+1 < len(ps) {
+//line app/vmselect/loki/patterns_response.qtpl:22
+			qw422016.N().S(`,`)
+//line app/vmselect/loki/patterns_response.qtpl:22
+		}
+//line app/vmselect/loki/patterns_response.qtpl:23
+	}
+//line app/vmselect/loki/patterns_response.qtpl:23
+	qw422016.N().S(`]}`)
+//line app/vmselect/loki/patterns_response.qtpl:26
+}
+
+//line app/vmselect/loki/patterns_response.qtpl:26
+func WritePatternsResponse(qq422016 qtio422016.Writer, ps []*patterns.Pattern) {
+//line app/vmselect/loki/patterns_response.qtpl:26
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/loki/patterns_response.qtpl:26
+	StreamPatternsResponse(qw422016, ps)
+//line app/vmselect/loki/patterns_response.qtpl:26
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/loki/patterns_response.qtpl:26
+}
+
+//line app/vmselect/loki/patterns_response.qtpl:26
+func PatternsResponse(ps []*patterns.Pattern) string {
+//line app/vmselect/loki/patterns_response.qtpl:26
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/loki/patterns_response.qtpl:26
+	WritePatternsResponse(qb422016, ps)
+//line app/vmselect/loki/patterns_response.qtpl:26
+	qs422016 := string(qb422016.B)
+//line app/vmselect/loki/patterns_response.qtpl:26
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/loki/patterns_response.qtpl:26
+	return qs422016
+//line app/vmselect/loki/patterns_response.qtpl:26
+}
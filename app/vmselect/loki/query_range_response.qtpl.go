@@ -7,257 +7,344 @@ package loki
 //line app/vmselect/loki/query_range_response.qtpl:1
 import (
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/querytracer"
 )
 
 // QueryRangeResponse generates response for /api/v1/query_range.See https://prometheus.io/docs/prometheus/latest/querying/api/#range-queries
 
-//line app/vmselect/loki/query_range_response.qtpl:8
+//line app/vmselect/loki/query_range_response.qtpl:9
 import (
 	qtio422016 "io"
 
 	qt422016 "github.com/valyala/quicktemplate"
 )
 
-//line app/vmselect/loki/query_range_response.qtpl:8
+//line app/vmselect/loki/query_range_response.qtpl:9
 var (
 	_ = qtio422016.Copy
 	_ = qt422016.AcquireByteBuffer
 )
 
-//line app/vmselect/loki/query_range_response.qtpl:8
-func StreamVectorQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:8
+//line app/vmselect/loki/query_range_response.qtpl:9
+func StreamVectorQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_range_response.qtpl:10
+	qtWrite := qt.NewChild("generate response for %d series", len(rs))
+
+//line app/vmselect/loki/query_range_response.qtpl:10
 	qw422016.N().S(`{"status":"success","data":{"resultType":"matrix","result":[`)
-//line app/vmselect/loki/query_range_response.qtpl:14
+//line app/vmselect/loki/query_range_response.qtpl:16
 	if len(rs) > 0 {
-//line app/vmselect/loki/query_range_response.qtpl:15
+//line app/vmselect/loki/query_range_response.qtpl:17
 		streamvectorQueryRangeLine(qw422016, &rs[0])
-//line app/vmselect/loki/query_range_response.qtpl:16
+//line app/vmselect/loki/query_range_response.qtpl:18
 		rs = rs[1:]
 
-//line app/vmselect/loki/query_range_response.qtpl:17
+//line app/vmselect/loki/query_range_response.qtpl:19
 		for i := range rs {
-//line app/vmselect/loki/query_range_response.qtpl:17
+//line app/vmselect/loki/query_range_response.qtpl:19
 			qw422016.N().S(`,`)
-//line app/vmselect/loki/query_range_response.qtpl:18
+//line app/vmselect/loki/query_range_response.qtpl:20
 			streamvectorQueryRangeLine(qw422016, &rs[i])
-//line app/vmselect/loki/query_range_response.qtpl:19
+//line app/vmselect/loki/query_range_response.qtpl:21
 		}
-//line app/vmselect/loki/query_range_response.qtpl:20
+//line app/vmselect/loki/query_range_response.qtpl:22
 	}
-//line app/vmselect/loki/query_range_response.qtpl:20
-	qw422016.N().S(`]}}`)
+//line app/vmselect/loki/query_range_response.qtpl:22
+	qw422016.N().S(`],"stats":`)
 //line app/vmselect/loki/query_range_response.qtpl:24
+	streamqueryStats(qw422016, qs)
+//line app/vmselect/loki/query_range_response.qtpl:24
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_range_response.qtpl:26
+	qtWrite.Donef("")
+
+//line app/vmselect/loki/query_range_response.qtpl:27
+	streamqueryTrace(qw422016, qt)
+//line app/vmselect/loki/query_range_response.qtpl:27
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_range_response.qtpl:29
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:24
-func WriteVectorQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
+func WriteVectorQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_range_response.qtpl:29
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/loki/query_range_response.qtpl:24
-	StreamVectorQueryRangeResponse(qw422016, rs)
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
+	StreamVectorQueryRangeResponse(qw422016, rs, qs, qt)
+//line app/vmselect/loki/query_range_response.qtpl:29
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:24
-func VectorQueryRangeResponse(rs []netstorage.Result) string {
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
+func VectorQueryRangeResponse(rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) string {
+//line app/vmselect/loki/query_range_response.qtpl:29
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/loki/query_range_response.qtpl:24
-	WriteVectorQueryRangeResponse(qb422016, rs)
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
+	WriteVectorQueryRangeResponse(qb422016, rs, qs, qt)
+//line app/vmselect/loki/query_range_response.qtpl:29
 	qs422016 := string(qb422016.B)
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
 	return qs422016
-//line app/vmselect/loki/query_range_response.qtpl:24
+//line app/vmselect/loki/query_range_response.qtpl:29
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:26
+//line app/vmselect/loki/query_range_response.qtpl:31
 func streamvectorQueryRangeLine(qw422016 *qt422016.Writer, r *netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:26
+//line app/vmselect/loki/query_range_response.qtpl:31
 	qw422016.N().S(`{"metric":`)
-//line app/vmselect/loki/query_range_response.qtpl:28
+//line app/vmselect/loki/query_range_response.qtpl:33
 	streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/loki/query_range_response.qtpl:28
+//line app/vmselect/loki/query_range_response.qtpl:33
 	qw422016.N().S(`,"values":`)
-//line app/vmselect/loki/query_range_response.qtpl:29
+//line app/vmselect/loki/query_range_response.qtpl:34
 	streamvaluesWithTimestamps(qw422016, r.Values, r.Timestamps)
-//line app/vmselect/loki/query_range_response.qtpl:29
+//line app/vmselect/loki/query_range_response.qtpl:34
 	qw422016.N().S(`}`)
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 func writevectorQueryRangeLine(qq422016 qtio422016.Writer, r *netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	streamvectorQueryRangeLine(qw422016, r)
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 func vectorQueryRangeLine(r *netstorage.Result) string {
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	writevectorQueryRangeLine(qb422016, r)
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	qs422016 := string(qb422016.B)
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 	return qs422016
-//line app/vmselect/loki/query_range_response.qtpl:31
+//line app/vmselect/loki/query_range_response.qtpl:36
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:33
-func StreamStreamsQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:33
-	qw422016.N().S(`{"status":"success","data":{"resultType":"streams","result":[`)
-//line app/vmselect/loki/query_range_response.qtpl:39
-	if len(rs) > 0 {
-//line app/vmselect/loki/query_range_response.qtpl:40
-		streamstreamsQueryRangeLine(qw422016, &rs[0])
-//line app/vmselect/loki/query_range_response.qtpl:41
-		rs = rs[1:]
+// StreamsQueryRangeResponse generates response for /loki/api/v1/query_range with streams.nextToken is an optional token for resuming the query from the last returned log row.qs contains query execution stats, while qt contains optional query trace.
 
+//line app/vmselect/loki/query_range_response.qtpl:41
+func StreamStreamsQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, nextToken string, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
 //line app/vmselect/loki/query_range_response.qtpl:42
-		for i := range rs {
-//line app/vmselect/loki/query_range_response.qtpl:42
-			qw422016.N().S(`,`)
+	qtWrite := qt.NewChild("generate response for %d series", len(rs))
+
 //line app/vmselect/loki/query_range_response.qtpl:43
-			streamstreamsQueryRangeLine(qw422016, &rs[i])
+	StreamStreamsQueryRangeResponseHeader(qw422016)
 //line app/vmselect/loki/query_range_response.qtpl:44
-		}
+	StreamStreamsQueryRangeResponseChunk(qw422016, rs, true)
 //line app/vmselect/loki/query_range_response.qtpl:45
-	}
-//line app/vmselect/loki/query_range_response.qtpl:45
-	qw422016.N().S(`]}}`)
-//line app/vmselect/loki/query_range_response.qtpl:49
+	qtWrite.Donef("")
+
+//line app/vmselect/loki/query_range_response.qtpl:46
+	StreamStreamsQueryRangeResponseFooter(qw422016, nextToken, qs, qt)
+//line app/vmselect/loki/query_range_response.qtpl:47
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:49
-func WriteStreamsQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
+func WriteStreamsQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, nextToken string, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_range_response.qtpl:47
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/loki/query_range_response.qtpl:49
-	StreamStreamsQueryRangeResponse(qw422016, rs)
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
+	StreamStreamsQueryRangeResponse(qw422016, rs, nextToken, qs, qt)
+//line app/vmselect/loki/query_range_response.qtpl:47
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:49
-func StreamsQueryRangeResponse(rs []netstorage.Result) string {
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
+func StreamsQueryRangeResponse(rs []netstorage.Result, nextToken string, qs *netstorage.QueryStats, qt *querytracer.Tracer) string {
+//line app/vmselect/loki/query_range_response.qtpl:47
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/loki/query_range_response.qtpl:49
-	WriteStreamsQueryRangeResponse(qb422016, rs)
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
+	WriteStreamsQueryRangeResponse(qb422016, rs, nextToken, qs, qt)
+//line app/vmselect/loki/query_range_response.qtpl:47
 	qs422016 := string(qb422016.B)
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
 	return qs422016
-//line app/vmselect/loki/query_range_response.qtpl:49
+//line app/vmselect/loki/query_range_response.qtpl:47
 }
 
+// StreamsQueryRangeResponseHeader generates the beginning of response for /loki/api/v1/query_range with streams,which is written in chunks with StreamsQueryRangeResponseChunk.
+
 //line app/vmselect/loki/query_range_response.qtpl:51
-func StreamTailQueryRangeResponse(qw422016 *qt422016.Writer, rs []netstorage.Result) {
+func StreamStreamsQueryRangeResponseHeader(qw422016 *qt422016.Writer) {
 //line app/vmselect/loki/query_range_response.qtpl:51
-	qw422016.N().S(`{"streams":[`)
-//line app/vmselect/loki/query_range_response.qtpl:54
-	if len(rs) > 0 {
-//line app/vmselect/loki/query_range_response.qtpl:55
-		streamstreamsQueryRangeLine(qw422016, &rs[0])
-//line app/vmselect/loki/query_range_response.qtpl:56
-		rs = rs[1:]
+	qw422016.N().S(`{"status":"success","data":{"resultType":"streams","result":[`)
+//line app/vmselect/loki/query_range_response.qtpl:57
+}
 
 //line app/vmselect/loki/query_range_response.qtpl:57
-		for i := range rs {
+func WriteStreamsQueryRangeResponseHeader(qq422016 qtio422016.Writer) {
+//line app/vmselect/loki/query_range_response.qtpl:57
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/loki/query_range_response.qtpl:57
+	StreamStreamsQueryRangeResponseHeader(qw422016)
 //line app/vmselect/loki/query_range_response.qtpl:57
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/loki/query_range_response.qtpl:57
+}
+
+//line app/vmselect/loki/query_range_response.qtpl:57
+func StreamsQueryRangeResponseHeader() string {
+//line app/vmselect/loki/query_range_response.qtpl:57
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/loki/query_range_response.qtpl:57
+	WriteStreamsQueryRangeResponseHeader(qb422016)
+//line app/vmselect/loki/query_range_response.qtpl:57
+	qs422016 := string(qb422016.B)
+//line app/vmselect/loki/query_range_response.qtpl:57
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/loki/query_range_response.qtpl:57
+	return qs422016
+//line app/vmselect/loki/query_range_response.qtpl:57
+}
+
+// StreamsQueryRangeResponseChunk generates the next chunk of streams for response started with StreamsQueryRangeResponseHeader.isFirst must be set for the first chunk in the response.
+
+//line app/vmselect/loki/query_range_response.qtpl:61
+func StreamStreamsQueryRangeResponseChunk(qw422016 *qt422016.Writer, rs []netstorage.Result, isFirst bool) {
+//line app/vmselect/loki/query_range_response.qtpl:62
+	for i := range rs {
+//line app/vmselect/loki/query_range_response.qtpl:63
+		if i > 0 || !isFirst {
+//line app/vmselect/loki/query_range_response.qtpl:63
 			qw422016.N().S(`,`)
-//line app/vmselect/loki/query_range_response.qtpl:58
-			streamstreamsQueryRangeLine(qw422016, &rs[i])
-//line app/vmselect/loki/query_range_response.qtpl:59
+//line app/vmselect/loki/query_range_response.qtpl:63
 		}
-//line app/vmselect/loki/query_range_response.qtpl:60
+//line app/vmselect/loki/query_range_response.qtpl:64
+		streamstreamsQueryRangeLine(qw422016, &rs[i])
+//line app/vmselect/loki/query_range_response.qtpl:65
 	}
-//line app/vmselect/loki/query_range_response.qtpl:60
-	qw422016.N().S(`]}`)
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:63
-func WriteTailQueryRangeResponse(qq422016 qtio422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
+func WriteStreamsQueryRangeResponseChunk(qq422016 qtio422016.Writer, rs []netstorage.Result, isFirst bool) {
+//line app/vmselect/loki/query_range_response.qtpl:66
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/loki/query_range_response.qtpl:63
-	StreamTailQueryRangeResponse(qw422016, rs)
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
+	StreamStreamsQueryRangeResponseChunk(qw422016, rs, isFirst)
+//line app/vmselect/loki/query_range_response.qtpl:66
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:63
-func TailQueryRangeResponse(rs []netstorage.Result) string {
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
+func StreamsQueryRangeResponseChunk(rs []netstorage.Result, isFirst bool) string {
+//line app/vmselect/loki/query_range_response.qtpl:66
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/loki/query_range_response.qtpl:63
-	WriteTailQueryRangeResponse(qb422016, rs)
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
+	WriteStreamsQueryRangeResponseChunk(qb422016, rs, isFirst)
+//line app/vmselect/loki/query_range_response.qtpl:66
 	qs422016 := string(qb422016.B)
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
 	return qs422016
-//line app/vmselect/loki/query_range_response.qtpl:63
+//line app/vmselect/loki/query_range_response.qtpl:66
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:65
+// StreamsQueryRangeResponseFooter generates the end of response started with StreamsQueryRangeResponseHeader.
+
+//line app/vmselect/loki/query_range_response.qtpl:69
+func StreamStreamsQueryRangeResponseFooter(qw422016 *qt422016.Writer, nextToken string, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_range_response.qtpl:69
+	qw422016.N().S(`],"stats":`)
+//line app/vmselect/loki/query_range_response.qtpl:71
+	streamqueryStats(qw422016, qs)
+//line app/vmselect/loki/query_range_response.qtpl:72
+	if len(nextToken) > 0 {
+//line app/vmselect/loki/query_range_response.qtpl:72
+		qw422016.N().S(`,"nextToken":`)
+//line app/vmselect/loki/query_range_response.qtpl:73
+		qw422016.N().Q(nextToken)
+//line app/vmselect/loki/query_range_response.qtpl:74
+	}
+//line app/vmselect/loki/query_range_response.qtpl:74
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_range_response.qtpl:76
+	streamqueryTrace(qw422016, qt)
+//line app/vmselect/loki/query_range_response.qtpl:76
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_range_response.qtpl:78
+}
+
+//line app/vmselect/loki/query_range_response.qtpl:78
+func WriteStreamsQueryRangeResponseFooter(qq422016 qtio422016.Writer, nextToken string, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_range_response.qtpl:78
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/loki/query_range_response.qtpl:78
+	StreamStreamsQueryRangeResponseFooter(qw422016, nextToken, qs, qt)
+//line app/vmselect/loki/query_range_response.qtpl:78
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/loki/query_range_response.qtpl:78
+}
+
+//line app/vmselect/loki/query_range_response.qtpl:78
+func StreamsQueryRangeResponseFooter(nextToken string, qs *netstorage.QueryStats, qt *querytracer.Tracer) string {
+//line app/vmselect/loki/query_range_response.qtpl:78
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/loki/query_range_response.qtpl:78
+	WriteStreamsQueryRangeResponseFooter(qb422016, nextToken, qs, qt)
+//line app/vmselect/loki/query_range_response.qtpl:78
+	qs422016 := string(qb422016.B)
+//line app/vmselect/loki/query_range_response.qtpl:78
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/loki/query_range_response.qtpl:78
+	return qs422016
+//line app/vmselect/loki/query_range_response.qtpl:78
+}
+
+//line app/vmselect/loki/query_range_response.qtpl:80
 func streamstreamsQueryRangeLine(qw422016 *qt422016.Writer, r *netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:65
+//line app/vmselect/loki/query_range_response.qtpl:80
 	qw422016.N().S(`{"stream":`)
-//line app/vmselect/loki/query_range_response.qtpl:67
+//line app/vmselect/loki/query_range_response.qtpl:82
 	streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/loki/query_range_response.qtpl:67
+//line app/vmselect/loki/query_range_response.qtpl:82
 	qw422016.N().S(`,"values":`)
-//line app/vmselect/loki/query_range_response.qtpl:68
+//line app/vmselect/loki/query_range_response.qtpl:83
 	streamdatasWithTimestamps(qw422016, r.Datas, r.Timestamps)
-//line app/vmselect/loki/query_range_response.qtpl:68
+//line app/vmselect/loki/query_range_response.qtpl:83
 	qw422016.N().S(`}`)
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 func writestreamsQueryRangeLine(qq422016 qtio422016.Writer, r *netstorage.Result) {
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	streamstreamsQueryRangeLine(qw422016, r)
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 }
 
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 func streamsQueryRangeLine(r *netstorage.Result) string {
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	writestreamsQueryRangeLine(qb422016, r)
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	qs422016 := string(qb422016.B)
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 	return qs422016
-//line app/vmselect/loki/query_range_response.qtpl:70
+//line app/vmselect/loki/query_range_response.qtpl:85
 }
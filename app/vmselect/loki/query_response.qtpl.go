@@ -7,173 +7,202 @@ package loki
 //line app/vmselect/loki/query_response.qtpl:1
 import (
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/querytracer"
 )
 
 // QueryResponse generates response for /api/v1/query.See https://prometheus.io/docs/prometheus/latest/querying/api/#instant-queries
 
-//line app/vmselect/loki/query_response.qtpl:8
+//line app/vmselect/loki/query_response.qtpl:9
 import (
 	qtio422016 "io"
 
 	qt422016 "github.com/valyala/quicktemplate"
 )
 
-//line app/vmselect/loki/query_response.qtpl:8
+//line app/vmselect/loki/query_response.qtpl:9
 var (
 	_ = qtio422016.Copy
 	_ = qt422016.AcquireByteBuffer
 )
 
-//line app/vmselect/loki/query_response.qtpl:8
-func StreamVectorQueryResponse(qw422016 *qt422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_response.qtpl:8
+//line app/vmselect/loki/query_response.qtpl:9
+func StreamVectorQueryResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_response.qtpl:10
+	qtWrite := qt.NewChild("generate response for %d series", len(rs))
+
+//line app/vmselect/loki/query_response.qtpl:10
 	qw422016.N().S(`{"status":"success","data":{"resultType":"vector","result":[`)
-//line app/vmselect/loki/query_response.qtpl:14
+//line app/vmselect/loki/query_response.qtpl:16
 	if len(rs) > 0 {
-//line app/vmselect/loki/query_response.qtpl:14
-		qw422016.N().S(`{"metric":`)
 //line app/vmselect/loki/query_response.qtpl:16
+		qw422016.N().S(`{"metric":`)
+//line app/vmselect/loki/query_response.qtpl:18
 		streammetricNameObject(qw422016, &rs[0].MetricName)
-//line app/vmselect/loki/query_response.qtpl:16
+//line app/vmselect/loki/query_response.qtpl:18
 		qw422016.N().S(`,"value": [`)
-//line app/vmselect/loki/query_response.qtpl:17
+//line app/vmselect/loki/query_response.qtpl:19
 		qw422016.N().F(float64(rs[0].Timestamps[0]) / 1e3)
-//line app/vmselect/loki/query_response.qtpl:17
+//line app/vmselect/loki/query_response.qtpl:19
 		qw422016.N().S(`,"`)
-//line app/vmselect/loki/query_response.qtpl:17
+//line app/vmselect/loki/query_response.qtpl:19
 		qw422016.N().F(rs[0].Values[0])
-//line app/vmselect/loki/query_response.qtpl:17
-		qw422016.N().S(`"]}`)
 //line app/vmselect/loki/query_response.qtpl:19
+		qw422016.N().S(`"]}`)
+//line app/vmselect/loki/query_response.qtpl:21
 		rs = rs[1:]
 
-//line app/vmselect/loki/query_response.qtpl:20
+//line app/vmselect/loki/query_response.qtpl:22
 		for i := range rs {
-//line app/vmselect/loki/query_response.qtpl:21
+//line app/vmselect/loki/query_response.qtpl:23
 			r := &rs[i]
 
-//line app/vmselect/loki/query_response.qtpl:21
-			qw422016.N().S(`,{"metric":`)
 //line app/vmselect/loki/query_response.qtpl:23
+			qw422016.N().S(`,{"metric":`)
+//line app/vmselect/loki/query_response.qtpl:25
 			streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/loki/query_response.qtpl:23
+//line app/vmselect/loki/query_response.qtpl:25
 			qw422016.N().S(`,"value": [`)
-//line app/vmselect/loki/query_response.qtpl:24
+//line app/vmselect/loki/query_response.qtpl:26
 			qw422016.N().F(float64(r.Timestamps[0]) / 1e3)
-//line app/vmselect/loki/query_response.qtpl:24
+//line app/vmselect/loki/query_response.qtpl:26
 			qw422016.N().S(`,"`)
-//line app/vmselect/loki/query_response.qtpl:24
+//line app/vmselect/loki/query_response.qtpl:26
 			qw422016.N().F(r.Values[0])
-//line app/vmselect/loki/query_response.qtpl:24
-			qw422016.N().S(`"]}`)
 //line app/vmselect/loki/query_response.qtpl:26
+			qw422016.N().S(`"]}`)
+//line app/vmselect/loki/query_response.qtpl:28
 		}
-//line app/vmselect/loki/query_response.qtpl:27
+//line app/vmselect/loki/query_response.qtpl:29
 	}
-//line app/vmselect/loki/query_response.qtpl:27
-	qw422016.N().S(`]}}`)
+//line app/vmselect/loki/query_response.qtpl:29
+	qw422016.N().S(`],"stats":`)
+//line app/vmselect/loki/query_response.qtpl:31
+	streamqueryStats(qw422016, qs)
 //line app/vmselect/loki/query_response.qtpl:31
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_response.qtpl:33
+	qtWrite.Donef("")
+
+//line app/vmselect/loki/query_response.qtpl:34
+	streamqueryTrace(qw422016, qt)
+//line app/vmselect/loki/query_response.qtpl:34
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_response.qtpl:36
 }
 
-//line app/vmselect/loki/query_response.qtpl:31
-func WriteVectorQueryResponse(qq422016 qtio422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
+func WriteVectorQueryResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_response.qtpl:36
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/loki/query_response.qtpl:31
-	StreamVectorQueryResponse(qw422016, rs)
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
+	StreamVectorQueryResponse(qw422016, rs, qs, qt)
+//line app/vmselect/loki/query_response.qtpl:36
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
 }
 
-//line app/vmselect/loki/query_response.qtpl:31
-func VectorQueryResponse(rs []netstorage.Result) string {
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
+func VectorQueryResponse(rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) string {
+//line app/vmselect/loki/query_response.qtpl:36
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/loki/query_response.qtpl:31
-	WriteVectorQueryResponse(qb422016, rs)
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
+	WriteVectorQueryResponse(qb422016, rs, qs, qt)
+//line app/vmselect/loki/query_response.qtpl:36
 	qs422016 := string(qb422016.B)
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
 	return qs422016
-//line app/vmselect/loki/query_response.qtpl:31
+//line app/vmselect/loki/query_response.qtpl:36
 }
 
-//line app/vmselect/loki/query_response.qtpl:33
-func StreamStreamsQueryResponse(qw422016 *qt422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_response.qtpl:33
-	qw422016.N().S(`{"status":"success","data":{"resultType":"streams","result":[`)
+//line app/vmselect/loki/query_response.qtpl:38
+func StreamStreamsQueryResponse(qw422016 *qt422016.Writer, rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
 //line app/vmselect/loki/query_response.qtpl:39
-	if len(rs) > 0 {
+	qtWrite := qt.NewChild("generate response for %d series", len(rs))
+
 //line app/vmselect/loki/query_response.qtpl:39
+	qw422016.N().S(`{"status":"success","data":{"resultType":"streams","result":[`)
+//line app/vmselect/loki/query_response.qtpl:45
+	if len(rs) > 0 {
+//line app/vmselect/loki/query_response.qtpl:45
 		qw422016.N().S(`{"stream":`)
-//line app/vmselect/loki/query_response.qtpl:41
+//line app/vmselect/loki/query_response.qtpl:47
 		streammetricNameObject(qw422016, &rs[0].MetricName)
-//line app/vmselect/loki/query_response.qtpl:41
+//line app/vmselect/loki/query_response.qtpl:47
 		qw422016.N().S(`,"value": ["`)
-//line app/vmselect/loki/query_response.qtpl:42
+//line app/vmselect/loki/query_response.qtpl:48
 		qw422016.N().DL(rs[0].Timestamps[0] * 1e6)
-//line app/vmselect/loki/query_response.qtpl:42
+//line app/vmselect/loki/query_response.qtpl:48
 		qw422016.N().S(`",`)
-//line app/vmselect/loki/query_response.qtpl:42
+//line app/vmselect/loki/query_response.qtpl:48
 		qw422016.N().QZ(rs[0].Datas[0])
-//line app/vmselect/loki/query_response.qtpl:42
+//line app/vmselect/loki/query_response.qtpl:48
 		qw422016.N().S(`]}`)
-//line app/vmselect/loki/query_response.qtpl:44
+//line app/vmselect/loki/query_response.qtpl:50
 		rs = rs[1:]
 
-//line app/vmselect/loki/query_response.qtpl:45
+//line app/vmselect/loki/query_response.qtpl:51
 		for i := range rs {
-//line app/vmselect/loki/query_response.qtpl:46
+//line app/vmselect/loki/query_response.qtpl:52
 			r := &rs[i]
 
-//line app/vmselect/loki/query_response.qtpl:46
+//line app/vmselect/loki/query_response.qtpl:52
 			qw422016.N().S(`,{"stream":`)
-//line app/vmselect/loki/query_response.qtpl:48
+//line app/vmselect/loki/query_response.qtpl:54
 			streammetricNameObject(qw422016, &r.MetricName)
-//line app/vmselect/loki/query_response.qtpl:48
+//line app/vmselect/loki/query_response.qtpl:54
 			qw422016.N().S(`,"value": ["`)
-//line app/vmselect/loki/query_response.qtpl:49
+//line app/vmselect/loki/query_response.qtpl:55
 			qw422016.N().DL(r.Timestamps[0] * 1e6)
-//line app/vmselect/loki/query_response.qtpl:49
+//line app/vmselect/loki/query_response.qtpl:55
 			qw422016.N().S(`",`)
-//line app/vmselect/loki/query_response.qtpl:49
+//line app/vmselect/loki/query_response.qtpl:55
 			qw422016.N().QZ(r.Datas[0])
-//line app/vmselect/loki/query_response.qtpl:49
+//line app/vmselect/loki/query_response.qtpl:55
 			qw422016.N().S(`]}`)
-//line app/vmselect/loki/query_response.qtpl:51
+//line app/vmselect/loki/query_response.qtpl:57
 		}
-//line app/vmselect/loki/query_response.qtpl:52
+//line app/vmselect/loki/query_response.qtpl:58
 	}
-//line app/vmselect/loki/query_response.qtpl:52
-	qw422016.N().S(`]}}`)
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:58
+	qw422016.N().S(`],"stats":`)
+//line app/vmselect/loki/query_response.qtpl:60
+	streamqueryStats(qw422016, qs)
+//line app/vmselect/loki/query_response.qtpl:60
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_response.qtpl:62
+	qtWrite.Donef("")
+
+//line app/vmselect/loki/query_response.qtpl:63
+	streamqueryTrace(qw422016, qt)
+//line app/vmselect/loki/query_response.qtpl:63
+	qw422016.N().S(`}`)
+//line app/vmselect/loki/query_response.qtpl:65
 }
 
-//line app/vmselect/loki/query_response.qtpl:56
-func WriteStreamsQueryResponse(qq422016 qtio422016.Writer, rs []netstorage.Result) {
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
+func WriteStreamsQueryResponse(qq422016 qtio422016.Writer, rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) {
+//line app/vmselect/loki/query_response.qtpl:65
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line app/vmselect/loki/query_response.qtpl:56
-	StreamStreamsQueryResponse(qw422016, rs)
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
+	StreamStreamsQueryResponse(qw422016, rs, qs, qt)
+//line app/vmselect/loki/query_response.qtpl:65
 	qt422016.ReleaseWriter(qw422016)
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
 }
 
-//line app/vmselect/loki/query_response.qtpl:56
-func StreamsQueryResponse(rs []netstorage.Result) string {
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
+func StreamsQueryResponse(rs []netstorage.Result, qs *netstorage.QueryStats, qt *querytracer.Tracer) string {
+//line app/vmselect/loki/query_response.qtpl:65
 	qb422016 := qt422016.AcquireByteBuffer()
-//line app/vmselect/loki/query_response.qtpl:56
-	WriteStreamsQueryResponse(qb422016, rs)
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
+	WriteStreamsQueryResponse(qb422016, rs, qs, qt)
+//line app/vmselect/loki/query_response.qtpl:65
 	qs422016 := string(qb422016.B)
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
 	qt422016.ReleaseByteBuffer(qb422016)
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
 	return qs422016
-//line app/vmselect/loki/query_response.qtpl:56
+//line app/vmselect/loki/query_response.qtpl:65
 }
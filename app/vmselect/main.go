@@ -8,11 +8,14 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/loki"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/querier"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/ruler"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/scheduler"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
@@ -24,7 +27,6 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
 	"github.com/VictoriaMetrics/metrics"
 )
 
@@ -35,6 +37,8 @@ var (
 		"It shouldn't be high, since a single request can saturate all the CPU cores. See also -search.maxQueueDuration")
 	maxQueueDuration = flag.Duration("search.maxQueueDuration", 10*time.Second, "The maximum time the request waits for execution when -search.maxConcurrentRequests "+
 		"limit is reached; see also -search.maxQueryDuration")
+	maxQueueLengthPerTenant = flag.Int("search.maxQueueLengthPerTenant", 100, "The maximum number of requests per tenant, which may wait for execution "+
+		"when -search.maxConcurrentRequests limit is reached. Queued requests are executed in round-robin order across tenants")
 	minScrapeInterval = flag.Duration("dedup.minScrapeInterval", 0, "Remove superflouos samples from time series if they are located closer to each other than this duration. "+
 		"This may be useful for reducing overhead when multiple identically configured Prometheus instances write data to the same VictoriaMetrics. "+
 		"Deduplication is disabled if the -dedup.minScrapeInterval is 0")
@@ -66,6 +70,9 @@ func main() {
 	logger.Infof("starting netstorage at storageNodes %s", *storageNodes)
 	startTime := time.Now()
 	storage.SetMinScrapeIntervalForDeduplication(*minScrapeInterval)
+	if err := searchutils.InitTenantLimits(); err != nil {
+		logger.Fatalf("%s", err)
+	}
 	if len(*storageNodes) == 0 {
 		logger.Fatalf("missing -storageNode arg")
 	}
@@ -76,10 +83,17 @@ func main() {
 		tmpDataPath := *cacheDataPath + "/tmp"
 		fs.RemoveDirContents(tmpDataPath)
 		netstorage.InitTmpBlocksDir(tmpDataPath)
+		querier.InitRollupResultCache(*cacheDataPath + "/rollupResult")
+		querier.InitStreamResultCache(*cacheDataPath + "/streamResult")
 	} else {
 		netstorage.InitTmpBlocksDir("")
+		querier.InitRollupResultCache("")
+		querier.InitStreamResultCache("")
+	}
+	querySchedulerV = scheduler.New(*maxConcurrentRequests, *maxQueueLengthPerTenant)
+	if err := ruler.Init(); err != nil {
+		logger.Fatalf("cannot start ruler: %s", err)
 	}
-	concurrencyCh = make(chan struct{}, *maxConcurrentRequests)
 
 	go func() {
 		httpserver.Serve(*httpListenAddr, requestHandler)
@@ -95,28 +109,34 @@ func main() {
 	}
 	logger.Infof("successfully shut down http service in %.3f seconds", time.Since(startTime).Seconds())
 
+	ruler.Stop()
+
 	logger.Infof("shutting down neststorage...")
 	startTime = time.Now()
 	netstorage.Stop()
 
 	logger.Infof("successfully stopped netstorage in %.3f seconds", time.Since(startTime).Seconds())
 
+	querier.StopRollupResultCache()
+	querier.StopStreamResultCache()
+
 	fs.MustStopDirRemover()
 
 	logger.Infof("the vmselect has been stopped")
 }
 
-var concurrencyCh chan struct{}
+// querySchedulerV limits the number of concurrent queries and fairly shares them among tenants.
+var querySchedulerV *scheduler.Scheduler
 
 var (
-	concurrencyLimitReached = metrics.NewCounter(`vm_concurrent_select_limit_reached_total`)
-	concurrencyLimitTimeout = metrics.NewCounter(`vm_concurrent_select_limit_timeout_total`)
-
 	_ = metrics.NewGauge(`vm_concurrent_select_capacity`, func() float64 {
-		return float64(cap(concurrencyCh))
+		return float64(querySchedulerV.Capacity())
 	})
 	_ = metrics.NewGauge(`vm_concurrent_select_current`, func() float64 {
-		return float64(len(concurrencyCh))
+		return float64(querySchedulerV.Running())
+	})
+	_ = metrics.NewGauge(`vm_concurrent_select_queued`, func() float64 {
+		return float64(querySchedulerV.Queued())
 	})
 )
 
@@ -126,39 +146,16 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	}
 	startTime := time.Now()
-	// Limit the number of concurrent queries.
-	select {
-	case concurrencyCh <- struct{}{}:
-		defer func() { <-concurrencyCh }()
-	default:
-		// Sleep for a while until giving up. This should resolve short bursts in requests.
-		concurrencyLimitReached.Inc()
-		d := searchutils.GetMaxQueryDuration(r)
-		if d > *maxQueueDuration {
-			d = *maxQueueDuration
-		}
-		t := timerpool.Get(d)
-		select {
-		case concurrencyCh <- struct{}{}:
-			timerpool.Put(t)
-			defer func() { <-concurrencyCh }()
-		case <-t.C:
-			timerpool.Put(t)
-			concurrencyLimitTimeout.Inc()
-			err := &httpserver.ErrorWithStatusCode{
-				Err: fmt.Errorf("cannot handle more than %d concurrent search requests during %s; possible solutions: "+
-					"increase `-search.maxQueueDuration`; increase `-search.maxQueryDuration`; increase `-search.maxConcurrentRequests`; "+
-					"increase server capacity",
-					*maxConcurrentRequests, d),
-				StatusCode: http.StatusServiceUnavailable,
-			}
+	path := strings.Replace(r.URL.Path, "//", "/", -1)
+	if path == "/internal/resetRollupResultCache" {
+		resetRollupResultCacheRequests.Inc()
+		if err := loki.ResetRollupResultCacheHandler(w, r); err != nil {
+			resetRollupResultCacheErrors.Inc()
 			httpserver.Errorf(w, r, "%s", err)
-			return true
 		}
+		return true
 	}
 
-	path := strings.Replace(r.URL.Path, "//", "/", -1)
-
 	p, err := httpserver.ParsePath(path)
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot parse path %q: %s", path, err)
@@ -169,9 +166,43 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		httpserver.Errorf(w, r, "auth error: %s", err)
 		return true
 	}
+	if p.Prefix != "select" && p.Prefix != "delete" {
+		// This is not our link
+		return false
+	}
+
+	// Limit the number of concurrent queries. Queued queries are executed in round-robin order across tenants,
+	// so a single tenant cannot starve the remaining tenants.
+	d := searchutils.GetMaxQueryDuration(r)
+	if d > *maxQueueDuration {
+		d = *maxQueueDuration
+	}
+	if err := querySchedulerV.Acquire(at, d); err != nil {
+		statusCode := http.StatusServiceUnavailable
+		var qfe *scheduler.QueueFullError
+		if errors.As(err, &qfe) {
+			statusCode = http.StatusTooManyRequests
+		}
+		err := &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("cannot handle more than %d concurrent search requests for tenant %d:%d: %s; possible solutions: "+
+				"increase `-search.maxQueueDuration`; increase `-search.maxQueueLengthPerTenant`; increase `-search.maxQueryDuration`; "+
+				"increase `-search.maxConcurrentRequests`; increase server capacity",
+				*maxConcurrentRequests, at.AccountID, at.ProjectID, err),
+			StatusCode: statusCode,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+	// Long-running requests such as tail may release the slot before they are finished.
+	var releaseOnce sync.Once
+	releaseQuerySlot := func() {
+		releaseOnce.Do(querySchedulerV.Release)
+	}
+	defer releaseQuerySlot()
+
 	switch p.Prefix {
 	case "select":
-		return selectHandler(startTime, w, r, p, at)
+		return selectHandler(startTime, w, r, p, at, releaseQuerySlot)
 	case "delete":
 		return deleteHandler(startTime, w, r, p, at)
 	default:
@@ -180,7 +211,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
-func selectHandler(startTime time.Time, w http.ResponseWriter, r *http.Request, p *httpserver.Path, at *auth.Token) bool {
+func selectHandler(startTime time.Time, w http.ResponseWriter, r *http.Request, p *httpserver.Path, at *auth.Token, releaseQuerySlot func()) bool {
 	if strings.HasPrefix(p.Suffix, "loki/api/v1/label/") {
 		s := p.Suffix[len("loki/api/v1/label/"):]
 		if strings.HasSuffix(s, "/values") {
@@ -215,15 +246,87 @@ func selectHandler(startTime time.Time, w http.ResponseWriter, r *http.Request,
 			return true
 		}
 		return true
+	case "loki/api/v1/context":
+		contextRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.ContextHandler(startTime, at, w, r); err != nil {
+			contextErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "loki/api/v1/index/stats":
+		indexStatsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.IndexStatsHandler(startTime, at, w, r); err != nil {
+			indexStatsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "loki/api/v1/index/volume":
+		indexVolumeRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.IndexVolumeHandler(startTime, at, w, r); err != nil {
+			indexVolumeErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "loki/api/v1/index/volume_range":
+		indexVolumeRangeRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.IndexVolumeRangeHandler(startTime, at, w, r); err != nil {
+			indexVolumeRangeErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "loki/api/v1/detected_fields":
+		detectedFieldsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.DetectedFieldsHandler(startTime, at, w, r); err != nil {
+			detectedFieldsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "loki/api/v1/patterns":
+		patternsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.PatternsHandler(startTime, at, w, r); err != nil {
+			patternsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "loki/api/v1/explain":
+		explainRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.ExplainHandler(startTime, at, w, r); err != nil {
+			explainErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "loki/api/v1/tail":
 		tailRequests.Inc()
 		httpserver.EnableCORS(w, r)
-		if err := loki.TailHandler(startTime, at, w, r); err != nil {
+		if err := loki.TailHandler(startTime, at, w, r, releaseQuerySlot); err != nil {
 			tailErrors.Inc()
 			sendPrometheusError(w, r, err)
 			return true
 		}
 		return true
+	case "loki/api/v1/tail/stream":
+		tailStreamRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.TailStreamHandler(startTime, at, w, r, releaseQuerySlot); err != nil {
+			tailStreamErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "loki/api/v1/series":
 		seriesRequests.Inc()
 		httpserver.EnableCORS(w, r)
@@ -272,6 +375,15 @@ func selectHandler(startTime time.Time, w http.ResponseWriter, r *http.Request,
 		statusActiveQueriesRequests.Inc()
 		querier.WriteActiveQueries(w)
 		return true
+	case "loki/api/v1/status/active_queries/cancel":
+		cancelQueryRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.CancelQueryHandler(at, w, r); err != nil {
+			cancelQueryErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "loki/api/v1/export":
 		exportRequests.Inc()
 		if err := loki.ExportHandler(startTime, at, w, r); err != nil {
@@ -288,6 +400,24 @@ func selectHandler(startTime time.Time, w http.ResponseWriter, r *http.Request,
 			return true
 		}
 		return true
+	case "loki/api/v1/rules":
+		rulesRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.RulesHandler(startTime, at, w, r); err != nil {
+			rulesErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "prometheus/api/v1/alerts":
+		alertsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := loki.AlertsHandler(startTime, at, w, r); err != nil {
+			alertsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "loki/federate":
 		federateRequests.Inc()
 		if err := loki.FederateHandler(startTime, at, w, r); err != nil {
@@ -340,9 +470,39 @@ var (
 	queryRangeRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/query_range"}`)
 	queryRangeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/query_range"}`)
 
+	contextRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/context"}`)
+	contextErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/context"}`)
+
+	indexStatsRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/index/stats"}`)
+	indexStatsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/index/stats"}`)
+
+	indexVolumeRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/index/volume"}`)
+	indexVolumeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/index/volume"}`)
+
+	indexVolumeRangeRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/index/volume_range"}`)
+	indexVolumeRangeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/index/volume_range"}`)
+
+	detectedFieldsRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/detected_fields"}`)
+	detectedFieldsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/detected_fields"}`)
+
+	patternsRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/patterns"}`)
+	patternsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/patterns"}`)
+
+	explainRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/explain"}`)
+	explainErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/explain"}`)
+
 	tailRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/tail"}`)
 	tailErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/tail"}`)
 
+	tailStreamRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/tail/stream"}`)
+	tailStreamErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/tail/stream"}`)
+
+	rulesRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/rules"}`)
+	rulesErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/rules"}`)
+
+	alertsRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/prometheus/api/v1/alerts"}`)
+	alertsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/prometheus/api/v1/alerts"}`)
+
 	seriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/series"}`)
 	seriesErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/series"}`)
 
@@ -360,6 +520,12 @@ var (
 
 	statusActiveQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}v1/api/v1/status/active_queries"}`)
 
+	cancelQueryRequests = metrics.NewCounter(`vm_http_requests_total{path="/select/{}/loki/api/v1/status/active_queries/cancel"}`)
+	cancelQueryErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/select/{}/loki/api/v1/status/active_queries/cancel"}`)
+
+	resetRollupResultCacheRequests = metrics.NewCounter(`vm_http_requests_total{path="/internal/resetRollupResultCache"}`)
+	resetRollupResultCacheErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/internal/resetRollupResultCache"}`)
+
 	deleteRequests = metrics.NewCounter(`vm_http_requests_total{path="/delete/{}/v1/api/v1/admin/tsdb/delete_series"}`)
 	deleteErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/delete/{}/v1/api/v1/admin/tsdb/delete_series"}`)
 
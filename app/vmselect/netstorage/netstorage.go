@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
@@ -23,6 +24,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
 	"github.com/VictoriaMetrics/metrics"
 )
 
@@ -59,6 +61,9 @@ type Results struct {
 	tr        storage.TimeRange
 	fetchData uint8
 	deadline  searchutils.Deadline
+	qs        *QueryStats
+	qt        *querytracer.Tracer
+	qc        *QueryCanceler
 
 	tbf *tmpBlocksFile
 
@@ -85,7 +90,8 @@ type timeseriesWork struct {
 	f        func(rs *Result, workerID uint) error
 	doneCh   chan error
 
-	rowsProcessed int
+	rowsProcessed  int
+	bytesProcessed int
 }
 
 func init() {
@@ -103,6 +109,10 @@ func timeseriesWorker(workerID uint) {
 			tsw.doneCh <- fmt.Errorf("timeout exceeded during query execution: %s", rss.deadline.String())
 			continue
 		}
+		if rss.qc.IsCanceled() {
+			tsw.doneCh <- ErrQueryCanceled
+			continue
+		}
 		if atomic.LoadUint64(&tsw.mustStop) != 0 {
 			tsw.doneCh <- nil
 			continue
@@ -118,6 +128,10 @@ func timeseriesWorker(workerID uint) {
 			}
 		}
 		tsw.rowsProcessed = len(rs.Values)
+		tsw.bytesProcessed = 0
+		for _, data := range rs.Datas {
+			tsw.bytesProcessed += len(data)
+		}
 		tsw.doneCh <- nil
 		currentTime := fasttime.UnixTimestamp()
 		if cap(rs.Values) > 1024*1024 && 4*len(rs.Values) < cap(rs.Values) && currentTime-rsLastResetTime > 10 {
@@ -136,6 +150,7 @@ func timeseriesWorker(workerID uint) {
 //
 // rss becomes unusable after the call to RunParallel.
 func (rss *Results) RunParallel(f func(rs *Result, workerID uint) error) error {
+	qt := rss.qt.NewChild("parallel process of fetched data")
 	defer func() {
 		putTmpBlocksFile(rss.tbf)
 		rss.tbf = nil
@@ -159,6 +174,7 @@ func (rss *Results) RunParallel(f func(rs *Result, workerID uint) error) error {
 	// Wait until work is complete.
 	var firstErr error
 	rowsProcessedTotal := 0
+	bytesProcessedTotal := 0
 	for _, tsw := range tsws {
 		if err := <-tsw.doneCh; err != nil && firstErr == nil {
 			// Return just the first error, since other errors
@@ -170,7 +186,10 @@ func (rss *Results) RunParallel(f func(rs *Result, workerID uint) error) error {
 			}
 		}
 		rowsProcessedTotal += tsw.rowsProcessed
+		bytesProcessedTotal += tsw.bytesProcessed
 	}
+	rss.qs.addUnpacked(uint64(rowsProcessedTotal), uint64(bytesProcessedTotal))
+	qt.Donef("series=%d, rows=%d, bytes=%d", seriesProcessedTotal, rowsProcessedTotal, bytesProcessedTotal)
 
 	perQueryRowsProcessed.Update(float64(rowsProcessedTotal))
 	perQuerySeriesProcessed.Update(float64(seriesProcessedTotal))
@@ -978,6 +997,230 @@ func GetSeriesCount(at *auth.Token, deadline searchutils.Deadline) (uint64, bool
 	return n, isPartialResult, nil
 }
 
+// GetIndexStats returns index stats for the given sq from all the vmstorage nodes.
+//
+// The stats are summed across vmstorage nodes.
+func GetIndexStats(at *auth.Token, sq *storage.SearchQuery, deadline searchutils.Deadline) (*storage.IndexStats, bool, error) {
+	if deadline.Exceeded() {
+		return nil, false, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	requestData := sq.Marshal(nil)
+
+	// Send the query to all the storage nodes in parallel.
+	type nodeResult struct {
+		stats *storage.IndexStats
+		err   error
+	}
+	resultsCh := make(chan nodeResult, len(storageNodes))
+	for _, sn := range storageNodes {
+		go func(sn *storageNode) {
+			sn.indexStatsRequests.Inc()
+			stats, err := sn.getIndexStats(requestData, deadline)
+			if err != nil {
+				sn.indexStatsRequestErrors.Inc()
+				err = fmt.Errorf("cannot get index stats from vmstorage %s: %w", sn.connPool.Addr(), err)
+			}
+			resultsCh <- nodeResult{
+				stats: stats,
+				err:   err,
+			}
+		}(sn)
+	}
+
+	// Collect results
+	var stats storage.IndexStats
+	var errors []error
+	for i := 0; i < len(storageNodes); i++ {
+		// There is no need in timer here, since all the goroutines executing
+		// sn.getIndexStats must be finished until the deadline.
+		nr := <-resultsCh
+		if nr.err != nil {
+			errors = append(errors, nr.err)
+			continue
+		}
+		stats.Add(nr.stats)
+	}
+	isPartialResult := false
+	if len(errors) > 0 {
+		if len(errors) == len(storageNodes) {
+			// Return only the first error, since it has no sense in returning all errors.
+			return nil, true, fmt.Errorf("error occured during fetching index stats: %w", errors[0])
+		}
+		// Just log errors and return partial results.
+		// This allows gracefully degrade vmselect in the case
+		// if certain storageNodes are temporarily unavailable.
+		partialIndexStatsResults.Inc()
+		// Log only the first error, since it has no sense in returning all errors.
+		logger.Errorf("certain storageNodes are unhealthy when fetching index stats: %s", errors[0])
+		isPartialResult = true
+	}
+
+	return &stats, isPartialResult, nil
+}
+
+// tailRetryInterval is the interval between attempts to re-subscribe to vmstorage node after tail errors.
+const tailRetryInterval = time.Second
+
+// Tail passes log rows matching sq to f as soon as they are added to vmstorage nodes.
+//
+// f is called serially. tb passed to f cannot be used after returning from f.
+// Tail returns when stopCh is closed, the deadline is reached or f returns an error.
+// Subscriptions to unavailable vmstorage nodes are re-established until then.
+func Tail(at *auth.Token, sq *storage.SearchQuery, deadline searchutils.Deadline, stopCh <-chan struct{}, f func(tb *storage.TailBatch) error) error {
+	if deadline.Exceeded() {
+		return fmt.Errorf("timeout exceeded before starting the tail: %s", deadline.String())
+	}
+	requestData := sq.Marshal(nil)
+
+	doneCh := make(chan struct{})
+	var doneOnce sync.Once
+	done := func() {
+		doneOnce.Do(func() {
+			close(doneCh)
+		})
+	}
+	go func() {
+		select {
+		case <-stopCh:
+			done()
+		case <-doneCh:
+		}
+	}()
+
+	var fLock sync.Mutex
+	var fErr error
+	processBatch := func(tb *storage.TailBatch) error {
+		fLock.Lock()
+		defer fLock.Unlock()
+		if fErr != nil {
+			return fErr
+		}
+		if err := f(tb); err != nil {
+			fErr = err
+			done()
+			return err
+		}
+		return nil
+	}
+
+	// Subscribe to all the storage nodes in parallel.
+	var wg sync.WaitGroup
+	for _, sn := range storageNodes {
+		wg.Add(1)
+		go func(sn *storageNode) {
+			defer wg.Done()
+			for {
+				sn.tailRequests.Inc()
+				err := sn.tail(requestData, deadline, doneCh, processBatch)
+				select {
+				case <-doneCh:
+					return
+				default:
+				}
+				if err == nil {
+					// vmstorage node sent the end marker, since the deadline is reached.
+					return
+				}
+				sn.tailRequestErrors.Inc()
+				logger.Warnf("cannot tail vmstorage %s; re-subscribing in %s: %s", sn.connPool.Addr(), tailRetryInterval, err)
+				t := timerpool.Get(tailRetryInterval)
+				select {
+				case <-doneCh:
+					timerpool.Put(t)
+					return
+				case <-t.C:
+					timerpool.Put(t)
+				}
+				if deadline.Exceeded() {
+					return
+				}
+			}
+		}(sn)
+	}
+	wg.Wait()
+	done()
+
+	fLock.Lock()
+	err := fErr
+	fLock.Unlock()
+	return err
+}
+
+// GetIndexVolume returns index volume for the given sq grouped by targetLabels from all the vmstorage nodes.
+//
+// If step is positive, then the volume is additionally grouped by time buckets with step duration.
+// The volume for the same group and time bucket is summed across vmstorage nodes.
+func GetIndexVolume(at *auth.Token, sq *storage.SearchQuery, targetLabels []string, step int64, deadline searchutils.Deadline) ([]storage.IndexVolume, bool, error) {
+	if deadline.Exceeded() {
+		return nil, false, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	requestData := sq.Marshal(nil)
+
+	// Send the query to all the storage nodes in parallel.
+	type nodeResult struct {
+		ivs []storage.IndexVolume
+		err error
+	}
+	resultsCh := make(chan nodeResult, len(storageNodes))
+	for _, sn := range storageNodes {
+		go func(sn *storageNode) {
+			sn.indexVolumeRequests.Inc()
+			ivs, err := sn.getIndexVolume(requestData, targetLabels, step, deadline)
+			if err != nil {
+				sn.indexVolumeRequestErrors.Inc()
+				err = fmt.Errorf("cannot get index volume from vmstorage %s: %w", sn.connPool.Addr(), err)
+			}
+			resultsCh <- nodeResult{
+				ivs: ivs,
+				err: err,
+			}
+		}(sn)
+	}
+
+	// Collect results
+	var ivs []storage.IndexVolume
+	m := make(map[string]int)
+	var key []byte
+	var errors []error
+	for i := 0; i < len(storageNodes); i++ {
+		// There is no need in timer here, since all the goroutines executing
+		// sn.getIndexVolume must be finished until the deadline.
+		nr := <-resultsCh
+		if nr.err != nil {
+			errors = append(errors, nr.err)
+			continue
+		}
+		for j := range nr.ivs {
+			iv := &nr.ivs[j]
+			key = iv.MetricName.Marshal(key[:0])
+			key = encoding.MarshalInt64(key, iv.Timestamp)
+			if idx, ok := m[string(key)]; ok {
+				ivs[idx].Entries += iv.Entries
+				ivs[idx].Bytes += iv.Bytes
+				continue
+			}
+			m[string(key)] = len(ivs)
+			ivs = append(ivs, *iv)
+		}
+	}
+	isPartialResult := false
+	if len(errors) > 0 {
+		if len(errors) == len(storageNodes) {
+			// Return only the first error, since it has no sense in returning all errors.
+			return nil, true, fmt.Errorf("error occured during fetching index volume: %w", errors[0])
+		}
+		// Just log errors and return partial results.
+		// This allows gracefully degrade vmselect in the case
+		// if certain storageNodes are temporarily unavailable.
+		partialIndexVolumeResults.Inc()
+		// Log only the first error, since it has no sense in returning all errors.
+		logger.Errorf("certain storageNodes are unhealthy when fetching index volume: %s", errors[0])
+		isPartialResult = true
+	}
+
+	return ivs, isPartialResult, nil
+}
+
 type tmpBlocksFileWrapper struct {
 	mu                 sync.Mutex
 	tbf                *tmpBlocksFile
@@ -1053,7 +1296,7 @@ func ExportBlocks(at *auth.Token, sq *storage.SearchQuery, deadline searchutils.
 		metricNamePool.Put(mn)
 		return nil
 	}
-	isPartialResult, err := processSearchQuery(at, sq, 1, processBlock, deadline)
+	isPartialResult, err := processSearchQuery(nil, "search_v6", sq.Marshal(nil), 1, 0, false, nil, nil, nil, processBlock, deadline)
 	if err != nil {
 		return true, fmt.Errorf("error occured during export: %w", err)
 	}
@@ -1062,15 +1305,65 @@ func ExportBlocks(at *auth.Token, sq *storage.SearchQuery, deadline searchutils.
 
 // ProcessSearchQuery performs sq until the given deadline.
 //
+// Query execution stats are registered in the optional qs, while the query is traced with the optional qt.
+// The query may be canceled via the optional qc. Tenant limits on the data read by the query are enforced by the optional ql.
+//
 // Results.RunParallel or Results.Cancel must be called on the returned Results.
-func ProcessSearchQuery(at *auth.Token, sq *storage.SearchQuery, fetchData uint8, deadline searchutils.Deadline) (*Results, bool, error) {
-	if deadline.Exceeded() {
-		return nil, false, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
-	}
+func ProcessSearchQuery(qt *querytracer.Tracer, at *auth.Token, sq *storage.SearchQuery, fetchData uint8, qs *QueryStats, qc *QueryCanceler,
+	ql *QueryLimiter, deadline searchutils.Deadline) (*Results, bool, error) {
+	return ProcessSearchQueryWithLimit(qt, at, sq, fetchData, 0, false, qs, qc, ql, deadline)
+}
+
+// ProcessSearchQueryWithLimit performs sq until the given deadline.
+//
+// vmstorage nodes may stop the search after finding at least limit newest rows
+// (or limit oldest rows if forward is set), so the returned Results may contain rows outside of these limits.
+// The caller is responsible for selecting limit rows from the returned Results. Zero limit means no limit.
+//
+// Query execution stats are registered in the optional qs, while the query is traced with the optional qt.
+// The query may be canceled via the optional qc. Tenant limits on the data read by the query are enforced by the optional ql.
+//
+// Results.RunParallel or Results.Cancel must be called on the returned Results.
+func ProcessSearchQueryWithLimit(qt *querytracer.Tracer, at *auth.Token, sq *storage.SearchQuery, fetchData uint8, limit int64, forward bool,
+	qs *QueryStats, qc *QueryCanceler, ql *QueryLimiter, deadline searchutils.Deadline) (*Results, bool, error) {
 	tr := storage.TimeRange{
 		MinTimestamp: sq.MinTimestamp,
 		MaxTimestamp: sq.MaxTimestamp,
 	}
+	return processSearchRequest(qt, at, "search_v6", sq, sq.Marshal(nil), tr, fetchData, limit, forward, qs, qc, ql, deadline)
+}
+
+// ProcessStreamSearchQuery performs ssq until the given deadline.
+//
+// Only blocks for the time series with ssq.MetricName are read from vmstorage nodes,
+// so the search doesn't scan the index for tag filters.
+// See ProcessSearchQueryWithLimit for details on limit and forward args.
+//
+// Results.RunParallel or Results.Cancel must be called on the returned Results.
+func ProcessStreamSearchQuery(qt *querytracer.Tracer, at *auth.Token, ssq *storage.StreamSearchQuery, fetchData uint8, limit int64, forward bool,
+	qs *QueryStats, qc *QueryCanceler, ql *QueryLimiter, deadline searchutils.Deadline) (*Results, bool, error) {
+	tr := storage.TimeRange{
+		MinTimestamp: ssq.MinTimestamp,
+		MaxTimestamp: ssq.MaxTimestamp,
+	}
+	return processSearchRequest(qt, at, "searchStream_v1", ssq, ssq.Marshal(nil), tr, fetchData, limit, forward, qs, qc, ql, deadline)
+}
+
+// processSearchRequest sends requestData for the given rpcName to vmstorage nodes and collects the found blocks into Results.
+//
+// q is the search query for requestData. It is used for tracing.
+func processSearchRequest(qt *querytracer.Tracer, at *auth.Token, rpcName string, q fmt.Stringer, requestData []byte, tr storage.TimeRange,
+	fetchData uint8, limit int64, forward bool, qs *QueryStats, qc *QueryCanceler, ql *QueryLimiter, deadline searchutils.Deadline) (*Results, bool, error) {
+	if deadline.Exceeded() {
+		return nil, false, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	if qc.IsCanceled() {
+		return nil, false, ErrQueryCanceled
+	}
+	if err := ql.Error(); err != nil {
+		// The query already exceeded tenant limits in the previous requests.
+		return nil, false, err
+	}
 	tbfw := &tmpBlocksFileWrapper{
 		tbf: getTmpBlocksFile(),
 		m:   make(map[string][]tmpBlockAddr),
@@ -1078,19 +1371,30 @@ func ProcessSearchQuery(at *auth.Token, sq *storage.SearchQuery, fetchData uint8
 	processBlock := func(mb *storage.MetricBlock) error {
 		if fetchData == 0 {
 			tbfw.RegisterEmptyBlock(mb)
-			return nil
-		}
-		if err := tbfw.RegisterAndWriteBlock(mb); err != nil {
+		} else if err := tbfw.RegisterAndWriteBlock(mb); err != nil {
 			return fmt.Errorf("cannot write MetricBlock to temporary blocks file: %w", err)
 		}
-		return nil
+		return ql.registerStream(mb.MetricName)
+	}
+	qtFetch := qt.NewChild("fetch matching series: %s, fetchData=%d, limit=%d, forward=%v", q, fetchData, limit, forward)
+	startTime := time.Now()
+	isPartialResult, err := processSearchQuery(qtFetch, rpcName, requestData, fetchData, limit, forward, qs, qc, ql, processBlock, deadline)
+	qs.addStorageDuration(time.Since(startTime))
+	if qc.IsCanceled() {
+		// Do not return partial results for the canceled query.
+		err = ErrQueryCanceled
+	}
+	if errLimit := ql.Error(); errLimit != nil {
+		// Do not return partial results for the query exceeding tenant limits.
+		err = errLimit
 	}
-	isPartialResult, err := processSearchQuery(at, sq, fetchData, processBlock, deadline)
 	if err != nil {
+		qtFetch.Donef("error: %s", err)
 		putTmpBlocksFile(tbfw.tbf)
 		return nil, true, fmt.Errorf("error occured during search: %w", err)
 	}
 	if err := tbfw.tbf.Finalize(); err != nil {
+		qtFetch.Donef("error: %s", err)
 		putTmpBlocksFile(tbfw.tbf)
 		return nil, false, fmt.Errorf("cannot finalize temporary blocks file with %d time series: %w", len(tbfw.m), err)
 	}
@@ -1100,6 +1404,9 @@ func ProcessSearchQuery(at *auth.Token, sq *storage.SearchQuery, fetchData uint8
 	rss.tr = tr
 	rss.fetchData = fetchData
 	rss.deadline = deadline
+	rss.qs = qs
+	rss.qt = qt
+	rss.qc = qc
 	rss.tbf = tbfw.tbf
 	pts := make([]packedTimeseries, len(tbfw.orderedMetricNames))
 	for i, metricName := range tbfw.orderedMetricNames {
@@ -1109,18 +1416,18 @@ func ProcessSearchQuery(at *auth.Token, sq *storage.SearchQuery, fetchData uint8
 		}
 	}
 	rss.packedTimeseries = pts
+	qtFetch.Donef("series=%d, isPartial=%v", len(pts), isPartialResult)
 	return &rss, isPartialResult, nil
 }
 
-func processSearchQuery(at *auth.Token, sq *storage.SearchQuery, fetchData uint8, processBlock func(mb *storage.MetricBlock) error, deadline searchutils.Deadline) (bool, error) {
-	requestData := sq.Marshal(nil)
-
+func processSearchQuery(qt *querytracer.Tracer, rpcName string, requestData []byte, fetchData uint8, limit int64, forward bool, qs *QueryStats,
+	qc *QueryCanceler, ql *QueryLimiter, processBlock func(mb *storage.MetricBlock) error, deadline searchutils.Deadline) (bool, error) {
 	// Send the query to all the storage nodes in parallel.
 	resultsCh := make(chan error, len(storageNodes))
 	for _, sn := range storageNodes {
 		go func(sn *storageNode) {
 			sn.searchRequests.Inc()
-			err := sn.processSearchQuery(requestData, fetchData, processBlock, deadline)
+			err := sn.processSearchQuery(qt, rpcName, requestData, fetchData, limit, forward, qs, qc, ql, processBlock, deadline)
 			if err != nil {
 				sn.searchRequestErrors.Inc()
 				err = fmt.Errorf("cannot perform search on vmstorage %s: %w", sn.connPool.Addr(), err)
@@ -1153,6 +1460,7 @@ func processSearchQuery(at *auth.Token, sq *storage.SearchQuery, fetchData uint8
 		// Do not return the error, since it may spam logs on busy vmselect
 		// serving high amount of requests.
 		partialSearchResults.Inc()
+		qs.setPartial()
 		isPartialResult = true
 	}
 	return isPartialResult, nil
@@ -1200,6 +1508,24 @@ type storageNode struct {
 	// The number of errors during requests to tsdb status.
 	tsdbStatusRequestErrors *metrics.Counter
 
+	// The number of requests to indexStats.
+	indexStatsRequests *metrics.Counter
+
+	// The number of errors during requests to indexStats.
+	indexStatsRequestErrors *metrics.Counter
+
+	// The number of requests to indexVolume.
+	indexVolumeRequests *metrics.Counter
+
+	// The number of errors during requests to indexVolume.
+	indexVolumeRequestErrors *metrics.Counter
+
+	// The number of requests to tail.
+	tailRequests *metrics.Counter
+
+	// The number of errors during requests to tail.
+	tailRequestErrors *metrics.Counter
+
 	// The number of requests to seriesCount.
 	seriesCountRequests *metrics.Counter
 
@@ -1360,23 +1686,159 @@ func (sn *storageNode) getSeriesCount(accountID, projectID uint32, deadline sear
 	return n, nil
 }
 
-func (sn *storageNode) processSearchQuery(requestData []byte, fetchData uint8, processBlock func(mb *storage.MetricBlock) error, deadline searchutils.Deadline) error {
+func (sn *storageNode) getIndexStats(requestData []byte, deadline searchutils.Deadline) (*storage.IndexStats, error) {
+	var stats *storage.IndexStats
+	f := func(bc *handshake.BufferedConn) error {
+		st, err := sn.getIndexStatsOnConn(bc, requestData)
+		if err != nil {
+			return err
+		}
+		stats = st
+		return nil
+	}
+	if err := sn.execOnConn("indexStats_v1", f, deadline); err != nil {
+		// Try again before giving up.
+		stats = nil
+		if err = sn.execOnConn("indexStats_v1", f, deadline); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func (sn *storageNode) getIndexVolume(requestData []byte, targetLabels []string, step int64, deadline searchutils.Deadline) ([]storage.IndexVolume, error) {
+	var ivs []storage.IndexVolume
+	f := func(bc *handshake.BufferedConn) error {
+		result, err := sn.getIndexVolumeOnConn(bc, requestData, targetLabels, step)
+		if err != nil {
+			return err
+		}
+		ivs = result
+		return nil
+	}
+	if err := sn.execOnConn("indexVolume_v1", f, deadline); err != nil {
+		// Try again before giving up.
+		ivs = nil
+		if err = sn.execOnConn("indexVolume_v1", f, deadline); err != nil {
+			return nil, err
+		}
+	}
+	return ivs, nil
+}
+
+// tail subscribes to log rows matching the search query from requestData at sn and passes them to f.
+//
+// The tail isn't executed via execOnConn, since it holds the connection until the deadline
+// and it mustn't occupy slots for concurrent queries. The connection is closed when stopCh is closed.
+func (sn *storageNode) tail(requestData []byte, deadline searchutils.Deadline, stopCh <-chan struct{}, f func(tb *storage.TailBatch) error) error {
+	timeout := time.Until(time.Unix(int64(deadline.Deadline()), 0))
+	if timeout <= 0 {
+		return nil
+	}
+	bc, err := sn.connPool.Get()
+	if err != nil {
+		return fmt.Errorf("cannot obtain connection from a pool: %w", err)
+	}
+	// The connection cannot be returned to the pool, since vmstorage may continue sending rows to it.
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-stopCh:
+		case <-doneCh:
+		}
+		_ = bc.Close()
+	}()
+
+	if err := bc.SetDeadline(time.Now().Add(tailReadTimeout)); err != nil {
+		return fmt.Errorf("cannot set connection deadline: %w", err)
+	}
+	if err := writeBytes(bc, []byte("tail_v1")); err != nil {
+		return fmt.Errorf("cannot send rpcName to the server: %w", err)
+	}
+	if err := writeUint32(bc, uint32(timeout.Seconds()+1)); err != nil {
+		return fmt.Errorf("cannot send timeout=%s to the server: %w", timeout, err)
+	}
+	if err := writeBytes(bc, requestData); err != nil {
+		return fmt.Errorf("cannot write requestData: %w", err)
+	}
+	if err := bc.Flush(); err != nil {
+		return fmt.Errorf("cannot flush tail args to conn: %w", err)
+	}
+
+	// Read response error.
+	buf, err := readBytes(nil, bc, maxErrorMessageSize)
+	if err != nil {
+		return fmt.Errorf("cannot read error message: %w", err)
+	}
+	if len(buf) > 0 {
+		return newErrRemote(buf)
+	}
+
+	// Read batches until the end marker.
+	// vmstorage sends empty batches every second, so the read deadline detects broken connections.
+	var tb storage.TailBatch
+	for {
+		if err := bc.SetReadDeadline(time.Now().Add(tailReadTimeout)); err != nil {
+			return fmt.Errorf("cannot set read deadline: %w", err)
+		}
+		buf, err = readBytes(buf, bc, maxTailBatchSize)
+		if err != nil {
+			return fmt.Errorf("cannot read tail batch: %w", err)
+		}
+		if len(buf) == 0 {
+			// Reached the end of the tail.
+			return nil
+		}
+		if err := tb.Unmarshal(buf); err != nil {
+			return fmt.Errorf("cannot unmarshal tail batch: %w", err)
+		}
+		if tb.Len() == 0 {
+			continue
+		}
+		if err := f(&tb); err != nil {
+			return err
+		}
+	}
+}
+
+const (
+	// tailReadTimeout is the maximum duration between batches sent by vmstorage for tail requests.
+	tailReadTimeout = 10 * time.Second
+
+	// maxTailBatchSize is the maximum size of a single batch sent by vmstorage for tail requests.
+	maxTailBatchSize = 16 * 1024 * 1024
+)
+
+func (sn *storageNode) processSearchQuery(qt *querytracer.Tracer, rpcName string, requestData []byte, fetchData uint8, limit int64, forward bool, qs *QueryStats,
+	qc *QueryCanceler, ql *QueryLimiter, processBlock func(mb *storage.MetricBlock) error, deadline searchutils.Deadline) error {
+	qt = qt.NewChild("rpc call %s() at vmstorage %s", rpcName, sn.connPool.Addr())
+	var sns StorageNodeStats
+	startTime := time.Now()
+	defer func() {
+		qs.addStorageNodeStats(sn.connPool.Addr(), sns.BlocksRead, sns.RowsRead, sns.BytesRead, time.Since(startTime))
+		qt.Donef("blocks=%d, rows=%d, bytes=%d", sns.BlocksRead, sns.RowsRead, sns.BytesRead)
+	}()
 	var blocksRead int
 	f := func(bc *handshake.BufferedConn) error {
-		n, err := sn.processSearchQueryOnConn(bc, requestData, fetchData, processBlock)
+		stopInterrupt := qc.interruptConnOnCancel(bc)
+		n, err := sn.processSearchQueryOnConn(bc, requestData, fetchData, limit, forward, &sns, ql, processBlock)
+		stopInterrupt()
 		if err != nil {
+			if qc.IsCanceled() {
+				return ErrQueryCanceled
+			}
 			return err
 		}
 		blocksRead = n
 		return nil
 	}
-	if err := sn.execOnConn("search_v5", f, deadline); err != nil && blocksRead == 0 {
+	err := sn.execOnConn(rpcName, f, deadline)
+	if err != nil && blocksRead == 0 && !qc.IsCanceled() && ql.Error() == nil {
 		// Try again before giving up if zero blocks read on the previous attempt.
-		if err = sn.execOnConn("search_v5", f, deadline); err != nil {
-			return err
-		}
+		err = sn.execOnConn(rpcName, f, deadline)
 	}
-	return nil
+	return err
 }
 
 func (sn *storageNode) execOnConn(rpcName string, f func(bc *handshake.BufferedConn) error, deadline searchutils.Deadline) error {
@@ -1773,6 +2235,88 @@ func (sn *storageNode) getSeriesCountOnConn(bc *handshake.BufferedConn, accountI
 	return n, nil
 }
 
+func (sn *storageNode) getIndexStatsOnConn(bc *handshake.BufferedConn, requestData []byte) (*storage.IndexStats, error) {
+	// Send the request to sn.
+	if err := writeBytes(bc, requestData); err != nil {
+		return nil, fmt.Errorf("cannot write requestData: %w", err)
+	}
+	if err := bc.Flush(); err != nil {
+		return nil, fmt.Errorf("cannot flush indexStats args to conn: %w", err)
+	}
+
+	// Read response error.
+	buf, err := readBytes(nil, bc, maxErrorMessageSize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read error message: %w", err)
+	}
+	if len(buf) > 0 {
+		return nil, newErrRemote(buf)
+	}
+
+	// Read response
+	var stats storage.IndexStats
+	for _, p := range []*uint64{&stats.Streams, &stats.Chunks, &stats.Entries, &stats.Bytes} {
+		n, err := readUint64(bc)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read index stats: %w", err)
+		}
+		*p = n
+	}
+	return &stats, nil
+}
+
+func (sn *storageNode) getIndexVolumeOnConn(bc *handshake.BufferedConn, requestData []byte, targetLabels []string, step int64) ([]storage.IndexVolume, error) {
+	// Send the request to sn.
+	if err := writeBytes(bc, requestData); err != nil {
+		return nil, fmt.Errorf("cannot write requestData: %w", err)
+	}
+	if err := writeUint32(bc, uint32(len(targetLabels))); err != nil {
+		return nil, fmt.Errorf("cannot write the number of target labels: %w", err)
+	}
+	for _, label := range targetLabels {
+		if err := writeBytes(bc, []byte(label)); err != nil {
+			return nil, fmt.Errorf("cannot write target label %q: %w", label, err)
+		}
+	}
+	if err := writeUint64(bc, uint64(step)); err != nil {
+		return nil, fmt.Errorf("cannot write step=%d: %w", step, err)
+	}
+	if err := bc.Flush(); err != nil {
+		return nil, fmt.Errorf("cannot flush indexVolume args to conn: %w", err)
+	}
+
+	// Read response error.
+	buf, err := readBytes(nil, bc, maxErrorMessageSize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read error message: %w", err)
+	}
+	if len(buf) > 0 {
+		return nil, newErrRemote(buf)
+	}
+
+	// Read response
+	var ivs []storage.IndexVolume
+	for {
+		buf, err = readBytes(buf[:0], bc, maxMetricBlockSize)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read IndexVolume: %w", err)
+		}
+		if len(buf) == 0 {
+			// Reached the end of the response
+			return ivs, nil
+		}
+		ivs = append(ivs, storage.IndexVolume{})
+		iv := &ivs[len(ivs)-1]
+		tail, err := iv.Unmarshal(buf)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal IndexVolume: %w", err)
+		}
+		if len(tail) > 0 {
+			return nil, fmt.Errorf("non-empty tail after unmarshaling IndexVolume: (len=%d) %q", len(tail), tail)
+		}
+	}
+}
+
 // maxMetricBlockSize is the maximum size of serialized MetricBlock.
 const maxMetricBlockSize = 1024 * 1024
 
@@ -1780,7 +2324,8 @@ const maxMetricBlockSize = 1024 * 1024
 // from vmstorage.
 const maxErrorMessageSize = 64 * 1024
 
-func (sn *storageNode) processSearchQueryOnConn(bc *handshake.BufferedConn, requestData []byte, fetchData uint8, processBlock func(mb *storage.MetricBlock) error) (int, error) {
+func (sn *storageNode) processSearchQueryOnConn(bc *handshake.BufferedConn, requestData []byte, fetchData uint8, limit int64, forward bool,
+	sns *StorageNodeStats, ql *QueryLimiter, processBlock func(mb *storage.MetricBlock) error) (int, error) {
 	// Send the request to sn.
 	if err := writeBytes(bc, requestData); err != nil {
 		return 0, fmt.Errorf("cannot write requestData: %w", err)
@@ -1788,6 +2333,12 @@ func (sn *storageNode) processSearchQueryOnConn(bc *handshake.BufferedConn, requ
 	if err := writeByte(bc, fetchData); err != nil {
 		return 0, fmt.Errorf("cannot write fetchData=%v: %w", fetchData, err)
 	}
+	if err := writeUint64(bc, uint64(limit)); err != nil {
+		return 0, fmt.Errorf("cannot write limit=%d: %w", limit, err)
+	}
+	if err := writeBool(bc, forward); err != nil {
+		return 0, fmt.Errorf("cannot write forward=%v: %w", forward, err)
+	}
 	if err := bc.Flush(); err != nil {
 		return 0, fmt.Errorf("cannot flush requestData to conn: %w", err)
 	}
@@ -1826,6 +2377,12 @@ func (sn *storageNode) processSearchQueryOnConn(bc *handshake.BufferedConn, requ
 		blocksRead++
 		sn.metricBlocksRead.Inc()
 		sn.metricRowsRead.Add(mb.Block.RowsCount())
+		sns.BlocksRead++
+		sns.RowsRead += uint64(mb.Block.RowsCount())
+		sns.BytesRead += uint64(len(buf))
+		if err := ql.registerBlock(uint64(mb.Block.RowsCount()), uint64(len(buf))); err != nil {
+			return blocksRead, err
+		}
 		if err := processBlock(&mb); err != nil {
 			return blocksRead, fmt.Errorf("cannot process MetricBlock #%d: %w", blocksRead, err)
 		}
@@ -1860,6 +2417,15 @@ func writeByte(bc *handshake.BufferedConn, b byte) error {
 	return err
 }
 
+func writeBool(bc *handshake.BufferedConn, b bool) error {
+	var buf [1]byte
+	if b {
+		buf[0] = 1
+	}
+	_, err := bc.Write(buf[:])
+	return err
+}
+
 func sendAccountIDProjectID(bc *handshake.BufferedConn, accountID, projectID uint32) error {
 	if err := writeUint32(bc, accountID); err != nil {
 		return fmt.Errorf("cannot send accountID=%d to conn: %w", accountID, err)
@@ -1925,6 +2491,12 @@ func InitStorageNodes(addrs []string) {
 			tagValueSuffixesRequestErrors: metrics.NewCounter(fmt.Sprintf(`vm_request_errors_total{action="tagValueSuffixes", type="rpcClient", name="vmselect", addr=%q}`, addr)),
 			tsdbStatusRequests:            metrics.NewCounter(fmt.Sprintf(`vm_requests_total{action="tsdbStatus", type="rpcClient", name="vmselect", addr=%q}`, addr)),
 			tsdbStatusRequestErrors:       metrics.NewCounter(fmt.Sprintf(`vm_request_errors_total{action="tsdbStatus", type="rpcClient", name="vmselect", addr=%q}`, addr)),
+			indexStatsRequests:            metrics.NewCounter(fmt.Sprintf(`vm_requests_total{action="indexStats", type="rpcClient", name="vmselect", addr=%q}`, addr)),
+			indexStatsRequestErrors:       metrics.NewCounter(fmt.Sprintf(`vm_request_errors_total{action="indexStats", type="rpcClient", name="vmselect", addr=%q}`, addr)),
+			indexVolumeRequests:           metrics.NewCounter(fmt.Sprintf(`vm_requests_total{action="indexVolume", type="rpcClient", name="vmselect", addr=%q}`, addr)),
+			indexVolumeRequestErrors:      metrics.NewCounter(fmt.Sprintf(`vm_request_errors_total{action="indexVolume", type="rpcClient", name="vmselect", addr=%q}`, addr)),
+			tailRequests:                  metrics.NewCounter(fmt.Sprintf(`vm_requests_total{action="tail", type="rpcClient", name="vmselect", addr=%q}`, addr)),
+			tailRequestErrors:             metrics.NewCounter(fmt.Sprintf(`vm_request_errors_total{action="tail", type="rpcClient", name="vmselect", addr=%q}`, addr)),
 			seriesCountRequests:           metrics.NewCounter(fmt.Sprintf(`vm_requests_total{action="seriesCount", type="rpcClient", name="vmselect", addr=%q}`, addr)),
 			seriesCountRequestErrors:      metrics.NewCounter(fmt.Sprintf(`vm_request_errors_total{action="seriesCount", type="rpcClient", name="vmselect", addr=%q}`, addr)),
 			searchRequests:                metrics.NewCounter(fmt.Sprintf(`vm_requests_total{action="search", type="rpcClient", name="vmselect", addr=%q}`, addr)),
@@ -1950,6 +2522,8 @@ var (
 	partialLabelEntriesResults = metrics.NewCounter(`vm_partial_label_entries_results_total{name="vmselect"}`)
 	partialTSDBStatusResults   = metrics.NewCounter(`vm_partial_tsdb_status_results_total{name="vmselect"}`)
 	partialSeriesCountResults  = metrics.NewCounter(`vm_partial_series_count_results_total{name="vmselect"}`)
+	partialIndexStatsResults   = metrics.NewCounter(`vm_partial_index_stats_results_total{name="vmselect"}`)
+	partialIndexVolumeResults  = metrics.NewCounter(`vm_partial_index_volume_results_total{name="vmselect"}`)
 	partialSearchResults       = metrics.NewCounter(`vm_partial_search_results_total{name="vmselect"}`)
 )
 
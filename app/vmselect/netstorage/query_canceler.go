@@ -0,0 +1,78 @@
+package netstorage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/handshake"
+)
+
+// ErrQueryCanceled is returned when the query is canceled via QueryCanceler.Cancel.
+var ErrQueryCanceled = errors.New("the query has been canceled")
+
+// QueryCanceler allows canceling the running query.
+//
+// All the QueryCanceler methods may be called on nil QueryCanceler, which cannot be canceled.
+// QueryCanceler may be used from concurrently running goroutines.
+type QueryCanceler struct {
+	once     sync.Once
+	cancelCh chan struct{}
+}
+
+// NewQueryCanceler returns new QueryCanceler.
+func NewQueryCanceler() *QueryCanceler {
+	return &QueryCanceler{
+		cancelCh: make(chan struct{}),
+	}
+}
+
+// Cancel cancels the query.
+//
+// Open vmstorage connections for the query are interrupted, so vmstorage nodes stop sending data for the query.
+func (qc *QueryCanceler) Cancel() {
+	if qc == nil {
+		return
+	}
+	qc.once.Do(func() {
+		close(qc.cancelCh)
+	})
+}
+
+// IsCanceled returns true if the query has been canceled.
+func (qc *QueryCanceler) IsCanceled() bool {
+	if qc == nil {
+		return false
+	}
+	select {
+	case <-qc.cancelCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// interruptConnOnCancel interrupts I/O on bc if qc is canceled until the returned stop func is called.
+//
+// The stop func must be called before returning bc to the pool.
+func (qc *QueryCanceler) interruptConnOnCancel(bc *handshake.BufferedConn) func() {
+	if qc == nil {
+		return func() {}
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		select {
+		case <-qc.cancelCh:
+			// Pending reads and writes fail immediately after the deadline in the past is set.
+			// The connection is closed by execOnConn after the failure.
+			_ = bc.SetDeadline(time.Now())
+		case <-stopCh:
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+	}
+}
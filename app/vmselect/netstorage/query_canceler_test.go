@@ -0,0 +1,89 @@
+package netstorage
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/handshake"
+)
+
+func TestQueryCancelerNil(t *testing.T) {
+	var qc *QueryCanceler
+	qc.Cancel()
+	if qc.IsCanceled() {
+		t.Fatalf("nil QueryCanceler cannot be canceled")
+	}
+	stop := qc.interruptConnOnCancel(nil)
+	stop()
+}
+
+func TestQueryCancelerCancel(t *testing.T) {
+	qc := NewQueryCanceler()
+	if qc.IsCanceled() {
+		t.Fatalf("unexpected canceled state for new QueryCanceler")
+	}
+	qc.Cancel()
+	if !qc.IsCanceled() {
+		t.Fatalf("expecting canceled state after Cancel call")
+	}
+
+	// Cancel may be called multiple times.
+	qc.Cancel()
+	if !qc.IsCanceled() {
+		t.Fatalf("expecting canceled state after the second Cancel call")
+	}
+}
+
+func TestQueryCancelerInterruptConn(t *testing.T) {
+	c, cRemote := net.Pipe()
+	defer func() {
+		_ = c.Close()
+		_ = cRemote.Close()
+	}()
+	bc := &handshake.BufferedConn{
+		Conn: c,
+	}
+	qc := NewQueryCanceler()
+	stop := qc.interruptConnOnCancel(bc)
+	readErrCh := make(chan error, 1)
+	go func() {
+		var buf [1]byte
+		_, err := bc.Conn.Read(buf[:])
+		readErrCh <- err
+	}()
+	qc.Cancel()
+	select {
+	case err := <-readErrCh:
+		if err == nil {
+			t.Fatalf("expecting non-nil error when reading from interrupted conn")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for interrupted read")
+	}
+	stop()
+}
+
+func TestQueryCancelerInterruptConnStop(t *testing.T) {
+	c, cRemote := net.Pipe()
+	defer func() {
+		_ = c.Close()
+		_ = cRemote.Close()
+	}()
+	bc := &handshake.BufferedConn{
+		Conn: c,
+	}
+	qc := NewQueryCanceler()
+	stop := qc.interruptConnOnCancel(bc)
+	stop()
+
+	// The conn mustn't be interrupted after the stop call.
+	qc.Cancel()
+	go func() {
+		_, _ = cRemote.Write([]byte("x"))
+	}()
+	var buf [1]byte
+	if _, err := bc.Conn.Read(buf[:]); err != nil {
+		t.Fatalf("unexpected error when reading from conn: %s", err)
+	}
+}
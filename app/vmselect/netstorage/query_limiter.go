@@ -0,0 +1,126 @@
+package netstorage
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+// NewTenantLimitError returns an error with the given statusCode for the exceeded limit with the given name and value for the given at.
+//
+// See searchutils.TenantLimits for available limits.
+func NewTenantLimitError(at *auth.Token, statusCode int, limitName string, limitValue interface{}, format string, args ...interface{}) error {
+	return &httpserver.ErrorWithStatusCode{
+		Err: fmt.Errorf("%s: the query exceeds `%s: %v` limit for tenant %d:%d; see -search.tenantLimitsFile",
+			fmt.Sprintf(format, args...), limitName, limitValue, at.AccountID, at.ProjectID),
+		StatusCode: statusCode,
+	}
+}
+
+// QueryLimiter enforces per-tenant limits on the data read from vmstorage nodes by a single query.
+//
+// A single QueryLimiter must be shared among all the vmstorage requests for the query,
+// such as requests for distinct selectors and time ranges, so the limits apply to the whole query.
+//
+// All the QueryLimiter methods may be called on nil QueryLimiter, which has no limits.
+// QueryLimiter may be used from concurrently running goroutines.
+type QueryLimiter struct {
+	// 64-bit fields must be at the top of the struct for proper alignment on 32-bit archs.
+	linesRead uint64
+	bytesRead uint64
+
+	at *auth.Token
+	tl *searchutils.TenantLimits
+
+	mu      sync.Mutex
+	err     error
+	streams map[string]struct{}
+}
+
+// NewQueryLimiter returns QueryLimiter for a query from the given at.
+//
+// nil is returned if at has no limits on the data read by a single query.
+func NewQueryLimiter(at *auth.Token) *QueryLimiter {
+	tl := searchutils.GetTenantLimits(at)
+	if tl.MaxStreamsPerQuery <= 0 && tl.MaxLinesPerQuery <= 0 && tl.MaxBytesPerQuery <= 0 {
+		return nil
+	}
+	return &QueryLimiter{
+		at: at,
+		tl: tl,
+	}
+}
+
+// registerBlock registers a block with the given number of rows and bytes read from vmstorage.
+//
+// Non-nil error is returned if the query exceeds tenant limits.
+func (ql *QueryLimiter) registerBlock(rows, bytes uint64) error {
+	if ql == nil {
+		return nil
+	}
+	if maxLines := ql.tl.MaxLinesPerQuery; maxLines > 0 {
+		if n := atomic.AddUint64(&ql.linesRead, rows); n > maxLines {
+			return ql.setError(NewTenantLimitError(ql.at, http.StatusBadRequest, "max_lines_per_query", maxLines,
+				"the query reads more than %d log lines", maxLines))
+		}
+	}
+	if maxBytes := ql.tl.MaxBytesPerQuery; maxBytes > 0 {
+		if n := atomic.AddUint64(&ql.bytesRead, bytes); n > maxBytes {
+			return ql.setError(NewTenantLimitError(ql.at, http.StatusBadRequest, "max_bytes_per_query", maxBytes,
+				"the query reads more than %d bytes", maxBytes))
+		}
+	}
+	return nil
+}
+
+// registerStream registers a log stream with the given metricName selected by the query.
+//
+// Non-nil error is returned if the query selects more streams than tenant limits allow.
+func (ql *QueryLimiter) registerStream(metricName []byte) error {
+	if ql == nil {
+		return nil
+	}
+	maxStreams := ql.tl.MaxStreamsPerQuery
+	if maxStreams <= 0 {
+		return nil
+	}
+	ql.mu.Lock()
+	if _, ok := ql.streams[string(metricName)]; !ok {
+		if ql.streams == nil {
+			ql.streams = make(map[string]struct{})
+		}
+		ql.streams[string(metricName)] = struct{}{}
+	}
+	n := len(ql.streams)
+	ql.mu.Unlock()
+	if n > maxStreams {
+		return ql.setError(NewTenantLimitError(ql.at, http.StatusBadRequest, "max_streams_per_query", maxStreams,
+			"the query selects more than %d log streams", maxStreams))
+	}
+	return nil
+}
+
+func (ql *QueryLimiter) setError(err error) error {
+	ql.mu.Lock()
+	if ql.err == nil {
+		ql.err = err
+	}
+	ql.mu.Unlock()
+	return err
+}
+
+// Error returns the first error for the exceeded limit.
+func (ql *QueryLimiter) Error() error {
+	if ql == nil {
+		return nil
+	}
+	ql.mu.Lock()
+	err := ql.err
+	ql.mu.Unlock()
+	return err
+}
@@ -0,0 +1,113 @@
+package netstorage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+func TestQueryLimiterNil(t *testing.T) {
+	ql := NewQueryLimiter(&auth.Token{})
+	if ql != nil {
+		t.Fatalf("expecting nil QueryLimiter without tenant limits")
+	}
+	if err := ql.registerBlock(1e9, 1e9); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ql.registerStream([]byte("foo")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ql.Error(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestQueryLimiter(t *testing.T) {
+	f := func(tl *searchutils.TenantLimits, registerBlocks func(ql *QueryLimiter) error, limitName string) {
+		t.Helper()
+		ql := &QueryLimiter{
+			at: &auth.Token{AccountID: 12, ProjectID: 34},
+			tl: tl,
+		}
+		err := registerBlocks(ql)
+		if limitName == "" {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := ql.Error(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %s", limitName)
+		}
+		if ql.Error() != err {
+			t.Fatalf("unexpected error returned from Error(); got %v; want %v", ql.Error(), err)
+		}
+		var esc *httpserver.ErrorWithStatusCode
+		if !errors.As(err, &esc) || esc.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expecting error with status code %d; got %v", http.StatusBadRequest, err)
+		}
+		if !strings.Contains(err.Error(), limitName) || !strings.Contains(err.Error(), "tenant 12:34") {
+			t.Fatalf("error must contain limit name %q and tenant; got %q", limitName, err)
+		}
+	}
+
+	// Lines limit
+	tl := &searchutils.TenantLimits{
+		MaxLinesPerQuery: 100,
+	}
+	f(tl, func(ql *QueryLimiter) error {
+		return ql.registerBlock(100, 1e9)
+	}, "")
+	f(tl, func(ql *QueryLimiter) error {
+		if err := ql.registerBlock(60, 1); err != nil {
+			return err
+		}
+		return ql.registerBlock(41, 1)
+	}, "max_lines_per_query")
+
+	// Bytes limit
+	tl = &searchutils.TenantLimits{
+		MaxBytesPerQuery: 1000,
+	}
+	f(tl, func(ql *QueryLimiter) error {
+		return ql.registerBlock(1e9, 1000)
+	}, "")
+	f(tl, func(ql *QueryLimiter) error {
+		return ql.registerBlock(1, 1001)
+	}, "max_bytes_per_query")
+
+	// Streams limit
+	tl = &searchutils.TenantLimits{
+		MaxStreamsPerQuery: 10,
+	}
+	registerStreams := func(ql *QueryLimiter, n int) error {
+		for i := 0; i < n; i++ {
+			if err := ql.registerStream([]byte(fmt.Sprintf("stream_%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	f(tl, func(ql *QueryLimiter) error {
+		return registerStreams(ql, 10)
+	}, "")
+	f(tl, func(ql *QueryLimiter) error {
+		// The same streams may be selected multiple times, for example, for distinct time ranges.
+		if err := registerStreams(ql, 10); err != nil {
+			return err
+		}
+		return registerStreams(ql, 10)
+	}, "")
+	f(tl, func(ql *QueryLimiter) error {
+		return registerStreams(ql, 11)
+	}, "max_streams_per_query")
+}
@@ -0,0 +1,232 @@
+package netstorage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueryStats contains statistics collected during query execution.
+//
+// All the QueryStats methods may be called on nil QueryStats.
+// QueryStats may be used from concurrently running goroutines.
+type QueryStats struct {
+	// 64-bit fields must be at the top of the struct for proper alignment on 32-bit archs.
+	rowsUnpacked    uint64
+	bytesUnpacked   uint64
+	storageDuration int64
+	execDuration    int64
+
+	// isPartial is set to 1 if some of vmstorage nodes were unavailable during the query.
+	isPartial uint32
+
+	mu           sync.Mutex
+	storageNodes map[string]*StorageNodeStats
+	lineFilters  map[string]*LineFilterStats
+}
+
+// StorageNodeStats contains per-vmstorage stats for the query.
+type StorageNodeStats struct {
+	// Addr is vmstorage address.
+	Addr string
+
+	// BlocksRead is the number of blocks sent by vmstorage.
+	BlocksRead uint64
+
+	// RowsRead is the number of rows in blocks sent by vmstorage.
+	RowsRead uint64
+
+	// BytesRead is the number of bytes sent by vmstorage.
+	BytesRead uint64
+
+	// Duration is the total duration of search requests to vmstorage.
+	Duration time.Duration
+}
+
+// LineFilterStats contains stats for a single line filter such as `|= "foo"`.
+type LineFilterStats struct {
+	// Filter is string representation of the line filter.
+	Filter string
+
+	// LinesProcessed is the number of lines processed by the filter.
+	LinesProcessed uint64
+
+	// LinesFiltered is the number of lines filtered out by the filter.
+	LinesFiltered uint64
+}
+
+func (qs *QueryStats) addStorageNodeStats(addr string, blocksRead, rowsRead, bytesRead uint64, d time.Duration) {
+	if qs == nil {
+		return
+	}
+	qs.mu.Lock()
+	if qs.storageNodes == nil {
+		qs.storageNodes = make(map[string]*StorageNodeStats)
+	}
+	sns := qs.storageNodes[addr]
+	if sns == nil {
+		sns = &StorageNodeStats{
+			Addr: addr,
+		}
+		qs.storageNodes[addr] = sns
+	}
+	sns.BlocksRead += blocksRead
+	sns.RowsRead += rowsRead
+	sns.BytesRead += bytesRead
+	sns.Duration += d
+	qs.mu.Unlock()
+}
+
+func (qs *QueryStats) addUnpacked(rows, bytes uint64) {
+	if qs == nil {
+		return
+	}
+	atomic.AddUint64(&qs.rowsUnpacked, rows)
+	atomic.AddUint64(&qs.bytesUnpacked, bytes)
+}
+
+func (qs *QueryStats) addStorageDuration(d time.Duration) {
+	if qs == nil {
+		return
+	}
+	atomic.AddInt64(&qs.storageDuration, int64(d))
+}
+
+// AddLineFilterStats registers the number of lines processed and filtered out by the given line filter.
+func (qs *QueryStats) AddLineFilterStats(filter string, linesProcessed, linesFiltered uint64) {
+	if qs == nil {
+		return
+	}
+	qs.mu.Lock()
+	if qs.lineFilters == nil {
+		qs.lineFilters = make(map[string]*LineFilterStats)
+	}
+	lfs := qs.lineFilters[filter]
+	if lfs == nil {
+		lfs = &LineFilterStats{
+			Filter: filter,
+		}
+		qs.lineFilters[filter] = lfs
+	}
+	lfs.LinesProcessed += linesProcessed
+	lfs.LinesFiltered += linesFiltered
+	qs.mu.Unlock()
+}
+
+func (qs *QueryStats) setPartial() {
+	if qs == nil {
+		return
+	}
+	atomic.StoreUint32(&qs.isPartial, 1)
+}
+
+// IsPartial returns true if the query returned partial results because some of vmstorage nodes were unavailable.
+func (qs *QueryStats) IsPartial() bool {
+	if qs == nil {
+		return false
+	}
+	return atomic.LoadUint32(&qs.isPartial) != 0
+}
+
+// SetExecDuration sets the total query execution duration.
+func (qs *QueryStats) SetExecDuration(d time.Duration) {
+	if qs == nil {
+		return
+	}
+	atomic.StoreInt64(&qs.execDuration, int64(d))
+}
+
+// RowsUnpacked returns the number of rows unpacked during the query.
+func (qs *QueryStats) RowsUnpacked() uint64 {
+	if qs == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&qs.rowsUnpacked)
+}
+
+// BytesUnpacked returns the number of log line bytes unpacked during the query.
+func (qs *QueryStats) BytesUnpacked() uint64 {
+	if qs == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&qs.bytesUnpacked)
+}
+
+// StorageDuration returns the time spent on fetching data from vmstorage nodes.
+func (qs *QueryStats) StorageDuration() time.Duration {
+	if qs == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&qs.storageDuration))
+}
+
+// ExecDuration returns the total query execution duration.
+func (qs *QueryStats) ExecDuration() time.Duration {
+	if qs == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&qs.execDuration))
+}
+
+// EvalDuration returns the time spent on query evaluation in vmselect.
+func (qs *QueryStats) EvalDuration() time.Duration {
+	d := qs.ExecDuration() - qs.StorageDuration()
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// StorageNodes returns per-vmstorage stats sorted by vmstorage address.
+func (qs *QueryStats) StorageNodes() []StorageNodeStats {
+	if qs == nil {
+		return nil
+	}
+	qs.mu.Lock()
+	a := make([]StorageNodeStats, 0, len(qs.storageNodes))
+	for _, sns := range qs.storageNodes {
+		a = append(a, *sns)
+	}
+	qs.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].Addr < a[j].Addr
+	})
+	return a
+}
+
+// LineFilters returns line filters stats sorted by filter.
+func (qs *QueryStats) LineFilters() []LineFilterStats {
+	if qs == nil {
+		return nil
+	}
+	qs.mu.Lock()
+	a := make([]LineFilterStats, 0, len(qs.lineFilters))
+	for _, lfs := range qs.lineFilters {
+		a = append(a, *lfs)
+	}
+	qs.mu.Unlock()
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].Filter < a[j].Filter
+	})
+	return a
+}
+
+// String returns human-readable representation of qs suitable for logging.
+func (qs *QueryStats) String() string {
+	var blocksRead, rowsRead, bytesRead uint64
+	for _, sns := range qs.StorageNodes() {
+		blocksRead += sns.BlocksRead
+		rowsRead += sns.RowsRead
+		bytesRead += sns.BytesRead
+	}
+	var lfs []string
+	for _, lf := range qs.LineFilters() {
+		lfs = append(lfs, fmt.Sprintf("%s: %d/%d", lf.Filter, lf.LinesFiltered, lf.LinesProcessed))
+	}
+	return fmt.Sprintf("blocksRead=%d, rowsRead=%d, bytesRead=%d, rowsUnpacked=%d, bytesUnpacked=%d, storageDuration=%.3fs, evalDuration=%.3fs, linesFiltered=[%s]",
+		blocksRead, rowsRead, bytesRead, qs.RowsUnpacked(), qs.BytesUnpacked(), qs.StorageDuration().Seconds(), qs.EvalDuration().Seconds(),
+		strings.Join(lfs, ", "))
+}
@@ -0,0 +1,85 @@
+package netstorage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryStatsNil(t *testing.T) {
+	var qs *QueryStats
+	qs.addStorageNodeStats("foo", 1, 2, 3, time.Second)
+	qs.addUnpacked(1, 2)
+	qs.addStorageDuration(time.Second)
+	qs.AddLineFilterStats(`|= "foo"`, 1, 2)
+	qs.SetExecDuration(time.Second)
+	if n := qs.RowsUnpacked(); n != 0 {
+		t.Fatalf("unexpected RowsUnpacked; got %d; want 0", n)
+	}
+	if sns := qs.StorageNodes(); sns != nil {
+		t.Fatalf("unexpected StorageNodes; got %v; want nil", sns)
+	}
+	_ = qs.String()
+}
+
+func TestQueryStats(t *testing.T) {
+	var qs QueryStats
+	qs.addStorageNodeStats("node2", 1, 10, 100, time.Second)
+	qs.addStorageNodeStats("node1", 2, 20, 200, time.Second)
+	qs.addStorageNodeStats("node2", 3, 30, 300, 2*time.Second)
+	qs.addUnpacked(60, 1000)
+	qs.addUnpacked(1, 10)
+	qs.addStorageDuration(3 * time.Second)
+	qs.AddLineFilterStats(`|= "foo"`, 61, 11)
+	qs.AddLineFilterStats(`!~ "bar"`, 50, 5)
+	qs.AddLineFilterStats(`|= "foo"`, 10, 1)
+	qs.SetExecDuration(5 * time.Second)
+
+	snsExpected := []StorageNodeStats{
+		{
+			Addr:       "node1",
+			BlocksRead: 2,
+			RowsRead:   20,
+			BytesRead:  200,
+			Duration:   time.Second,
+		},
+		{
+			Addr:       "node2",
+			BlocksRead: 4,
+			RowsRead:   40,
+			BytesRead:  400,
+			Duration:   3 * time.Second,
+		},
+	}
+	if sns := qs.StorageNodes(); !reflect.DeepEqual(sns, snsExpected) {
+		t.Fatalf("unexpected StorageNodes;\ngot\n%v\nwant\n%v", sns, snsExpected)
+	}
+	lfsExpected := []LineFilterStats{
+		{
+			Filter:         `!~ "bar"`,
+			LinesProcessed: 50,
+			LinesFiltered:  5,
+		},
+		{
+			Filter:         `|= "foo"`,
+			LinesProcessed: 71,
+			LinesFiltered:  12,
+		},
+	}
+	if lfs := qs.LineFilters(); !reflect.DeepEqual(lfs, lfsExpected) {
+		t.Fatalf("unexpected LineFilters;\ngot\n%v\nwant\n%v", lfs, lfsExpected)
+	}
+	if n := qs.RowsUnpacked(); n != 61 {
+		t.Fatalf("unexpected RowsUnpacked; got %d; want %d", n, 61)
+	}
+	if n := qs.BytesUnpacked(); n != 1010 {
+		t.Fatalf("unexpected BytesUnpacked; got %d; want %d", n, 1010)
+	}
+	if d := qs.EvalDuration(); d != 2*time.Second {
+		t.Fatalf("unexpected EvalDuration; got %s; want %s", d, 2*time.Second)
+	}
+	sExpected := `blocksRead=6, rowsRead=60, bytesRead=600, rowsUnpacked=61, bytesUnpacked=1010, storageDuration=3.000s, evalDuration=2.000s, linesFiltered=[!~ "bar": 5/50, |= "foo": 12/71]`
+	if s := qs.String(); s != sExpected {
+		t.Fatalf("unexpected String();\ngot\n%s\nwant\n%s", s, sExpected)
+	}
+}
@@ -0,0 +1,332 @@
+package patterns
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Wildcard is the token for variable parts of patterns.
+const Wildcard = "<_>"
+
+// Config is the configuration for Drain.
+type Config struct {
+	// Depth is the depth of the prefix tree. It must be at least 3.
+	//
+	// Lines are grouped by the number of tokens and by the first Depth-2 tokens.
+	Depth int
+
+	// SimilarityThreshold is the minimum share of matching tokens for adding a line to an existing pattern.
+	SimilarityThreshold float64
+
+	// MaxChildren is the maximum number of children per prefix tree node.
+	//
+	// Lines with tokens exceeding the limit are grouped under Wildcard node.
+	MaxChildren int
+
+	// MaxPatterns is the maximum number of patterns.
+	//
+	// The least recently used patterns are evicted when the limit is reached.
+	MaxPatterns int
+
+	// MaxTokens is the maximum number of tokens per line. The rest of the line is treated as a single token.
+	MaxTokens int
+
+	// Step is the interval for grouping line counts in Pattern samples.
+	Step int64
+}
+
+// DefaultConfig returns the default config with the given step.
+func DefaultConfig(step int64) *Config {
+	return &Config{
+		Depth:               3,
+		SimilarityThreshold: 0.3,
+		MaxChildren:         15,
+		MaxPatterns:         1000,
+		MaxTokens:           80,
+		Step:                step,
+	}
+}
+
+// Drain extracts patterns from log lines with Drain algorithm.
+//
+// See https://jiemingzhu.github.io/pub/pjhe_icws2017.pdf
+//
+// Drain isn't safe for concurrent use.
+type Drain struct {
+	cfg  Config
+	root node
+
+	patterns map[uint64]*Pattern
+	nextID   uint64
+	lastUsed uint64
+	evicted  uint64
+
+	tokensBuf []string
+}
+
+// Pattern is a template for similar log lines.
+type Pattern struct {
+	// Tokens contains pattern tokens. Variable tokens are equal to Wildcard.
+	Tokens []string
+
+	// Samples contains the number of lines per step keyed by the step start timestamp.
+	Samples map[int64]uint64
+
+	id       uint64
+	lastUsed uint64
+	leaf     *node
+}
+
+// String returns string representation for p.
+func (p *Pattern) String() string {
+	return strings.Join(p.Tokens, " ")
+}
+
+// Total returns the total number of lines for p.
+func (p *Pattern) Total() uint64 {
+	n := uint64(0)
+	for _, v := range p.Samples {
+		n += v
+	}
+	return n
+}
+
+// SortedSamples returns p samples sorted by timestamps.
+func (p *Pattern) SortedSamples() ([]int64, []uint64) {
+	timestamps := make([]int64, 0, len(p.Samples))
+	for ts := range p.Samples {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	values := make([]uint64, len(timestamps))
+	for i, ts := range timestamps {
+		values[i] = p.Samples[ts]
+	}
+	return timestamps, values
+}
+
+type node struct {
+	children   map[string]*node
+	patternIDs []uint64
+}
+
+// New returns new Drain for the given cfg.
+func New(cfg *Config) *Drain {
+	c := *cfg
+	if c.Depth < 3 {
+		c.Depth = 3
+	}
+	if c.Step <= 0 {
+		c.Step = 1
+	}
+	return &Drain{
+		cfg:      c,
+		patterns: make(map[uint64]*Pattern),
+	}
+}
+
+// Add adds line with the given timestamp in milliseconds to d and returns the pattern for the line.
+func (d *Drain) Add(line string, timestamp int64) *Pattern {
+	tokens := d.tokenize(line)
+	if len(tokens) == 0 {
+		return nil
+	}
+	d.lastUsed++
+	leaf := d.getLeaf(tokens)
+	p := d.matchPattern(leaf, tokens)
+	if p == nil {
+		p = d.newPattern(leaf, tokens)
+	} else {
+		for i, token := range tokens {
+			if p.Tokens[i] != token {
+				p.Tokens[i] = Wildcard
+			}
+		}
+	}
+	p.lastUsed = d.lastUsed
+	bucket := timestamp - timestamp%d.cfg.Step
+	if timestamp < 0 && timestamp%d.cfg.Step != 0 {
+		bucket -= d.cfg.Step
+	}
+	p.Samples[bucket]++
+	return p
+}
+
+// Patterns returns all the patterns from d sorted by the number of lines in descending order.
+func (d *Drain) Patterns() []*Pattern {
+	ps := make([]*Pattern, 0, len(d.patterns))
+	totals := make(map[*Pattern]uint64, len(d.patterns))
+	for _, p := range d.patterns {
+		ps = append(ps, p)
+		totals[p] = p.Total()
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		if totals[ps[i]] != totals[ps[j]] {
+			return totals[ps[i]] > totals[ps[j]]
+		}
+		return ps[i].id < ps[j].id
+	})
+	return ps
+}
+
+// tokenize splits line into whitespace-separated tokens.
+//
+// Tokens with digits are replaced with Wildcard, since they are likely variable.
+func (d *Drain) tokenize(line string) []string {
+	tokens := d.tokensBuf[:0]
+	for {
+		line = strings.TrimLeft(line, " \t\r\n")
+		if len(line) == 0 {
+			break
+		}
+		if d.cfg.MaxTokens > 0 && len(tokens) == d.cfg.MaxTokens-1 {
+			tokens = append(tokens, strings.TrimRight(line, " \t\r\n"))
+			break
+		}
+		n := strings.IndexAny(line, " \t\r\n")
+		if n < 0 {
+			n = len(line)
+		}
+		token := line[:n]
+		line = line[n:]
+		if hasDigits(token) {
+			token = Wildcard
+		}
+		tokens = append(tokens, token)
+	}
+	d.tokensBuf = tokens
+	return tokens
+}
+
+func hasDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// getLeaf returns prefix tree leaf for tokens, creating missing nodes.
+//
+// The first level of the tree is keyed by the number of tokens, while the next levels are keyed by the first tokens.
+func (d *Drain) getLeaf(tokens []string) *node {
+	n := d.root.getChild(strconv.Itoa(len(tokens)), true)
+	prefixLen := d.cfg.Depth - 2
+	if prefixLen > len(tokens) {
+		prefixLen = len(tokens)
+	}
+	for _, token := range tokens[:prefixLen] {
+		child := n.getChild(token, false)
+		if child == nil {
+			if d.cfg.MaxChildren > 0 && len(n.children) >= d.cfg.MaxChildren-1 {
+				// Reserve the last child for Wildcard.
+				token = Wildcard
+			}
+			child = n.getChild(token, true)
+		}
+		n = child
+	}
+	return n
+}
+
+func (n *node) getChild(key string, create bool) *node {
+	child := n.children[key]
+	if child == nil && create {
+		if n.children == nil {
+			n.children = make(map[string]*node)
+		}
+		child = &node{}
+		n.children[key] = child
+	}
+	return child
+}
+
+// matchPattern returns the most similar pattern for tokens at leaf.
+//
+// nil is returned if there are no patterns with similarity exceeding the threshold.
+func (d *Drain) matchPattern(leaf *node, tokens []string) *Pattern {
+	var best *Pattern
+	bestSim := -1.0
+	bestWildcards := -1
+	for _, id := range leaf.patternIDs {
+		p := d.patterns[id]
+		sim, wildcards := getSimilarity(p.Tokens, tokens)
+		if sim > bestSim || sim == bestSim && wildcards > bestWildcards {
+			best = p
+			bestSim = sim
+			bestWildcards = wildcards
+		}
+	}
+	if best == nil || bestSim < d.cfg.SimilarityThreshold {
+		return nil
+	}
+	return best
+}
+
+// getSimilarity returns the share of tokens matching the pattern tokens and the number of wildcards in the pattern.
+//
+// Pattern wildcards aren't counted as matching tokens, so lines don't collapse into patterns consisting of wildcards only.
+func getSimilarity(patternTokens, tokens []string) (float64, int) {
+	matches := 0
+	wildcards := 0
+	for i, token := range patternTokens {
+		if token == Wildcard {
+			wildcards++
+			continue
+		}
+		if token == tokens[i] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(tokens)), wildcards
+}
+
+func (d *Drain) newPattern(leaf *node, tokens []string) *Pattern {
+	if d.cfg.MaxPatterns > 0 && len(d.patterns) >= d.cfg.MaxPatterns {
+		d.evictLeastRecentlyUsed()
+	}
+	d.nextID++
+	p := &Pattern{
+		Tokens:  append([]string{}, tokens...),
+		Samples: make(map[int64]uint64),
+		id:      d.nextID,
+		leaf:    leaf,
+	}
+	// Tokens may refer to the original line, so copy them in order to avoid holding the line in memory.
+	for i, token := range p.Tokens {
+		if token != Wildcard {
+			p.Tokens[i] = string(append([]byte{}, token...))
+		}
+	}
+	d.patterns[p.id] = p
+	leaf.patternIDs = append(leaf.patternIDs, p.id)
+	return p
+}
+
+func (d *Drain) evictLeastRecentlyUsed() {
+	var lru *Pattern
+	for _, p := range d.patterns {
+		if lru == nil || p.lastUsed < lru.lastUsed {
+			lru = p
+		}
+	}
+	if lru == nil {
+		return
+	}
+	delete(d.patterns, lru.id)
+	ids := lru.leaf.patternIDs
+	for i, id := range ids {
+		if id == lru.id {
+			lru.leaf.patternIDs = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	d.evicted++
+}
+
+// Evicted returns the number of patterns evicted from d because of MaxPatterns limit.
+func (d *Drain) Evicted() uint64 {
+	return d.evicted
+}
@@ -0,0 +1,134 @@
+package patterns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDrainAdd(t *testing.T) {
+	f := func(lines []string, patternsExpected []string) {
+		t.Helper()
+		d := New(DefaultConfig(1000))
+		for i, line := range lines {
+			d.Add(line, int64(i))
+		}
+		var result []string
+		for _, p := range d.Patterns() {
+			result = append(result, p.String())
+		}
+		if !reflect.DeepEqual(result, patternsExpected) {
+			t.Fatalf("unexpected patterns\ngot\n%q\nwant\n%q", result, patternsExpected)
+		}
+	}
+	f(nil, nil)
+	f([]string{"", "  "}, nil)
+
+	// Tokens with digits are replaced with wildcards.
+	f([]string{
+		"took 12ms",
+		"took 5ms",
+	}, []string{
+		"took <_>",
+	})
+
+	// Distinct tokens are merged into wildcards.
+	f([]string{
+		"user alice logged in",
+		"user bob logged in",
+		"user carol logged in",
+		"connection to db failed after retries",
+	}, []string{
+		"user <_> logged in",
+		"connection to db failed after retries",
+	})
+
+	// Lines with distinct number of tokens belong to distinct patterns.
+	f([]string{
+		"GET /api/v1/users status=200",
+		"GET /api/v1/users status=500 slow",
+		"GET /api/v1/orders status=200",
+	}, []string{
+		"GET <_> <_>",
+		"GET <_> <_> slow",
+	})
+
+	// Dissimilar lines with the same prefix belong to distinct patterns.
+	f([]string{
+		"error: cannot open file foo",
+		"error: cannot open file bar",
+		"error: disk is full right now",
+	}, []string{
+		"error: cannot open file <_>",
+		"error: disk is full right now",
+	})
+}
+
+func TestDrainSamples(t *testing.T) {
+	d := New(DefaultConfig(1000))
+	d.Add("request served", 100)
+	d.Add("request served", 999)
+	d.Add("request served", 1000)
+	d.Add("request served", 3500)
+	ps := d.Patterns()
+	if len(ps) != 1 {
+		t.Fatalf("unexpected number of patterns; got %d; want 1", len(ps))
+	}
+	timestamps, values := ps[0].SortedSamples()
+	timestampsExpected := []int64{0, 1000, 3000}
+	valuesExpected := []uint64{2, 1, 1}
+	if !reflect.DeepEqual(timestamps, timestampsExpected) {
+		t.Fatalf("unexpected timestamps; got %d; want %d", timestamps, timestampsExpected)
+	}
+	if !reflect.DeepEqual(values, valuesExpected) {
+		t.Fatalf("unexpected values; got %d; want %d", values, valuesExpected)
+	}
+	if n := ps[0].Total(); n != 4 {
+		t.Fatalf("unexpected total; got %d; want 4", n)
+	}
+}
+
+func TestDrainMaxPatterns(t *testing.T) {
+	cfg := DefaultConfig(1000)
+	cfg.MaxPatterns = 2
+	d := New(cfg)
+	d.Add("first pattern", 0)
+	d.Add("second line here", 0)
+	d.Add("first pattern", 0)
+	d.Add("third one goes here now", 0)
+
+	// The second pattern is the least recently used, so it must be evicted.
+	var result []string
+	for _, p := range d.Patterns() {
+		result = append(result, p.String())
+	}
+	resultExpected := []string{"first pattern", "third one goes here now"}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected patterns; got %q; want %q", result, resultExpected)
+	}
+	if n := d.Evicted(); n != 1 {
+		t.Fatalf("unexpected number of evicted patterns; got %d; want 1", n)
+	}
+
+	// The evicted pattern is created again.
+	d.Add("second line here", 0)
+	if n := d.Evicted(); n != 2 {
+		t.Fatalf("unexpected number of evicted patterns; got %d; want 2", n)
+	}
+}
+
+func TestDrainMaxTokens(t *testing.T) {
+	cfg := DefaultConfig(1000)
+	cfg.MaxTokens = 3
+	d := New(cfg)
+	d.Add("a b c d e", 0)
+	d.Add("a b x y z", 0)
+	ps := d.Patterns()
+	var result []string
+	for _, p := range ps {
+		result = append(result, p.String())
+	}
+	resultExpected := []string{"a b <_>"}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected patterns; got %q; want %q", result, resultExpected)
+	}
+}
@@ -3,10 +3,16 @@ package querier
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 // WriteActiveQueries writes active queries to w.
@@ -25,6 +31,24 @@ func WriteActiveQueries(w io.Writer) {
 	}
 }
 
+// CancelActiveQuery cancels active query with the given qid.
+//
+// Only queries for the given at are canceled unless isAdmin is set.
+func CancelActiveQuery(at *auth.Token, qid uint64, isAdmin bool) error {
+	aqe, ok := activeQueriesV.Get(qid)
+	if !ok || !isAdmin && (aqe.accountID != at.AccountID || aqe.projectID != at.ProjectID) {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot find active query with id=%016X", qid),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	aqe.qc.Cancel()
+	canceledQueries.Inc()
+	return nil
+}
+
+var canceledQueries = metrics.NewCounter(`vm_canceled_queries_total`)
+
 var activeQueriesV = newActiveQueries()
 
 type activeQueries struct {
@@ -42,6 +66,7 @@ type activeQueryEntry struct {
 	quotedRemoteAddr string
 	q                string
 	startTime        time.Time
+	qc               *netstorage.QueryCanceler
 }
 
 func newActiveQueries() *activeQueries {
@@ -50,7 +75,11 @@ func newActiveQueries() *activeQueries {
 	}
 }
 
-func (aq *activeQueries) Add(ec *EvalConfig, q string) uint64 {
+// Add registers the query q executed with ec.
+//
+// Non-nil error is returned if the number of active queries for ec.AuthToken reaches maxConcurrentQueries.
+// Zero maxConcurrentQueries means no limit.
+func (aq *activeQueries) Add(ec *EvalConfig, q string, maxConcurrentQueries int) (uint64, error) {
 	var aqe activeQueryEntry
 	aqe.accountID = ec.AuthToken.AccountID
 	aqe.projectID = ec.AuthToken.ProjectID
@@ -61,11 +90,24 @@ func (aq *activeQueries) Add(ec *EvalConfig, q string) uint64 {
 	aqe.quotedRemoteAddr = ec.QuotedRemoteAddr
 	aqe.q = q
 	aqe.startTime = time.Now()
+	aqe.qc = ec.Canceler
 
 	aq.mu.Lock()
+	defer aq.mu.Unlock()
+	if maxConcurrentQueries > 0 {
+		n := 0
+		for _, x := range aq.m {
+			if x.accountID == aqe.accountID && x.projectID == aqe.projectID {
+				n++
+			}
+		}
+		if n >= maxConcurrentQueries {
+			return 0, netstorage.NewTenantLimitError(ec.AuthToken, http.StatusTooManyRequests, "max_concurrent_queries", maxConcurrentQueries,
+				"cannot execute more than %d concurrent queries", maxConcurrentQueries)
+		}
+	}
 	aq.m[aqe.qid] = aqe
-	aq.mu.Unlock()
-	return aqe.qid
+	return aqe.qid, nil
 }
 
 func (aq *activeQueries) Remove(qid uint64) {
@@ -74,6 +116,13 @@ func (aq *activeQueries) Remove(qid uint64) {
 	aq.mu.Unlock()
 }
 
+func (aq *activeQueries) Get(qid uint64) (activeQueryEntry, bool) {
+	aq.mu.Lock()
+	aqe, ok := aq.m[qid]
+	aq.mu.Unlock()
+	return aqe, ok
+}
+
 func (aq *activeQueries) GetAll() []activeQueryEntry {
 	aq.mu.Lock()
 	aqes := make([]activeQueryEntry, 0, len(aq.m))
@@ -0,0 +1,79 @@
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+)
+
+func TestCancelActiveQuery(t *testing.T) {
+	ec := &EvalConfig{
+		AuthToken: &auth.Token{
+			AccountID: 1,
+			ProjectID: 2,
+		},
+		Canceler: netstorage.NewQueryCanceler(),
+	}
+	qid, err := activeQueriesV.Add(ec, `{app="api"}`, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer activeQueriesV.Remove(qid)
+
+	// Unknown query id
+	if err := CancelActiveQuery(ec.AuthToken, qid+1, true); err == nil {
+		t.Fatalf("expecting non-nil error when canceling unknown query")
+	}
+
+	// Query from another tenant
+	if err := CancelActiveQuery(&auth.Token{AccountID: 1}, qid, false); err == nil {
+		t.Fatalf("expecting non-nil error when canceling query from another tenant")
+	}
+	if ec.Canceler.IsCanceled() {
+		t.Fatalf("the query mustn't be canceled by another tenant")
+	}
+
+	// Query from the same tenant
+	if err := CancelActiveQuery(&auth.Token{AccountID: 1, ProjectID: 2}, qid, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ec.Canceler.IsCanceled() {
+		t.Fatalf("expecting the query to be canceled")
+	}
+
+	// Admin may cancel queries for any tenant
+	ec.Canceler = netstorage.NewQueryCanceler()
+	qidAdmin, err := activeQueriesV.Add(ec, `{app="web"}`, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer activeQueriesV.Remove(qidAdmin)
+	if err := CancelActiveQuery(&auth.Token{}, qidAdmin, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ec.Canceler.IsCanceled() {
+		t.Fatalf("expecting the query to be canceled by admin")
+	}
+}
+
+func TestExecCanceledQuery(t *testing.T) {
+	qc := netstorage.NewQueryCanceler()
+	qc.Cancel()
+	ec := &EvalConfig{
+		AuthToken: &auth.Token{
+			AccountID: 1,
+		},
+		Start:    1000,
+		End:      2000,
+		Step:     100,
+		Deadline: searchutils.NewDeadline(time.Now(), time.Minute, ""),
+		Canceler: qc,
+	}
+	// The query doesn't touch vmstorage, so it must be canceled during evaluation.
+	if _, _, err := Exec(ec, `sum(label_set(time(), "job", "foo")) + 1`, false); err != netstorage.ErrQueryCanceled {
+		t.Fatalf("unexpected error; got %v; want %v", err, netstorage.ErrQueryCanceled)
+	}
+}
@@ -0,0 +1,216 @@
+package querier
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var logContextQueries = metrics.NewCounter(`vm_log_context_queries_total`)
+
+// LogContext contains log rows around the given log row in a single stream.
+type LogContext struct {
+	// MetricName contains stream labels.
+	MetricName storage.MetricName
+
+	// Timestamps and Datas contain log rows for the stream in ascending order of timestamps.
+	Timestamps []int64
+	Datas      [][]byte
+
+	// EntryIdx is the index of the requested log row in Timestamps and Datas.
+	//
+	// Timestamps[:EntryIdx] contain log rows before the requested row,
+	// while Timestamps[EntryIdx+1:] contain log rows after the requested row.
+	EntryIdx int
+}
+
+// ParseStreamLabels parses stream labels such as `{app="api",host="foo"}` into mn.
+//
+// Only `label="value"` matchers are allowed, since they must identify a single stream.
+func ParseStreamLabels(mn *storage.MetricName, s string) error {
+	e, err := parsePromQLWithCache(s)
+	if err != nil {
+		return fmt.Errorf("cannot parse stream labels %q: %w", s, err)
+	}
+	me, ok := e.(*logql.MetricExpr)
+	if !ok || me.IsEmpty() {
+		return fmt.Errorf("stream labels must be in the form `{label1=\"value1\",...,labelN=\"valueN\"}`; got %q", s)
+	}
+	mn.Reset()
+	m := make(map[string]bool, len(me.LabelFilters))
+	for i := range me.LabelFilters {
+		lf := &me.LabelFilters[i]
+		if lf.IsNegative || lf.IsRegexp {
+			return fmt.Errorf("stream labels may contain only `label=\"value\"` matchers; got %q", s)
+		}
+		if m[lf.Label] {
+			return fmt.Errorf("duplicate label %q in stream labels %q", lf.Label, s)
+		}
+		m[lf.Label] = true
+		if lf.Label == "__name__" {
+			mn.MetricGroup = append(mn.MetricGroup[:0], lf.Value...)
+			continue
+		}
+		mn.AddTag(lf.Label, lf.Value)
+	}
+	return nil
+}
+
+// GetLogContext returns up to before log rows before and up to after log rows after the log row in the stream with the given mn.
+//
+// The log row is identified by its timestamp and offset among log rows with the same timestamp in the stream.
+// Log rows are searched on ec time range. Only blocks for the given stream are read from vmstorage nodes.
+func GetLogContext(ec *EvalConfig, mn *storage.MetricName, timestamp int64, offset, before, after int) (*LogContext, error) {
+	logContextQueries.Inc()
+	if timestamp < ec.Start || timestamp > ec.End {
+		return nil, fmt.Errorf("timestamp=%d must be on the time range [%d..%d]", timestamp, ec.Start, ec.End)
+	}
+	if offset < 0 || before < 0 || after < 0 {
+		return nil, fmt.Errorf("offset, before and after must be non-negative; got offset=%d, before=%d, after=%d", offset, before, after)
+	}
+	ec.memoryBudget = newQueryMemoryBudget()
+	defer ec.memoryBudget.Release()
+	ec.queryLimiter = netstorage.NewQueryLimiter(ec.AuthToken)
+
+	qt := ec.Tracer.NewChild("get log context for %s at timestamp=%d, offset=%d, before=%d, after=%d", mn, timestamp, offset, before, after)
+	search := func(start, end, limit int64, forward bool) (*netstorage.Result, error) {
+		return searchStreamRows(ec, mn, start, end, limit, forward)
+	}
+	lc, err := getLogContext(search, mn, ec.Start, ec.End, timestamp, offset, before, after)
+	if err != nil {
+		qt.Donef("error: %s", err)
+		return nil, err
+	}
+	qt.Donef("rows=%d, entryIdx=%d", len(lc.Timestamps), lc.EntryIdx)
+	return lc, nil
+}
+
+// streamRowsSearchFunc must return log rows for a single stream on the time range [start..end] like searchStreamRows does.
+type streamRowsSearchFunc func(start, end, limit int64, forward bool) (*netstorage.Result, error)
+
+// getLogContext returns log context for the log row in the stream with the given mn on the time range [start..end].
+//
+// See GetLogContext for details.
+func getLogContext(search streamRowsSearchFunc, mn *storage.MetricName, start, end, timestamp int64, offset, before, after int) (*LogContext, error) {
+	// All the log rows with the requested timestamp. They are searched without limit,
+	// since vmstorage nodes apply the limit per block, so it may cut rows with the requested timestamp.
+	rs, err := search(timestamp, timestamp, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	n := len(rs.Timestamps)
+	if offset >= n {
+		return nil, fmt.Errorf("cannot find log row with timestamp=%d and offset=%d in the stream %s; the stream contains %d rows with this timestamp", timestamp, offset, mn, n)
+	}
+
+	var lc LogContext
+	lc.MetricName.CopyFrom(&rs.MetricName)
+
+	// Log rows before the requested row with smaller timestamps.
+	if offset < before && timestamp > start {
+		limit := before - offset
+		rsBefore, err := search(start, timestamp-1, int64(limit), false)
+		if err != nil {
+			return nil, err
+		}
+		from := len(rsBefore.Timestamps) - limit
+		if from < 0 {
+			from = 0
+		}
+		lc.Timestamps = append(lc.Timestamps, rsBefore.Timestamps[from:]...)
+		lc.Datas = append(lc.Datas, rsBefore.Datas[from:]...)
+	}
+
+	// Log rows with the requested timestamp.
+	from := offset - before
+	if from < 0 {
+		from = 0
+	}
+	lc.EntryIdx = len(lc.Timestamps) + offset - from
+	lc.Timestamps = append(lc.Timestamps, rs.Timestamps[from:]...)
+	lc.Datas = append(lc.Datas, rs.Datas[from:]...)
+
+	// Log rows after the requested row with bigger timestamps.
+	if rowsAfter := n - offset - 1; rowsAfter < after && timestamp < end {
+		rsAfter, err := search(timestamp+1, end, int64(after-rowsAfter), true)
+		if err != nil {
+			return nil, err
+		}
+		lc.Timestamps = append(lc.Timestamps, rsAfter.Timestamps...)
+		lc.Datas = append(lc.Datas, rsAfter.Datas...)
+	}
+	if to := lc.EntryIdx + 1 + after; to < len(lc.Timestamps) {
+		lc.Timestamps = lc.Timestamps[:to]
+		lc.Datas = lc.Datas[:to]
+	}
+	return &lc, nil
+}
+
+// searchStreamRows returns log rows for the stream with the given mn on the time range [start..end].
+//
+// vmstorage nodes may stop the search after finding at least limit rows in the given direction,
+// so the returned rows may contain more than limit rows. The rows are sorted by timestamps.
+func searchStreamRows(ec *EvalConfig, mn *storage.MetricName, start, end, limit int64, forward bool) (*netstorage.Result, error) {
+	ssq := &storage.StreamSearchQuery{
+		AccountID:    ec.AuthToken.AccountID,
+		ProjectID:    ec.AuthToken.ProjectID,
+		MinTimestamp: start,
+		MaxTimestamp: end,
+	}
+	ssq.MetricName.CopyFrom(mn)
+	rss, isPartial, err := netstorage.ProcessStreamSearchQuery(ec.Tracer, ec.AuthToken, ssq, 2, limit, forward, ec.QueryStats, ec.Canceler, ec.queryLimiter, ec.Deadline)
+	if err != nil {
+		return nil, err
+	}
+	if isPartial && ec.DenyPartialResponse {
+		rss.Cancel()
+		return nil, fmt.Errorf("cannot return full response, since some of vmstorage nodes are unavailable")
+	}
+	var r netstorage.Result
+	r.MetricName.CopyFrom(mn)
+	var mu sync.Mutex
+	blocks := 0
+	err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		if err := ec.memoryBudget.Add(getLogRowsSize(rs.Datas)); err != nil {
+			return err
+		}
+		mu.Lock()
+		r.MetricName.CopyFrom(&rs.MetricName)
+		r.Timestamps = append(r.Timestamps, rs.Timestamps...)
+		r.Datas = append(r.Datas, rs.Datas...)
+		blocks++
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if blocks > 1 {
+		// The stream may be registered under multiple TSIDs in distinct indexdb generations.
+		sort.Stable(&logRowsSorter{r: &r})
+	}
+	return &r, nil
+}
+
+type logRowsSorter struct {
+	r *netstorage.Result
+}
+
+func (lrs *logRowsSorter) Len() int {
+	return len(lrs.r.Timestamps)
+}
+
+func (lrs *logRowsSorter) Less(i, j int) bool {
+	return lrs.r.Timestamps[i] < lrs.r.Timestamps[j]
+}
+
+func (lrs *logRowsSorter) Swap(i, j int) {
+	r := lrs.r
+	r.Timestamps[i], r.Timestamps[j] = r.Timestamps[j], r.Timestamps[i]
+	r.Datas[i], r.Datas[j] = r.Datas[j], r.Datas[i]
+}
@@ -0,0 +1,132 @@
+package querier
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+)
+
+func TestParseStreamLabelsSuccess(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+		var mn storage.MetricName
+		if err := ParseStreamLabels(&mn, s); err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		if result := mn.String(); result != resultExpected {
+			t.Fatalf("unexpected stream labels for %q; got %s; want %s", s, result, resultExpected)
+		}
+	}
+	f(`{app="api"}`, `AccountID=0, ProjectID=0, MetricGroup="", tags=["app"="api"]`)
+	f(`{host="foo",app="api"}`, `AccountID=0, ProjectID=0, MetricGroup="", tags=["host"="foo", "app"="api"]`)
+	f(`{__name__="logs",app="api"}`, `AccountID=0, ProjectID=0, MetricGroup="logs", tags=["app"="api"]`)
+}
+
+func TestParseStreamLabelsError(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		var mn storage.MetricName
+		if err := ParseStreamLabels(&mn, s); err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q", s)
+		}
+	}
+	f(``)
+	f(`{}`)
+	f(`{app=~"api"}`)
+	f(`{app!="api"}`)
+	f(`{app="api",app="foo"}`)
+	f(`{app="api"} |= "error"`)
+	f(`rate({app="api"}[5m])`)
+}
+
+func TestLogRowsSorter(t *testing.T) {
+	r := &netstorage.Result{
+		Timestamps: []int64{30, 10, 20, 10},
+		Datas:      [][]byte{[]byte("d"), []byte("a"), []byte("c"), []byte("b")},
+	}
+	sort.Stable(&logRowsSorter{r: r})
+	timestampsExpected := []int64{10, 10, 20, 30}
+	if !reflect.DeepEqual(r.Timestamps, timestampsExpected) {
+		t.Fatalf("unexpected timestamps; got %v; want %v", r.Timestamps, timestampsExpected)
+	}
+	datasExpected := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+	if !reflect.DeepEqual(r.Datas, datasExpected) {
+		t.Fatalf("unexpected datas; got %q; want %q", r.Datas, datasExpected)
+	}
+}
+
+func TestGetLogContext(t *testing.T) {
+	type logRow struct {
+		timestamp int64
+		data      string
+	}
+	// Rows with timestamp=20 are split across blocks.
+	blocks := [][]logRow{
+		{{10, "a"}, {20, "b"}},
+		{{20, "c"}, {20, "d"}, {30, "e"}},
+		{{40, "f"}},
+	}
+	var mn storage.MetricName
+	mn.AddTag("app", "api")
+	// search works like vmstorage nodes - it returns the whole blocks in the search direction
+	// until at least limit rows are found.
+	search := func(start, end, limit int64, forward bool) (*netstorage.Result, error) {
+		var r netstorage.Result
+		r.MetricName.CopyFrom(&mn)
+		var rows []logRow
+		for i := range blocks {
+			b := blocks[i]
+			if !forward {
+				b = blocks[len(blocks)-1-i]
+			}
+			if limit > 0 && int64(len(rows)) >= limit {
+				break
+			}
+			for _, row := range b {
+				if row.timestamp >= start && row.timestamp <= end {
+					rows = append(rows, row)
+				}
+			}
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			return rows[i].timestamp < rows[j].timestamp
+		})
+		for _, row := range rows {
+			r.Timestamps = append(r.Timestamps, row.timestamp)
+			r.Datas = append(r.Datas, []byte(row.data))
+		}
+		return &r, nil
+	}
+	f := func(timestamp int64, offset, before, after int, datasExpected string, entryIdxExpected int) {
+		t.Helper()
+		lc, err := getLogContext(search, &mn, 0, 100, timestamp, offset, before, after)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var datas []byte
+		for _, data := range lc.Datas {
+			datas = append(datas, data...)
+		}
+		if string(datas) != datasExpected || lc.EntryIdx != entryIdxExpected {
+			t.Fatalf("unexpected log context for timestamp=%d, offset=%d, before=%d, after=%d; got rows=%q, entryIdx=%d; want rows=%q, entryIdx=%d",
+				timestamp, offset, before, after, datas, lc.EntryIdx, datasExpected, entryIdxExpected)
+		}
+	}
+	f(20, 0, 0, 0, "b", 0)
+	f(20, 0, 1, 1, "abc", 1)
+	f(20, 1, 1, 1, "bcd", 1)
+	f(20, 2, 3, 2, "abcdef", 3)
+	f(20, 2, 0, 0, "d", 0)
+	f(10, 0, 5, 2, "abc", 0)
+	f(40, 0, 2, 5, "def", 2)
+
+	if _, err := getLogContext(search, &mn, 0, 100, 20, 3, 0, 0); err == nil {
+		t.Fatalf("expecting non-nil error for missing offset")
+	}
+	if _, err := getLogContext(search, &mn, 0, 100, 25, 0, 0, 0); err == nil {
+		t.Fatalf("expecting non-nil error for missing timestamp")
+	}
+}
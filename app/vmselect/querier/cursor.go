@@ -0,0 +1,308 @@
+package querier
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/cespare/xxhash/v2"
+)
+
+// LogCursor points to the last log row returned by stream query.
+//
+// Log rows are ordered by timestamp according to the query direction, then by stream hash
+// and then by offset among rows with the same stream and timestamp.
+type LogCursor struct {
+	// Forward is the query direction for the cursor.
+	Forward bool
+
+	// QueryHash is the hash for the query and direction the cursor was obtained for. See GetLogCursorQueryHash.
+	//
+	// It prevents from resuming another query with the cursor.
+	QueryHash uint64
+
+	// Timestamp is the timestamp for the last returned log row.
+	Timestamp int64
+
+	// StreamHash is the hash for the stream containing the last returned log row.
+	StreamHash uint64
+
+	// Offset is the offset of the last returned log row among rows with the same StreamHash and Timestamp
+	// according to the query direction.
+	Offset uint64
+}
+
+// Marshal appends marshaled lc to dst and returns the result.
+func (lc *LogCursor) Marshal(dst []byte) []byte {
+	forward := byte(0)
+	if lc.Forward {
+		forward = 1
+	}
+	dst = append(dst, forward)
+	dst = encoding.MarshalUint64(dst, lc.QueryHash)
+	dst = encoding.MarshalVarInt64(dst, lc.Timestamp)
+	dst = encoding.MarshalUint64(dst, lc.StreamHash)
+	dst = encoding.MarshalVarUint64(dst, lc.Offset)
+	return dst
+}
+
+// Unmarshal unmarshals lc from src.
+func (lc *LogCursor) Unmarshal(src []byte) error {
+	if len(src) < 1 {
+		return fmt.Errorf("cannot unmarshal Forward from empty src")
+	}
+	switch src[0] {
+	case 0:
+		lc.Forward = false
+	case 1:
+		lc.Forward = true
+	default:
+		return fmt.Errorf("unexpected value for Forward: %d; want 0 or 1", src[0])
+	}
+	src = src[1:]
+
+	if len(src) < 8 {
+		return fmt.Errorf("cannot unmarshal QueryHash: too short src len: %d; must be at least %d bytes", len(src), 8)
+	}
+	lc.QueryHash = encoding.UnmarshalUint64(src)
+	src = src[8:]
+
+	tail, timestamp, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal Timestamp: %w", err)
+	}
+	lc.Timestamp = timestamp
+	src = tail
+
+	if len(src) < 8 {
+		return fmt.Errorf("cannot unmarshal StreamHash: too short src len: %d; must be at least %d bytes", len(src), 8)
+	}
+	lc.StreamHash = encoding.UnmarshalUint64(src)
+	src = src[8:]
+
+	tail, offset, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal Offset: %w", err)
+	}
+	lc.Offset = offset
+	src = tail
+
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected non-empty tail left after unmarshaling LogCursor: (len=%d) %q", len(src), src)
+	}
+	return nil
+}
+
+// String returns opaque string representation of lc, which can be parsed with ParseLogCursor.
+func (lc *LogCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString(lc.Marshal(nil))
+}
+
+// ParseLogCursor parses log cursor from s obtained via LogCursor.String.
+func ParseLogCursor(s string) (*LogCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode cursor %q: %w", s, err)
+	}
+	var lc LogCursor
+	if err := lc.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("cannot parse cursor %q: %w", s, err)
+	}
+	return &lc, nil
+}
+
+// GetLogCursorQueryHash returns LogCursor.QueryHash for the query q with the given direction.
+func GetLogCursorQueryHash(q string, forward bool) uint64 {
+	d := xxhash.New()
+	_, _ = d.WriteString(q)
+	if forward {
+		_, _ = d.Write([]byte{1})
+	} else {
+		_, _ = d.Write([]byte{0})
+	}
+	return d.Sum64()
+}
+
+// GetNextLogCursor returns cursor for the last log row in rs returned by stream query with the given cursor, limit and direction.
+//
+// nil is returned if rs contains less than limit rows, i.e. there are no more rows to return.
+func GetNextLogCursor(rs []netstorage.Result, cursor *LogCursor, limit int64, forward bool) *LogCursor {
+	lct := NewLogCursorTracker(cursor, limit, forward)
+	lct.Add(rs)
+	return lct.Next()
+}
+
+// LogCursorTracker tracks the last log row in stream query results, which are written in chunks.
+//
+// Chunks must be passed to Add in the query direction.
+type LogCursorTracker struct {
+	cursor  *LogCursor
+	limit   int64
+	forward bool
+
+	rowsCount int64
+	last      *LogCursor
+}
+
+// NewLogCursorTracker returns new LogCursorTracker for stream query with the given cursor, limit and direction.
+func NewLogCursorTracker(cursor *LogCursor, limit int64, forward bool) *LogCursorTracker {
+	return &LogCursorTracker{
+		cursor:  cursor,
+		limit:   limit,
+		forward: forward,
+	}
+}
+
+// Add registers the next chunk of stream query results.
+func (lct *LogCursorTracker) Add(rs []netstorage.Result) {
+	var last *netstorage.Result
+	for i := range rs {
+		r := &rs[i]
+		if len(r.Timestamps) == 0 {
+			continue
+		}
+		lct.rowsCount += int64(len(r.Timestamps))
+		if last == nil || isLogRowAfter(r.Timestamps[len(r.Timestamps)-1], r.MetricNameHash,
+			last.Timestamps[len(last.Timestamps)-1], last.MetricNameHash, lct.forward) {
+			last = r
+		}
+	}
+	if last == nil {
+		return
+	}
+	timestamps := last.Timestamps
+	timestamp := timestamps[len(timestamps)-1]
+	n := 0
+	for i := len(timestamps) - 1; i >= 0 && timestamps[i] == timestamp; i-- {
+		n++
+	}
+	lc := &LogCursor{
+		Forward:    lct.forward,
+		Timestamp:  timestamp,
+		StreamHash: last.MetricNameHash,
+		Offset:     uint64(n - 1),
+	}
+	if lct.last != nil && lct.last.StreamHash == lc.StreamHash && lct.last.Timestamp == lc.Timestamp {
+		// The previous chunks contain rows with the same stream and timestamp.
+		lc.Offset += lct.last.Offset + 1
+	} else if cursor := lct.cursor; cursor != nil && cursor.StreamHash == lc.StreamHash && cursor.Timestamp == lc.Timestamp {
+		// rs doesn't contain rows with the same stream and timestamp returned before the cursor.
+		lc.Offset += cursor.Offset + 1
+	}
+	lct.last = lc
+}
+
+// Next returns cursor for the last log row registered with Add.
+//
+// nil is returned if less than limit rows were registered, i.e. there are no more rows to return.
+func (lct *LogCursorTracker) Next() *LogCursor {
+	if lct.limit <= 0 || lct.rowsCount < lct.limit {
+		return nil
+	}
+	return lct.last
+}
+
+// GetLastLogCursor returns forward cursor for the last log row in rs if it goes after prev. Otherwise prev is returned.
+//
+// It is used for tracking the last log row sent to tail client, so the tail may be resumed after this row.
+// Rows in every rs entry must be sorted by timestamp in ascending order.
+func GetLastLogCursor(rs []netstorage.Result, prev *LogCursor) *LogCursor {
+	lct := NewLogCursorTracker(prev, 0, true)
+	lct.Add(rs)
+	lc := lct.last
+	if lc == nil {
+		return prev
+	}
+	if prev != nil && (lc.Timestamp != prev.Timestamp || lc.StreamHash != prev.StreamHash) &&
+		!isLogRowAfter(lc.Timestamp, lc.StreamHash, prev.Timestamp, prev.StreamHash, true) {
+		// rs contains only log rows arriving late.
+		return prev
+	}
+	return lc
+}
+
+// RemoveLogRowsUpToCursor removes log rows up to the given forward cursor lc from rs.
+//
+// Rows in every rs entry must be sorted by timestamp in ascending order.
+func RemoveLogRowsUpToCursor(rs []netstorage.Result, lc *LogCursor) []netstorage.Result {
+	dst := rs[:0]
+	for i := range rs {
+		r := &rs[i]
+		from, to := getLogRowsAfterCursor(r.Timestamps, r.MetricNameHash, lc)
+		if from >= to {
+			continue
+		}
+		r.Timestamps = r.Timestamps[from:to]
+		r.Values = r.Values[from:to]
+		r.Datas = r.Datas[from:to]
+		dst = append(dst, *r)
+	}
+	return dst
+}
+
+// isLogRowAfter returns true if the log row with timestamp and hash goes after the row with prevTimestamp and prevHash
+// in stream query results with the given direction.
+func isLogRowAfter(timestamp int64, hash uint64, prevTimestamp int64, prevHash uint64, forward bool) bool {
+	if timestamp == prevTimestamp {
+		return hash > prevHash
+	}
+	if forward {
+		return timestamp > prevTimestamp
+	}
+	return timestamp < prevTimestamp
+}
+
+// getStreamHash returns stream hash for ts.
+//
+// The hash must match netstorage.Result.MetricNameHash.
+func getStreamHash(ts *timeseries) uint64 {
+	bb := bbPool.Get()
+	bb.B = marshalMetricNameSorted(bb.B[:0], &ts.MetricName)
+	h := xxhash.Sum64(bb.B)
+	bbPool.Put(bb)
+	return h
+}
+
+// getLogRowsAfterCursor returns [from, to) index range for rows with the given timestamps, which go after lc.
+//
+// timestamps must be sorted in ascending order. hash must contain stream hash for the rows.
+func getLogRowsAfterCursor(timestamps []int64, hash uint64, lc *LogCursor) (int, int) {
+	n := len(timestamps)
+	if lc == nil {
+		return 0, n
+	}
+	lowerBound := sort.Search(n, func(i int) bool {
+		return timestamps[i] >= lc.Timestamp
+	})
+	upperBound := sort.Search(n, func(i int) bool {
+		return timestamps[i] > lc.Timestamp
+	})
+	if lc.Forward {
+		switch {
+		case hash < lc.StreamHash:
+			return upperBound, n
+		case hash > lc.StreamHash:
+			return lowerBound, n
+		default:
+			from := lowerBound + int(lc.Offset) + 1
+			if from > upperBound {
+				from = upperBound
+			}
+			return from, n
+		}
+	}
+	switch {
+	case hash < lc.StreamHash:
+		return 0, lowerBound
+	case hash > lc.StreamHash:
+		return 0, upperBound
+	default:
+		to := upperBound - int(lc.Offset) - 1
+		if to < lowerBound {
+			to = lowerBound
+		}
+		return 0, to
+	}
+}
@@ -0,0 +1,250 @@
+package querier
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestLogCursorMarshalUnmarshal(t *testing.T) {
+	f := func(lc *LogCursor) {
+		t.Helper()
+		s := lc.String()
+		lcParsed, err := ParseLogCursor(s)
+		if err != nil {
+			t.Fatalf("cannot parse cursor %q: %s", s, err)
+		}
+		if !reflect.DeepEqual(lcParsed, lc) {
+			t.Fatalf("unexpected cursor parsed from %q;\ngot\n%+v\nwant\n%+v", s, lcParsed, lc)
+		}
+	}
+	f(&LogCursor{})
+	f(&LogCursor{
+		Forward:    true,
+		QueryHash:  GetLogCursorQueryHash(`{app="foo"}`, true),
+		Timestamp:  1600000000000,
+		StreamHash: 0xdeadbeefcafebabe,
+		Offset:     12345,
+	})
+	f(&LogCursor{
+		Timestamp:  -1,
+		StreamHash: 1,
+	})
+}
+
+func TestParseLogCursorFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		lc, err := ParseLogCursor(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q; got %+v", s, lc)
+		}
+	}
+	f("")
+	f("foo bar")
+	f("Ag")
+	f("AAIB")
+	f((&LogCursor{}).String() + "AA")
+}
+
+func TestLogCursorPagination(t *testing.T) {
+	newTimeseriesList := func() []*timeseries {
+		var tss []*timeseries
+		for _, app := range []string{"foo", "bar", "baz"} {
+			var ts timeseries
+			ts.MetricName.AddTag("app", app)
+			for _, timestamp := range []int64{10, 20, 20, 20, 30, 40, 40} {
+				ts.Timestamps = append(ts.Timestamps, timestamp)
+				ts.Values = append(ts.Values, 1)
+				ts.Datas = append(ts.Datas, []byte(fmt.Sprintf("%s %d #%d", app, timestamp, len(ts.Datas))))
+			}
+			tss = append(tss, &ts)
+		}
+		return tss
+	}
+	getRows := func(limit int64, forward bool, lc *LogCursor) ([]string, *LogCursor) {
+		t.Helper()
+		tss := limitLogRows(newTimeseriesList(), limit, forward, lc)
+		rs, err := timeseriesToResult(tss, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var rows []string
+		for i := range rs {
+			for _, data := range rs[i].Datas {
+				rows = append(rows, string(data))
+			}
+		}
+		return rows, GetNextLogCursor(rs, lc, limit, forward)
+	}
+	f := func(limit int64, forward bool) {
+		t.Helper()
+		rowsExpected, lc := getRows(0, forward, nil)
+		if lc != nil {
+			t.Fatalf("unexpected non-nil cursor for zero limit: %+v", lc)
+		}
+		m := make(map[string]bool)
+		pages := 0
+		for {
+			rows, lcNext := getRows(limit, forward, lc)
+			if int64(len(rows)) > limit {
+				t.Fatalf("too many rows returned; got %d; want up to %d", len(rows), limit)
+			}
+			for _, row := range rows {
+				if m[row] {
+					t.Fatalf("duplicate row %q at page #%d for limit=%d, forward=%v", row, pages, limit, forward)
+				}
+				m[row] = true
+			}
+			pages++
+			if lcNext == nil {
+				break
+			}
+			if pages > len(rowsExpected) {
+				t.Fatalf("too many pages for limit=%d, forward=%v", limit, forward)
+			}
+			lc, _ = ParseLogCursor(lcNext.String())
+		}
+		if len(m) != len(rowsExpected) {
+			t.Fatalf("unexpected number of rows returned for limit=%d, forward=%v; got %d; want %d", limit, forward, len(m), len(rowsExpected))
+		}
+	}
+	for limit := int64(1); limit <= 25; limit++ {
+		f(limit, false)
+		f(limit, true)
+	}
+}
+
+func TestLogCursorTrackerChunks(t *testing.T) {
+	newResult := func(app string, timestamps ...int64) netstorage.Result {
+		var r netstorage.Result
+		r.MetricName.AddTag("app", app)
+		r.MetricNameHash = xxhash.Sum64String(app)
+		for _, timestamp := range timestamps {
+			r.Timestamps = append(r.Timestamps, timestamp)
+			r.Values = append(r.Values, 1)
+			r.Datas = append(r.Datas, []byte(fmt.Sprintf("%s %d", app, timestamp)))
+		}
+		return r
+	}
+	f := func(chunks [][]netstorage.Result, cursor *LogCursor, limit int64, forward bool) {
+		t.Helper()
+		var rs []netstorage.Result
+		lct := NewLogCursorTracker(cursor, limit, forward)
+		for _, chunk := range chunks {
+			lct.Add(chunk)
+			rs = append(rs, chunk...)
+		}
+		lc := lct.Next()
+		lcExpected := GetNextLogCursor(rs, cursor, limit, forward)
+		if !reflect.DeepEqual(lc, lcExpected) {
+			t.Fatalf("unexpected cursor;\ngot\n%+v\nwant\n%+v", lc, lcExpected)
+		}
+	}
+
+	// Forward chunks
+	chunks := [][]netstorage.Result{
+		{newResult("foo", 10, 20), newResult("bar", 15)},
+		{newResult("foo", 30, 40, 40), newResult("bar", 40)},
+		{},
+	}
+	f(chunks, nil, 7, true)
+	f(chunks, nil, 8, true)
+	f(chunks, &LogCursor{Forward: true, Timestamp: 10, StreamHash: xxhash.Sum64String("foo")}, 7, true)
+
+	// Backward chunks
+	chunks = [][]netstorage.Result{
+		{newResult("foo", 30, 40), newResult("bar", 40)},
+		{newResult("foo", 10, 10), newResult("bar", 15)},
+	}
+	f(chunks, nil, 6, false)
+	f(chunks, nil, 7, false)
+	f(chunks, &LogCursor{Timestamp: 10, StreamHash: xxhash.Sum64String("foo")}, 6, false)
+
+	// The last chunk contains only rows with the same stream and timestamp as the previous chunk.
+	lct := NewLogCursorTracker(nil, 4, true)
+	lct.Add([]netstorage.Result{newResult("foo", 10, 20)})
+	lct.Add([]netstorage.Result{newResult("foo", 20, 20)})
+	lc := lct.Next()
+	lcExpected := &LogCursor{
+		Forward:    true,
+		Timestamp:  20,
+		StreamHash: xxhash.Sum64String("foo"),
+		Offset:     2,
+	}
+	if !reflect.DeepEqual(lc, lcExpected) {
+		t.Fatalf("unexpected cursor;\ngot\n%+v\nwant\n%+v", lc, lcExpected)
+	}
+}
+
+func TestTailLogCursorResume(t *testing.T) {
+	type row struct {
+		app       string
+		timestamp int64
+	}
+	// Rows in forward order of LogCursor: by timestamp, then by stream hash.
+	var rows []row
+	for _, timestamp := range []int64{10, 10, 20, 30, 30, 30} {
+		for _, app := range []string{"foo", "bar"} {
+			rows = append(rows, row{app, timestamp})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].timestamp != rows[j].timestamp {
+			return rows[i].timestamp < rows[j].timestamp
+		}
+		return xxhash.Sum64String(rows[i].app) < xxhash.Sum64String(rows[j].app)
+	})
+	newResults := func(rows []row) []netstorage.Result {
+		var rs []netstorage.Result
+		m := make(map[string]int)
+		for _, r := range rows {
+			idx, ok := m[r.app]
+			if !ok {
+				idx = len(rs)
+				m[r.app] = idx
+				rs = append(rs, netstorage.Result{})
+				rs[idx].MetricName.AddTag("app", r.app)
+				rs[idx].MetricNameHash = xxhash.Sum64String(r.app)
+			}
+			rs[idx].Timestamps = append(rs[idx].Timestamps, r.timestamp)
+			rs[idx].Values = append(rs[idx].Values, 1)
+			rs[idx].Datas = append(rs[idx].Datas, []byte(r.app))
+		}
+		return rs
+	}
+	countRows := func(rs []netstorage.Result) int {
+		n := 0
+		for i := range rs {
+			n += len(rs[i].Timestamps)
+		}
+		return n
+	}
+
+	for n := 1; n <= len(rows); n++ {
+		// The first n rows are sent to the client in two messages.
+		var lc *LogCursor
+		lc = GetLastLogCursor(newResults(rows[:n/2]), lc)
+		lc = GetLastLogCursor(newResults(rows[n/2:n]), lc)
+		lc, err := ParseLogCursor(lc.String())
+		if err != nil {
+			t.Fatalf("cannot parse cursor: %s", err)
+		}
+
+		// The remaining rows must be sent after resuming the tail from lc.
+		rs := RemoveLogRowsUpToCursor(newResults(rows), lc)
+		if m := countRows(rs); m != len(rows)-n {
+			t.Fatalf("unexpected number of rows after resuming from row #%d; got %d; want %d", n, m, len(rows)-n)
+		}
+	}
+
+	// Late rows mustn't move the cursor back.
+	lc := GetLastLogCursor(newResults(rows[len(rows)-1:]), nil)
+	if lcLate := GetLastLogCursor(newResults(rows[:1]), lc); lcLate != lc {
+		t.Fatalf("unexpected cursor after late rows; got %+v; want %+v", lcLate, lc)
+	}
+}
@@ -0,0 +1,199 @@
+package querier
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var detectedFieldsQueries = metrics.NewCounter(`vm_detected_fields_queries_total`)
+
+// DetectedField describes a field detected in log lines.
+type DetectedField struct {
+	// Label is the field name.
+	Label string
+
+	// Type is the inferred type for field values: string, int, float, boolean, duration or bytes.
+	Type string
+
+	// Cardinality is the number of unique field values in the sampled log lines.
+	Cardinality int
+
+	// Parsers contains parsers, which extract the field from log lines: json and/or logfmt.
+	Parsers []string
+}
+
+// GetDetectedFields returns fields detected in up to lineLimit newest log lines for the log query q on ec time range.
+//
+// The format of every log line is detected automatically. Fields are sorted by their names.
+// Up to fieldLimit fields are returned.
+func GetDetectedFields(ec *EvalConfig, q string, lineLimit, fieldLimit int) ([]DetectedField, error) {
+	detectedFieldsQueries.Inc()
+	if lineLimit <= 0 {
+		return nil, fmt.Errorf("line limit must be positive; got %d", lineLimit)
+	}
+	ec.Limit = int64(lineLimit)
+	ec.Forward = false
+	rs, e, err := Exec(ec, q, false)
+	if err != nil {
+		return nil, err
+	}
+	if !isLogQueryExpr(e) {
+		return nil, fmt.Errorf("expecting log query; got %q", e.AppendString(nil))
+	}
+
+	qt := ec.Tracer.NewChild("detect fields")
+	fd := newFieldsDetector()
+	lines := 0
+	for i := range rs {
+		for _, line := range rs[i].Datas {
+			if lines >= lineLimit {
+				break
+			}
+			fd.addLine(line)
+			lines++
+		}
+	}
+	dfs := fd.getFields(fieldLimit)
+	qt.Donef("lines=%d, fields=%d", lines, len(dfs))
+	return dfs, nil
+}
+
+// fieldsDetector detects fields in log lines.
+type fieldsDetector struct {
+	pp     pipelineProcessor
+	fields map[string]*detectedFieldState
+}
+
+type detectedFieldState struct {
+	typ          string
+	values       map[string]struct{}
+	parsedJSON   bool
+	parsedLogfmt bool
+}
+
+func newFieldsDetector() *fieldsDetector {
+	return &fieldsDetector{
+		fields: make(map[string]*detectedFieldState),
+	}
+}
+
+// addLine adds fields from the given line to fd.
+//
+// JSON is tried for lines starting with `{`, while logfmt is tried for the rest of lines.
+func (fd *fieldsDetector) addLine(line []byte) {
+	pp := &fd.pp
+	pp.fields = pp.fields[:0]
+	line = bytes.TrimSpace(line)
+	if len(line) > 0 && line[0] == '{' {
+		if err := pp.parseJSON(line); err == nil {
+			fd.addFields(true)
+			return
+		}
+		pp.fields = pp.fields[:0]
+	}
+	if bytes.IndexByte(line, '=') < 0 {
+		// The line cannot contain logfmt fields.
+		return
+	}
+	if err := pp.parseLogfmt(line); err != nil {
+		return
+	}
+	fd.addFields(false)
+}
+
+func (fd *fieldsDetector) addFields(isJSON bool) {
+	for i := range fd.pp.fields {
+		f := &fd.pp.fields[i]
+		if !isJSON && len(f.value) == 0 {
+			// Skip words without values, since they are likely a part of unstructured text.
+			continue
+		}
+		dfs := fd.fields[f.name]
+		if dfs == nil {
+			dfs = &detectedFieldState{
+				typ:    getFieldValueType(f.value),
+				values: make(map[string]struct{}),
+			}
+			fd.fields[f.name] = dfs
+		} else {
+			dfs.typ = mergeFieldTypes(dfs.typ, getFieldValueType(f.value))
+		}
+		dfs.values[f.value] = struct{}{}
+		if isJSON {
+			dfs.parsedJSON = true
+		} else {
+			dfs.parsedLogfmt = true
+		}
+	}
+}
+
+// getFields returns up to limit detected fields sorted by names.
+func (fd *fieldsDetector) getFields(limit int) []DetectedField {
+	names := make([]string, 0, len(fd.fields))
+	for name := range fd.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	dfs := make([]DetectedField, 0, len(names))
+	for _, name := range names {
+		st := fd.fields[name]
+		var parsers []string
+		if st.parsedJSON {
+			parsers = append(parsers, "json")
+		}
+		if st.parsedLogfmt {
+			parsers = append(parsers, "logfmt")
+		}
+		dfs = append(dfs, DetectedField{
+			Label:       name,
+			Type:        st.typ,
+			Cardinality: len(st.values),
+			Parsers:     parsers,
+		})
+	}
+	return dfs
+}
+
+// getFieldValueType returns the inferred type for the given field value.
+func getFieldValueType(s string) string {
+	if len(s) == 0 {
+		return "string"
+	}
+	if s == "true" || s == "false" {
+		return "boolean"
+	}
+	if ch := s[0]; ch >= '0' && ch <= '9' || ch == '-' || ch == '+' || ch == '.' {
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return "int"
+		}
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return "float"
+		}
+		if _, err := time.ParseDuration(s); err == nil {
+			return "duration"
+		}
+		if _, err := parseBytes(s); err == nil {
+			return "bytes"
+		}
+	}
+	return "string"
+}
+
+// mergeFieldTypes returns the type, which fits values with both a and b types.
+func mergeFieldTypes(a, b string) string {
+	if a == b {
+		return a
+	}
+	if a == "int" && b == "float" || a == "float" && b == "int" {
+		return "float"
+	}
+	return "string"
+}
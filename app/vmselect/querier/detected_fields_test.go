@@ -0,0 +1,90 @@
+package querier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetFieldValueType(t *testing.T) {
+	f := func(s, typeExpected string) {
+		t.Helper()
+		if typ := getFieldValueType(s); typ != typeExpected {
+			t.Fatalf("unexpected type for %q; got %q; want %q", s, typ, typeExpected)
+		}
+	}
+	f(``, "string")
+	f(`foo`, "string")
+	f(`true`, "boolean")
+	f(`false`, "boolean")
+	f(`123`, "int")
+	f(`-42`, "int")
+	f(`1.5`, "float")
+	f(`-1e3`, "float")
+	f(`1.5s`, "duration")
+	f(`1h30m`, "duration")
+	f(`10KB`, "bytes")
+	f(`1.5MiB`, "bytes")
+	f(`1.2.3`, "string")
+}
+
+func TestMergeFieldTypes(t *testing.T) {
+	f := func(a, b, typeExpected string) {
+		t.Helper()
+		if typ := mergeFieldTypes(a, b); typ != typeExpected {
+			t.Fatalf("unexpected type for (%q, %q); got %q; want %q", a, b, typ, typeExpected)
+		}
+	}
+	f("int", "int", "int")
+	f("int", "float", "float")
+	f("float", "int", "float")
+	f("int", "duration", "string")
+	f("boolean", "string", "string")
+	f("bytes", "bytes", "bytes")
+}
+
+func TestFieldsDetector(t *testing.T) {
+	f := func(lines []string, limit int, dfsExpected []DetectedField) {
+		t.Helper()
+		fd := newFieldsDetector()
+		for _, line := range lines {
+			fd.addLine([]byte(line))
+		}
+		dfs := fd.getFields(limit)
+		if !reflect.DeepEqual(dfs, dfsExpected) {
+			t.Fatalf("unexpected fields\ngot\n%+v\nwant\n%+v", dfs, dfsExpected)
+		}
+	}
+	f(nil, 0, []DetectedField{})
+	f([]string{"unstructured line", "another line"}, 0, []DetectedField{})
+
+	// JSON lines
+	f([]string{
+		`{"level":"info","duration":"1.5s","status":200}`,
+		`{"level":"error","duration":"20ms","status":500}`,
+		`{"level":"info","status":200,"latency":0.5}`,
+	}, 0, []DetectedField{
+		{Label: "duration", Type: "duration", Cardinality: 2, Parsers: []string{"json"}},
+		{Label: "latency", Type: "float", Cardinality: 1, Parsers: []string{"json"}},
+		{Label: "level", Type: "string", Cardinality: 2, Parsers: []string{"json"}},
+		{Label: "status", Type: "int", Cardinality: 2, Parsers: []string{"json"}},
+	})
+
+	// logfmt lines mixed with JSON and unstructured lines
+	f([]string{
+		`level=info size=10KB took=5`,
+		`level=warn size=2MB took=5.5 msg="slow request"`,
+		`{"level":"debug"}`,
+		`plain text`,
+	}, 0, []DetectedField{
+		{Label: "level", Type: "string", Cardinality: 3, Parsers: []string{"json", "logfmt"}},
+		{Label: "msg", Type: "string", Cardinality: 1, Parsers: []string{"logfmt"}},
+		{Label: "size", Type: "bytes", Cardinality: 2, Parsers: []string{"logfmt"}},
+		{Label: "took", Type: "float", Cardinality: 2, Parsers: []string{"logfmt"}},
+	})
+
+	// limit
+	f([]string{`b=1 a=2 c=3`}, 2, []DetectedField{
+		{Label: "a", Type: "int", Cardinality: 1, Parsers: []string{"logfmt"}},
+		{Label: "b", Type: "int", Cardinality: 1, Parsers: []string{"logfmt"}},
+	})
+}
@@ -1,15 +1,18 @@
 package querier
 
 import (
+	"container/heap"
 	"flag"
 	"fmt"
 	"math"
 	"runtime"
+	"sort"
 	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
@@ -90,6 +93,9 @@ type EvalConfig struct {
 	Limit     int64
 	Forward   bool
 
+	// Cursor is an optional position to resume stream query from.
+	Cursor *LogCursor
+
 	// QuotedRemoteAddr contains quoted remote address.
 	QuotedRemoteAddr string
 
@@ -102,6 +108,31 @@ type EvalConfig struct {
 
 	DenyPartialResponse bool
 
+	// QueryStats is an optional stats for the query execution.
+	QueryStats *netstorage.QueryStats
+
+	// Tracer is an optional tracer for the query execution.
+	Tracer *querytracer.Tracer
+
+	// Canceler is an optional canceler for the query execution.
+	Canceler *netstorage.QueryCanceler
+
+	// LogRowsWriter is an optional callback for writing log rows selected by stream query.
+	//
+	// If it is set, then Exec passes log rows to it in chunks as soon as they are selected instead of returning them.
+	// Chunks may contain log rows for the same streams. Chunks are passed in the query direction if Limit is set.
+	// Otherwise chunks are passed in the order log rows are read from vmstorage nodes.
+	LogRowsWriter func(rs []netstorage.Result) error
+
+	// memoryBudget limits memory used for holding log lines selected by the query.
+	memoryBudget *queryMemoryBudget
+
+	// queryLimiter enforces tenant limits on the data read from vmstorage nodes by the whole query.
+	queryLimiter *netstorage.QueryLimiter
+
+	// logRowsWriter writes log rows for stream query without limit as soon as they are read from vmstorage nodes.
+	logRowsWriter *logRowsWriter
+
 	timestamps     []int64
 	timestampsOnce sync.Once
 }
@@ -115,11 +146,19 @@ func newEvalConfig(src *EvalConfig) *EvalConfig {
 	ec.Step = src.Step
 	ec.Limit = src.Limit
 	ec.Forward = src.Forward
+	ec.Cursor = src.Cursor
 	ec.Deadline = src.Deadline
 	ec.MayCache = src.MayCache
 	ec.LookbackDelta = src.LookbackDelta
 	ec.DenyPartialResponse = src.DenyPartialResponse
-
+	ec.QueryStats = src.QueryStats
+	ec.Tracer = src.Tracer
+	ec.Canceler = src.Canceler
+	ec.memoryBudget = src.memoryBudget
+	ec.queryLimiter = src.queryLimiter
+	ec.logRowsWriter = src.logRowsWriter
+
+	// do not copy src.LogRowsWriter - log rows must be written only by the root EvalConfig.
 	// do not copy src.timestamps - they must be generated again.
 	return &ec
 }
@@ -180,7 +219,50 @@ func getTimestamps(start, end, step int64) []int64 {
 	return timestamps
 }
 
+// checkCanceled returns netstorage.ErrQueryCanceled if the query for ec has been canceled.
+//
+// It must be called between CPU-bound evaluation steps, since cancellation interrupts only vmstorage connections.
+func checkCanceled(ec *EvalConfig) error {
+	if ec.Canceler.IsCanceled() {
+		return netstorage.ErrQueryCanceled
+	}
+	return nil
+}
+
 func evalExpr(ec *EvalConfig, e logql.Expr, isRoot bool) ([]*timeseries, error) {
+	if !ec.Tracer.Enabled() {
+		rv, err := evalExprInternal(ec, e, isRoot)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCanceled(ec); err != nil {
+			return nil, err
+		}
+		return rv, nil
+	}
+	qt := ec.Tracer.NewChild("eval: query=%s, timeRange=[%d..%d], step=%d", e.AppendString(nil), ec.Start, ec.End, ec.Step)
+	ecChild := newEvalConfig(ec)
+	ecChild.Tracer = qt
+	rv, err := evalExprInternal(ecChild, e, isRoot)
+	if err == nil {
+		err = checkCanceled(ec)
+	}
+	if err != nil {
+		qt.Donef("error: %s", err)
+		return nil, err
+	}
+	rows := 0
+	for _, ts := range rv {
+		rows += len(ts.Timestamps)
+	}
+	qt.Donef("series=%d, rows=%d", len(rv), rows)
+	return rv, nil
+}
+
+func evalExprInternal(ec *EvalConfig, e logql.Expr, isRoot bool) ([]*timeseries, error) {
+	if err := checkCanceled(ec); err != nil {
+		return nil, err
+	}
 	if me, ok := e.(*logql.MetricExpr); ok {
 		if isRoot {
 			return evalMetricExpr(ec, me)
@@ -194,6 +276,19 @@ func evalExpr(ec *EvalConfig, e logql.Expr, isRoot bool) ([]*timeseries, error)
 		}
 		return rv, nil
 	}
+	if pe, ok := e.(*logql.PipelineExpr); ok {
+		if isRoot {
+			return evalPipelineExprRoot(ec, pe)
+		}
+		re := &logql.RollupExpr{
+			Expr: pe,
+		}
+		rv, err := evalRollupFunc(ec, "default_rollup", rollupDefault, e, re, nil)
+		if err != nil {
+			return nil, fmt.Errorf(`cannot evaluate %q: %w`, pe.AppendString(nil), err)
+		}
+		return rv, nil
+	}
 	if re, ok := e.(*logql.RollupExpr); ok {
 		rv, err := evalRollupFunc(ec, "d efault_rollup", rollupDefault, e, re, nil)
 		if err != nil {
@@ -275,6 +370,10 @@ func evalExpr(ec *EvalConfig, e logql.Expr, isRoot bool) ([]*timeseries, error)
 		return rv, nil
 	}
 	if be, ok := e.(*logql.BinaryOpExpr); ok {
+		if isRoot && isLineFilterExpr(be) {
+			// Line filters must be applied before limiting the number of returned log rows.
+			return evalPipelineExprRoot(ec, &logql.PipelineExpr{Expr: be})
+		}
 		left, err := evalExpr(ec, be.Left, isRoot)
 		if err != nil {
 			return nil, err
@@ -350,6 +449,10 @@ func tryGetArgRollupFuncWithMetricExpr(ae *logql.AggrFuncExpr) (*logql.FuncExpr,
 	if !ok {
 		return nil, nil
 	}
+	if fe.Modifier.Op != "" {
+		// Log rows must be grouped according to `by (...)` or `without (...)` modifier before calculating the rollup.
+		return nil, nil
+	}
 	nrf := getRollupFunc(fe.Name)
 	if nrf == nil {
 		return nil, nil
@@ -473,8 +576,32 @@ func evalRollupFunc(ec *EvalConfig, name string, rf rollupFunc, expr logql.Expr,
 	}
 	var rvs []*timeseries
 	var err error
-	if me, ok := re.Expr.(*logql.MetricExpr); ok {
+	if me, ok := re.Expr.(*logql.MetricExpr); ok && (getRollupModifier(expr) == nil || me.IsEmpty()) {
 		rvs, err = evalRollupFuncWithMetricExpr(ecNew, name, rf, expr, me, iafc, re.Window)
+	} else if me, ok := re.Expr.(*logql.MetricExpr); ok {
+		if iafc != nil {
+			logger.Panicf("BUG: iafc must be nil for rollup %q with `by` or `without` modifier", name)
+		}
+		// Log rows for streams must be grouped according to `by (...)` or `without (...)` modifier before calculating the rollup,
+		// so the stream selector is evaluated as log pipeline without stages.
+		pe := &logql.PipelineExpr{
+			Expr: me,
+		}
+		rvs, err = evalRollupFuncWithPipelineExpr(ecNew, name, rf, expr, pe, re.Window)
+	} else if pe, ok := re.Expr.(*logql.PipelineExpr); ok {
+		if iafc != nil {
+			logger.Panicf("BUG: iafc must be nil for rollup %q over log pipeline %q", name, re.AppendString(nil))
+		}
+		rvs, err = evalRollupFuncWithPipelineExpr(ecNew, name, rf, expr, pe, re.Window)
+	} else if isLineFilterExpr(re.Expr) {
+		if iafc != nil {
+			logger.Panicf("BUG: iafc must be nil for rollup %q over line filter %q", name, re.AppendString(nil))
+		}
+		// Line filters such as `{app="foo"} |= "bar"` are evaluated as log pipeline without stages.
+		pe := &logql.PipelineExpr{
+			Expr: re.Expr,
+		}
+		rvs, err = evalRollupFuncWithPipelineExpr(ecNew, name, rf, expr, pe, re.Window)
 	} else {
 		if iafc != nil {
 			logger.Panicf("BUG: iafc must be nil for rollup %q over subquery %q", name, re.AppendString(nil))
@@ -532,6 +659,17 @@ func evalRollupFuncWithSubquery(ec *EvalConfig, name string, rf rollupFunc, expr
 	if err != nil {
 		return nil, err
 	}
+	if modifier := getRollupModifier(expr); modifier != nil {
+		// Merge subquery results according to `by (...)` or `without (...)` modifier before calculating the rollup.
+		// Timestamps are copied, since they may be shared among time series, while groupTimeseriesByModifier modifies them.
+		for i, tsSQ := range tssSQ {
+			var ts timeseries
+			ts.CopyFromShallowTimestamps(tsSQ)
+			ts.Timestamps = append([]int64(nil), tsSQ.Timestamps...)
+			tssSQ[i] = &ts
+		}
+		tssSQ = groupTimeseriesByModifier(tssSQ, modifier)
+	}
 	if len(tssSQ) == 0 {
 		if name == "absent_over_time" {
 			tss := evalNumber(ec, 1)
@@ -625,10 +763,6 @@ var (
 	rollupResultCacheMiss        = metrics.NewCounter(`vm_rollup_result_cache_miss_total`)
 )
 
-var (
-	errReachedLimit = fmt.Errorf("reached limit")
-)
-
 func evalMetricExpr(ec *EvalConfig, me *logql.MetricExpr) ([]*timeseries, error) {
 	if me.IsEmpty() {
 		return evalNumber(ec, nan), nil
@@ -643,7 +777,7 @@ func evalMetricExpr(ec *EvalConfig, me *logql.MetricExpr) ([]*timeseries, error)
 		MaxTimestamp: ec.End,
 		TagFilterss:  [][]storage.TagFilter{tfs},
 	}
-	rss, isPartial, err := netstorage.ProcessSearchQuery(ec.AuthToken, sq, 2, ec.Deadline)
+	rss, isPartial, err := netstorage.ProcessSearchQueryWithLimit(ec.Tracer, ec.AuthToken, sq, 2, ec.Limit, ec.Forward, ec.QueryStats, ec.Canceler, ec.queryLimiter, ec.Deadline)
 	if err != nil {
 		return nil, err
 	}
@@ -657,58 +791,275 @@ func evalMetricExpr(ec *EvalConfig, me *logql.MetricExpr) ([]*timeseries, error)
 		return nil, nil
 	}
 
-	var tss []*timeseries
-	var tssLock sync.RWMutex
-	var interval int64
+	lrc := newLogRowsCollector(ec, true)
+	err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		if len(rs.Timestamps) == 0 {
+			return nil
+		}
+		size := getLogRowsSize(rs.Datas)
+		if err := ec.memoryBudget.Add(size); err != nil {
+			return err
+		}
+		var ts timeseries
+		ts.MetricName.CopyFrom(&rs.MetricName)
+		ts.Timestamps = append(ts.Timestamps, rs.Timestamps...)
+		ts.Values = append(ts.Values, rs.Values...)
+		ts.Datas = append(ts.Datas, rs.Datas...)
+		ts.denyReuse = true
+		return lrc.add([]*timeseries{&ts}, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCanceled(ec); err != nil {
+		return nil, err
+	}
+	return lrc.finish(), nil
+}
 
-	if ec.End > ec.Start {
-		interval = (ec.End - ec.Start) / ec.Limit
+// evalPipelineExprRoot evaluates log pipeline such as `{app="api"} | json` for stream query.
+func evalPipelineExprRoot(ec *EvalConfig, pe *logql.PipelineExpr) ([]*timeseries, error) {
+	if pe.Unwrap() != nil {
+		return nil, fmt.Errorf("`unwrap` stage can be used only inside range aggregations such as `sum_over_time(%s [5m])`", pe.AppendString(nil))
+	}
+	lrc := newLogRowsCollector(ec, true)
+	if _, err := evalPipelineExpr(ec, pe, ec.Start, ec.End, lrc); err != nil {
+		return nil, err
 	}
+	if err := checkCanceled(ec); err != nil {
+		return nil, err
+	}
+	return lrc.finish(), nil
+}
 
-	err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
-		tssLock.Lock()
+// logRowsCollector collects log rows from concurrently running goroutines.
+//
+// Log rows for stream query are written to ec.logRowsWriter as soon as they are collected if it is set.
+// Otherwise up to 2*ec.Limit log rows in the query direction are kept for stream query,
+// so memory usage is bounded by the limit instead of the number of selected log rows.
+type logRowsCollector struct {
+	ec       *EvalConfig
+	isStream bool
+
+	mu   sync.Mutex
+	tss  []*timeseries
+	size uint64
+	rows int64
+}
 
-		var ts timeseries
-		var prevTimestamp int64
+// newLogRowsCollector returns new logRowsCollector for ec.
+//
+// isStream must be set if log rows are collected for stream query.
+func newLogRowsCollector(ec *EvalConfig, isStream bool) *logRowsCollector {
+	return &logRowsCollector{
+		ec:       ec,
+		isStream: isStream,
+	}
+}
 
-		if !ec.Forward {
-			for i := 0; i < len(rs.Timestamps); i++ {
-				currTimestamp, currValue, currData := rs.Timestamps[i], rs.Values[i], rs.Datas[i]
-				if currTimestamp-prevTimestamp < interval {
-					continue
-				}
-				prevTimestamp = currTimestamp
-				ts.Datas = append(ts.Datas, currData)
-				ts.Values = append(ts.Values, currValue)
-				ts.Timestamps = append(ts.Timestamps, currTimestamp)
+// add adds tss with log rows of the given size, which is already added to ec.memoryBudget.
+func (lrc *logRowsCollector) add(tss []*timeseries, size uint64) error {
+	ec := lrc.ec
+	if lrc.isStream && ec.logRowsWriter != nil {
+		tss = limitLogRows(tss, 0, ec.Forward, ec.Cursor)
+		err := ec.logRowsWriter.write(tss)
+		ec.memoryBudget.Sub(size)
+		return err
+	}
+
+	lrc.mu.Lock()
+	defer lrc.mu.Unlock()
+	lrc.tss = append(lrc.tss, tss...)
+	lrc.size += size
+	for _, ts := range tss {
+		lrc.rows += int64(len(ts.Timestamps))
+	}
+	if lrc.isStream && ec.Limit > 0 && lrc.rows > 2*ec.Limit {
+		// Drop log rows, which cannot be returned because of the limit, and release memory occupied by them.
+		// The rows are dropped only after the limit is exceeded twice, so every selected row is processed
+		// a constant number of times on average.
+		// Rows are kept in ascending order, so they don't need sorting on the next call.
+		lrc.tss = selectLogRows(lrc.tss, ec.Limit, ec.Forward, ec.Cursor)
+		size := getTimeseriesLogRowsSize(lrc.tss)
+		ec.memoryBudget.Sub(lrc.size - size)
+		lrc.size = size
+		lrc.rows = 0
+		for _, ts := range lrc.tss {
+			lrc.rows += int64(len(ts.Timestamps))
+		}
+	}
+	return nil
+}
+
+// finish returns the collected log rows.
+//
+// Log rows for stream query are limited with limitLogRows. Memory occupied by the dropped rows is released from ec.memoryBudget.
+func (lrc *logRowsCollector) finish() []*timeseries {
+	if !lrc.isStream {
+		return lrc.tss
+	}
+	ec := lrc.ec
+	tss := limitLogRows(lrc.tss, ec.Limit, ec.Forward, ec.Cursor)
+	ec.memoryBudget.Sub(lrc.size - getTimeseriesLogRowsSize(tss))
+	return tss
+}
+
+// isLineFilterExpr returns true if e is a stream selector with line filters such as `{app="foo"} |= "bar"`.
+func isLineFilterExpr(e logql.Expr) bool {
+	be, ok := e.(*logql.BinaryOpExpr)
+	if !ok || !logql.IsBinaryOpLineFilter(be.Op) {
+		return false
+	}
+	if _, ok := be.Right.(*logql.StringExpr); !ok {
+		return false
+	}
+	switch t := be.Left.(type) {
+	case *logql.MetricExpr:
+		return true
+	case *logql.BinaryOpExpr:
+		return isLineFilterExpr(t)
+	default:
+		return false
+	}
+}
+
+// limitLogRows returns up to limit newest log rows from tss (or up to limit oldest rows if forward is set),
+// which go after the given optional lc.
+//
+// Rows in the returned time series are sorted by timestamp in descending order (or in ascending order if forward is set).
+// Rows with the same timestamp are ordered by stream hash. Zero limit means no limit.
+func limitLogRows(tss []*timeseries, limit int64, forward bool, lc *LogCursor) []*timeseries {
+	rvs := selectLogRows(tss, limit, forward, lc)
+	if !forward {
+		for _, ts := range rvs {
+			reverseTimeseriesRows(ts)
+		}
+	}
+	return rvs
+}
+
+// selectLogRows works like limitLogRows, but rows in the returned time series are always sorted by timestamp in ascending order.
+func selectLogRows(tss []*timeseries, limit int64, forward bool, lc *LogCursor) []*timeseries {
+	cs := make([]logRowsCursor, 0, len(tss))
+	for _, ts := range tss {
+		if !sort.IsSorted(&timeseriesRowsSorter{ts: ts}) {
+			sort.Stable(&timeseriesRowsSorter{ts: ts})
+		}
+		hash := getStreamHash(ts)
+		from, to := getLogRowsAfterCursor(ts.Timestamps, hash, lc)
+		truncateTimeseriesRows(ts, from, to)
+		if len(ts.Timestamps) == 0 {
+			continue
+		}
+		c := logRowsCursor{
+			ts:           ts,
+			hash:         hash,
+			rowsSelected: len(ts.Timestamps),
+		}
+		if !forward {
+			c.idx = len(ts.Timestamps) - 1
+		}
+		cs = append(cs, c)
+	}
+	if limit > 0 {
+		// Select limit rows across all the time series with k-way merge.
+		h := &logRowsHeap{
+			forward: forward,
+		}
+		for i := range cs {
+			c := &cs[i]
+			c.rowsSelected = 0
+			h.cursors = append(h.cursors, c)
+		}
+		heap.Init(h)
+		for n := int64(0); n < limit && len(h.cursors) > 0; n++ {
+			c := h.cursors[0]
+			c.rowsSelected++
+			if forward {
+				c.idx++
+			} else {
+				c.idx--
 			}
-		} else {
-			for i := len(rs.Timestamps) - 1; i >= 0; i-- {
-				currTimestamp, currValue, currData := rs.Timestamps[i], rs.Values[i], rs.Datas[i]
-				if prevTimestamp-currTimestamp < interval {
-					continue
-				}
-				prevTimestamp = currTimestamp
-				ts.Datas = append(ts.Datas, currData)
-				ts.Values = append(ts.Values, currValue)
-				ts.Timestamps = append(ts.Timestamps, currTimestamp)
+			if c.idx < 0 || c.idx >= len(c.ts.Timestamps) {
+				heap.Pop(h)
+			} else {
+				heap.Fix(h, 0)
 			}
 		}
+	}
 
-		if len(ts.Timestamps) > 0 {
-			ts.MetricName.CopyFrom(&rs.MetricName)
-			ts.denyReuse = true
-			tss = append(tss, &ts)
+	rvs := tss[:0]
+	for i := range cs {
+		c := &cs[i]
+		if c.rowsSelected == 0 {
+			continue
+		}
+		ts := c.ts
+		if forward {
+			truncateTimeseriesRows(ts, 0, c.rowsSelected)
+		} else {
+			truncateTimeseriesRows(ts, len(ts.Timestamps)-c.rowsSelected, len(ts.Timestamps))
 		}
+		rvs = append(rvs, ts)
+	}
+	return rvs
+}
 
-		tssLock.Unlock()
-		return nil
-	})
-	if err != errReachedLimit && err != nil {
-		return nil, err
+// truncateTimeseriesRows leaves only rows in the range [from..to) in ts.
+//
+// The remaining rows are copied to newly allocated slices, so the dropped log lines can be freed by GC.
+func truncateTimeseriesRows(ts *timeseries, from, to int) {
+	if from == 0 && to == len(ts.Timestamps) {
+		return
+	}
+	ts.Timestamps = append([]int64(nil), ts.Timestamps[from:to]...)
+	ts.Values = append([]float64(nil), ts.Values[from:to]...)
+	ts.Datas = append([][]byte(nil), ts.Datas[from:to]...)
+}
+
+func reverseTimeseriesRows(ts *timeseries) {
+	for i, j := 0, len(ts.Timestamps)-1; i < j; i, j = i+1, j-1 {
+		ts.Timestamps[i], ts.Timestamps[j] = ts.Timestamps[j], ts.Timestamps[i]
+		ts.Values[i], ts.Values[j] = ts.Values[j], ts.Values[i]
+		ts.Datas[i], ts.Datas[j] = ts.Datas[j], ts.Datas[i]
 	}
+}
 
-	return tss, nil
+type logRowsCursor struct {
+	ts           *timeseries
+	hash         uint64
+	idx          int
+	rowsSelected int
+}
+
+func (c *logRowsCursor) timestamp() int64 {
+	return c.ts.Timestamps[c.idx]
+}
+
+// logRowsHeap returns the cursor with the newest row at the top (or with the oldest row if forward is set).
+//
+// Cursors with the same timestamp are ordered by stream hash.
+type logRowsHeap struct {
+	cursors []*logRowsCursor
+	forward bool
+}
+
+func (h *logRowsHeap) Len() int { return len(h.cursors) }
+func (h *logRowsHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	return isLogRowAfter(b.timestamp(), b.hash, a.timestamp(), a.hash, h.forward)
+}
+func (h *logRowsHeap) Swap(i, j int) {
+	h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i]
+}
+func (h *logRowsHeap) Push(x interface{}) {
+	h.cursors = append(h.cursors, x.(*logRowsCursor))
+}
+func (h *logRowsHeap) Pop() interface{} {
+	a := h.cursors
+	x := a[len(a)-1]
+	h.cursors = a[:len(a)-1]
+	return x
 }
 
 func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
@@ -747,6 +1098,11 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 	}
 
 	// Fetch the remaining part of the result.
+	// Log lines are fetched only if the rollup is calculated over their sizes.
+	fetchData := uint8(1)
+	if rollupFuncsLineBytes[name] {
+		fetchData = 2
+	}
 	tfs := toTagFilters(me.LabelFilters)
 	minTimestamp := start - maxSilenceInterval
 	if window > ec.Step {
@@ -761,7 +1117,7 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 		MaxTimestamp: ec.End,
 		TagFilterss:  [][]storage.TagFilter{tfs},
 	}
-	rss, isPartial, err := netstorage.ProcessSearchQuery(ec.AuthToken, sq, 1, ec.Deadline)
+	rss, isPartial, err := netstorage.ProcessSearchQuery(ec.Tracer, ec.AuthToken, sq, fetchData, ec.QueryStats, ec.Canceler, ec.queryLimiter, ec.Deadline)
 	if err != nil {
 		return nil, err
 	}
@@ -826,6 +1182,10 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 	} else {
 		tss, err = evalRollupNoIncrementalAggregate(name, rss, rcs, preFunc, sharedTimestamps, removeMetricGroup)
 	}
+	if err == nil {
+		// Do not cache results for the canceled query.
+		err = checkCanceled(ec)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -850,7 +1210,11 @@ func getRollupMemoryLimiter() *memoryLimiter {
 
 func evalRollupWithIncrementalAggregate(name string, iafc *incrementalAggrFuncContext, rss *netstorage.Results, rcs []*rollupConfig,
 	preFunc func(values []float64, timestamps []int64), sharedTimestamps []int64, removeMetricGroup bool) ([]*timeseries, error) {
+	useLineBytes := rollupFuncsLineBytes[name]
 	err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		if useLineBytes {
+			setLineBytesValues(rs.Values, rs.Datas)
+		}
 		preFunc(rs.Values, rs.Timestamps)
 		ts := getTimeseries()
 		defer putTimeseries(ts)
@@ -883,7 +1247,11 @@ func evalRollupNoIncrementalAggregate(name string, rss *netstorage.Results, rcs
 	preFunc func(values []float64, timestamps []int64), sharedTimestamps []int64, removeMetricGroup bool) ([]*timeseries, error) {
 	tss := make([]*timeseries, 0, rss.Len()*len(rcs))
 	var tssLock sync.Mutex
+	useLineBytes := rollupFuncsLineBytes[name]
 	err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		if useLineBytes {
+			setLineBytesValues(rs.Values, rs.Datas)
+		}
 		preFunc(rs.Values, rs.Timestamps)
 		for _, rc := range rcs {
 			if tsm := newTimeseriesMap(name, sharedTimestamps, &rs.MetricName); tsm != nil {
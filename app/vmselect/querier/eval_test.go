@@ -0,0 +1,248 @@
+package querier
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+)
+
+func TestLimitLogRows(t *testing.T) {
+	newTimeseries := func(app string, timestamps ...int64) *timeseries {
+		var ts timeseries
+		ts.MetricName.AddTag("app", app)
+		for _, timestamp := range timestamps {
+			ts.Timestamps = append(ts.Timestamps, timestamp)
+			ts.Values = append(ts.Values, 1)
+			ts.Datas = append(ts.Datas, []byte(app))
+		}
+		return &ts
+	}
+	f := func(limit int64, forward bool, resultExpected map[string][]int64) {
+		t.Helper()
+		tss := []*timeseries{
+			newTimeseries("foo", 10, 20, 30, 40),
+			newTimeseries("bar", 15, 25),
+			newTimeseries("baz"),
+			newTimeseries("qux", 5, 45, 50),
+		}
+		rvs := limitLogRows(tss, limit, forward, nil)
+		result := make(map[string][]int64)
+		for _, ts := range rvs {
+			app := string(ts.MetricName.GetTagValue("app"))
+			if len(ts.Values) != len(ts.Timestamps) || len(ts.Datas) != len(ts.Timestamps) {
+				t.Fatalf("unexpected number of rows for %q; timestamps=%d, values=%d, datas=%d", app, len(ts.Timestamps), len(ts.Values), len(ts.Datas))
+			}
+			result[app] = ts.Timestamps
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result for limit=%d, forward=%v;\ngot\n%v\nwant\n%v", limit, forward, result, resultExpected)
+		}
+	}
+
+	// Zero limit
+	f(0, false, map[string][]int64{
+		"foo": {40, 30, 20, 10},
+		"bar": {25, 15},
+		"qux": {50, 45, 5},
+	})
+	f(0, true, map[string][]int64{
+		"foo": {10, 20, 30, 40},
+		"bar": {15, 25},
+		"qux": {5, 45, 50},
+	})
+
+	// Newest rows
+	f(4, false, map[string][]int64{
+		"foo": {40, 30},
+		"qux": {50, 45},
+	})
+	f(5, false, map[string][]int64{
+		"foo": {40, 30},
+		"bar": {25},
+		"qux": {50, 45},
+	})
+
+	// Oldest rows
+	f(3, true, map[string][]int64{
+		"foo": {10},
+		"qux": {5},
+		"bar": {15},
+	})
+
+	// Limit exceeding the number of rows
+	f(100, true, map[string][]int64{
+		"foo": {10, 20, 30, 40},
+		"bar": {15, 25},
+		"qux": {5, 45, 50},
+	})
+}
+
+func TestIsLineFilterExpr(t *testing.T) {
+	f := func(q string, resultExpected bool) {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		result := isLineFilterExpr(e)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %v; want %v", q, result, resultExpected)
+		}
+	}
+	f(`{app="foo"}`, false)
+	f(`{app="foo"} |= "bar"`, true)
+	f(`{app="foo"} |= "bar" !~ "baz.+"`, true)
+	f(`{app="foo"} or {app="bar"}`, false)
+	f(`count_over_time({app="foo"}[5m]) > 10`, false)
+}
+
+func TestLogRowsCollector(t *testing.T) {
+	newTimeseries := func(app string, timestamps ...int64) *timeseries {
+		var ts timeseries
+		ts.MetricName.AddTag("app", app)
+		for _, timestamp := range timestamps {
+			ts.Timestamps = append(ts.Timestamps, timestamp)
+			ts.Values = append(ts.Values, 1)
+			ts.Datas = append(ts.Datas, []byte(app))
+		}
+		return &ts
+	}
+	getChunks := func() [][]*timeseries {
+		return [][]*timeseries{
+			{newTimeseries("foo", 10, 20, 30, 40)},
+			{newTimeseries("bar", 15, 25)},
+			{newTimeseries("qux", 5, 45, 50)},
+		}
+	}
+	getResult := func(tss []*timeseries) map[string][]int64 {
+		result := make(map[string][]int64)
+		for _, ts := range tss {
+			app := string(ts.MetricName.GetTagValue("app"))
+			result[app] = append(result[app], ts.Timestamps...)
+		}
+		return result
+	}
+	f := func(limit int64, forward bool, resultExpected map[string][]int64) {
+		t.Helper()
+		ec := &EvalConfig{
+			Limit:        limit,
+			Forward:      forward,
+			memoryBudget: newQueryMemoryBudget(),
+		}
+		lrc := newLogRowsCollector(ec, true)
+		for _, tss := range getChunks() {
+			size := getTimeseriesLogRowsSize(tss)
+			if err := ec.memoryBudget.Add(size); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := lrc.add(tss, size); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		tss := lrc.finish()
+		result := getResult(tss)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result for limit=%d, forward=%v;\ngot\n%v\nwant\n%v", limit, forward, result, resultExpected)
+		}
+		// Memory for dropped log rows must be released.
+		if n, nExpected := ec.memoryBudget.Usage(), getTimeseriesLogRowsSize(tss); n != nExpected {
+			t.Fatalf("unexpected memory usage; got %d; want %d", n, nExpected)
+		}
+		ec.memoryBudget.Release()
+	}
+
+	f(0, false, map[string][]int64{
+		"foo": {40, 30, 20, 10},
+		"bar": {25, 15},
+		"qux": {50, 45, 5},
+	})
+	f(4, false, map[string][]int64{
+		"foo": {40, 30},
+		"qux": {50, 45},
+	})
+	f(3, true, map[string][]int64{
+		"foo": {10},
+		"qux": {5},
+		"bar": {15},
+	})
+
+	// Held log rows must be bounded by 2*limit and kept in ascending order.
+	ec := &EvalConfig{
+		Limit:        2,
+		memoryBudget: newQueryMemoryBudget(),
+	}
+	lrc := newLogRowsCollector(ec, true)
+	for i := int64(0); i < 10; i++ {
+		tss := []*timeseries{newTimeseries("foo", 100-i*10)}
+		size := getTimeseriesLogRowsSize(tss)
+		if err := ec.memoryBudget.Add(size); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := lrc.add(tss, size); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if lrc.rows > 2*ec.Limit {
+			t.Fatalf("too many held log rows after adding chunk #%d; got %d; want up to %d", i, lrc.rows, 2*ec.Limit)
+		}
+		if n := ec.memoryBudget.Usage(); n != lrc.size {
+			t.Fatalf("unexpected memory usage after adding chunk #%d; got %d; want %d", i, n, lrc.size)
+		}
+	}
+	for _, ts := range lrc.tss {
+		if !sort.IsSorted(&timeseriesRowsSorter{ts: ts}) {
+			t.Fatalf("held log rows must be sorted in ascending order; got %v", ts.Timestamps)
+		}
+		// Dropped log rows mustn't be referenced by held log rows, so they can be freed.
+		if cap(ts.Datas) != len(ts.Datas) {
+			t.Fatalf("dropped log lines are still referenced by held log rows; len=%d, cap=%d", len(ts.Datas), cap(ts.Datas))
+		}
+	}
+	tss := lrc.finish()
+	if result := getResult(tss); !reflect.DeepEqual(result, map[string][]int64{"foo": {100, 90}}) {
+		t.Fatalf("unexpected result; got %v; want %v", result, map[string][]int64{"foo": {100, 90}})
+	}
+	if n, nExpected := ec.memoryBudget.Usage(), getTimeseriesLogRowsSize(tss); n != nExpected {
+		t.Fatalf("unexpected memory usage after finish; got %d; want %d", n, nExpected)
+	}
+	ec.memoryBudget.Release()
+
+	// Log rows must be written as soon as they are added if ec.logRowsWriter is set.
+	var chunks int
+	var rows []int64
+	ec = &EvalConfig{
+		memoryBudget: newQueryMemoryBudget(),
+	}
+	ec.logRowsWriter = &logRowsWriter{
+		e: &logql.MetricExpr{},
+		w: func(rs []netstorage.Result) error {
+			chunks++
+			for i := range rs {
+				rows = append(rows, rs[i].Timestamps...)
+			}
+			return nil
+		},
+	}
+	lrc = newLogRowsCollector(ec, true)
+	for _, tss := range getChunks() {
+		size := getTimeseriesLogRowsSize(tss)
+		if err := ec.memoryBudget.Add(size); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := lrc.add(tss, size); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if tss := lrc.finish(); len(tss) != 0 {
+		t.Fatalf("unexpected log rows left after writing: %d series", len(tss))
+	}
+	rowsExpected := []int64{40, 30, 20, 10, 25, 15, 50, 45, 5}
+	if chunks != 3 || !reflect.DeepEqual(rows, rowsExpected) {
+		t.Fatalf("unexpected written log rows; got %d chunks with %v; want 3 chunks with %v", chunks, rows, rowsExpected)
+	}
+	if n := ec.memoryBudget.Usage(); n != 0 {
+		t.Fatalf("unexpected memory usage after writing log rows; got %d; want 0", n)
+	}
+}
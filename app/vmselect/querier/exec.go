@@ -21,18 +21,29 @@ var logSlowQueryDuration = flag.Duration("search.logSlowQueryDuration", 5*time.S
 var slowQueries = metrics.NewCounter(`vm_slow_queries_total`)
 
 // Exec executes q for the given ec.
+//
+// Query execution stats are collected in ec.QueryStats if it is set.
+// The query execution is traced with ec.Tracer if it is set.
+// The query may be canceled via CancelActiveQuery while it is executed.
+// Log rows selected by stream query are passed to ec.LogRowsWriter instead of returning them if it is set.
+// Memory used for holding log lines is limited by -search.maxMemoryPerQuery.
 func Exec(ec *EvalConfig, q string, isFirstPointOnly bool) ([]netstorage.Result, logql.Expr, error) {
-	if *logSlowQueryDuration > 0 {
-		startTime := time.Now()
-		defer func() {
-			d := time.Since(startTime)
-			if d >= *logSlowQueryDuration {
-				logger.Warnf("slow query according to -search.logSlowQueryDuration=%s: duration=%.3f seconds, start=%d, end=%d, step=%d, accountID=%d, projectID=%d, query=%q",
-					*logSlowQueryDuration, d.Seconds(), ec.Start/1000, ec.End/1000, ec.Step/1000, ec.AuthToken.AccountID, ec.AuthToken.ProjectID, q)
-				slowQueries.Inc()
-			}
-		}()
+	if ec.QueryStats == nil {
+		ec.QueryStats = &netstorage.QueryStats{}
+	}
+	if ec.Canceler == nil {
+		ec.Canceler = netstorage.NewQueryCanceler()
 	}
+	startTime := time.Now()
+	defer func() {
+		d := time.Since(startTime)
+		ec.QueryStats.SetExecDuration(d)
+		if *logSlowQueryDuration > 0 && d >= *logSlowQueryDuration {
+			logger.Warnf("slow query according to -search.logSlowQueryDuration=%s: duration=%.3f seconds, start=%d, end=%d, step=%d, accountID=%d, projectID=%d, query=%q, stats: %s",
+				*logSlowQueryDuration, d.Seconds(), ec.Start/1000, ec.End/1000, ec.Step/1000, ec.AuthToken.AccountID, ec.AuthToken.ProjectID, q, ec.QueryStats)
+			slowQueries.Inc()
+		}
+	}()
 
 	ec.validate()
 
@@ -40,13 +51,43 @@ func Exec(ec *EvalConfig, q string, isFirstPointOnly bool) ([]netstorage.Result,
 	if err != nil {
 		return nil, e, err
 	}
+	ec.Tracer.Printf("parsed query: %s", e.AppendString(nil))
 
-	qid := activeQueriesV.Add(ec, q)
-	rv, err := evalExpr(ec, e, true)
-	activeQueriesV.Remove(qid)
+	qid, err := beginQuery(ec, q, e)
 	if err != nil {
 		return nil, e, err
 	}
+	ec.memoryBudget = newQueryMemoryBudget()
+	defer ec.memoryBudget.Release()
+	ec.queryLimiter = netstorage.NewQueryLimiter(ec.AuthToken)
+	if ec.LogRowsWriter != nil && ec.Limit <= 0 && isLogQueryExpr(e) {
+		// Log rows for stream query without limit may be written in any order as soon as they are read from vmstorage nodes.
+		ec.logRowsWriter = &logRowsWriter{
+			e: e,
+			w: ec.LogRowsWriter,
+		}
+	}
+
+	var rv []*timeseries
+	if isFirstPointOnly {
+		rv, err = evalExpr(ec, e, true)
+	} else {
+		// Range queries over long time ranges are split by time, so the parts are executed in parallel.
+		rv, err = evalExprSplitByTime(ec, e, *splitQueriesByInterval, *maxSplitQueriesParallelism)
+	}
+	EndQuery(qid)
+	if err != nil {
+		return nil, e, err
+	}
+
+	if ec.LogRowsWriter != nil && isLogQueryExpr(e) {
+		// Log rows for queries split by time are already written by evalLogQuerySplits,
+		// while log rows for queries without limit are already written by ec.logRowsWriter.
+		if err := writeLogRows(ec, e, rv); err != nil {
+			return nil, e, err
+		}
+		return nil, e, nil
+	}
 
 	if isFirstPointOnly {
 		// Remove all the points except the first one from every time series.
@@ -56,14 +97,61 @@ func Exec(ec *EvalConfig, q string, isFirstPointOnly bool) ([]netstorage.Result,
 		}
 	}
 
+	qt := ec.Tracer.NewChild("convert %d series to results", len(rv))
 	maySort := maySortResults(e, rv)
 	result, err := timeseriesToResult(rv, maySort)
 	if err != nil {
+		qt.Donef("error: %s", err)
 		return nil, e, err
 	}
+	qt.Donef("sorted=%v", maySort)
 	return result, e, err
 }
 
+// writeLogRows passes log rows from tss to ec.LogRowsWriter.
+func writeLogRows(ec *EvalConfig, e logql.Expr, tss []*timeseries) error {
+	if len(tss) == 0 {
+		return nil
+	}
+	qt := ec.Tracer.NewChild("write %d series", len(tss))
+	rs, err := timeseriesToResult(tss, maySortResults(e, tss))
+	if err != nil {
+		qt.Donef("error: %s", err)
+		return err
+	}
+	if err := ec.LogRowsWriter(rs); err != nil {
+		qt.Donef("error: %s", err)
+		return fmt.Errorf("cannot write log rows: %w", err)
+	}
+	qt.Donef("")
+	return nil
+}
+
+// logRowsWriter passes log rows to EvalConfig.LogRowsWriter from concurrently running goroutines.
+type logRowsWriter struct {
+	e logql.Expr
+
+	mu sync.Mutex
+	w  func(rs []netstorage.Result) error
+}
+
+func (lw *logRowsWriter) write(tss []*timeseries) error {
+	if len(tss) == 0 {
+		return nil
+	}
+	rs, err := timeseriesToResult(tss, maySortResults(lw.e, tss))
+	if err != nil {
+		return err
+	}
+	lw.mu.Lock()
+	err = lw.w(rs)
+	lw.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("cannot write log rows: %w", err)
+	}
+	return nil
+}
+
 func maySortResults(e logql.Expr, tss []*timeseries) bool {
 	if len(tss) > 100 {
 		// There is no sense in sorting a lot of results
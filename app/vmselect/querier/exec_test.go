@@ -3370,6 +3370,74 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{}
 		f(q, resultExpected)
 	})
+	t.Run(`count_over_time(selector) by (label)`, func(t *testing.T) {
+		t.Parallel()
+		q := `count_over_time({app="api"}[5m]) by (host)`
+		resultExpected := []netstorage.Result{}
+		f(q, resultExpected)
+	})
+	t.Run(`count_over_time(selector) without (label)`, func(t *testing.T) {
+		t.Parallel()
+		q := `count_over_time({app="api"}[5m]) without (host)`
+		resultExpected := []netstorage.Result{}
+		f(q, resultExpected)
+	})
+	t.Run(`count_over_time(subquery) by (label)`, func(t *testing.T) {
+		t.Parallel()
+		q := `sort(count_over_time((
+			label_set(time(), "host", "a", "x", "1")
+			or label_set(time(), "host", "a", "x", "2")
+			or label_set(time(), "host", "b", "x", "3")
+		)[400s:100s]) by (host))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{4, 4, 4, 4, 4, 4},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("host"),
+			Value: []byte("b"),
+		}}
+		r2 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{8, 8, 8, 8, 8, 8},
+			Timestamps: timestampsExpected,
+		}
+		r2.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("host"),
+			Value: []byte("a"),
+		}}
+		resultExpected := []netstorage.Result{r1, r2}
+		f(q, resultExpected)
+	})
+	t.Run(`count_over_time(subquery) without (label)`, func(t *testing.T) {
+		t.Parallel()
+		q := `sort(count_over_time((
+			label_set(time(), "host", "a", "x", "1")
+			or label_set(time(), "host", "a", "x", "2")
+			or label_set(time(), "host", "b", "x", "3")
+		)[400s:100s]) without (x))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{4, 4, 4, 4, 4, 4},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("host"),
+			Value: []byte("b"),
+		}}
+		r2 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{8, 8, 8, 8, 8, 8},
+			Timestamps: timestampsExpected,
+		}
+		r2.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("host"),
+			Value: []byte("a"),
+		}}
+		resultExpected := []netstorage.Result{r1, r2}
+		f(q, resultExpected)
+	})
 	t.Run(`sum(scalar)`, func(t *testing.T) {
 		t.Parallel()
 		q := `sum(123)`
@@ -3647,6 +3715,18 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run(`sum_over_time(time() != 0)`, func(t *testing.T) {
+		t.Parallel()
+		// Numeric comparison with the line filter operator must be evaluated as subquery.
+		q := `sum_over_time((time() != 0)[5m:1m])`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{4200, 5400, 6300, 7200, 8400, 9300},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run(`sum2(time)`, func(t *testing.T) {
 		t.Parallel()
 		q := `sum2(time()/100)`
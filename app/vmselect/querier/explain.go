@@ -0,0 +1,99 @@
+package querier
+
+import (
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+)
+
+// ExprSelector describes log stream selector from the query and the way it is evaluated.
+type ExprSelector struct {
+	// Selector is the log stream selector such as `{app="api"}`.
+	Selector string
+
+	// StorageFilters contains label filters, which are pushed down to vmstorage.
+	StorageFilters []string
+
+	// LineFilters contains line filters, which are applied in vmselect.
+	LineFilters []string
+
+	// Stages contains pipeline stages, which are applied in vmselect.
+	Stages []string
+
+	// Limit is the limit on the number of log rows pushed down to vmstorage.
+	//
+	// Zero Limit means the limit isn't pushed down to vmstorage.
+	Limit int64
+
+	// Forward is the direction pushed down to vmstorage together with Limit.
+	Forward bool
+}
+
+// GetExprSelectors returns log stream selectors from e, which is evaluated with ec.
+func GetExprSelectors(ec *EvalConfig, e logql.Expr) []ExprSelector {
+	return appendExprSelectors(nil, ec, e, true)
+}
+
+func appendExprSelectors(dst []ExprSelector, ec *EvalConfig, e logql.Expr, isRoot bool) []ExprSelector {
+	switch t := e.(type) {
+	case *logql.MetricExpr:
+		sel := newExprSelector(t)
+		if isRoot && ec.Limit > 0 {
+			// See evalMetricExpr
+			sel.Limit = ec.Limit
+			sel.Forward = ec.Forward
+		}
+		return append(dst, sel)
+	case *logql.PipelineExpr:
+		sel, ok := newExprSelectorForPipeline(t.Expr)
+		if !ok {
+			return dst
+		}
+		for _, se := range t.Stages {
+			sel.Stages = append(sel.Stages, string(se.AppendString(nil)))
+		}
+		return append(dst, sel)
+	case *logql.BinaryOpExpr:
+		if isLineFilterExpr(t) {
+			if sel, ok := newExprSelectorForPipeline(t); ok {
+				dst = append(dst, sel)
+			}
+			return dst
+		}
+		dst = appendExprSelectors(dst, ec, t.Left, isRoot)
+		return appendExprSelectors(dst, ec, t.Right, isRoot)
+	case *logql.RollupExpr:
+		return appendExprSelectors(dst, ec, t.Expr, false)
+	case *logql.FuncExpr:
+		for _, arg := range t.Args {
+			dst = appendExprSelectors(dst, ec, arg, false)
+		}
+		return dst
+	case *logql.AggrFuncExpr:
+		for _, arg := range t.Args {
+			dst = appendExprSelectors(dst, ec, arg, false)
+		}
+		return dst
+	default:
+		return dst
+	}
+}
+
+func newExprSelector(me *logql.MetricExpr) ExprSelector {
+	var sel ExprSelector
+	sel.Selector = string(me.AppendString(nil))
+	for i := range me.LabelFilters {
+		sel.StorageFilters = append(sel.StorageFilters, string(me.LabelFilters[i].AppendString(nil)))
+	}
+	return sel
+}
+
+func newExprSelectorForPipeline(e logql.Expr) (ExprSelector, bool) {
+	me, lfs, err := getPipelineSelector(e)
+	if err != nil {
+		return ExprSelector{}, false
+	}
+	sel := newExprSelector(me)
+	for _, lf := range lfs {
+		sel.LineFilters = append(sel.LineFilters, lf.String())
+	}
+	return sel, true
+}
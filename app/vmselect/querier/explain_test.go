@@ -0,0 +1,65 @@
+package querier
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+)
+
+func TestGetExprSelectors(t *testing.T) {
+	f := func(q string, limit int64, selsExpected []ExprSelector) {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		ec := &EvalConfig{
+			Limit:   limit,
+			Forward: true,
+		}
+		sels := GetExprSelectors(ec, e)
+		if !reflect.DeepEqual(sels, selsExpected) {
+			t.Fatalf("unexpected selectors for %q;\ngot\n%+v\nwant\n%+v", q, sels, selsExpected)
+		}
+	}
+	f(`{app="api"}`, 0, []ExprSelector{
+		{
+			Selector:       `{app="api"}`,
+			StorageFilters: []string{`app="api"`},
+		},
+	})
+	f(`{app="api"}`, 10, []ExprSelector{
+		{
+			Selector:       `{app="api"}`,
+			StorageFilters: []string{`app="api"`},
+			Limit:          10,
+			Forward:        true,
+		},
+	})
+	f(`{app="api"} |= "foo" |~ "b.r"`, 10, []ExprSelector{
+		{
+			Selector:       `{app="api"}`,
+			StorageFilters: []string{`app="api"`},
+			LineFilters:    []string{`|= "foo"`, `|~ "b.r"`},
+		},
+	})
+	f(`{app="api", env!="dev"} |= "foo" | json`, 10, []ExprSelector{
+		{
+			Selector:       `{app="api", env!="dev"}`,
+			StorageFilters: []string{`app="api"`, `env!="dev"`},
+			LineFilters:    []string{`|= "foo"`},
+			Stages:         []string{"json"},
+		},
+	})
+	f(`sum(count_over_time({app="api"}[5m])) / sum(count_over_time({app="web"}[5m]))`, 10, []ExprSelector{
+		{
+			Selector:       `{app="api"}`,
+			StorageFilters: []string{`app="api"`},
+		},
+		{
+			Selector:       `{app="web"}`,
+			StorageFilters: []string{`app="web"`},
+		},
+	})
+}
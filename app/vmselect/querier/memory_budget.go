@@ -0,0 +1,133 @@
+package querier
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var maxMemoryPerQuery = flagutil.NewBytes("search.maxMemoryPerQuery", 0, "The maximum memory, which may be used for holding log lines selected by a single query. "+
+	"Queries exceeding the limit are rejected. By default it is limited by 1/8 of -memory.allowedPercent")
+
+var memoryBudgetExceeded = metrics.NewCounter(`vm_query_memory_budget_exceeded_total`)
+
+// logRowOverhead is the approximate memory overhead for a single log row in addition to the log line itself.
+//
+// It includes the slice header for the log line, the timestamp and the value.
+const logRowOverhead = 24 + 8 + 8
+
+// queryMemoryBudget limits memory used for holding log lines selected by a single query.
+//
+// The memory is also reserved in the limiter shared among concurrently executed queries.
+type queryMemoryBudget struct {
+	maxSize uint64
+
+	mu    sync.Mutex
+	usage uint64
+}
+
+// newQueryMemoryBudget returns new budget limited by -search.maxMemoryPerQuery.
+//
+// Release must be called when the budget is no longer needed.
+func newQueryMemoryBudget() *queryMemoryBudget {
+	maxSize := maxMemoryPerQuery.N
+	if maxSize <= 0 {
+		maxSize = memory.Allowed() / 8
+	}
+	return &queryMemoryBudget{
+		maxSize: uint64(maxSize),
+	}
+}
+
+// Add reserves n bytes in qmb.
+//
+// An error is returned if the query exceeds its budget or if there is no enough memory for concurrently executed queries.
+// It is safe calling Add on nil qmb.
+func (qmb *queryMemoryBudget) Add(n uint64) error {
+	if qmb == nil {
+		return nil
+	}
+	qmb.mu.Lock()
+	defer qmb.mu.Unlock()
+	if n > qmb.maxSize || qmb.maxSize-n < qmb.usage {
+		memoryBudgetExceeded.Inc()
+		return fmt.Errorf("not enough memory for holding log lines selected by the query; the query needs more than -search.maxMemoryPerQuery=%d bytes; "+
+			"possible solutions are: reducing the time range for the query; using more specific stream selectors and line filters; "+
+			"reducing `limit` query arg; increasing -search.maxMemoryPerQuery", qmb.maxSize)
+	}
+	lml := getLogLinesMemoryLimiter()
+	if !lml.Get(n) {
+		memoryBudgetExceeded.Inc()
+		return fmt.Errorf("not enough memory for holding log lines selected by the query; total available memory for concurrent requests: %d bytes; "+
+			"possible solutions are: reducing the time range for the query; using more specific stream selectors and line filters; "+
+			"switching to node with more RAM; increasing -memory.allowedPercent", lml.MaxSize)
+	}
+	qmb.usage += n
+	return nil
+}
+
+// Sub releases up to n bytes reserved in qmb with Add.
+//
+// It is safe calling Sub on nil qmb.
+func (qmb *queryMemoryBudget) Sub(n uint64) {
+	if qmb == nil {
+		return
+	}
+	qmb.mu.Lock()
+	if n > qmb.usage {
+		// Log rows may be dropped or merged after they were added, so the caller cannot always release the exact amount.
+		n = qmb.usage
+	}
+	qmb.usage -= n
+	qmb.mu.Unlock()
+	getLogLinesMemoryLimiter().Put(n)
+}
+
+// Release releases all the memory reserved in qmb.
+func (qmb *queryMemoryBudget) Release() {
+	qmb.Sub(qmb.Usage())
+}
+
+// Usage returns the number of bytes reserved in qmb.
+func (qmb *queryMemoryBudget) Usage() uint64 {
+	if qmb == nil {
+		return 0
+	}
+	qmb.mu.Lock()
+	n := qmb.usage
+	qmb.mu.Unlock()
+	return n
+}
+
+var (
+	logLinesMemoryLimiter     memoryLimiter
+	logLinesMemoryLimiterOnce sync.Once
+)
+
+func getLogLinesMemoryLimiter() *memoryLimiter {
+	logLinesMemoryLimiterOnce.Do(func() {
+		logLinesMemoryLimiter.MaxSize = uint64(memory.Allowed()) / 4
+	})
+	return &logLinesMemoryLimiter
+}
+
+// getLogRowsSize returns the approximate memory size for log rows with the given lines.
+func getLogRowsSize(datas [][]byte) uint64 {
+	n := uint64(len(datas)) * logRowOverhead
+	for _, data := range datas {
+		n += uint64(len(data))
+	}
+	return n
+}
+
+// getTimeseriesLogRowsSize returns the approximate memory size for log rows in tss.
+func getTimeseriesLogRowsSize(tss []*timeseries) uint64 {
+	n := uint64(0)
+	for _, ts := range tss {
+		n += getLogRowsSize(ts.Datas)
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+package querier
+
+import (
+	"testing"
+)
+
+func TestQueryMemoryBudget(t *testing.T) {
+	qmb := &queryMemoryBudget{
+		maxSize: 100,
+	}
+	defer qmb.Release()
+	lml := getLogLinesMemoryLimiter()
+	lmlUsage := func() uint64 {
+		lml.mu.Lock()
+		n := lml.usage
+		lml.mu.Unlock()
+		return n
+	}
+	usageInitial := lmlUsage()
+
+	if err := qmb.Add(60); err != nil {
+		t.Fatalf("cannot add 60 out of %d bytes: %s", qmb.maxSize, err)
+	}
+	if err := qmb.Add(30); err != nil {
+		t.Fatalf("cannot add 30 out of 40 bytes: %s", err)
+	}
+	if n := qmb.Usage(); n != 90 {
+		t.Fatalf("unexpected usage; got %d; want %d", n, 90)
+	}
+	if n := lmlUsage() - usageInitial; n != 90 {
+		t.Fatalf("unexpected usage for the shared limiter; got %d; want %d", n, 90)
+	}
+	if err := qmb.Add(11); err == nil {
+		t.Fatalf("expecting non-nil error when exceeding the budget")
+	}
+	if n := qmb.Usage(); n != 90 {
+		t.Fatalf("unexpected usage after failed Add; got %d; want %d", n, 90)
+	}
+
+	// Return memory back
+	qmb.Sub(60)
+	if err := qmb.Add(70); err != nil {
+		t.Fatalf("cannot add 70 bytes after releasing 60 bytes: %s", err)
+	}
+	qmb.Sub(1000)
+	if n := qmb.Usage(); n != 0 {
+		t.Fatalf("unexpected usage; got %d; want %d", n, 0)
+	}
+	if n := lmlUsage(); n != usageInitial {
+		t.Fatalf("unexpected usage for the shared limiter; got %d; want %d", n, usageInitial)
+	}
+
+	// Release all the memory
+	if err := qmb.Add(50); err != nil {
+		t.Fatalf("cannot add 50 bytes: %s", err)
+	}
+	qmb.Release()
+	if n := qmb.Usage(); n != 0 {
+		t.Fatalf("unexpected usage after Release; got %d; want %d", n, 0)
+	}
+	if n := lmlUsage(); n != usageInitial {
+		t.Fatalf("unexpected usage for the shared limiter after Release; got %d; want %d", n, usageInitial)
+	}
+
+	// nil budget doesn't limit memory usage
+	var qmbNil *queryMemoryBudget
+	if err := qmbNil.Add(1 << 40); err != nil {
+		t.Fatalf("unexpected error for nil budget: %s", err)
+	}
+	qmbNil.Sub(1 << 40)
+	qmbNil.Release()
+}
+
+func TestGetTimeseriesLogRowsSize(t *testing.T) {
+	tss := []*timeseries{
+		{
+			Datas: [][]byte{[]byte("foo"), []byte("barbaz")},
+		},
+		{
+			Datas: [][]byte{nil},
+		},
+	}
+	n := getTimeseriesLogRowsSize(tss)
+	nExpected := uint64(3*logRowOverhead + 9)
+	if n != nExpected {
+		t.Fatalf("unexpected size; got %d; want %d", n, nExpected)
+	}
+}
@@ -61,3 +61,12 @@ func ParseMetricSelector(s string) ([]storage.TagFilter, error) {
 	tfs := toTagFilters(me.LabelFilters)
 	return tfs, nil
 }
+
+// IsLogQuery returns true if q selects log rows instead of time series.
+func IsLogQuery(q string) (bool, error) {
+	expr, err := parsePromQLWithCache(q)
+	if err != nil {
+		return false, err
+	}
+	return isLogQueryExpr(expr), nil
+}
@@ -47,3 +47,25 @@ func TestParseMetricSelectorError(t *testing.T) {
 	f(`foo[5m]`)
 	f(`foo offset 5m`)
 }
+
+func TestIsLogQuery(t *testing.T) {
+	f := func(q string, resultExpected bool) {
+		t.Helper()
+		result, err := IsLogQuery(q)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", q, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %v; want %v", q, result, resultExpected)
+		}
+	}
+	f(`{job="foo"}`, true)
+	f(`{job="foo"} |= "error"`, true)
+	f(`rate({job="foo"}[5m])`, false)
+	f(`sum(count_over_time({job="foo"} |= "error" [5m])) by (level)`, false)
+	f(`1`, false)
+
+	if _, err := IsLogQuery(`sum(`); err == nil {
+		t.Fatalf("expecting non-nil error for invalid query")
+	}
+}
@@ -0,0 +1,64 @@
+package querier
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/patterns"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	patternsQueries = metrics.NewCounter(`vm_patterns_queries_total`)
+	patternsEvicted = metrics.NewCounter(`vm_patterns_evicted_total`)
+)
+
+// GetPatterns returns patterns for up to lineLimit newest log lines for the log query q on ec time range.
+//
+// Line counts for every pattern are grouped into ec.Step intervals aligned to multiples of ec.Step.
+// Up to maxPatterns patterns are tracked during the query, so the least recently seen patterns are evicted when the limit is reached.
+// Patterns are sorted by the number of lines in descending order.
+func GetPatterns(ec *EvalConfig, q string, lineLimit, maxPatterns int) ([]*patterns.Pattern, error) {
+	patternsQueries.Inc()
+	if lineLimit <= 0 {
+		return nil, fmt.Errorf("line limit must be positive; got %d", lineLimit)
+	}
+	e, err := parsePromQLWithCache(q)
+	if err != nil {
+		return nil, err
+	}
+	if !isLogQueryExpr(e) {
+		return nil, fmt.Errorf("expecting log query; got %q", e.AppendString(nil))
+	}
+
+	cfg := patterns.DefaultConfig(ec.Step)
+	cfg.MaxPatterns = maxPatterns
+	d := patterns.New(cfg)
+	lines := 0
+	ec.Limit = int64(lineLimit)
+	ec.Forward = false
+	// Log rows are passed to the drain in chunks, so they don't occupy memory until the whole query is executed.
+	ec.LogRowsWriter = func(rs []netstorage.Result) error {
+		for i := range rs {
+			r := &rs[i]
+			for j, data := range r.Datas {
+				if math.IsNaN(r.Values[j]) {
+					// The log row is filtered out.
+					continue
+				}
+				d.Add(bytesutil.ToUnsafeString(data), r.Timestamps[j])
+				lines++
+			}
+		}
+		return nil
+	}
+	if _, _, err := Exec(ec, q, false); err != nil {
+		return nil, err
+	}
+	ps := d.Patterns()
+	patternsEvicted.Add(int(d.Evicted()))
+	ec.Tracer.Printf("extracted %d patterns from %d lines; evicted patterns: %d", len(ps), lines, d.Evicted())
+	return ps, nil
+}
@@ -0,0 +1,664 @@
+package querier
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+	"github.com/valyala/fastjson"
+)
+
+// Values for `__error__` label, which is set on log lines failed to pass pipeline stages.
+//
+// See https://grafana.com/docs/loki/latest/logql/#pipeline-errors
+const (
+	errJSONParser       = "JSONParserErr"
+	errLogfmtParser     = "LogfmtParserErr"
+	errSampleExtraction = "SampleExtractionErr"
+)
+
+const errorLabel = "__error__"
+
+// lineFilter is a line filter such as `|= "foo"` or `!~ "bar.+"`.
+type lineFilter struct {
+	op string
+	s  []byte
+	re *regexp.Regexp
+}
+
+// String returns string representation of lf.
+func (lf *lineFilter) String() string {
+	return fmt.Sprintf("%s %q", lf.op, lf.s)
+}
+
+func (lf *lineFilter) match(line []byte) bool {
+	switch lf.op {
+	case "|=":
+		return bytes.Contains(line, lf.s)
+	case "!=":
+		return !bytes.Contains(line, lf.s)
+	case "|~":
+		return lf.re.Match(line)
+	case "!~":
+		return !lf.re.Match(line)
+	default:
+		return true
+	}
+}
+
+// getPipelineSelector returns stream selector and line filters from e.
+//
+// e must contain stream selector with optional line filters, i.e. `{app="foo"} |= "bar" !~ "baz"`.
+func getPipelineSelector(e logql.Expr) (*logql.MetricExpr, []*lineFilter, error) {
+	switch t := e.(type) {
+	case *logql.MetricExpr:
+		return t, nil, nil
+	case *logql.BinaryOpExpr:
+		if !logql.IsBinaryOpLineFilter(t.Op) {
+			return nil, nil, fmt.Errorf("unexpected binary operation %q in log pipeline %q; want line filter", t.Op, e.AppendString(nil))
+		}
+		se, ok := t.Right.(*logql.StringExpr)
+		if !ok {
+			return nil, nil, fmt.Errorf("line filter %q must contain string; got %q", t.Op, t.Right.AppendString(nil))
+		}
+		me, lfs, err := getPipelineSelector(t.Left)
+		if err != nil {
+			return nil, nil, err
+		}
+		lf := &lineFilter{
+			op: t.Op,
+			s:  []byte(se.S),
+		}
+		if t.Op == "|~" || t.Op == "!~" {
+			re, err := logql.CompileRegexp(se.S)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot parse regexp for line filter %q: %w", t.Op, err)
+			}
+			lf.re = re
+		}
+		lfs = append(lfs, lf)
+		return me, lfs, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected expression %q in log pipeline; want stream selector with optional line filters", e.AppendString(nil))
+	}
+}
+
+// pipelineField is a field extracted from log line by pipeline stage.
+type pipelineField struct {
+	name  string
+	value string
+}
+
+// pipelineProcessor applies pipeline stages to log lines.
+//
+// pipelineProcessor cannot be used from concurrently running goroutines.
+type pipelineProcessor struct {
+	lfs    []*lineFilter
+	stages []*logql.StageExpr
+	unwrap *logql.StageExpr
+
+	// linesProcessed and linesFiltered contain per-lfs stats.
+	linesProcessed []uint64
+	linesFiltered  []uint64
+
+	jp     fastjson.Parser
+	fields []pipelineField
+	errMsg string
+	value  float64
+}
+
+func newPipelineProcessor(pe *logql.PipelineExpr, lfs []*lineFilter) *pipelineProcessor {
+	return &pipelineProcessor{
+		lfs:    lfs,
+		stages: pe.Stages,
+		unwrap: pe.Unwrap(),
+
+		linesProcessed: make([]uint64, len(lfs)),
+		linesFiltered:  make([]uint64, len(lfs)),
+	}
+}
+
+// process applies line filters and pipeline stages to line from the stream with the given mn.
+//
+// It returns false if the line doesn't match line filters.
+// Extracted fields are stored in pp.fields, while the unwrapped value is stored in pp.value.
+func (pp *pipelineProcessor) process(mn *storage.MetricName, line []byte) bool {
+	for i, lf := range pp.lfs {
+		pp.linesProcessed[i]++
+		if !lf.match(line) {
+			pp.linesFiltered[i]++
+			return false
+		}
+	}
+	pp.fields = pp.fields[:0]
+	pp.errMsg = ""
+	pp.value = 1
+	for _, se := range pp.stages {
+		switch se.Name {
+		case "json":
+			if err := pp.parseJSON(line); err != nil && pp.errMsg == "" {
+				pp.errMsg = errJSONParser
+			}
+		case "logfmt":
+			if err := pp.parseLogfmt(line); err != nil && pp.errMsg == "" {
+				pp.errMsg = errLogfmtParser
+			}
+		case "unwrap":
+			v, err := pp.unwrapValue(mn, se)
+			if err != nil {
+				if pp.errMsg == "" {
+					pp.errMsg = errSampleExtraction
+				}
+				v = 0
+			}
+			pp.value = v
+		}
+	}
+	return true
+}
+
+// appendMetricName appends extracted fields to dst, which must contain stream labels.
+func (pp *pipelineProcessor) appendMetricName(dst *storage.MetricName) {
+	streamTags := dst.Tags[:len(dst.Tags):len(dst.Tags)]
+	isStreamTag := func(name string) bool {
+		for i := range streamTags {
+			if string(streamTags[i].Key) == name {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range pp.fields {
+		f := &pp.fields[i]
+		if pp.unwrap != nil && f.name == pp.unwrap.Label {
+			continue
+		}
+		name := f.name
+		if isStreamTag(name) {
+			// Do not override stream labels. See https://grafana.com/docs/loki/latest/logql/#json
+			name += "_extracted"
+		}
+		dst.RemoveTag(name)
+		dst.AddTag(name, f.value)
+	}
+	if pp.unwrap != nil {
+		dst.RemoveTag(pp.unwrap.Label)
+	}
+	if pp.errMsg != "" {
+		dst.AddTag(errorLabel, pp.errMsg)
+	}
+}
+
+func (pp *pipelineProcessor) unwrapValue(mn *storage.MetricName, se *logql.StageExpr) (float64, error) {
+	s, ok := pp.getField(se.Label)
+	if !ok {
+		v := mn.GetTagValue(se.Label)
+		if len(v) == 0 {
+			return 0, fmt.Errorf("missing %q label", se.Label)
+		}
+		s = string(v)
+	}
+	return convertUnwrapValue(se.Conv, s)
+}
+
+func (pp *pipelineProcessor) getField(name string) (string, bool) {
+	for i := len(pp.fields) - 1; i >= 0; i-- {
+		f := &pp.fields[i]
+		if f.name == name {
+			return f.value, true
+		}
+	}
+	return "", false
+}
+
+func (pp *pipelineProcessor) addField(name, value string) {
+	pp.fields = append(pp.fields, pipelineField{
+		name:  sanitizeLabelName(name),
+		value: value,
+	})
+}
+
+func (pp *pipelineProcessor) parseJSON(line []byte) error {
+	v, err := pp.jp.ParseBytes(line)
+	if err != nil {
+		return err
+	}
+	o, err := v.Object()
+	if err != nil {
+		return err
+	}
+	pp.addJSONObject("", o)
+	return nil
+}
+
+func (pp *pipelineProcessor) addJSONObject(prefix string, o *fastjson.Object) {
+	o.Visit(func(k []byte, v *fastjson.Value) {
+		name := string(k)
+		if len(prefix) > 0 {
+			name = prefix + "_" + name
+		}
+		switch v.Type() {
+		case fastjson.TypeObject:
+			pp.addJSONObject(name, v.GetObject())
+		case fastjson.TypeString:
+			pp.addField(name, string(v.GetStringBytes()))
+		case fastjson.TypeNumber, fastjson.TypeTrue, fastjson.TypeFalse:
+			pp.addField(name, v.String())
+		default:
+			// Skip null values and arrays like Loki does.
+		}
+	})
+}
+
+func (pp *pipelineProcessor) parseLogfmt(line []byte) error {
+	s := string(line)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if len(s) == 0 {
+			return nil
+		}
+		n := strings.IndexAny(s, "= \t")
+		if n == 0 {
+			return fmt.Errorf("missing key in logfmt line %q", line)
+		}
+		if n < 0 || s[n] != '=' {
+			// A key without value.
+			if n < 0 {
+				n = len(s)
+			}
+			pp.addField(s[:n], "")
+			s = s[n:]
+			continue
+		}
+		key := s[:n]
+		s = s[n+1:]
+		if len(s) > 0 && s[0] == '"' {
+			qs := scanQuotedString(s)
+			if len(qs) == 0 {
+				return fmt.Errorf("cannot find the end of quoted value for %q in logfmt line %q", key, line)
+			}
+			value, err := strconv.Unquote(qs)
+			if err != nil {
+				return fmt.Errorf("cannot unquote value for %q in logfmt line %q: %w", key, line, err)
+			}
+			pp.addField(key, value)
+			s = s[len(qs):]
+			continue
+		}
+		n = strings.IndexAny(s, " \t")
+		if n < 0 {
+			n = len(s)
+		}
+		pp.addField(key, s[:n])
+		s = s[n:]
+	}
+}
+
+// scanQuotedString returns double-quoted string from the beginning of s.
+//
+// It returns an empty string if s doesn't contain the closing quote.
+func scanQuotedString(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[:i+1]
+		}
+	}
+	return ""
+}
+
+// sanitizeLabelName converts s to valid label name by replacing invalid chars with `_`.
+func sanitizeLabelName(s string) string {
+	isValid := func(i int, ch byte) bool {
+		return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || i > 0 && ch >= '0' && ch <= '9'
+	}
+	needSanitize := len(s) == 0
+	for i := 0; i < len(s) && !needSanitize; i++ {
+		needSanitize = !isValid(i, s[i])
+	}
+	if !needSanitize {
+		return s
+	}
+	b := make([]byte, 0, len(s)+1)
+	if len(s) == 0 || s[0] >= '0' && s[0] <= '9' {
+		b = append(b, '_')
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if !isValid(len(b), ch) {
+			ch = '_'
+		}
+		b = append(b, ch)
+	}
+	return string(b)
+}
+
+// convertUnwrapValue converts s to float64 according to conv func from `unwrap` stage.
+func convertUnwrapValue(conv, s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	switch conv {
+	case "":
+		return strconv.ParseFloat(s, 64)
+	case "duration", "duration_seconds":
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		return d.Seconds(), nil
+	case "bytes":
+		return parseBytes(s)
+	default:
+		return 0, fmt.Errorf("unsupported conversion func %q", conv)
+	}
+}
+
+var bytesUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"eb":  1e18,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+	"eib": 1 << 60,
+}
+
+// parseBytes parses human-readable size such as `42`, `1.5KB` or `10 MiB`.
+func parseBytes(s string) (float64, error) {
+	n := 0
+	for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '.' || s[n] == '-' || s[n] == '+') {
+		n++
+	}
+	f, err := strconv.ParseFloat(s[:n], 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse bytes value %q: %w", s, err)
+	}
+	unit := strings.ToLower(strings.TrimSpace(s[n:]))
+	m, ok := bytesUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("cannot parse bytes value %q: unknown unit %q", s, s[n:])
+	}
+	return f * m, nil
+}
+
+// evalPipelineExpr returns log lines on the time range [start...end] passed through pe.
+//
+// Extracted fields are added to labels of the returned time series, while values
+// contain the unwrapped field if pe contains `unwrap` stage.
+// The log lines are passed to lrc. isPartial is set to true if some of vmstorage nodes were unavailable.
+func evalPipelineExpr(ec *EvalConfig, pe *logql.PipelineExpr, start, end int64, lrc *logRowsCollector) (bool, error) {
+	me, lfs, err := getPipelineSelector(pe.Expr)
+	if err != nil {
+		return false, err
+	}
+	if me.IsEmpty() {
+		return false, nil
+	}
+	tfs := toTagFilters(me.LabelFilters)
+	sq := &storage.SearchQuery{
+		AccountID:    ec.AuthToken.AccountID,
+		ProjectID:    ec.AuthToken.ProjectID,
+		MinTimestamp: start,
+		MaxTimestamp: end,
+		TagFilterss:  [][]storage.TagFilter{tfs},
+	}
+	rss, isPartial, err := netstorage.ProcessSearchQuery(ec.Tracer, ec.AuthToken, sq, 2, ec.QueryStats, ec.Canceler, ec.queryLimiter, ec.Deadline)
+	if err != nil {
+		return false, err
+	}
+	if isPartial && ec.DenyPartialResponse {
+		rss.Cancel()
+		return false, fmt.Errorf("cannot return full response, since some of vmstorage nodes are unavailable")
+	}
+	if rss.Len() == 0 {
+		rss.Cancel()
+		return isPartial, nil
+	}
+
+	pps := make(map[uint]*pipelineProcessor)
+	var ppsLock sync.Mutex
+	err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		ppsLock.Lock()
+		pp := pps[workerID]
+		if pp == nil {
+			pp = newPipelineProcessor(pe, lfs)
+			pps[workerID] = pp
+		}
+		ppsLock.Unlock()
+		tss := pp.processResult(rs)
+		n := getTimeseriesLogRowsSize(tss)
+		if err := ec.memoryBudget.Add(n); err != nil {
+			return err
+		}
+		return lrc.add(tss, n)
+	})
+	for _, pp := range pps {
+		for i, lf := range lfs {
+			ec.QueryStats.AddLineFilterStats(lf.String(), pp.linesProcessed[i], pp.linesFiltered[i])
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	return isPartial, nil
+}
+
+// processResult passes log lines from rs through pp and returns the matching lines grouped by labels.
+//
+// Lines, which failed to pass pipeline stages, are grouped into separate time series with `__error__` label,
+// so they don't skew range aggregations over valid lines.
+func (pp *pipelineProcessor) processResult(rs *netstorage.Result) []*timeseries {
+	m := make(map[string]*timeseries)
+	var tss []*timeseries
+	var mn storage.MetricName
+	bb := bbPool.Get()
+	for i, line := range rs.Datas {
+		if !pp.process(&rs.MetricName, line) {
+			continue
+		}
+		mn.CopyFrom(&rs.MetricName)
+		pp.appendMetricName(&mn)
+		bb.B = marshalMetricNameSorted(bb.B[:0], &mn)
+		ts := m[string(bb.B)]
+		if ts == nil {
+			ts = &timeseries{}
+			ts.MetricName.CopyFrom(&mn)
+			ts.denyReuse = true
+			m[string(bb.B)] = ts
+			tss = append(tss, ts)
+		}
+		ts.Timestamps = append(ts.Timestamps, rs.Timestamps[i])
+		ts.Values = append(ts.Values, pp.value)
+		ts.Datas = append(ts.Datas, line)
+	}
+	bbPool.Put(bb)
+	return tss
+}
+
+// groupTimeseriesByModifier merges tss according to `by (...)` or `without (...)` modifier
+// from range aggregation such as `quantile_over_time(0.99, {app="api"} | json | unwrap latency_ms [5m]) by (route)`.
+//
+// `__error__` label is always preserved, so lines with pipeline errors aren't mixed with valid lines.
+func groupTimeseriesByModifier(tss []*timeseries, modifier *logql.ModifierExpr) []*timeseries {
+	byArgs := append([]string{errorLabel}, modifier.Args...)
+	m := make(map[string]*timeseries)
+	var keys []string
+	bb := bbPool.Get()
+	for _, ts := range tss {
+		switch strings.ToLower(modifier.Op) {
+		case "by":
+			ts.MetricName.RemoveTagsOn(byArgs)
+		case "without":
+			ts.MetricName.RemoveTagsIgnoring(modifier.Args)
+		}
+		bb.B = marshalMetricNameSorted(bb.B[:0], &ts.MetricName)
+		dst := m[string(bb.B)]
+		if dst == nil {
+			m[string(bb.B)] = ts
+			keys = append(keys, string(bb.B))
+			continue
+		}
+		dst.Timestamps = append(dst.Timestamps, ts.Timestamps...)
+		dst.Values = append(dst.Values, ts.Values...)
+		dst.Datas = append(dst.Datas, ts.Datas...)
+	}
+	bbPool.Put(bb)
+	rvs := make([]*timeseries, 0, len(keys))
+	for _, k := range keys {
+		ts := m[k]
+		sort.Stable(&timeseriesRowsSorter{ts: ts})
+		rvs = append(rvs, ts)
+	}
+	return rvs
+}
+
+// getRollupModifier returns `by (...)` or `without (...)` modifier for range aggregation expr
+// such as `count_over_time({app="api"}[5m]) by (host)` or nil if expr has no modifier.
+func getRollupModifier(expr logql.Expr) *logql.ModifierExpr {
+	fe, ok := expr.(*logql.FuncExpr)
+	if !ok || fe.Modifier.Op == "" {
+		return nil
+	}
+	return &fe.Modifier
+}
+
+// timeseriesRowsSorter sorts ts rows by timestamps.
+type timeseriesRowsSorter struct {
+	ts *timeseries
+}
+
+func (trs *timeseriesRowsSorter) Len() int { return len(trs.ts.Timestamps) }
+func (trs *timeseriesRowsSorter) Less(i, j int) bool {
+	return trs.ts.Timestamps[i] < trs.ts.Timestamps[j]
+}
+func (trs *timeseriesRowsSorter) Swap(i, j int) {
+	ts := trs.ts
+	ts.Timestamps[i], ts.Timestamps[j] = ts.Timestamps[j], ts.Timestamps[i]
+	ts.Values[i], ts.Values[j] = ts.Values[j], ts.Values[i]
+	if len(ts.Datas) > 0 {
+		ts.Datas[i], ts.Datas[j] = ts.Datas[j], ts.Datas[i]
+	}
+}
+
+// evalRollupFuncWithPipelineExpr evaluates rollup func over log pipeline
+// such as `sum_over_time({app="api"} | logfmt | unwrap bytes(size) [1m])`.
+func evalRollupFuncWithPipelineExpr(ec *EvalConfig, name string, rf rollupFunc, expr logql.Expr, pe *logql.PipelineExpr, windowStr string) ([]*timeseries, error) {
+	var window int64
+	if len(windowStr) > 0 {
+		var err error
+		window, err = logql.PositiveDurationValue(windowStr, ec.Step)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Search for partial results in cache.
+	// The cache key contains expr with all the line filters and pipeline stages.
+	tssCached, start := rollupResultCacheV.Get(ec, expr, window)
+	if start > ec.End {
+		// The result is fully cached.
+		rollupResultCacheFullHits.Inc()
+		return tssCached, nil
+	}
+	if start > ec.Start {
+		rollupResultCachePartialHits.Inc()
+	} else {
+		rollupResultCacheMiss.Inc()
+	}
+
+	sharedTimestamps := getTimestamps(start, ec.End, ec.Step)
+	preFunc, rcs, err := getRollupConfigs(name, rf, expr, start, ec.End, ec.Step, window, ec.LookbackDelta, sharedTimestamps)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch the remaining part of the result.
+	minTimestamp := start - maxSilenceInterval
+	if window > ec.Step {
+		minTimestamp -= window
+	} else {
+		minTimestamp -= ec.Step
+	}
+	useLineBytes := rollupFuncsLineBytes[name]
+	if useLineBytes && pe.Unwrap() != nil {
+		return nil, fmt.Errorf("%s cannot be used with `unwrap` stage; it is calculated over log line sizes", name)
+	}
+	lrc := newLogRowsCollector(ec, false)
+	isPartial, err := evalPipelineExpr(ec, pe, minTimestamp, ec.End, lrc)
+	if err != nil {
+		return nil, err
+	}
+	tssSrc := lrc.finish()
+	// Log lines aren't needed after the rollup is calculated, so their memory may be used by other parts of the query.
+	defer ec.memoryBudget.Sub(getTimeseriesLogRowsSize(tssSrc))
+	if useLineBytes {
+		for _, ts := range tssSrc {
+			setLineBytesValues(ts.Values, ts.Datas)
+		}
+	}
+	if modifier := getRollupModifier(expr); modifier != nil {
+		tssSrc = groupTimeseriesByModifier(tssSrc, modifier)
+	}
+	if len(tssSrc) == 0 {
+		// Add missing points until ec.End.
+		// Do not cache the result, since missing points
+		// may be backfilled in the future.
+		return mergeTimeseries(tssCached, nil, start, ec), nil
+	}
+
+	pointsPerTimeseries := 1 + (ec.End-ec.Start)/ec.Step
+	rollupPoints := mulNoOverflow(pointsPerTimeseries, int64(len(tssSrc)*len(rcs)))
+	rollupMemorySize := mulNoOverflow(rollupPoints, 16)
+	rml := getRollupMemoryLimiter()
+	if !rml.Get(uint64(rollupMemorySize)) {
+		return nil, fmt.Errorf("not enough memory for processing %d data points across %d time series with %d points in each time series; "+
+			"total available memory for concurrent requests: %d bytes; "+
+			"possible solutions are: reducing the number of matching log streams; removing high-cardinality labels from log pipeline; "+
+			"increasing -memory.allowedPercent; increasing `step` query arg (%gs)",
+			rollupPoints, len(tssSrc)*len(rcs), pointsPerTimeseries, rml.MaxSize, float64(ec.Step)/1e3)
+	}
+	defer rml.Put(uint64(rollupMemorySize))
+
+	removeMetricGroup := !rollupFuncsKeepMetricGroup[name]
+	tss := make([]*timeseries, 0, len(tssSrc)*len(rcs))
+	var tssLock sync.Mutex
+	doParallel(tssSrc, func(tsSrc *timeseries, values []float64, timestamps []int64) ([]float64, []int64) {
+		preFunc(tsSrc.Values, tsSrc.Timestamps)
+		for _, rc := range rcs {
+			if tsm := newTimeseriesMap(name, sharedTimestamps, &tsSrc.MetricName); tsm != nil {
+				rc.DoTimeseriesMap(tsm, tsSrc.Values, tsSrc.Timestamps)
+				tssLock.Lock()
+				tss = tsm.AppendTimeseriesTo(tss)
+				tssLock.Unlock()
+				continue
+			}
+			var ts timeseries
+			doRollupForTimeseries(rc, &ts, &tsSrc.MetricName, tsSrc.Values, tsSrc.Timestamps, sharedTimestamps, removeMetricGroup)
+			tssLock.Lock()
+			tss = append(tss, &ts)
+			tssLock.Unlock()
+		}
+		return values, timestamps
+	})
+	tss = mergeTimeseries(tssCached, tss, start, ec)
+	if !isPartial {
+		rollupResultCacheV.Put(ec, expr, window, tss)
+	}
+	return tss, nil
+}
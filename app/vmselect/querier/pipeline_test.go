@@ -0,0 +1,227 @@
+package querier
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+)
+
+func TestPipelineProcessor(t *testing.T) {
+	f := func(q, line string, matchExpected bool, labelsExpected string, valueExpected float64) {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		pe, ok := e.(*logql.PipelineExpr)
+		if !ok {
+			t.Fatalf("expecting PipelineExpr; got %q", e.AppendString(nil))
+		}
+		_, lfs, err := getPipelineSelector(pe.Expr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var mn storage.MetricName
+		mn.AddTag("app", "api")
+		pp := newPipelineProcessor(pe, lfs)
+		match := pp.process(&mn, []byte(line))
+		if match != matchExpected {
+			t.Fatalf("unexpected match result for %q; got %v; want %v", line, match, matchExpected)
+		}
+		if !match {
+			return
+		}
+		pp.appendMetricName(&mn)
+		mn.RemoveTag("app")
+		labels := stringMetricName(&mn)
+		if labels != labelsExpected {
+			t.Fatalf("unexpected labels for %q;\ngot\n%s\nwant\n%s", line, labels, labelsExpected)
+		}
+		if math.Abs(pp.value-valueExpected) > 1e-9 {
+			t.Fatalf("unexpected value for %q; got %v; want %v", line, pp.value, valueExpected)
+		}
+	}
+
+	// json
+	f(`{app="api"} | json`, `{"route":"/foo","status":200,"ok":true,"req":{"method":"GET"},"tags":["a"],"x":null}`, true,
+		`{ok="true", req_method="GET", route="/foo", status="200"}`, 1)
+	f(`{app="api"} | json`, `{"app":"other","a.b":"c"}`, true, `{a_b="c", app_extracted="other"}`, 1)
+	f(`{app="api"} | json`, `not json`, true, `{__error__="JSONParserErr"}`, 1)
+	f(`{app="api"} | json | unwrap latency_ms`, `{"route":"/foo","latency_ms":12.5}`, true, `{route="/foo"}`, 12.5)
+	f(`{app="api"} | json | unwrap latency_ms`, `{"route":"/foo","latency_ms":"fast"}`, true, `{__error__="SampleExtractionErr", route="/foo"}`, 0)
+	f(`{app="api"} | json | unwrap latency_ms`, `{"route":"/foo"}`, true, `{__error__="SampleExtractionErr", route="/foo"}`, 0)
+	f(`{app="api"} | json | unwrap duration(took)`, `{"took":"1m30s"}`, true, `{}`, 90)
+
+	// logfmt
+	f(`{app="api"} | logfmt`, `level=info msg="hello \"world\"" empty= flag`, true, `{empty="", flag="", level="info", msg="hello \"world\""}`, 1)
+	f(`{app="api"} | logfmt`, `msg="unterminated`, true, `{__error__="LogfmtParserErr"}`, 1)
+	f(`{app="api"} | logfmt | unwrap bytes(size)`, `path=/x size=1.5KiB`, true, `{path="/x"}`, 1536)
+	f(`{app="api"} | logfmt | unwrap duration_seconds(elapsed)`, `elapsed=250ms`, true, `{}`, 0.25)
+
+	// line filters
+	f(`{app="api"} |= "error" | logfmt`, `level=info`, false, ``, 0)
+	f(`{app="api"} |= "error" | logfmt`, `level=error`, true, `{level="error"}`, 1)
+	f(`{app="api"} |~ "lev.+=err" | logfmt`, `level=error`, true, `{level="error"}`, 1)
+	f(`{app="api"} !~ "lev.+=err" | logfmt`, `level=error`, false, ``, 0)
+}
+
+func TestConvertUnwrapValue(t *testing.T) {
+	f := func(conv, s string, resultExpected float64) {
+		t.Helper()
+		result, err := convertUnwrapValue(conv, s)
+		if err != nil {
+			t.Fatalf("unexpected error when converting %q with %q: %s", s, conv, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result when converting %q with %q; got %v; want %v", s, conv, result, resultExpected)
+		}
+	}
+	f("", "123", 123)
+	f("", " -1.5e3 ", -1500)
+	f("duration", "1h", 3600)
+	f("duration_seconds", "1.5s", 1.5)
+	f("bytes", "42", 42)
+	f("bytes", "42B", 42)
+	f("bytes", "1.5kB", 1500)
+	f("bytes", "10 MiB", 10*1024*1024)
+	f("bytes", "2GB", 2e9)
+}
+
+func TestConvertUnwrapValueError(t *testing.T) {
+	f := func(conv, s string) {
+		t.Helper()
+		if _, err := convertUnwrapValue(conv, s); err == nil {
+			t.Fatalf("expecting non-nil error when converting %q with %q", s, conv)
+		}
+	}
+	f("", "")
+	f("", "foo")
+	f("duration", "10")
+	f("bytes", "")
+	f("bytes", "10 parsecs")
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+		result := sanitizeLabelName(s)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %q; want %q", s, result, resultExpected)
+		}
+	}
+	f("foo", "foo")
+	f("foo_bar1", "foo_bar1")
+	f("foo.bar-baz", "foo_bar_baz")
+	f("1foo", "_1foo")
+	f("", "_")
+}
+
+func TestGroupTimeseriesByModifier(t *testing.T) {
+	newTimeseries := func(route, errMsg string, timestamps []int64, values []float64) *timeseries {
+		var ts timeseries
+		ts.MetricName.AddTag("app", "api")
+		ts.MetricName.AddTag("route", route)
+		if errMsg != "" {
+			ts.MetricName.AddTag(errorLabel, errMsg)
+		}
+		ts.Timestamps = timestamps
+		ts.Values = values
+		return &ts
+	}
+	tss := []*timeseries{
+		newTimeseries("/foo", "", []int64{10, 30}, []float64{1, 3}),
+		newTimeseries("/bar", "", []int64{15}, []float64{5}),
+		newTimeseries("/foo", "", []int64{20, 40}, []float64{2, 4}),
+		newTimeseries("/foo", errSampleExtraction, []int64{25}, []float64{0}),
+	}
+	rvs := groupTimeseriesByModifier(tss, &logql.ModifierExpr{
+		Op:   "by",
+		Args: []string{"route"},
+	})
+	if len(rvs) != 3 {
+		t.Fatalf("unexpected number of time series; got %d; want %d", len(rvs), 3)
+	}
+	ts := rvs[0]
+	if s := stringMetricName(&ts.MetricName); s != `{route="/foo"}` {
+		t.Fatalf("unexpected labels; got %s; want %s", s, `{route="/foo"}`)
+	}
+	timestampsExpected := []int64{10, 20, 30, 40}
+	valuesExpected := []float64{1, 2, 3, 4}
+	for i := range timestampsExpected {
+		if ts.Timestamps[i] != timestampsExpected[i] || ts.Values[i] != valuesExpected[i] {
+			t.Fatalf("unexpected rows; got timestamps=%v, values=%v; want timestamps=%v, values=%v",
+				ts.Timestamps, ts.Values, timestampsExpected, valuesExpected)
+		}
+	}
+	if s := stringMetricName(&rvs[2].MetricName); s != `{__error__="SampleExtractionErr", route="/foo"}` {
+		t.Fatalf("unexpected labels for error series; got %s", s)
+	}
+}
+
+func TestPipelineProcessorProcessResult(t *testing.T) {
+	e, err := logql.Parse(`{app="api"} | logfmt | unwrap latency`)
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+	pe := e.(*logql.PipelineExpr)
+	_, lfs, err := getPipelineSelector(pe.Expr)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pp := newPipelineProcessor(pe, lfs)
+	var rs netstorage.Result
+	rs.MetricName.AddTag("app", "api")
+	for i, line := range []string{"latency=10", "latency=fast", "status=200", "latency=30"} {
+		rs.Timestamps = append(rs.Timestamps, int64(i))
+		rs.Values = append(rs.Values, 1)
+		rs.Datas = append(rs.Datas, []byte(line))
+	}
+
+	// Lines with non-numeric or missing unwrapped label must be returned in a separate series with `__error__` label.
+	tss := pp.processResult(&rs)
+	if len(tss) != 3 {
+		t.Fatalf("unexpected number of time series; got %d; want 3", len(tss))
+	}
+	f := func(ts *timeseries, labelsExpected string, timestampsExpected []int64, valuesExpected []float64) {
+		t.Helper()
+		if s := stringMetricName(&ts.MetricName); s != labelsExpected {
+			t.Fatalf("unexpected labels; got %s; want %s", s, labelsExpected)
+		}
+		if !reflect.DeepEqual(ts.Timestamps, timestampsExpected) || !reflect.DeepEqual(ts.Values, valuesExpected) {
+			t.Fatalf("unexpected rows for %s; got timestamps=%v, values=%v; want timestamps=%v, values=%v",
+				labelsExpected, ts.Timestamps, ts.Values, timestampsExpected, valuesExpected)
+		}
+	}
+	f(tss[0], `{app="api"}`, []int64{0, 3}, []float64{10, 30})
+	f(tss[1], `{__error__="SampleExtractionErr", app="api"}`, []int64{1}, []float64{0})
+	f(tss[2], `{__error__="SampleExtractionErr", app="api", status="200"}`, []int64{2}, []float64{0})
+}
+
+func TestPipelineProcessorLineFilterStats(t *testing.T) {
+	e, err := logql.Parse(`{app="api"} |= "error" !~ "timeout.+" | logfmt`)
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+	pe := e.(*logql.PipelineExpr)
+	_, lfs, err := getPipelineSelector(pe.Expr)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var mn storage.MetricName
+	pp := newPipelineProcessor(pe, lfs)
+	for _, line := range []string{"level=info", "level=error", "level=error err=timeout_db", "level=info msg=ok", "level=error msg=x"} {
+		pp.process(&mn, []byte(line))
+	}
+	linesProcessedExpected := []uint64{5, 3}
+	linesFilteredExpected := []uint64{2, 1}
+	for i := range lfs {
+		if pp.linesProcessed[i] != linesProcessedExpected[i] || pp.linesFiltered[i] != linesFilteredExpected[i] {
+			t.Fatalf("unexpected stats for line filter %s; got processed=%d, filtered=%d; want processed=%d, filtered=%d",
+				lfs[i], pp.linesProcessed[i], pp.linesFiltered[i], linesProcessedExpected[i], linesFilteredExpected[i])
+		}
+	}
+}
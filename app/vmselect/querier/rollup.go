@@ -87,6 +87,10 @@ var rollupFuncs = map[string]newRollupFunc{
 	"mode_over_time": newRollupFuncOneArg(rollupModeOverTime),
 
 	"rate_over_sum": newRollupFuncOneArg(rollupRateOverSum),
+
+	// Log range funcs from LogQL. See https://grafana.com/docs/loki/latest/logql/#range-vector-aggregation
+	"bytes_over_time": newRollupFuncOneArg(rollupSum),       // + rollupFuncsLineBytes
+	"bytes_rate":      newRollupFuncOneArg(rollupBytesRate), // + rollupFuncsLineBytes
 }
 
 // rollupAggrFuncs are functions that can be passed to `aggr_over_time()`
@@ -158,6 +162,18 @@ var rollupFuncsCannotAdjustWindow = map[string]bool{
 	"ascent_over_time":    true,
 	"descent_over_time":   true,
 	"zscore_over_time":    true,
+	"bytes_over_time":     true,
+	"bytes_rate":          true,
+}
+
+// rollupFuncsLineBytes contains rollup funcs, which must be calculated over log line sizes instead of values.
+//
+// Log lines are always fetched and unpacked for these funcs, since block headers contain only compressed block sizes,
+// which cannot be split into per-line sizes for arbitrary rollup windows. So these funcs are as expensive as log queries
+// over the same time range.
+var rollupFuncsLineBytes = map[string]bool{
+	"bytes_over_time": true,
+	"bytes_rate":      true,
 }
 
 var rollupFuncsRemoveCounterResets = map[string]bool{
@@ -1125,6 +1141,23 @@ func rollupRateOverSum(rfa *rollupFuncArg) float64 {
 	return sum / (float64(dt) / 1e3)
 }
 
+func rollupBytesRate(rfa *rollupFuncArg) float64 {
+	// There is no need in handling NaNs here, since they must be cleaned up
+	// before calling rollup funcs.
+	sum := rollupSum(rfa)
+	if math.IsNaN(sum) || rfa.window <= 0 {
+		return sum
+	}
+	return sum / (float64(rfa.window) / 1e3)
+}
+
+// setLineBytesValues sets values to sizes of the corresponding log lines from datas.
+func setLineBytesValues(values []float64, datas [][]byte) {
+	for i, data := range datas {
+		values[i] = float64(len(data))
+	}
+}
+
 func rollupRange(rfa *rollupFuncArg) float64 {
 	max := rollupMax(rfa)
 	min := rollupMin(rfa)
@@ -390,6 +390,70 @@ func TestMergeTimeseries(t *testing.T) {
 	})
 }
 
+func TestRollupResultCachePipelineExpr(t *testing.T) {
+	ResetRollupResultCache()
+	window := int64(300e3)
+	ec := &EvalConfig{
+		Start: 1000,
+		End:   2000,
+		Step:  200,
+
+		AuthToken: &auth.Token{
+			AccountID: 333,
+			ProjectID: 843,
+		},
+
+		MayCache: true,
+	}
+	mustParse := func(q string) logql.Expr {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		return e
+	}
+	e := mustParse(`count_over_time({app="api"} |= "error" | json [5m])`)
+	tss := []*timeseries{
+		{
+			Timestamps: []int64{1000, 1200, 1400},
+			Values:     []float64{1, 2, 3},
+		},
+	}
+	rollupResultCacheV.Put(ec, e, window, tss)
+
+	// The same query must be returned from the cache.
+	tss, newStart := rollupResultCacheV.Get(ec, mustParse(`count_over_time({app="api"} |= "error" | json [5m])`), window)
+	if newStart != 1600 {
+		t.Fatalf("unexpected newStart; got %d; want %d", newStart, 1600)
+	}
+	tssExpected := []*timeseries{
+		{
+			Timestamps: []int64{1000, 1200, 1400},
+			Values:     []float64{1, 2, 3},
+		},
+	}
+	testTimeseriesEqual(t, tss, tssExpected)
+
+	// Queries with other line filters or pipeline stages mustn't be returned from the cache.
+	f := func(q string) {
+		t.Helper()
+		tss, newStart := rollupResultCacheV.Get(ec, mustParse(q), window)
+		if newStart != ec.Start {
+			t.Fatalf("unexpected newStart for %q; got %d; want %d", q, newStart, ec.Start)
+		}
+		if len(tss) != 0 {
+			t.Fatalf("got %d timeseries for %q, while expecting zero", len(tss), q)
+		}
+	}
+	f(`count_over_time({app="api"} |= "warn" | json [5m])`)
+	f(`count_over_time({app="api"} |~ "error" | json [5m])`)
+	f(`count_over_time({app="api"} |= "error" | logfmt [5m])`)
+	f(`count_over_time({app="api"} |= "error" [5m])`)
+	f(`count_over_time({app="api"} | json [5m])`)
+	f(`count_over_time({app="api"} |= "error" | json [5m]) by (host)`)
+}
+
 func testTimeseriesEqual(t *testing.T, tss, tssExpected []*timeseries) {
 	t.Helper()
 	if len(tss) != len(tssExpected) {
@@ -2,6 +2,7 @@ package querier
 
 import (
 	"math"
+	"reflect"
 	"testing"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
@@ -442,6 +443,17 @@ func TestRollupNewRollupFuncSuccess(t *testing.T) {
 	f("timestamp", 0.13)
 	f("mode_over_time", 34)
 	f("rate_over_sum", 4520)
+	f("bytes_over_time", 565)
+	f("bytes_rate", 4520)
+}
+
+func TestSetLineBytesValues(t *testing.T) {
+	values := []float64{1, 1, 1}
+	setLineBytesValues(values, [][]byte{[]byte("foo"), nil, []byte("line with bytes")})
+	valuesExpected := []float64{3, 0, 15}
+	if !reflect.DeepEqual(values, valuesExpected) {
+		t.Fatalf("unexpected values; got %v; want %v", values, valuesExpected)
+	}
 }
 
 func TestRollupNewRollupFuncError(t *testing.T) {
@@ -0,0 +1,360 @@
+package querier
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/querytracer"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	splitQueriesByInterval = flag.Duration("search.splitQueriesByInterval", 24*time.Hour, "Split range queries into time ranges aligned to the given interval "+
+		"and execute them in parallel. This reduces memory usage and latency for queries over long time ranges. Zero disables splitting. "+
+		"See also -search.maxSplitQueriesParallelism")
+	maxSplitQueriesParallelism = flag.Int("search.maxSplitQueriesParallelism", 4, "The maximum number of time ranges executed in parallel for a single query "+
+		"split by -search.splitQueriesByInterval")
+)
+
+var (
+	splitQueries        = metrics.NewCounter(`vm_split_queries_total`)
+	splitQueriesRanges  = metrics.NewCounter(`vm_split_queries_ranges_total`)
+	splitQueriesSkipped = metrics.NewCounter(`vm_split_queries_skipped_ranges_total`)
+)
+
+// splitUnsafeFuncs contains functions, which calculate results over the whole time range of the query.
+//
+// Queries with these functions cannot be split by time.
+var splitUnsafeFuncs = map[string]bool{
+	// aggr funcs
+	"limitk":         true,
+	"any":            true,
+	"outliersk":      true,
+	"zscore":         true,
+	"topk_min":       true,
+	"topk_max":       true,
+	"topk_avg":       true,
+	"topk_median":    true,
+	"bottomk_min":    true,
+	"bottomk_max":    true,
+	"bottomk_avg":    true,
+	"bottomk_median": true,
+
+	// transform funcs
+	"sort":               true,
+	"sort_desc":          true,
+	"sort_by_label":      true,
+	"sort_by_label_desc": true,
+	"keep_last_value":    true,
+	"keep_next_value":    true,
+	"interpolate":        true,
+	"start":              true,
+	"end":                true,
+	"running_sum":        true,
+	"running_max":        true,
+	"running_min":        true,
+	"running_avg":        true,
+	"range_sum":          true,
+	"range_max":          true,
+	"range_min":          true,
+	"range_avg":          true,
+	"range_first":        true,
+	"range_last":         true,
+	"range_quantile":     true,
+	"smooth_exponential": true,
+	"remove_resets":      true,
+	"rand":               true,
+	"rand_normal":        true,
+	"rand_exponential":   true,
+}
+
+// querySplit is a time range for a part of the query split by time.
+type querySplit struct {
+	start int64
+	end   int64
+}
+
+// getQuerySplits splits [start..end] time range into time ranges aligned to interval.
+//
+// The boundaries of the returned time ranges are aligned to step relative to start,
+// so the time ranges contain the same points as the original time range.
+func getQuerySplits(start, end, step, interval int64) []querySplit {
+	if interval <= step || end-start < interval {
+		return []querySplit{{start: start, end: end}}
+	}
+	var splits []querySplit
+	for start <= end {
+		// Find the last point before the next interval boundary.
+		boundary := (start/interval + 1) * interval
+		splitEnd := start + ((boundary-1-start)/step)*step
+		if splitEnd > end {
+			splitEnd = end
+		}
+		splits = append(splits, querySplit{
+			start: start,
+			end:   splitEnd,
+		})
+		start = splitEnd + step
+	}
+	return splits
+}
+
+// isLogQueryExpr returns true if e selects log rows such as `{app="api"} |= "error"`.
+func isLogQueryExpr(e logql.Expr) bool {
+	switch t := e.(type) {
+	case *logql.MetricExpr, *logql.PipelineExpr:
+		return true
+	case *logql.BinaryOpExpr:
+		return isLineFilterExpr(t)
+	default:
+		return false
+	}
+}
+
+// maySplitExpr returns true if the metric query e may be split by time.
+func maySplitExpr(e logql.Expr) bool {
+	ok := true
+	logql.VisitAll(e, func(expr logql.Expr) {
+		switch t := expr.(type) {
+		case *logql.FuncExpr:
+			if splitUnsafeFuncs[t.Name] {
+				ok = false
+			}
+		case *logql.AggrFuncExpr:
+			if splitUnsafeFuncs[t.Name] {
+				ok = false
+			}
+		}
+	})
+	return ok
+}
+
+// evalExprSplitByTime evaluates the root expression e by splitting ec time range into time ranges aligned to interval.
+//
+// Up to parallelism time ranges are evaluated in parallel. The results for all the time ranges are merged into a single result.
+func evalExprSplitByTime(ec *EvalConfig, e logql.Expr, interval time.Duration, parallelism int) ([]*timeseries, error) {
+	isLogQuery := isLogQueryExpr(e)
+	step := ec.Step
+	if isLogQuery {
+		// Log rows aren't aligned to step.
+		step = 1
+		if mayCacheStreamResults(ec) && (interval <= 0 || *streamResultCacheInterval < interval) {
+			// Split log queries by smaller time ranges, so results for immutable time ranges can be cached.
+			interval = *streamResultCacheInterval
+		}
+	} else if !maySplitExpr(e) {
+		return evalExpr(ec, e, true)
+	}
+	splits := getQuerySplits(ec.Start, ec.End, step, interval.Milliseconds())
+	if len(splits) <= 1 {
+		return evalExpr(ec, e, true)
+	}
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	splitQueries.Inc()
+
+	qt := ec.Tracer.NewChild("split query into %d time ranges by %s", len(splits), interval)
+	var rv []*timeseries
+	var err error
+	if isLogQuery {
+		rv, err = evalLogQuerySplits(ec, qt, e, splits, parallelism)
+	} else {
+		rv, err = evalMetricQuerySplits(ec, qt, e, splits, parallelism)
+	}
+	if err != nil {
+		qt.Donef("error: %s", err)
+		return nil, err
+	}
+	qt.Donef("series=%d", len(rv))
+	return rv, nil
+}
+
+// evalLogQuerySplits evaluates log query e over the given splits.
+//
+// Splits are evaluated in the query direction, so the remaining splits are skipped
+// as soon as the already evaluated splits contain ec.Limit log rows.
+// If ec.LogRowsWriter is set, then log rows are written to it after every batch of splits is evaluated and nil is returned.
+// Log rows for query without limit are written by splits as soon as they are read from vmstorage nodes.
+func evalLogQuerySplits(ec *EvalConfig, qt *querytracer.Tracer, e logql.Expr, splits []querySplit, parallelism int) ([]*timeseries, error) {
+	if !ec.Forward {
+		// The newest log rows must be returned first.
+		reversed := make([]querySplit, len(splits))
+		for i := range splits {
+			reversed[len(splits)-1-i] = splits[i]
+		}
+		splits = reversed
+	}
+	var tss []*timeseries
+	rows := int64(0)
+	for len(splits) > 0 {
+		if err := checkCanceled(ec); err != nil {
+			return nil, err
+		}
+		n := parallelism
+		if n > len(splits) {
+			n = len(splits)
+		}
+		results, err := evalSplits(ec, qt, splits[:n], n, func(ecSplit *EvalConfig) ([]*timeseries, error) {
+			return evalLogQuerySplit(ecSplit, e)
+		})
+		if err != nil {
+			return nil, err
+		}
+		splits = splits[n:]
+		if err := checkCanceled(ec); err != nil {
+			return nil, err
+		}
+		if ec.LogRowsWriter != nil {
+			// Write log rows for the evaluated splits, so they don't occupy memory while the remaining splits are evaluated.
+			var batch []*timeseries
+			for _, rv := range results {
+				batch = append(batch, rv...)
+			}
+			size := getTimeseriesLogRowsSize(batch)
+			limit := ec.Limit
+			if limit > 0 {
+				limit -= rows
+			}
+			batch = limitLogRows(mergeLogStreams(batch), limit, ec.Forward, ec.Cursor)
+			for _, ts := range batch {
+				rows += int64(len(ts.Timestamps))
+			}
+			err := writeLogRows(ec, e, batch)
+			ec.memoryBudget.Sub(size)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			for _, rv := range results {
+				for _, ts := range rv {
+					rows += int64(len(ts.Timestamps))
+				}
+				tss = append(tss, rv...)
+			}
+		}
+		if ec.Limit > 0 && rows >= ec.Limit {
+			// The remaining splits contain log rows, which cannot be returned because of the limit.
+			if len(splits) > 0 {
+				qt.Printf("skip %d time ranges, since %d log rows are already selected with limit=%d", len(splits), rows, ec.Limit)
+				splitQueriesSkipped.Add(len(splits))
+			}
+			break
+		}
+	}
+	if ec.LogRowsWriter != nil {
+		return nil, nil
+	}
+	if err := checkCanceled(ec); err != nil {
+		return nil, err
+	}
+	size := getTimeseriesLogRowsSize(tss)
+	tss = limitLogRows(mergeLogStreams(tss), ec.Limit, ec.Forward, ec.Cursor)
+	ec.memoryBudget.Sub(size - getTimeseriesLogRowsSize(tss))
+	return tss, nil
+}
+
+// evalLogQuerySplit evaluates log query e on ec time range.
+//
+// Log rows for immutable time ranges are cached in streamResultCacheV unless they are written to ec.logRowsWriter.
+func evalLogQuerySplit(ec *EvalConfig, e logql.Expr) ([]*timeseries, error) {
+	if ec.logRowsWriter != nil || !mayCacheStreamResults(ec) || !isImmutableTimeRange(ec.End) {
+		return evalExpr(ec, e, true)
+	}
+	if tss, ok := streamResultCacheV.Get(ec, e); ok {
+		ec.Tracer.Printf("log rows for time range [%d..%d] are obtained from cache", ec.Start, ec.End)
+		if err := ec.memoryBudget.Add(getTimeseriesLogRowsSize(tss)); err != nil {
+			return nil, err
+		}
+		return tss, nil
+	}
+	tss, err := evalExpr(ec, e, true)
+	if err != nil {
+		return nil, err
+	}
+	// Partial results aren't cached, since they are returned only on storage errors.
+	if !ec.QueryStats.IsPartial() {
+		streamResultCacheV.Put(ec, e, tss)
+	}
+	return tss, nil
+}
+
+// mergeLogStreams merges log rows for the same streams in tss.
+func mergeLogStreams(tss []*timeseries) []*timeseries {
+	m := make(map[string]*timeseries, len(tss))
+	rvs := tss[:0]
+	bb := bbPool.Get()
+	for _, ts := range tss {
+		bb.B = marshalMetricNameSorted(bb.B[:0], &ts.MetricName)
+		dst := m[string(bb.B)]
+		if dst == nil {
+			m[string(bb.B)] = ts
+			rvs = append(rvs, ts)
+			continue
+		}
+		dst.Timestamps = append(dst.Timestamps, ts.Timestamps...)
+		dst.Values = append(dst.Values, ts.Values...)
+		dst.Datas = append(dst.Datas, ts.Datas...)
+	}
+	bbPool.Put(bb)
+	return rvs
+}
+
+// evalMetricQuerySplits evaluates metric query e over the given splits and merges the results.
+func evalMetricQuerySplits(ec *EvalConfig, qt *querytracer.Tracer, e logql.Expr, splits []querySplit, parallelism int) ([]*timeseries, error) {
+	results, err := evalSplits(ec, qt, splits, parallelism, func(ecSplit *EvalConfig) ([]*timeseries, error) {
+		return evalExpr(ecSplit, e, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	tss := results[0]
+	for i := 1; i < len(results); i++ {
+		if err := checkCanceled(ec); err != nil {
+			return nil, err
+		}
+		ecMerged := newEvalConfig(ec)
+		ecMerged.End = splits[i].end
+		tss = mergeTimeseries(tss, results[i], splits[i].start, ecMerged)
+	}
+	return tss, nil
+}
+
+// evalSplits evaluates f over the given splits with up to parallelism concurrent goroutines.
+//
+// The results are returned in the order of splits.
+func evalSplits(ec *EvalConfig, qt *querytracer.Tracer, splits []querySplit, parallelism int, f func(ecSplit *EvalConfig) ([]*timeseries, error)) ([][]*timeseries, error) {
+	splitQueriesRanges.Add(len(splits))
+	results := make([][]*timeseries, len(splits))
+	errs := make([]error, len(splits))
+	concurrencyCh := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range splits {
+		concurrencyCh <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-concurrencyCh
+				wg.Done()
+			}()
+			ecSplit := newEvalConfig(ec)
+			ecSplit.Start = splits[i].start
+			ecSplit.End = splits[i].end
+			ecSplit.Tracer = qt
+			if err := checkCanceled(ecSplit); err != nil {
+				errs[i] = err
+				return
+			}
+			results[i], errs[i] = f(ecSplit)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
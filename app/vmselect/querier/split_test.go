@@ -0,0 +1,144 @@
+package querier
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+)
+
+func TestGetQuerySplits(t *testing.T) {
+	f := func(start, end, step, interval int64, splitsExpected []querySplit) {
+		t.Helper()
+		splits := getQuerySplits(start, end, step, interval)
+		if !reflect.DeepEqual(splits, splitsExpected) {
+			t.Fatalf("unexpected splits for start=%d, end=%d, step=%d, interval=%d;\ngot\n%+v\nwant\n%+v",
+				start, end, step, interval, splits, splitsExpected)
+		}
+	}
+
+	// Time range shorter than interval
+	f(100, 150, 10, 100, []querySplit{{100, 150}})
+
+	// Interval smaller than step
+	f(100, 500, 100, 50, []querySplit{{100, 500}})
+
+	// Aligned time range
+	f(100, 390, 10, 100, []querySplit{{100, 190}, {200, 290}, {300, 390}})
+
+	// Unaligned time range
+	f(150, 330, 20, 100, []querySplit{{150, 190}, {210, 290}, {310, 330}})
+
+	// Log rows
+	f(150, 330, 1, 100, []querySplit{{150, 199}, {200, 299}, {300, 330}})
+}
+
+func TestMaySplitExpr(t *testing.T) {
+	f := func(q string, resultExpected bool) {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		if result := maySplitExpr(e); result != resultExpected {
+			t.Fatalf("unexpected maySplitExpr(%q); got %v; want %v", q, result, resultExpected)
+		}
+	}
+	f(`count_over_time({app="api"}[5m])`, true)
+	f(`sum(rate({app="api"} |= "error" [5m])) by (host)`, true)
+	f(`topk(3, sum(count_over_time({app="api"}[5m])) by (host))`, true)
+	f(`sort(sum(count_over_time({app="api"}[5m])) by (host))`, false)
+	f(`limitk(3, count_over_time({app="api"}[5m]))`, false)
+	f(`running_sum(count_over_time({app="api"}[5m]))`, false)
+}
+
+func TestIsLogQueryExpr(t *testing.T) {
+	f := func(q string, resultExpected bool) {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		if result := isLogQueryExpr(e); result != resultExpected {
+			t.Fatalf("unexpected isLogQueryExpr(%q); got %v; want %v", q, result, resultExpected)
+		}
+	}
+	f(`{app="api"}`, true)
+	f(`{app="api"} |= "foo" |~ "b.r"`, true)
+	f(`{app="api"} | json`, true)
+	f(`count_over_time({app="api"}[5m])`, false)
+	f(`123`, false)
+}
+
+func TestEvalExprSplitByTime(t *testing.T) {
+	f := func(q string, start, end, step int64) {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		ec := &EvalConfig{
+			AuthToken: &auth.Token{},
+			Start:     start,
+			End:       end,
+			Step:      step,
+			Deadline:  searchutils.NewDeadline(time.Now(), time.Minute, ""),
+		}
+		tssExpected, err := evalExpr(ec, e, true)
+		if err != nil {
+			t.Fatalf("unexpected error when evaluating %q: %s", q, err)
+		}
+		for _, parallelism := range []int{1, 2, 8} {
+			tss, err := evalExprSplitByTime(ec, e, 300*time.Second, parallelism)
+			if err != nil {
+				t.Fatalf("unexpected error when evaluating %q with splits: %s", q, err)
+			}
+			testTimeseriesEqual(t, tss, tssExpected)
+		}
+	}
+	f(`time()`, 1000e3, 2000e3, 200e3)
+	f(`time()`, 1050e3, 2000e3, 70e3)
+	f(`123`, 1000e3, 2000e3, 10e3)
+	f(`union(label_set(time(), "foo", "bar"), label_set(time()*2, "foo", "baz"))`, 1000e3, 2000e3, 30e3)
+}
+
+func TestMergeLogStreams(t *testing.T) {
+	newTimeseries := func(stream string, timestamps ...int64) *timeseries {
+		var ts timeseries
+		ts.MetricName.AddTag("stream", stream)
+		for _, timestamp := range timestamps {
+			ts.Timestamps = append(ts.Timestamps, timestamp)
+			ts.Values = append(ts.Values, 0)
+			ts.Datas = append(ts.Datas, []byte("line"))
+		}
+		return &ts
+	}
+	tss := []*timeseries{
+		newTimeseries("a", 30, 20),
+		newTimeseries("b", 25),
+		newTimeseries("a", 10),
+	}
+	tss = mergeLogStreams(tss)
+	if len(tss) != 2 {
+		t.Fatalf("unexpected number of streams; got %d; want 2", len(tss))
+	}
+	if timestamps := tss[0].Timestamps; !reflect.DeepEqual(timestamps, []int64{30, 20, 10}) {
+		t.Fatalf("unexpected timestamps for stream a; got %v", timestamps)
+	}
+	if len(tss[0].Values) != 3 || len(tss[0].Datas) != 3 {
+		t.Fatalf("unexpected number of values for stream a; got %d values and %d datas", len(tss[0].Values), len(tss[0].Datas))
+	}
+
+	// Verify the merged streams are properly limited.
+	tss = limitLogRows(tss, 2, false, nil)
+	rows := 0
+	for _, ts := range tss {
+		rows += len(ts.Timestamps)
+	}
+	if rows != 2 {
+		t.Fatalf("unexpected number of rows after limit; got %d; want 2", rows)
+	}
+}
@@ -0,0 +1,355 @@
+package querier
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	streamResultCacheInterval = flag.Duration("search.streamResultCacheInterval", time.Hour, "Log queries are split into time ranges aligned to the given interval, "+
+		"so results for time ranges older than -search.cacheTimestampOffset are cached. Zero disables the cache for log queries. "+
+		"See also -search.splitQueriesByInterval")
+	streamResultCacheSize = flagutil.NewBytes("search.streamResultCacheSize", 0, "The maximum size for the cache of log query results. "+
+		"By default it is limited by 1/32 of -memory.allowedPercent")
+)
+
+var streamResultCacheV = &streamResultCache{
+	c: workingsetcache.New(1024*1024, time.Hour), // This is a cache for testing.
+}
+var streamResultCachePath string
+
+func getStreamResultCacheSize() int {
+	streamResultCacheSizeOnce.Do(func() {
+		n := streamResultCacheSize.N
+		if n <= 0 {
+			n = memory.Allowed() / 32
+		}
+		if n <= 0 {
+			n = 1024 * 1024
+		}
+		streamResultCacheSizeValue = n
+	})
+	return streamResultCacheSizeValue
+}
+
+var (
+	streamResultCacheSizeValue int
+	streamResultCacheSizeOnce  sync.Once
+)
+
+// InitStreamResultCache initializes the cache for log query results.
+//
+// if cachePath is empty, then the cache isn't stored to persistent disk.
+func InitStreamResultCache(cachePath string) {
+	streamResultCachePath = cachePath
+	startTime := time.Now()
+	cacheSize := getStreamResultCacheSize()
+	var c *workingsetcache.Cache
+	if len(streamResultCachePath) > 0 {
+		logger.Infof("loading streamResult cache from %q...", streamResultCachePath)
+		c = workingsetcache.Load(streamResultCachePath, cacheSize, time.Hour)
+	} else {
+		c = workingsetcache.New(cacheSize, time.Hour)
+	}
+	if *disableCache {
+		c.Reset()
+	}
+
+	stats := &fastcache.Stats{}
+	var statsLock sync.Mutex
+	var statsLastUpdate uint64
+	fcs := func() *fastcache.Stats {
+		statsLock.Lock()
+		defer statsLock.Unlock()
+
+		if fasttime.UnixTimestamp()-statsLastUpdate < 2 {
+			return stats
+		}
+		var fcs fastcache.Stats
+		c.UpdateStats(&fcs)
+		stats = &fcs
+		statsLastUpdate = fasttime.UnixTimestamp()
+		return stats
+	}
+	if len(streamResultCachePath) > 0 {
+		logger.Infof("loaded streamResult cache from %q in %.3f seconds; entriesCount: %d, sizeBytes: %d",
+			streamResultCachePath, time.Since(startTime).Seconds(), fcs().EntriesCount, fcs().BytesSize)
+	}
+
+	metrics.NewGauge(`vm_cache_entries{type="logql/streamResult"}`, func() float64 {
+		return float64(fcs().EntriesCount)
+	})
+	metrics.NewGauge(`vm_cache_size_bytes{type="logql/streamResult"}`, func() float64 {
+		return float64(fcs().BytesSize)
+	})
+	metrics.NewGauge(`vm_cache_requests_total{type="logql/streamResult"}`, func() float64 {
+		return float64(fcs().GetBigCalls)
+	})
+	metrics.NewGauge(`vm_cache_misses_total{type="logql/streamResult"}`, func() float64 {
+		return float64(fcs().Misses)
+	})
+
+	streamResultCacheV = &streamResultCache{
+		c: c,
+	}
+}
+
+// StopStreamResultCache closes the cache for log query results.
+func StopStreamResultCache() {
+	if len(streamResultCachePath) == 0 {
+		streamResultCacheV.c.Stop()
+		streamResultCacheV.c = nil
+		return
+	}
+	logger.Infof("saving streamResult cache to %q...", streamResultCachePath)
+	startTime := time.Now()
+	if err := streamResultCacheV.c.Save(streamResultCachePath); err != nil {
+		logger.Errorf("cannot close streamResult cache at %q: %s", streamResultCachePath, err)
+		return
+	}
+	var fcs fastcache.Stats
+	streamResultCacheV.c.UpdateStats(&fcs)
+	streamResultCacheV.c.Stop()
+	streamResultCacheV.c = nil
+	logger.Infof("saved streamResult cache to %q in %.3f seconds; entriesCount: %d, sizeBytes: %d",
+		streamResultCachePath, time.Since(startTime).Seconds(), fcs.EntriesCount, fcs.BytesSize)
+}
+
+var streamResultCacheResets = metrics.NewCounter(`vm_cache_resets_total{type="logql/streamResult"}`)
+
+// ResetStreamResultCache resets the cache for log query results.
+func ResetStreamResultCache() {
+	streamResultCacheResets.Inc()
+	streamResultCacheV.c.Reset()
+	logger.Infof("streamResult cache has been cleared")
+}
+
+// streamResultCache caches log rows returned by log queries for immutable time ranges.
+type streamResultCache struct {
+	c *workingsetcache.Cache
+}
+
+// mayCacheStreamResults returns true if log rows for ec may be cached.
+func mayCacheStreamResults(ec *EvalConfig) bool {
+	if *disableCache || *streamResultCacheInterval <= 0 {
+		return false
+	}
+	// Log rows are cached without cursor, so queries with cursor are always executed on vmstorage nodes.
+	return ec.MayCache && ec.Cursor == nil
+}
+
+// isImmutableTimeRange returns true if log rows on the time range ending at end cannot change anymore.
+func isImmutableTimeRange(end int64) bool {
+	deadline := int64(fasttime.UnixTimestamp())*1000 - cacheTimestampOffset.Milliseconds()
+	return end < deadline
+}
+
+// Get returns log rows for the log query e on ec time range.
+//
+// ok is set to false if the log rows are missing in the cache.
+func (src *streamResultCache) Get(ec *EvalConfig, e logql.Expr) (tss []*timeseries, ok bool) {
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+	bb.B = marshalStreamResultCacheKey(bb.B[:0], ec.AuthToken, e, ec.Start, ec.End, ec.Limit, ec.Forward)
+
+	compressedResultBuf := resultBufPool.Get()
+	defer resultBufPool.Put(compressedResultBuf)
+	compressedResultBuf.B = src.c.GetBig(compressedResultBuf.B[:0], bb.B)
+	if len(compressedResultBuf.B) == 0 {
+		streamResultCacheMisses.Inc()
+		return nil, false
+	}
+	// Decompress into newly allocated byte slice, since tss returned from unmarshalLogRows
+	// refers to the byte slice, so it cannot be returned to the resultBufPool.
+	resultBuf, err := encoding.DecompressZSTD(nil, compressedResultBuf.B)
+	if err == nil {
+		tss, err = unmarshalLogRows(resultBuf)
+	}
+	if err != nil {
+		// The corrupted entry is treated as a miss. Overwrite it with an empty value, so it isn't read again.
+		logger.Errorf("cannot unmarshal log rows from streamResultCache: %s; dropping the cache entry", err)
+		src.c.SetBig(bb.B, nil)
+		streamResultCacheCorrupted.Inc()
+		streamResultCacheMisses.Inc()
+		return nil, false
+	}
+	streamResultCacheHits.Inc()
+	return tss, true
+}
+
+// Put stores log rows tss for the log query e on ec time range.
+func (src *streamResultCache) Put(ec *EvalConfig, e logql.Expr, tss []*timeseries) {
+	maxMarshaledSize := getStreamResultCacheSize() / 4
+	resultBuf := resultBufPool.Get()
+	defer resultBufPool.Put(resultBuf)
+	resultBuf.B = marshalLogRows(resultBuf.B[:0], tss)
+	if len(resultBuf.B) > maxMarshaledSize {
+		tooBigStreamResults.Inc()
+		return
+	}
+	compressedResultBuf := resultBufPool.Get()
+	defer resultBufPool.Put(compressedResultBuf)
+	compressedResultBuf.B = encoding.CompressZSTDLevel(compressedResultBuf.B[:0], resultBuf.B, 1)
+
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+	bb.B = marshalStreamResultCacheKey(bb.B[:0], ec.AuthToken, e, ec.Start, ec.End, ec.Limit, ec.Forward)
+	src.c.SetBig(bb.B, compressedResultBuf.B)
+}
+
+var (
+	streamResultCacheHits   = metrics.NewCounter(`vm_stream_result_cache_hits_total`)
+	streamResultCacheMisses = metrics.NewCounter(`vm_stream_result_cache_misses_total`)
+	tooBigStreamResults     = metrics.NewCounter(`vm_too_big_stream_results_total`)
+
+	streamResultCacheCorrupted = metrics.NewCounter(`vm_stream_result_cache_corrupted_entries_total`)
+)
+
+// Increment this value every time the format of the cache changes.
+const streamResultCacheVersion = 2
+
+func marshalStreamResultCacheKey(dst []byte, at *auth.Token, e logql.Expr, start, end, limit int64, forward bool) []byte {
+	dst = append(dst, streamResultCacheVersion)
+	dst = encoding.MarshalUint32(dst, at.AccountID)
+	dst = encoding.MarshalUint32(dst, at.ProjectID)
+	dst = encoding.MarshalInt64(dst, start)
+	dst = encoding.MarshalInt64(dst, end)
+	dst = encoding.MarshalInt64(dst, limit)
+	if forward {
+		dst = append(dst, 1)
+	} else {
+		dst = append(dst, 0)
+	}
+	dst = e.AppendString(dst)
+	return dst
+}
+
+// marshalLogRows appends marshaled log rows from tss to dst and returns the result.
+//
+// The result must be unmarshaled with unmarshalLogRows.
+func marshalLogRows(dst []byte, tss []*timeseries) []byte {
+	dst = encoding.MarshalUint32(dst, uint32(len(tss)))
+	for _, ts := range tss {
+		mn := &ts.MetricName
+		dst = marshalBytesFast(dst, mn.MetricGroup)
+		dst = encoding.MarshalUint16(dst, uint16(len(mn.Tags)))
+		dst = marshalMetricTagsFast(dst, mn.Tags)
+		dst = encoding.MarshalVarUint64(dst, uint64(len(ts.Timestamps)))
+		dst = encoding.MarshalVarInt64s(dst, ts.Timestamps)
+		// Values and Datas may be missing, so their counts are stored separately.
+		dst = encoding.MarshalVarUint64(dst, uint64(len(ts.Values)))
+		if len(ts.Values) > 0 {
+			dst = append(dst, float64ToByteSlice(ts.Values)...)
+		}
+		dst = encoding.MarshalVarUint64(dst, uint64(len(ts.Datas)))
+		for _, data := range ts.Datas {
+			dst = encoding.MarshalBytes(dst, data)
+		}
+	}
+	return dst
+}
+
+// unmarshalLogRows unmarshals log rows from src.
+//
+// The returned timeseries refer to src, so it is unsafe to modify it
+// until timeseries are in use.
+func unmarshalLogRows(src []byte) ([]*timeseries, error) {
+	if len(src) < 4 {
+		return nil, fmt.Errorf("cannot decode len(tss); got %d bytes; want at least %d bytes", len(src), 4)
+	}
+	tssLen := int(encoding.UnmarshalUint32(src))
+	src = src[4:]
+	if tssLen > len(src) {
+		// Every timeseries occupies at least a single byte.
+		return nil, fmt.Errorf("too big len(tss)=%d for %d bytes", tssLen, len(src))
+	}
+	tss := make([]*timeseries, tssLen)
+	for i := range tss {
+		// ts members point to src, so they cannot be re-used.
+		ts := &timeseries{
+			denyReuse: true,
+		}
+		tail, err := unmarshalMetricNameFast(&ts.MetricName, src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal MetricName: %w", err)
+		}
+		src = tail
+
+		tail, n, err := encoding.UnmarshalVarUint64(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal rows count: %w", err)
+		}
+		src = tail
+		if n > uint64(len(src)) {
+			// Every timestamp occupies at least a single byte.
+			return nil, fmt.Errorf("too big rows count=%d for %d bytes", n, len(src))
+		}
+		rows := int(n)
+
+		ts.Timestamps = make([]int64, rows)
+		tail, err = encoding.UnmarshalVarInt64s(ts.Timestamps, src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal timestamps: %w", err)
+		}
+		src = tail
+
+		tail, n, err = encoding.UnmarshalVarUint64(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal values count: %w", err)
+		}
+		src = tail
+		valuesLen := int(n)
+		if valuesLen != 0 && valuesLen != rows {
+			return nil, fmt.Errorf("unexpected values count; got %d; want 0 or %d", valuesLen, rows)
+		}
+		bufSize := valuesLen * 8
+		if len(src) < bufSize {
+			return nil, fmt.Errorf("cannot unmarshal values; got %d bytes; want at least %d bytes", len(src), bufSize)
+		}
+		if valuesLen > 0 {
+			// Limit values capacity, so appending to values doesn't overwrite src.
+			values := byteSliceToFloat64(src[:bufSize])
+			ts.Values = values[:valuesLen:valuesLen]
+		}
+		src = src[bufSize:]
+
+		tail, n, err = encoding.UnmarshalVarUint64(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal log lines count: %w", err)
+		}
+		src = tail
+		datasLen := int(n)
+		if datasLen != 0 && datasLen != rows {
+			return nil, fmt.Errorf("unexpected log lines count; got %d; want 0 or %d", datasLen, rows)
+		}
+		if datasLen > 0 {
+			ts.Datas = make([][]byte, datasLen)
+		}
+		for j := range ts.Datas {
+			tail, data, err := encoding.UnmarshalBytes(src)
+			if err != nil {
+				return nil, fmt.Errorf("cannot unmarshal log line: %w", err)
+			}
+			src = tail
+			ts.Datas[j] = data[:len(data):len(data)]
+		}
+		tss[i] = ts
+	}
+	if len(src) > 0 {
+		return nil, fmt.Errorf("unexpected non-empty tail left after unmarshaling log rows; len(tail)=%d", len(src))
+	}
+	return tss, nil
+}
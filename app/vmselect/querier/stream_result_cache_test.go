@@ -0,0 +1,226 @@
+package querier
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+func TestMarshalUnmarshalLogRows(t *testing.T) {
+	f := func(tss []*timeseries) {
+		t.Helper()
+		data := marshalLogRows(nil, tss)
+		tssResult, err := unmarshalLogRows(data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal log rows: %s", err)
+		}
+		if len(tssResult) != len(tss) {
+			t.Fatalf("unexpected number of timeseries; got %d; want %d", len(tssResult), len(tss))
+		}
+		for i, ts := range tssResult {
+			tsExpected := tss[i]
+			testMetricNamesEqual(t, &ts.MetricName, &tsExpected.MetricName, i)
+			if len(ts.Timestamps) != len(tsExpected.Timestamps) {
+				t.Fatalf("unexpected number of rows; got %d; want %d", len(ts.Timestamps), len(tsExpected.Timestamps))
+			}
+			if len(ts.Timestamps) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(ts.Timestamps, tsExpected.Timestamps) {
+				t.Fatalf("unexpected timestamps; got %v; want %v", ts.Timestamps, tsExpected.Timestamps)
+			}
+			if !reflect.DeepEqual(ts.Values, tsExpected.Values) {
+				t.Fatalf("unexpected values; got %v; want %v", ts.Values, tsExpected.Values)
+			}
+			if !reflect.DeepEqual(ts.Datas, tsExpected.Datas) {
+				t.Fatalf("unexpected log lines; got %q; want %q", ts.Datas, tsExpected.Datas)
+			}
+		}
+	}
+
+	f(nil)
+
+	var ts1 timeseries
+	ts1.MetricName.AddTag("app", "api")
+	ts1.MetricName.AddTag("env", "prod")
+	ts1.Timestamps = []int64{3000, 2000, 1000}
+	ts1.Values = []float64{0, 0, 0}
+	ts1.Datas = [][]byte{[]byte("foo"), []byte(""), bytes.Repeat([]byte("x"), 100e3)}
+
+	var ts2 timeseries
+	ts2.MetricName.AddTag("app", "web")
+	ts2.Timestamps = []int64{1500}
+	ts2.Values = []float64{42}
+	ts2.Datas = [][]byte{[]byte("bar")}
+
+	var ts3 timeseries
+	ts3.MetricName.AddTag("app", "empty")
+
+	// Log rows without values
+	var ts4 timeseries
+	ts4.MetricName.AddTag("app", "novalues")
+	ts4.Timestamps = []int64{1000, 1100}
+	ts4.Datas = [][]byte{[]byte("foo"), []byte("bar")}
+	f([]*timeseries{&ts1, &ts2, &ts3, &ts4})
+}
+
+func TestUnmarshalLogRowsAppend(t *testing.T) {
+	var ts1, ts2 timeseries
+	ts1.MetricName.AddTag("app", "api")
+	ts1.Timestamps = []int64{1000}
+	ts1.Values = []float64{1}
+	ts1.Datas = [][]byte{[]byte("foo")}
+	ts2.MetricName.AddTag("app", "web")
+	ts2.Timestamps = []int64{2000}
+	ts2.Values = []float64{2}
+	ts2.Datas = [][]byte{[]byte("bar")}
+	data := marshalLogRows(nil, []*timeseries{&ts1, &ts2})
+	tss, err := unmarshalLogRows(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal log rows: %s", err)
+	}
+
+	// Appending to the unmarshaled log rows mustn't modify other log rows.
+	tss[0].Values = append(tss[0].Values, 123, 456)
+	tss[0].Datas[0] = append(tss[0].Datas[0], "xxxxxx"...)
+	if !reflect.DeepEqual(tss[1].Values, []float64{2}) {
+		t.Fatalf("unexpected values; got %v; want [2]", tss[1].Values)
+	}
+	if string(tss[1].Datas[0]) != "bar" {
+		t.Fatalf("unexpected log line; got %q; want %q", tss[1].Datas[0], "bar")
+	}
+}
+
+func TestStreamResultCache(t *testing.T) {
+	ResetStreamResultCache()
+	ec := &EvalConfig{
+		Start: 1000,
+		End:   2000,
+		Step:  200,
+		Limit: 100,
+
+		AuthToken: &auth.Token{
+			AccountID: 333,
+			ProjectID: 843,
+		},
+
+		MayCache: true,
+	}
+	mustParse := func(q string) logql.Expr {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		return e
+	}
+	e := mustParse(`{app="api"} |= "error"`)
+
+	// Try obtaining an empty value.
+	if _, ok := streamResultCacheV.Get(ec, e); ok {
+		t.Fatalf("unexpected log rows found in empty cache")
+	}
+
+	var ts timeseries
+	ts.MetricName.AddTag("app", "api")
+	ts.Timestamps = []int64{1900, 1500}
+	ts.Values = []float64{0, 0}
+	ts.Datas = [][]byte{[]byte("error: foo"), []byte("error: bar")}
+	streamResultCacheV.Put(ec, e, []*timeseries{&ts})
+
+	tss, ok := streamResultCacheV.Get(ec, mustParse(`{app="api"} |= "error"`))
+	if !ok {
+		t.Fatalf("missing log rows in the cache")
+	}
+	if len(tss) != 1 || !reflect.DeepEqual(tss[0].Timestamps, ts.Timestamps) || !reflect.DeepEqual(tss[0].Datas, ts.Datas) {
+		t.Fatalf("unexpected log rows obtained from the cache: %v", tss)
+	}
+
+	// Empty results must be cached too.
+	ecEmpty := newEvalConfig(ec)
+	ecEmpty.Start = 3000
+	ecEmpty.End = 4000
+	streamResultCacheV.Put(ecEmpty, e, nil)
+	tss, ok = streamResultCacheV.Get(ecEmpty, e)
+	if !ok {
+		t.Fatalf("missing empty log rows in the cache")
+	}
+	if len(tss) != 0 {
+		t.Fatalf("unexpected non-empty log rows obtained from the cache: %v", tss)
+	}
+
+	// Queries with other params mustn't be obtained from the cache.
+	f := func(ec *EvalConfig, q string) {
+		t.Helper()
+		if _, ok := streamResultCacheV.Get(ec, mustParse(q)); ok {
+			t.Fatalf("unexpected log rows found in the cache for %q", q)
+		}
+	}
+	f(ec, `{app="api"} |= "warn"`)
+	f(ec, `{app="api"} |~ "error"`)
+	f(ec, `{app="api"}`)
+
+	ecOther := newEvalConfig(ec)
+	ecOther.Limit = 10
+	f(ecOther, `{app="api"} |= "error"`)
+
+	ecOther = newEvalConfig(ec)
+	ecOther.Forward = true
+	f(ecOther, `{app="api"} |= "error"`)
+
+	ecOther = newEvalConfig(ec)
+	ecOther.End = 1999
+	f(ecOther, `{app="api"} |= "error"`)
+
+	ecOther = newEvalConfig(ec)
+	ecOther.AuthToken = &auth.Token{
+		AccountID: 333,
+	}
+	f(ecOther, `{app="api"} |= "error"`)
+
+	// Corrupted entries must be treated as misses and dropped.
+	ecCorrupted := newEvalConfig(ec)
+	ecCorrupted.Start = 5000
+	ecCorrupted.End = 6000
+	key := marshalStreamResultCacheKey(nil, ecCorrupted.AuthToken, e, ecCorrupted.Start, ecCorrupted.End, ecCorrupted.Limit, ecCorrupted.Forward)
+	streamResultCacheV.c.SetBig(key, encoding.CompressZSTDLevel(nil, []byte("corrupted"), 1))
+	for i := 0; i < 2; i++ {
+		if _, ok := streamResultCacheV.Get(ecCorrupted, e); ok {
+			t.Fatalf("unexpected log rows obtained from the corrupted cache entry")
+		}
+	}
+
+	// Reset must remove all the cached log rows.
+	ResetStreamResultCache()
+	f(ec, `{app="api"} |= "error"`)
+}
+
+func TestMayCacheStreamResults(t *testing.T) {
+	ec := &EvalConfig{
+		MayCache: true,
+	}
+	if !mayCacheStreamResults(ec) {
+		t.Fatalf("expecting stream results may be cached")
+	}
+	ec.Cursor = &LogCursor{}
+	if mayCacheStreamResults(ec) {
+		t.Fatalf("stream results mustn't be cached for queries with cursor")
+	}
+	ec = &EvalConfig{}
+	if mayCacheStreamResults(ec) {
+		t.Fatalf("stream results mustn't be cached for queries with disabled cache")
+	}
+
+	now := time.Now().UnixNano() / 1e6
+	if !isImmutableTimeRange(now - cacheTimestampOffset.Milliseconds() - 60e3) {
+		t.Fatalf("expecting immutable time range")
+	}
+	if isImmutableTimeRange(now) {
+		t.Fatalf("unexpected immutable time range")
+	}
+}
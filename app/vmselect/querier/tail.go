@@ -0,0 +1,267 @@
+package querier
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cespare/xxhash/v2"
+)
+
+// maxTailDroppedEntries is the maximum number of dropped entries returned by Tailer.Next.
+const maxTailDroppedEntries = 1000
+
+var (
+	tailRowsReceived = metrics.NewCounter(`vm_tail_rows_received_total`)
+	tailRowsDropped  = metrics.NewCounter(`vm_tail_rows_dropped_total`)
+)
+
+// DroppedEntry is a log row, which was dropped by tail because the client didn't keep up with the ingestion rate.
+type DroppedEntry struct {
+	MetricName storage.MetricName
+	Timestamp  int64
+}
+
+// Tailer receives log rows for the tail query as soon as they are added to vmstorage nodes.
+//
+// Received rows are returned by Next after delayFor, so rows arriving late are returned in the order of their timestamps.
+type Tailer struct {
+	at       *auth.Token
+	sq       *storage.SearchQuery
+	pp       *pipelineProcessor
+	delayFor int64
+
+	// maxPendingRows is the maximum number of rows waiting for Next call.
+	// Rows exceeding the limit are dropped.
+	maxPendingRows int
+
+	mu      sync.Mutex
+	pending []tailRow
+	dropped []DroppedEntry
+
+	// skip contains hashes for rows, which were already returned to the client.
+	skip map[uint64]struct{}
+}
+
+type tailRow struct {
+	mn         *storage.MetricName
+	key        string
+	timestamp  int64
+	data       []byte
+	receivedAt int64
+}
+
+// NewTailer returns new Tailer for the log query q.
+//
+// Rows are returned by Next after delayFor. Up to maxPendingRows rows are kept until Next call.
+func NewTailer(at *auth.Token, q string, delayFor time.Duration, maxPendingRows int) (*Tailer, error) {
+	e, err := parsePromQLWithCache(q)
+	if err != nil {
+		return nil, err
+	}
+	if !isLogQueryExpr(e) {
+		return nil, fmt.Errorf("expecting log query; got %q", e.AppendString(nil))
+	}
+	var pe *logql.PipelineExpr
+	selector := e
+	if t, ok := e.(*logql.PipelineExpr); ok {
+		pe = t
+		selector = t.Expr
+	}
+	me, lfs, err := getPipelineSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	if me.IsEmpty() {
+		return nil, fmt.Errorf("tail query must contain non-empty stream selector; got %q", q)
+	}
+	pp := &pipelineProcessor{
+		lfs:            lfs,
+		linesProcessed: make([]uint64, len(lfs)),
+		linesFiltered:  make([]uint64, len(lfs)),
+	}
+	if pe != nil {
+		pp = newPipelineProcessor(pe, lfs)
+	}
+	sq := &storage.SearchQuery{
+		AccountID:   at.AccountID,
+		ProjectID:   at.ProjectID,
+		TagFilterss: [][]storage.TagFilter{toTagFilters(me.LabelFilters)},
+	}
+	return &Tailer{
+		at:             at,
+		sq:             sq,
+		pp:             pp,
+		delayFor:       delayFor.Milliseconds(),
+		maxPendingRows: maxPendingRows,
+		skip:           make(map[uint64]struct{}),
+	}, nil
+}
+
+// Run receives log rows from vmstorage nodes until stopCh is closed or the deadline is reached.
+func (t *Tailer) Run(deadline searchutils.Deadline, stopCh <-chan struct{}) error {
+	return netstorage.Tail(t.at, t.sq, deadline, stopCh, func(tb *storage.TailBatch) error {
+		return t.addBatch(tb, time.Now().UnixNano()/1e6)
+	})
+}
+
+// Skip registers log rows from rs, which were already returned to the client, so they aren't returned by Next.
+//
+// Rows, which were already received by t, are dropped immediately.
+func (t *Tailer) Skip(rs []netstorage.Result) {
+	var bb []byte
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range rs {
+		r := &rs[i]
+		bb = marshalMetricNameSorted(bb[:0], &r.MetricName)
+		for j, data := range r.Datas {
+			t.skip[getTailRowHash(bb, r.Timestamps[j], data)] = struct{}{}
+		}
+	}
+	if len(t.skip) == 0 {
+		return
+	}
+	pending := t.pending[:0]
+	for i := range t.pending {
+		r := &t.pending[i]
+		h := getTailRowHash(bytesutil.ToUnsafeBytes(r.key), r.timestamp, r.data)
+		if _, ok := t.skip[h]; ok {
+			delete(t.skip, h)
+			continue
+		}
+		pending = append(pending, *r)
+	}
+	t.pending = pending
+}
+
+// getTailRowHash returns hash for the log row with the given timestamp and data in the stream with the given key.
+func getTailRowHash(key []byte, timestamp int64, data []byte) uint64 {
+	var buf [8]byte
+	d := xxhash.New()
+	_, _ = d.Write(key)
+	_, _ = d.Write(encoding.MarshalInt64(buf[:0], timestamp))
+	_, _ = d.Write(data)
+	return d.Sum64()
+}
+
+// addBatch adds rows from tb received at the given time in milliseconds to t.
+//
+// addBatch mustn't be called concurrently, since it uses t.pp.
+func (t *Tailer) addBatch(tb *storage.TailBatch, receivedAt int64) error {
+	var mnStream storage.MetricName
+	mns := make(map[string]*storage.MetricName)
+	var rows []tailRow
+	var bb []byte
+	for i := range tb.Rows {
+		r := &tb.Rows[i]
+		if err := mnStream.Unmarshal(r.MetricName); err != nil {
+			return fmt.Errorf("cannot unmarshal MetricName: %w", err)
+		}
+		if !t.pp.process(&mnStream, r.Data) {
+			continue
+		}
+		t.pp.appendMetricName(&mnStream)
+		bb = marshalMetricNameSorted(bb[:0], &mnStream)
+		mn := mns[string(bb)]
+		if mn == nil {
+			mn = &storage.MetricName{}
+			mn.CopyFrom(&mnStream)
+			mns[string(bb)] = mn
+		}
+		rows = append(rows, tailRow{
+			mn:         mn,
+			key:        string(bb),
+			timestamp:  r.Timestamp,
+			data:       append([]byte{}, r.Data...),
+			receivedAt: receivedAt,
+		})
+	}
+	tailRowsReceived.Add(len(rows))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range tb.Dropped {
+		r := &tb.Dropped[i]
+		if err := mnStream.Unmarshal(r.MetricName); err != nil {
+			return fmt.Errorf("cannot unmarshal MetricName for dropped row: %w", err)
+		}
+		t.addDroppedLocked(&mnStream, r.Timestamp)
+	}
+	for i := range rows {
+		r := &rows[i]
+		if len(t.skip) > 0 {
+			h := getTailRowHash(bytesutil.ToUnsafeBytes(r.key), r.timestamp, r.data)
+			if _, ok := t.skip[h]; ok {
+				delete(t.skip, h)
+				continue
+			}
+		}
+		if len(t.pending) >= t.maxPendingRows {
+			t.addDroppedLocked(r.mn, r.timestamp)
+			continue
+		}
+		t.pending = append(t.pending, *r)
+	}
+	return nil
+}
+
+func (t *Tailer) addDroppedLocked(mn *storage.MetricName, timestamp int64) {
+	tailRowsDropped.Inc()
+	if len(t.dropped) >= maxTailDroppedEntries {
+		return
+	}
+	t.dropped = append(t.dropped, DroppedEntry{})
+	de := &t.dropped[len(t.dropped)-1]
+	de.MetricName.CopyFrom(mn)
+	de.Timestamp = timestamp
+}
+
+// Next returns log rows received before now-delayFor and rows dropped since the previous call.
+//
+// now is the current time in milliseconds. If flush is set, then all the received rows are returned regardless of delayFor.
+// Rows are sorted by timestamps inside every stream.
+func (t *Tailer) Next(now int64, flush bool) ([]netstorage.Result, []DroppedEntry) {
+	t.mu.Lock()
+	n := len(t.pending)
+	if !flush {
+		n = sort.Search(len(t.pending), func(i int) bool {
+			return t.pending[i].receivedAt > now-t.delayFor
+		})
+	}
+	rows := append([]tailRow{}, t.pending[:n]...)
+	t.pending = append(t.pending[:0], t.pending[n:]...)
+	dropped := t.dropped
+	t.dropped = nil
+	t.mu.Unlock()
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].timestamp < rows[j].timestamp
+	})
+	m := make(map[string]int)
+	var rs []netstorage.Result
+	for i := range rows {
+		r := &rows[i]
+		idx, ok := m[r.key]
+		if !ok {
+			idx = len(rs)
+			m[r.key] = idx
+			rs = append(rs, netstorage.Result{})
+			rs[idx].MetricName.CopyFrom(r.mn)
+			rs[idx].MetricNameHash = xxhash.Sum64String(r.key)
+		}
+		rs[idx].Timestamps = append(rs[idx].Timestamps, r.timestamp)
+		rs[idx].Values = append(rs[idx].Values, 1)
+		rs[idx].Datas = append(rs[idx].Datas, r.data)
+	}
+	return rs, dropped
+}
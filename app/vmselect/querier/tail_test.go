@@ -0,0 +1,154 @@
+package querier
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+)
+
+func TestNewTailerFailure(t *testing.T) {
+	f := func(q string) {
+		t.Helper()
+		if _, err := NewTailer(&auth.Token{}, q, 0, 10); err == nil {
+			t.Fatalf("expecting non-nil error for query %q", q)
+		}
+	}
+	f(``)
+	f(`{job="foo"`)
+	f(`rate({job="foo"}[1m])`)
+}
+
+func TestTailer(t *testing.T) {
+	newBatch := func(rows ...string) *storage.TailBatch {
+		var tb storage.TailBatch
+		for i, row := range rows {
+			var mn storage.MetricName
+			mn.AddTag("job", row[:3])
+			tb.Rows = append(tb.Rows, storage.TailRow{
+				MetricName: mn.Marshal(nil),
+				Timestamp:  int64(10 - i),
+				Data:       []byte(row[4:]),
+			})
+		}
+		return &tb
+	}
+	resultToStrings := func(rs []netstorage.Result, dropped []DroppedEntry) []string {
+		var a []string
+		for i := range rs {
+			r := &rs[i]
+			for j, data := range r.Datas {
+				a = append(a, fmt.Sprintf("%s %d %s", r.MetricName.GetTagValue("job"), r.Timestamps[j], data))
+			}
+		}
+		for i := range dropped {
+			de := &dropped[i]
+			a = append(a, fmt.Sprintf("dropped %s %d", de.MetricName.GetTagValue("job"), de.Timestamp))
+		}
+		return a
+	}
+	f := func(tr *Tailer, now int64, flush bool, resultExpected []string) {
+		t.Helper()
+		rs, dropped := tr.Next(now, flush)
+		result := resultToStrings(rs, dropped)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%q\nwant\n%q", result, resultExpected)
+		}
+	}
+
+	// Line filter and delayFor
+	tr, err := NewTailer(&auth.Token{}, `{job=~"foo|bar"} |= "error"`, time.Second, 10)
+	if err != nil {
+		t.Fatalf("cannot create tailer: %s", err)
+	}
+	if err := tr.addBatch(newBatch("foo error 1", "bar info 2", "bar error 3"), 1000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := tr.addBatch(newBatch("foo error 4"), 1500); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f(tr, 1500, false, nil)
+	f(tr, 2000, false, []string{
+		`bar 8 error 3`,
+		`foo 10 error 1`,
+	})
+	f(tr, 2000, false, nil)
+	f(tr, 2000, true, []string{
+		`foo 10 error 4`,
+	})
+
+	// Rows exceeding maxPendingRows are dropped
+	tr, err = NewTailer(&auth.Token{}, `{job="foo"}`, 0, 2)
+	if err != nil {
+		t.Fatalf("cannot create tailer: %s", err)
+	}
+	if err := tr.addBatch(newBatch("foo a", "foo b", "foo c"), 1000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f(tr, 1000, false, []string{
+		`foo 9 b`,
+		`foo 10 a`,
+		`dropped foo 8`,
+	})
+	f(tr, 1000, false, nil)
+
+	// Rows registered via Skip aren't returned
+	tr, err = NewTailer(&auth.Token{}, `{job="foo"}`, 0, 10)
+	if err != nil {
+		t.Fatalf("cannot create tailer: %s", err)
+	}
+	newResult := func(job string, timestamp int64, data string) netstorage.Result {
+		var r netstorage.Result
+		r.MetricName.AddTag("job", job)
+		r.Timestamps = []int64{timestamp}
+		r.Values = []float64{1}
+		r.Datas = [][]byte{[]byte(data)}
+		return r
+	}
+	tr.Skip([]netstorage.Result{
+		newResult("foo", 9, "b"),
+		// The row with the same timestamp and line in another stream mustn't be skipped.
+		newResult("bar", 8, "c"),
+	})
+	if err := tr.addBatch(newBatch("foo a", "foo b", "foo c"), 1000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f(tr, 1000, false, []string{
+		`foo 8 c`,
+		`foo 10 a`,
+	})
+
+	// Rows received before Skip call aren't returned
+	tr, err = NewTailer(&auth.Token{}, `{job="foo"}`, 0, 10)
+	if err != nil {
+		t.Fatalf("cannot create tailer: %s", err)
+	}
+	if err := tr.addBatch(newBatch("foo a", "foo b", "foo c"), 1000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tr.Skip([]netstorage.Result{
+		newResult("foo", 10, "a"),
+		newResult("foo", 9, "b"),
+	})
+	f(tr, 1000, false, []string{
+		`foo 8 c`,
+	})
+
+	// Rows dropped by vmstorage are reported
+	tb := newBatch("foo a")
+	tb.Dropped = append(tb.Dropped, storage.TailRow{
+		MetricName: tb.Rows[0].MetricName,
+		Timestamp:  5,
+	})
+	if err := tr.addBatch(tb, 1000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f(tr, 1000, false, []string{
+		`foo 10 a`,
+		`dropped foo 5`,
+	})
+}
@@ -0,0 +1,73 @@
+package querier
+
+import (
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+)
+
+// BeginQuery verifies per-tenant limits for the query q evaluated with ec and registers q in active queries.
+//
+// It must be called by handlers, which execute tenant queries without Exec.
+// EndQuery must be called with the returned qid when the query is finished.
+func BeginQuery(ec *EvalConfig, q string) (uint64, error) {
+	e, err := parsePromQLWithCache(q)
+	if err != nil {
+		return 0, err
+	}
+	return beginQuery(ec, q, e)
+}
+
+// EndQuery unregisters the query with the given qid obtained from BeginQuery.
+func EndQuery(qid uint64) {
+	activeQueriesV.Remove(qid)
+}
+
+func beginQuery(ec *EvalConfig, q string, e logql.Expr) (uint64, error) {
+	if ec.Canceler == nil {
+		ec.Canceler = netstorage.NewQueryCanceler()
+	}
+	tl := searchutils.GetTenantLimits(ec.AuthToken)
+	if err := checkTenantLimits(ec, e, tl); err != nil {
+		return 0, err
+	}
+	return activeQueriesV.Add(ec, q, tl.MaxConcurrentQueries)
+}
+
+// checkTenantLimits verifies whether the query e evaluated with ec doesn't exceed the given tl limits.
+//
+// Limits on the data read from vmstorage nodes are verified by netstorage.
+// The limit on concurrent queries is verified by activeQueries.
+func checkTenantLimits(ec *EvalConfig, e logql.Expr, tl *searchutils.TenantLimits) error {
+	if maxRange := tl.MaxQueryTimeRangeMs(); maxRange > 0 && ec.End-ec.Start > maxRange {
+		return netstorage.NewTenantLimitError(ec.AuthToken, http.StatusBadRequest, "max_query_time_range", tl.MaxQueryTimeRange,
+			"the query time range [%d..%d] is longer than %d milliseconds", ec.Start, ec.End, maxRange)
+	}
+	if tl.RequireEqualityMatcher {
+		var err error
+		logql.VisitAll(e, func(expr logql.Expr) {
+			me, ok := expr.(*logql.MetricExpr)
+			if !ok || err != nil || hasEqualityMatcher(me) {
+				return
+			}
+			err = netstorage.NewTenantLimitError(ec.AuthToken, http.StatusBadRequest, "require_equality_matcher", true,
+				"the selector %s must contain at least a single `label=\"value\"` matcher", me.AppendString(nil))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasEqualityMatcher(me *logql.MetricExpr) bool {
+	for i := range me.LabelFilters {
+		lf := &me.LabelFilters[i]
+		if !lf.IsNegative && !lf.IsRegexp && len(lf.Value) > 0 {
+			return true
+		}
+	}
+	return false
+}
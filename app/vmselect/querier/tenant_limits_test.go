@@ -0,0 +1,113 @@
+package querier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+)
+
+func TestCheckTenantLimits(t *testing.T) {
+	cfg, err := searchutils.ParseTenantLimitsConfig([]byte(`
+default:
+  max_query_time_range: 1h
+  require_equality_matcher: true
+`))
+	if err != nil {
+		t.Fatalf("cannot parse tenant limits: %s", err)
+	}
+	tl := cfg.GetLimits(&auth.Token{})
+	f := func(q string, start, end int64, limitName string) {
+		t.Helper()
+		e, err := logql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		ec := &EvalConfig{
+			AuthToken: &auth.Token{},
+			Start:     start,
+			End:       end,
+		}
+		err = checkTenantLimits(ec, e, tl)
+		if limitName == "" {
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %s", q, err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q", q)
+		}
+		if !strings.Contains(err.Error(), limitName) {
+			t.Fatalf("error for %q must contain %q; got %q", q, limitName, err)
+		}
+	}
+	f(`{app="api"}`, 0, 3600*1000, "")
+	f(`{app="api", env!="dev"} |= "foo"`, 0, 1000, "")
+	f(`sum(rate({app="api"}[5m])) / sum(rate({app="web", job=~".+"}[5m]))`, 0, 1000, "")
+
+	// Too long time range
+	f(`{app="api"}`, 0, 3600*1000+1, "max_query_time_range")
+
+	// Selectors without equality matchers
+	f(`{job=~".+"} |~ ".*"`, 0, 1000, "require_equality_matcher")
+	f(`{app!="api"}`, 0, 1000, "require_equality_matcher")
+	f(`{app=""}`, 0, 1000, "require_equality_matcher")
+	f(`sum(rate({app="api"}[5m])) / sum(rate({job=~".+"}[5m]))`, 0, 1000, "require_equality_matcher")
+}
+
+func TestActiveQueriesMaxConcurrentQueries(t *testing.T) {
+	aq := newActiveQueries()
+	ec := &EvalConfig{
+		AuthToken: &auth.Token{AccountID: 1},
+	}
+	qid1, err := aq.Add(ec, "q1", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := aq.Add(ec, "q2", 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := aq.Add(ec, "q3", 2); err == nil || !strings.Contains(err.Error(), "max_concurrent_queries") {
+		t.Fatalf("expecting max_concurrent_queries error; got %v", err)
+	}
+
+	// Another tenant has its own limit.
+	ecOther := &EvalConfig{
+		AuthToken: &auth.Token{AccountID: 2},
+	}
+	if _, err := aq.Add(ecOther, "q4", 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The query may be added after another query is finished.
+	aq.Remove(qid1)
+	if _, err := aq.Add(ec, "q5", 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestBeginEndQuery(t *testing.T) {
+	ec := &EvalConfig{
+		AuthToken: &auth.Token{AccountID: 123},
+	}
+	if _, err := BeginQuery(ec, `{app="api"`); err == nil {
+		t.Fatalf("expecting non-nil error for invalid query")
+	}
+	qid, err := BeginQuery(ec, `{app="api"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ec.Canceler == nil {
+		t.Fatalf("expecting non-nil Canceler")
+	}
+	if _, ok := activeQueriesV.Get(qid); !ok {
+		t.Fatalf("cannot find the query %d in active queries", qid)
+	}
+	EndQuery(qid)
+	if _, ok := activeQueriesV.Get(qid); ok {
+		t.Fatalf("the query %d must be removed from active queries", qid)
+	}
+}
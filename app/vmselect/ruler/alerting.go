@@ -0,0 +1,410 @@
+package ruler
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+// Alert states.
+const (
+	// StateInactive is the state of resolved alert, which is kept for sending resolve notifications.
+	StateInactive = "inactive"
+
+	// StatePending is the state of active alert, which didn't reach `for` duration yet.
+	StatePending = "pending"
+
+	// StateFiring is the state of active alert, which is sent to Alertmanager.
+	StateFiring = "firing"
+)
+
+// resolvedRetention is the duration resolved alerts are kept for re-sending resolve notifications.
+const resolvedRetention = 15 * time.Minute
+
+// Alert is an alert produced by AlertingRule for a single series returned by the rule expression.
+type Alert struct {
+	// Labels are sorted by name.
+	Labels      []prompbmarshal.Label
+	Annotations map[string]string
+
+	State string
+	Value float64
+
+	// ActiveAt is the time the alert became pending.
+	ActiveAt time.Time
+
+	// FiredAt is the time the alert became firing.
+	FiredAt time.Time
+
+	// ResolvedAt is the time the firing alert became inactive.
+	ResolvedAt time.Time
+
+	// LastSentAt is the last time the alert was successfully sent to Alertmanager.
+	LastSentAt time.Time
+
+	// ValidUntil is the time Alertmanager may resolve the firing alert at if it isn't re-sent.
+	ValidUntil time.Time
+
+	// unsentResolve is the previous resolved alert with the same labels, which must be sent to Alertmanager
+	// before the alert in order to deliver its resolve notification.
+	unsentResolve *Alert
+}
+
+// needsSending returns true if a must be sent to Alertmanager at ts.
+func (a *Alert) needsSending(ts time.Time, resendDelay time.Duration) bool {
+	if a.State == StatePending {
+		return false
+	}
+	if a.ResolvedAt.After(a.LastSentAt) {
+		// Resolve notification wasn't sent yet.
+		return true
+	}
+	return !ts.Before(a.LastSentAt.Add(resendDelay))
+}
+
+// AlertingRule evaluates LogQL metric query and produces an alert for every returned series.
+type AlertingRule struct {
+	Name        string
+	Expr        string
+	For         time.Duration
+	Labels      map[string]string
+	Annotations map[string]string
+
+	labelsTpls      map[string]*template.Template
+	annotationsTpls map[string]*template.Template
+
+	mu     sync.Mutex
+	rs     ruleState
+	alerts map[string]*Alert
+
+	metrics *ruleMetrics
+}
+
+func newAlertingRule(rc *RuleConfig) (*AlertingRule, error) {
+	d, err := rc.getFor()
+	if err != nil {
+		return nil, err
+	}
+	labelsTpls, err := parseTemplates(rc.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `labels`: %w", err)
+	}
+	annotationsTpls, err := parseTemplates(rc.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `annotations`: %w", err)
+	}
+	return &AlertingRule{
+		Name:            rc.Alert,
+		Expr:            rc.Expr,
+		For:             d,
+		Labels:          rc.Labels,
+		Annotations:     rc.Annotations,
+		labelsTpls:      labelsTpls,
+		annotationsTpls: annotationsTpls,
+		alerts:          make(map[string]*Alert),
+	}, nil
+}
+
+// exec evaluates ar at ts, updates its alerts and returns ALERTS time series for pending and firing alerts.
+func (ar *AlertingRule) exec(at *auth.Token, ts time.Time, deadline searchutils.Deadline) ([]prompbmarshal.TimeSeries, error) {
+	startTime := time.Now()
+	rs, err := execQuery(at, ar.Expr, ts, deadline)
+	var active map[string]*Alert
+	if err == nil {
+		active, err = ar.newAlerts(rs)
+	}
+
+	ar.mu.Lock()
+	if err == nil {
+		ar.updateAlertsLocked(active, ts)
+	}
+	tss := ar.getAlertsTimeSeriesLocked(ts)
+	state := ruleState{
+		lastEvaluation: ts,
+		lastDuration:   time.Since(startTime),
+		lastSamples:    len(tss),
+		lastError:      err,
+	}
+	ar.rs = state
+	ar.mu.Unlock()
+
+	if ar.metrics != nil {
+		ar.metrics.update(&state)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tss, nil
+}
+
+// newAlerts returns alerts for rs keyed by their labels.
+func (ar *AlertingRule) newAlerts(rs []netstorage.Result) (map[string]*Alert, error) {
+	m := make(map[string]*Alert, len(rs))
+	for i := range rs {
+		r := &rs[i]
+		if len(r.Values) == 0 {
+			continue
+		}
+		value := r.Values[0]
+		seriesLabels := getResultLabels(r, nil)
+		td := newTemplateData(seriesLabels, value)
+
+		extraLabels := expandTemplates(ar.labelsTpls, td)
+		if extraLabels == nil {
+			extraLabels = make(map[string]string, 1)
+		}
+		extraLabels["alertname"] = ar.Name
+		labels := getResultLabels(r, extraLabels)
+		sortLabels(labels)
+		key := string(marshalLabels(nil, labels))
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("the query returns multiple series with the same labels %s after applying rule labels", key)
+		}
+		m[key] = &Alert{
+			Labels:      labels,
+			Annotations: expandTemplates(ar.annotationsTpls, td),
+			Value:       value,
+		}
+	}
+	return m, nil
+}
+
+// updateAlertsLocked updates ar alerts with the active alerts obtained at ts.
+func (ar *AlertingRule) updateAlertsLocked(active map[string]*Alert, ts time.Time) {
+	for key, a := range active {
+		prev := ar.alerts[key]
+		if prev != nil && prev.State != StateInactive {
+			prev.Value = a.Value
+			prev.Annotations = a.Annotations
+			continue
+		}
+		// The resolved alert is replaced with the new pending alert.
+		// Keep the resolved alert until its resolve notification is sent.
+		a.State = StatePending
+		a.ActiveAt = ts
+		if prev != nil && prev.ResolvedAt.After(prev.LastSentAt) {
+			a.unsentResolve = prev
+		}
+		ar.alerts[key] = a
+	}
+	for key, a := range ar.alerts {
+		if _, ok := active[key]; ok {
+			if a.unsentResolve != nil && ts.Sub(a.unsentResolve.ResolvedAt) > resolvedRetention {
+				a.unsentResolve = nil
+			}
+			if a.State == StatePending && !ts.Before(a.ActiveAt.Add(ar.For)) {
+				a.State = StateFiring
+				a.FiredAt = ts
+			}
+			continue
+		}
+		switch a.State {
+		case StatePending:
+			delete(ar.alerts, key)
+		case StateFiring:
+			a.State = StateInactive
+			a.ResolvedAt = ts
+			// The resolve notification for a supersedes the previous one.
+			a.unsentResolve = nil
+		case StateInactive:
+			if ts.Sub(a.ResolvedAt) > resolvedRetention {
+				delete(ar.alerts, key)
+			}
+		}
+	}
+}
+
+// getAlertsTimeSeriesLocked returns ALERTS time series for pending and firing alerts at ts.
+func (ar *AlertingRule) getAlertsTimeSeriesLocked(ts time.Time) []prompbmarshal.TimeSeries {
+	timestamp := ts.UnixNano() / 1e6
+	var tss []prompbmarshal.TimeSeries
+	for _, a := range ar.alerts {
+		if a.State == StateInactive {
+			continue
+		}
+		labels := make([]prompbmarshal.Label, 0, len(a.Labels)+2)
+		labels = append(labels, a.Labels...)
+		labels = append(labels, prompbmarshal.Label{
+			Name:  "__name__",
+			Value: "ALERTS",
+		}, prompbmarshal.Label{
+			Name:  "alertstate",
+			Value: a.State,
+		})
+		sortLabels(labels)
+		tss = append(tss, prompbmarshal.TimeSeries{
+			Labels: labels,
+			Samples: []prompbmarshal.Sample{{
+				Value:     1,
+				Timestamp: timestamp,
+			}},
+		})
+	}
+	sort.Slice(tss, func(i, j int) bool {
+		return string(marshalLabels(nil, tss[i].Labels)) < string(marshalLabels(nil, tss[j].Labels))
+	})
+	return tss
+}
+
+// getAlertsToSend returns copies of alerts, which must be sent to Alertmanager at ts.
+//
+// The ValidUntil field for firing alerts is set to ts+validFor.
+func (ar *AlertingRule) getAlertsToSend(ts time.Time, resendDelay, validFor time.Duration) []*Alert {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	var alerts []*Alert
+	for _, a := range ar.alerts {
+		if a.unsentResolve != nil {
+			ac := *a.unsentResolve
+			alerts = append(alerts, &ac)
+		}
+		if !a.needsSending(ts, resendDelay) {
+			continue
+		}
+		if a.State == StateFiring {
+			a.ValidUntil = ts.Add(validFor)
+		}
+		ac := *a
+		alerts = append(alerts, &ac)
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// markAlertsSent sets LastSentAt to ts for ar alerts with the same labels as in alerts.
+//
+// Sent resolve notifications for re-activated alerts are dropped.
+func (ar *AlertingRule) markAlertsSent(alerts []*Alert, ts time.Time) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	for _, sent := range alerts {
+		key := string(marshalLabels(nil, sent.Labels))
+		a := ar.alerts[key]
+		if a == nil {
+			continue
+		}
+		if sent.State == StateInactive && a.State != StateInactive {
+			a.unsentResolve = nil
+			continue
+		}
+		a.LastSentAt = ts
+	}
+}
+
+// getAlerts returns copies of ar alerts in the given states.
+func (ar *AlertingRule) getAlerts(states ...string) []*Alert {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	var alerts []*Alert
+	for _, a := range ar.alerts {
+		for _, state := range states {
+			if a.State == state {
+				ac := *a
+				alerts = append(alerts, &ac)
+				break
+			}
+		}
+	}
+	sortAlerts(alerts)
+	return alerts
+}
+
+// restoreAlerts restores ar alerts from the previously saved alerts.
+func (ar *AlertingRule) restoreAlerts(alerts []*Alert) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	for _, a := range alerts {
+		sortLabels(a.Labels)
+		key := string(marshalLabels(nil, a.Labels))
+		ar.alerts[key] = a
+	}
+}
+
+// String implements rule interface.
+func (ar *AlertingRule) String() string {
+	return fmt.Sprintf("alerting rule %q", ar.Name)
+}
+
+// state returns the result of the last evaluation for ar.
+func (ar *AlertingRule) state() ruleState {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.rs
+}
+
+// sortAlerts sorts alerts by labels.
+//
+// The order of alerts with the same labels is preserved, so resolve notifications are sent before re-activated alerts.
+func sortAlerts(alerts []*Alert) {
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return string(marshalLabels(nil, alerts[i].Labels)) < string(marshalLabels(nil, alerts[j].Labels))
+	})
+}
+
+// templateData is the data for labels and annotations templates.
+type templateData struct {
+	Labels map[string]string
+	Value  float64
+}
+
+func newTemplateData(labels []prompbmarshal.Label, value float64) *templateData {
+	m := make(map[string]string, len(labels))
+	for _, label := range labels {
+		m[label.Name] = label.Value
+	}
+	return &templateData{
+		Labels: m,
+		Value:  value,
+	}
+}
+
+// templateHeader defines $labels and $value variables for templates in the same way as Prometheus does.
+const templateHeader = `{{ $labels := .Labels }}{{ $value := .Value }}`
+
+var templateFuncs = template.FuncMap{
+	"humanize": func(v float64) string {
+		return strconv.FormatFloat(v, 'g', 4, 64)
+	},
+}
+
+// parseTemplates parses Go templates from m values.
+func parseTemplates(m map[string]string) (map[string]*template.Template, error) {
+	tpls := make(map[string]*template.Template, len(m))
+	for name, text := range m {
+		tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(templateHeader + text)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse template for %q: %w", name, err)
+		}
+		tpls[name] = tpl
+	}
+	return tpls, nil
+}
+
+// expandTemplates returns the result of tpls execution for td.
+//
+// Template execution errors are put into the result in the same way as Prometheus does.
+func expandTemplates(tpls map[string]*template.Template, td *templateData) map[string]string {
+	if len(tpls) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(tpls))
+	var bb bytes.Buffer
+	for name, tpl := range tpls {
+		bb.Reset()
+		if err := tpl.Execute(&bb, td); err != nil {
+			m[name] = fmt.Sprintf("<error expanding template: %s>", err)
+			continue
+		}
+		m[name] = bb.String()
+	}
+	return m
+}
@@ -0,0 +1,264 @@
+package ruler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestAlertingRuleExec(t *testing.T) {
+	at := &auth.Token{
+		AccountID: 1,
+	}
+	ts := time.Unix(1600000000, 0)
+	deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+
+	ar, err := newAlertingRule(&RuleConfig{
+		Alert: "TooManyErrors",
+		Expr:  `label_set(time() / 1e6, "job", "api", "severity", "info")`,
+		For:   "1m",
+		Labels: map[string]string{
+			"severity": "critical",
+			"service":  "{{ $labels.job }}-svc",
+		},
+		Annotations: map[string]string{
+			"summary": "{{ $labels.job }} has {{ humanize $value }} errors",
+			"broken":  "{{ .Foo.Bar }}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot create alerting rule: %s", err)
+	}
+	tss, err := ar.exec(at, ts, deadline)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	labelsExpected := []prompbmarshal.Label{
+		{Name: "alertname", Value: "TooManyErrors"},
+		{Name: "job", Value: "api"},
+		{Name: "service", Value: "api-svc"},
+		{Name: "severity", Value: "critical"},
+	}
+	tssExpected := []prompbmarshal.TimeSeries{{
+		Labels: []prompbmarshal.Label{
+			{Name: "__name__", Value: "ALERTS"},
+			{Name: "alertname", Value: "TooManyErrors"},
+			{Name: "alertstate", Value: "pending"},
+			{Name: "job", Value: "api"},
+			{Name: "service", Value: "api-svc"},
+			{Name: "severity", Value: "critical"},
+		},
+		Samples: []prompbmarshal.Sample{{
+			Value:     1,
+			Timestamp: 1600000000000,
+		}},
+	}}
+	if !reflect.DeepEqual(tss, tssExpected) {
+		t.Fatalf("unexpected result\ngot\n%+v\nwant\n%+v", tss, tssExpected)
+	}
+	alerts := ar.getAlerts(StatePending)
+	if len(alerts) != 1 {
+		t.Fatalf("unexpected number of pending alerts; got %d; want 1", len(alerts))
+	}
+	a := alerts[0]
+	if !reflect.DeepEqual(a.Labels, labelsExpected) {
+		t.Fatalf("unexpected alert labels\ngot\n%+v\nwant\n%+v", a.Labels, labelsExpected)
+	}
+	if s := a.Annotations["summary"]; s != "api has 1600 errors" {
+		t.Fatalf("unexpected summary annotation: %q", s)
+	}
+	if s := a.Annotations["broken"]; s == "" || s[0] != '<' {
+		t.Fatalf("expecting template error in the annotation; got %q", s)
+	}
+	if a.Value != 1600 || !a.ActiveAt.Equal(ts) {
+		t.Fatalf("unexpected alert: %+v", a)
+	}
+
+	// The alert must become firing after `for` duration.
+	if _, err := ar.exec(at, ts.Add(time.Minute), deadline); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	alerts = ar.getAlerts(StateFiring)
+	if len(alerts) != 1 || !alerts[0].ActiveAt.Equal(ts) || !alerts[0].FiredAt.Equal(ts.Add(time.Minute)) {
+		t.Fatalf("unexpected firing alerts: %+v", alerts)
+	}
+
+	// Evaluation errors mustn't resolve alerts.
+	ar.Expr = `sum(`
+	if _, err := ar.exec(at, ts.Add(2*time.Minute), deadline); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if alerts := ar.getAlerts(StateFiring); len(alerts) != 1 {
+		t.Fatalf("unexpected number of firing alerts after evaluation error; got %d; want 1", len(alerts))
+	}
+	if rs := ar.state(); rs.health() != healthErr {
+		t.Fatalf("unexpected state: %+v", rs)
+	}
+}
+
+func TestAlertingRuleUpdateAlerts(t *testing.T) {
+	newAlert := func(job string) (string, *Alert) {
+		labels := []prompbmarshal.Label{
+			{Name: "alertname", Value: "foo"},
+			{Name: "job", Value: job},
+		}
+		return string(marshalLabels(nil, labels)), &Alert{
+			Labels: labels,
+		}
+	}
+	update := func(ar *AlertingRule, ts time.Time, jobs ...string) {
+		t.Helper()
+		active := make(map[string]*Alert)
+		for _, job := range jobs {
+			key, a := newAlert(job)
+			active[key] = a
+		}
+		ar.mu.Lock()
+		ar.updateAlertsLocked(active, ts)
+		ar.mu.Unlock()
+	}
+	checkStates := func(ar *AlertingRule, statesExpected map[string]string) {
+		t.Helper()
+		states := make(map[string]string)
+		for _, a := range ar.getAlerts(StatePending, StateFiring, StateInactive) {
+			states[a.Labels[1].Value] = a.State
+		}
+		if !reflect.DeepEqual(states, statesExpected) {
+			t.Fatalf("unexpected alert states; got %v; want %v", states, statesExpected)
+		}
+	}
+
+	ar := &AlertingRule{
+		Name:   "foo",
+		For:    2 * time.Minute,
+		alerts: make(map[string]*Alert),
+	}
+	ts := time.Unix(1600000000, 0)
+	update(ar, ts, "a", "b")
+	checkStates(ar, map[string]string{"a": StatePending, "b": StatePending})
+
+	// Pending alert must be dropped when it disappears.
+	update(ar, ts.Add(time.Minute), "a")
+	checkStates(ar, map[string]string{"a": StatePending})
+
+	update(ar, ts.Add(2*time.Minute), "a", "b")
+	checkStates(ar, map[string]string{"a": StateFiring, "b": StatePending})
+
+	// Firing alert must be resolved when it disappears.
+	update(ar, ts.Add(3*time.Minute), "b")
+	checkStates(ar, map[string]string{"a": StateInactive, "b": StatePending})
+
+	// Resolved alert must start from pending state when it appears again.
+	update(ar, ts.Add(4*time.Minute), "a", "b")
+	checkStates(ar, map[string]string{"a": StatePending, "b": StateFiring})
+
+	// Resolved alerts must be dropped after resolvedRetention.
+	update(ar, ts.Add(5*time.Minute))
+	checkStates(ar, map[string]string{"b": StateInactive})
+	update(ar, ts.Add(5*time.Minute+resolvedRetention+time.Second))
+	checkStates(ar, map[string]string{})
+}
+
+func TestAlertingRuleGetAlertsToSend(t *testing.T) {
+	ar := &AlertingRule{
+		Name:   "foo",
+		alerts: make(map[string]*Alert),
+	}
+	labels := []prompbmarshal.Label{{Name: "alertname", Value: "foo"}}
+	key := string(marshalLabels(nil, labels))
+	update := func(ts time.Time, active bool) {
+		m := make(map[string]*Alert)
+		if active {
+			m[key] = &Alert{
+				Labels: labels,
+			}
+		}
+		ar.mu.Lock()
+		ar.updateAlertsLocked(m, ts)
+		ar.mu.Unlock()
+	}
+	send := func(ts time.Time, stateExpected string) {
+		t.Helper()
+		alerts := ar.getAlertsToSend(ts, time.Minute, 4*time.Minute)
+		if stateExpected == "" {
+			if len(alerts) > 0 {
+				t.Fatalf("unexpected alerts to send at %s: %+v", ts, alerts)
+			}
+			return
+		}
+		if len(alerts) != 1 || alerts[0].State != stateExpected {
+			t.Fatalf("unexpected alerts to send at %s; got %+v; want a single %s alert", ts, alerts, stateExpected)
+		}
+		if stateExpected == StateFiring && !alerts[0].ValidUntil.Equal(ts.Add(4*time.Minute)) {
+			t.Fatalf("unexpected ValidUntil; got %s; want %s", alerts[0].ValidUntil, ts.Add(4*time.Minute))
+		}
+		ar.markAlertsSent(alerts, ts)
+	}
+
+	ts := time.Unix(1600000000, 0)
+	update(ts, true)
+	send(ts, StateFiring)
+
+	// Firing alert must be re-sent after resendDelay.
+	update(ts.Add(30*time.Second), true)
+	send(ts.Add(30*time.Second), "")
+	update(ts.Add(time.Minute), true)
+	send(ts.Add(time.Minute), StateFiring)
+
+	// Resolved alert must be sent immediately.
+	update(ts.Add(70*time.Second), false)
+	send(ts.Add(70*time.Second), StateInactive)
+	send(ts.Add(80*time.Second), "")
+	send(ts.Add(130*time.Second), StateInactive)
+
+	// Failed sending must be retried on the next evaluation.
+	update(ts.Add(140*time.Second), true)
+	if alerts := ar.getAlertsToSend(ts.Add(140*time.Second), time.Minute, time.Minute); len(alerts) != 1 {
+		t.Fatalf("unexpected number of alerts to send; got %d; want 1", len(alerts))
+	}
+	send(ts.Add(150*time.Second), StateFiring)
+
+	// Undelivered resolve notification must be sent before the re-activated alert.
+	update(ts.Add(160*time.Second), false)
+	update(ts.Add(170*time.Second), true)
+	alerts := ar.getAlertsToSend(ts.Add(170*time.Second), time.Minute, time.Minute)
+	if len(alerts) != 2 || alerts[0].State != StateInactive || alerts[1].State != StateFiring {
+		t.Fatalf("unexpected alerts to send; got %+v; want inactive and firing alerts", alerts)
+	}
+	if !alerts[0].ResolvedAt.Equal(ts.Add(160 * time.Second)) {
+		t.Fatalf("unexpected ResolvedAt; got %s; want %s", alerts[0].ResolvedAt, ts.Add(160*time.Second))
+	}
+	ar.markAlertsSent(alerts, ts.Add(170*time.Second))
+	send(ts.Add(180*time.Second), "")
+	send(ts.Add(230*time.Second), StateFiring)
+}
+
+func TestExpandTemplates(t *testing.T) {
+	f := func(tpl, resultExpected string) {
+		t.Helper()
+		tpls, err := parseTemplates(map[string]string{"x": tpl})
+		if err != nil {
+			t.Fatalf("cannot parse template: %s", err)
+		}
+		td := newTemplateData([]prompbmarshal.Label{{Name: "job", Value: "api"}}, 0.123456)
+		result := expandTemplates(tpls, td)["x"]
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+	f(``, ``)
+	f(`foo`, `foo`)
+	f(`{{ $labels.job }}`, `api`)
+	f(`{{ $labels.missing }}`, ``)
+	f(`{{ $value }}`, `0.123456`)
+	f(`{{ humanize $value }}`, `0.1235`)
+	f(`{{ .Labels.job }}: {{ .Value }}`, `api: 0.123456`)
+
+	if _, err := parseTemplates(map[string]string{"x": "{{ foo"}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid template")
+	}
+}
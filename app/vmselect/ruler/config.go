@@ -0,0 +1,221 @@
+package ruler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/querier"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the contents of a rules file.
+//
+// The format is compatible with Prometheus and Loki rules files except of the optional `tenant` field for groups.
+type Config struct {
+	Groups []GroupConfig `yaml:"groups"`
+}
+
+// GroupConfig is a group of rules evaluated sequentially on the same interval.
+type GroupConfig struct {
+	Name string `yaml:"name"`
+
+	// Tenant is the tenant in the form `accountID[:projectID]` the rules are evaluated for. "0" is used if it is empty.
+	Tenant string `yaml:"tenant,omitempty"`
+
+	// Interval is the evaluation interval such as `1m`. -ruler.evaluationInterval is used if it is empty.
+	Interval string `yaml:"interval,omitempty"`
+
+	Rules []RuleConfig `yaml:"rules"`
+}
+
+// RuleConfig is a rule in the group.
+//
+// Either Record or Alert must be set.
+type RuleConfig struct {
+	// Record is the name of the time series for recording rule results.
+	Record string `yaml:"record,omitempty"`
+
+	// Alert is the name of the alert for alerting rule.
+	Alert string `yaml:"alert,omitempty"`
+
+	// Expr is LogQL metric query.
+	Expr string `yaml:"expr"`
+
+	// For is the duration such as `5m` the alert must be active before firing.
+	For string `yaml:"for,omitempty"`
+
+	// Labels are added to rule results, overriding the existing labels.
+	//
+	// Labels for alerting rules may contain Go templates. See Annotations.
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Annotations are added to alerts. They may contain Go templates referring to
+	// the labels of the alert series via $labels and to the series value via $value.
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// ParseConfig parses rules config from YAML data.
+func ParseConfig(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal rules: %w", err)
+	}
+	for i := range cfg.Groups {
+		gc := &cfg.Groups[i]
+		if err := gc.validate(); err != nil {
+			return nil, fmt.Errorf("invalid group %q: %w", gc.Name, err)
+		}
+	}
+	return &cfg, nil
+}
+
+func (gc *GroupConfig) validate() error {
+	if len(gc.Name) == 0 {
+		return fmt.Errorf("missing `name`")
+	}
+	if _, err := gc.getTenant(); err != nil {
+		return err
+	}
+	if _, err := gc.getInterval(time.Minute); err != nil {
+		return err
+	}
+	if len(gc.Rules) == 0 {
+		return fmt.Errorf("missing `rules`")
+	}
+	for i := range gc.Rules {
+		rc := &gc.Rules[i]
+		if err := rc.validate(); err != nil {
+			return fmt.Errorf("invalid rule #%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (gc *GroupConfig) getTenant() (*auth.Token, error) {
+	tenant := gc.Tenant
+	if len(tenant) == 0 {
+		tenant = "0"
+	}
+	at, err := auth.NewToken(tenant)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `tenant`: %w", err)
+	}
+	return at, nil
+}
+
+func (gc *GroupConfig) getInterval(defaultInterval time.Duration) (time.Duration, error) {
+	if len(gc.Interval) == 0 {
+		return defaultInterval, nil
+	}
+	ms, err := logql.PositiveDurationValue(gc.Interval, 0)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse `interval`: %w", err)
+	}
+	if ms <= 0 {
+		return 0, fmt.Errorf("`interval` must be positive; got %q", gc.Interval)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+var metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (rc *RuleConfig) validate() error {
+	switch {
+	case len(rc.Record) > 0 && len(rc.Alert) > 0:
+		return fmt.Errorf("`record` and `alert` cannot be set simultaneously")
+	case len(rc.Record) > 0:
+		if !metricNameRegexp.MatchString(rc.Record) {
+			return fmt.Errorf("invalid `record` name %q", rc.Record)
+		}
+		if len(rc.For) > 0 || len(rc.Annotations) > 0 {
+			return fmt.Errorf("`for` and `annotations` may be set only for alerting rules")
+		}
+	case len(rc.Alert) > 0:
+		if !labelNameRegexp.MatchString(rc.Alert) {
+			return fmt.Errorf("invalid `alert` name %q", rc.Alert)
+		}
+		if _, err := rc.getFor(); err != nil {
+			return err
+		}
+		if _, err := parseTemplates(rc.Labels); err != nil {
+			return fmt.Errorf("invalid `labels`: %w", err)
+		}
+		if _, err := parseTemplates(rc.Annotations); err != nil {
+			return fmt.Errorf("invalid `annotations`: %w", err)
+		}
+	default:
+		return fmt.Errorf("missing `record` or `alert`")
+	}
+	if len(rc.Expr) == 0 {
+		return fmt.Errorf("missing `expr`")
+	}
+	isLogQuery, err := querier.IsLogQuery(rc.Expr)
+	if err != nil {
+		return fmt.Errorf("cannot parse `expr`: %w", err)
+	}
+	if isLogQuery {
+		return fmt.Errorf("`expr` must be a metric query; got log query %q", rc.Expr)
+	}
+	for name := range rc.Labels {
+		if !labelNameRegexp.MatchString(name) || name == "__name__" {
+			return fmt.Errorf("invalid label name %q in `labels`", name)
+		}
+	}
+	return nil
+}
+
+func (rc *RuleConfig) getFor() (time.Duration, error) {
+	if len(rc.For) == 0 {
+		return 0, nil
+	}
+	ms, err := logql.PositiveDurationValue(rc.For, 0)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse `for`: %w", err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// loadGroups loads rule groups from files matching the given glob patterns.
+func loadGroups(patterns []string, defaultInterval time.Duration) ([]*Group, error) {
+	var groups []*Group
+	seen := make(map[string]string)
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read rules file: %w", err)
+			}
+			cfg, err := ParseConfig(data)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load rules file %q: %w", path, err)
+			}
+			for i := range cfg.Groups {
+				g, err := newGroup(&cfg.Groups[i], path, defaultInterval)
+				if err != nil {
+					return nil, fmt.Errorf("cannot load rules file %q: %w", path, err)
+				}
+				key := g.key()
+				if prevPath, ok := seen[key]; ok {
+					return nil, fmt.Errorf("duplicate group %q for tenant %d:%d in %q and %q", g.Name, g.Tenant.AccountID, g.Tenant.ProjectID, prevPath, path)
+				}
+				seen[key] = path
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,283 @@
+package ruler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseConfigSuccess(t *testing.T) {
+	f := func(data string, groupsExpected int) {
+		t.Helper()
+		cfg, err := ParseConfig([]byte(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(cfg.Groups) != groupsExpected {
+			t.Fatalf("unexpected number of groups; got %d; want %d", len(cfg.Groups), groupsExpected)
+		}
+	}
+	f(``, 0)
+	f(`
+groups:
+- name: errors
+  interval: 30s
+  tenant: "12:34"
+  rules:
+  - record: job:errors:rate5m
+    expr: sum(rate({app="api"} |= "error" [5m])) by (job)
+    labels:
+      team: backend
+  - record: job:lines:count1m
+    expr: count_over_time({app="api"}[1m])
+  - alert: TooManyErrors
+    expr: sum(rate({app="api"} |= "error" [5m])) by (job) > 10
+    for: 5m
+    labels:
+      severity: critical
+    annotations:
+      summary: "{{ $labels.job }} logs {{ $value }} errors per second"
+- name: other
+  rules:
+  - record: foo
+    expr: "1"
+`, 2)
+}
+
+func TestParseConfigFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		cfg, err := ParseConfig([]byte(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if cfg != nil {
+			t.Fatalf("expecting nil config")
+		}
+	}
+
+	// invalid yaml
+	f(`foo`)
+
+	// unknown field
+	f(`
+groups:
+- name: foo
+  unknown: bar
+  rules:
+  - record: foo
+    expr: "1"
+`)
+
+	// missing name
+	f(`
+groups:
+- rules:
+  - record: foo
+    expr: "1"
+`)
+
+	// invalid tenant
+	f(`
+groups:
+- name: foo
+  tenant: bar
+  rules:
+  - record: foo
+    expr: "1"
+`)
+
+	// invalid interval
+	f(`
+groups:
+- name: foo
+  interval: bar
+  rules:
+  - record: foo
+    expr: "1"
+`)
+
+	// missing rules
+	f(`
+groups:
+- name: foo
+`)
+
+	// missing record
+	f(`
+groups:
+- name: foo
+  rules:
+  - expr: "1"
+`)
+
+	// invalid record
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo-bar
+    expr: "1"
+`)
+
+	// missing expr
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+`)
+
+	// invalid expr
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: "sum("
+`)
+
+	// log query
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: '{app="api"} |= "error"'
+`)
+
+	// invalid label name
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: "1"
+    labels:
+      foo-bar: baz
+`)
+
+	// record and alert
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    alert: Foo
+    expr: "1"
+`)
+
+	// annotations for recording rule
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: "1"
+    annotations:
+      summary: bar
+`)
+
+	// invalid alert name
+	f(`
+groups:
+- name: foo
+  rules:
+  - alert: foo:bar
+    expr: "1"
+`)
+
+	// invalid for
+	f(`
+groups:
+- name: foo
+  rules:
+  - alert: Foo
+    expr: "1"
+    for: bar
+`)
+
+	// invalid annotation template
+	f(`
+groups:
+- name: foo
+  rules:
+  - alert: Foo
+    expr: "1"
+    annotations:
+      summary: "{{ $labels.job"
+`)
+}
+
+func TestLoadGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ruler")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	mustWriteFile := func(name, data string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("cannot write file: %s", err)
+		}
+	}
+	mustWriteFile("a.yml", `
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: "1"
+- name: foo
+  tenant: "1"
+  interval: 15s
+  rules:
+  - record: foo
+    expr: "2"
+  - record: bar
+    expr: "3"
+`)
+	mustWriteFile("b.yml", `
+groups:
+- name: bar
+  rules:
+  - record: bar
+    expr: "1"
+`)
+
+	groups, err := loadGroups([]string{filepath.Join(dir, "*.yml")}, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("unexpected number of groups; got %d; want 3", len(groups))
+	}
+	g := groups[1]
+	if g.Name != "foo" || g.Tenant.AccountID != 1 || g.Interval != 15*time.Second || len(g.rules) != 2 {
+		t.Fatalf("unexpected group: %+v", g)
+	}
+	if groups[0].Interval != time.Minute {
+		t.Fatalf("unexpected default interval; got %s; want %s", groups[0].Interval, time.Minute)
+	}
+
+	// Duplicate group name for the same tenant
+	mustWriteFile("c.yml", `
+groups:
+- name: bar
+  tenant: "0:0"
+  rules:
+  - record: bar
+    expr: "1"
+`)
+	if _, err := loadGroups([]string{filepath.Join(dir, "*.yml")}, time.Minute); err == nil {
+		t.Fatalf("expecting non-nil error for duplicate group")
+	}
+
+	// Missing files
+	if _, err := loadGroups([]string{filepath.Join(dir, "*.yaml")}, time.Minute); err == nil {
+		t.Fatalf("expecting non-nil error for missing files")
+	}
+}
@@ -0,0 +1,169 @@
+package ruler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Group is a group of rules evaluated sequentially on the same interval for the same tenant.
+type Group struct {
+	Name     string
+	File     string
+	Tenant   *auth.Token
+	Interval time.Duration
+
+	cfg   GroupConfig
+	rules []rule
+
+	evaluations       *metrics.Counter
+	missedIterations  *metrics.Counter
+	evaluationSeconds *metrics.Summary
+}
+
+func newGroup(gc *GroupConfig, file string, defaultInterval time.Duration) (*Group, error) {
+	at, err := gc.getTenant()
+	if err != nil {
+		return nil, fmt.Errorf("invalid group %q: %w", gc.Name, err)
+	}
+	interval, err := gc.getInterval(defaultInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group %q: %w", gc.Name, err)
+	}
+	g := &Group{
+		Name:     gc.Name,
+		File:     file,
+		Tenant:   at,
+		Interval: interval,
+		cfg:      *gc,
+	}
+	labels := fmt.Sprintf(`{accountID="%d",projectID="%d",group=%q}`, at.AccountID, at.ProjectID, g.Name)
+	g.evaluations = metrics.GetOrCreateCounter(`vm_ruler_group_evaluations_total` + labels)
+	g.missedIterations = metrics.GetOrCreateCounter(`vm_ruler_group_missed_iterations_total` + labels)
+	g.evaluationSeconds = metrics.GetOrCreateSummary(`vm_ruler_group_evaluation_duration_seconds` + labels)
+	for i := range gc.Rules {
+		rc := &gc.Rules[i]
+		if len(rc.Alert) > 0 {
+			ar, err := newAlertingRule(rc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid alerting rule %q in group %q: %w", rc.Alert, gc.Name, err)
+			}
+			ar.metrics = newRuleMetrics(g, "alerting", ar.Name)
+			g.rules = append(g.rules, ar)
+			continue
+		}
+		rr := &RecordingRule{
+			Name:   rc.Record,
+			Expr:   rc.Expr,
+			Labels: rc.Labels,
+		}
+		rr.metrics = newRuleMetrics(g, "recording", rr.Name)
+		g.rules = append(g.rules, rr)
+	}
+	return g, nil
+}
+
+// Config returns the config g was created from.
+func (g *Group) Config() GroupConfig {
+	return g.cfg
+}
+
+// alertingRules returns alerting rules in g.
+func (g *Group) alertingRules() []*AlertingRule {
+	var ars []*AlertingRule
+	for _, r := range g.rules {
+		if ar, ok := r.(*AlertingRule); ok {
+			ars = append(ars, ar)
+		}
+	}
+	return ars
+}
+
+// hasRecordingRules returns true if g contains recording rules.
+func (g *Group) hasRecordingRules() bool {
+	for _, r := range g.rules {
+		if _, ok := r.(*RecordingRule); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns unique key for g across all the tenants.
+func (g *Group) key() string {
+	return fmt.Sprintf("%d:%d/%s", g.Tenant.AccountID, g.Tenant.ProjectID, g.Name)
+}
+
+// run evaluates g on g.Interval until stopCh is closed.
+//
+// The results are written to w, while alerts are sent to n.
+func (g *Group) run(stopCh <-chan struct{}, w writer, n notifier) {
+	t := time.NewTicker(g.Interval)
+	defer t.Stop()
+	for {
+		startTime := time.Now()
+		g.eval(startTime, w, n)
+		if d := time.Since(startTime); d > g.Interval {
+			g.missedIterations.Add(int(d / g.Interval))
+			logger.Warnf("group %q for tenant %d:%d evaluation took %.3f seconds, which exceeds the group interval %s; some evaluations are skipped",
+				g.Name, g.Tenant.AccountID, g.Tenant.ProjectID, d.Seconds(), g.Interval)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// eval evaluates all the rules in g at ts, writes the results to w and sends alerts to n.
+func (g *Group) eval(ts time.Time, w writer, n notifier) {
+	startTime := time.Now()
+	defer g.evaluationSeconds.UpdateDuration(startTime)
+	g.evaluations.Inc()
+
+	// Every evaluation must finish before the next one starts, so the group interval is used as timeout.
+	deadline := searchutils.NewDeadline(startTime, g.Interval, "-ruler.evaluationInterval")
+	var tss []prompbmarshal.TimeSeries
+	for _, r := range g.rules {
+		a, err := r.exec(g.Tenant, ts, deadline)
+		if err != nil {
+			logger.Errorf("cannot evaluate %s in group %q for tenant %d:%d: %s", r, g.Name, g.Tenant.AccountID, g.Tenant.ProjectID, err)
+			continue
+		}
+		tss = append(tss, a...)
+	}
+	if len(tss) > 0 {
+		if err := w.write(g.Tenant, tss, deadline); err != nil {
+			logger.Errorf("cannot write %d rule results for group %q for tenant %d:%d: %s", len(tss), g.Name, g.Tenant.AccountID, g.Tenant.ProjectID, err)
+		}
+	}
+	g.sendAlerts(ts, n, deadline)
+}
+
+// sendAlerts sends alerts from g, which need sending at ts, to n.
+func (g *Group) sendAlerts(ts time.Time, n notifier, deadline searchutils.Deadline) {
+	// Alertmanager resolves firing alerts if they aren't re-sent until ValidUntil.
+	// Give it a few resend intervals in order to tolerate temporary errors.
+	validFor := *resendDelay
+	if validFor < g.Interval {
+		validFor = g.Interval
+	}
+	validFor *= 4
+	for _, ar := range g.alertingRules() {
+		alerts := ar.getAlertsToSend(ts, *resendDelay, validFor)
+		if len(alerts) == 0 {
+			continue
+		}
+		if err := n.send(g.Tenant, alerts, deadline); err != nil {
+			logger.Errorf("cannot send %d alerts for %s in group %q for tenant %d:%d: %s", len(alerts), ar, g.Name, g.Tenant.AccountID, g.Tenant.ProjectID, err)
+			continue
+		}
+		ar.markAlertsSent(alerts, ts)
+	}
+}
@@ -0,0 +1,122 @@
+package ruler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// notifier sends alerts.
+type notifier interface {
+	send(at *auth.Token, alerts []*Alert, deadline searchutils.Deadline) error
+}
+
+// multiNotifier sends alerts to all the notifiers.
+type multiNotifier []notifier
+
+func (mn multiNotifier) send(at *auth.Token, alerts []*Alert, deadline searchutils.Deadline) error {
+	var errs []string
+	for _, n := range mn {
+		if err := n.send(at, alerts, deadline); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+var (
+	alertmanagerRequests = metrics.NewCounter(`vm_ruler_alertmanager_requests_total`)
+	alertmanagerErrors   = metrics.NewCounter(`vm_ruler_alertmanager_errors_total`)
+	alertsSent           = metrics.NewCounter(`vm_ruler_alerts_sent_total`)
+)
+
+// alertmanager sends alerts to Alertmanager v2 API.
+type alertmanager struct {
+	// url may contain `{tenant}` placeholder, which is substituted with accountID:projectID.
+	url string
+	hc  *http.Client
+}
+
+func newAlertmanager(url string) *alertmanager {
+	return &alertmanager{
+		url: strings.TrimSuffix(url, "/"),
+		hc:  &http.Client{},
+	}
+}
+
+// amAlert is an alert in the format accepted by `POST /api/v2/alerts`.
+type amAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+func (am *alertmanager) send(at *auth.Token, alerts []*Alert, deadline searchutils.Deadline) error {
+	ams := make([]amAlert, 0, len(alerts))
+	for _, a := range alerts {
+		labels := make(map[string]string, len(a.Labels))
+		for _, label := range a.Labels {
+			labels[label.Name] = label.Value
+		}
+		endsAt := a.ValidUntil
+		if a.State == StateInactive {
+			endsAt = a.ResolvedAt
+		}
+		ams = append(ams, amAlert{
+			Labels:      labels,
+			Annotations: a.Annotations,
+			StartsAt:    a.FiredAt,
+			EndsAt:      endsAt,
+		})
+	}
+	data, err := json.Marshal(ams)
+	if err != nil {
+		return fmt.Errorf("cannot marshal alerts: %w", err)
+	}
+	u := strings.Replace(am.url, "{tenant}", fmt.Sprintf("%d:%d", at.AccountID, at.ProjectID), -1) + "/api/v2/alerts"
+
+	alertmanagerRequests.Inc()
+	if err := am.post(u, data, deadline); err != nil {
+		alertmanagerErrors.Inc()
+		return err
+	}
+	alertsSent.Add(len(alerts))
+	return nil
+}
+
+func (am *alertmanager) post(u string, data []byte, deadline searchutils.Deadline) error {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create Alertmanager request to %q: %w", u, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := *am.hc
+	hc.Timeout = time.Until(time.Unix(int64(deadline.Deadline()), 0))
+	if hc.Timeout < time.Second {
+		// The group evaluation took too long. Give Alertmanager a chance to receive alerts anyway.
+		hc.Timeout = time.Second
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send alerts to Alertmanager at %q: %w", u, err)
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code for Alertmanager request to %q: %d; response: %q", u, resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package ruler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+// fakeAlertmanager is a fake Alertmanager v2 API server.
+type fakeAlertmanager struct {
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	paths      []string
+	alerts     []amAlert
+	statusCode int
+}
+
+func newFakeAlertmanager(t *testing.T) *fakeAlertmanager {
+	fam := &fakeAlertmanager{
+		statusCode: http.StatusOK,
+	}
+	fam.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fam.mu.Lock()
+		defer fam.mu.Unlock()
+		if r.Method != "POST" {
+			t.Errorf("unexpected method; got %q; want POST", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected Content-Type; got %q; want application/json", ct)
+		}
+		fam.paths = append(fam.paths, r.URL.Path)
+		if fam.statusCode != http.StatusOK {
+			http.Error(w, "error", fam.statusCode)
+			return
+		}
+		var alerts []amAlert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			t.Errorf("cannot decode alerts: %s", err)
+			return
+		}
+		fam.alerts = append(fam.alerts, alerts...)
+	}))
+	return fam
+}
+
+func (fam *fakeAlertmanager) reset(statusCode int) {
+	fam.mu.Lock()
+	fam.paths = nil
+	fam.alerts = nil
+	fam.statusCode = statusCode
+	fam.mu.Unlock()
+}
+
+func TestAlertmanagerSend(t *testing.T) {
+	fam := newFakeAlertmanager(t)
+	defer fam.srv.Close()
+
+	am := newAlertmanager(fam.srv.URL + "/{tenant}/")
+	at := &auth.Token{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+	deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+	ts := time.Unix(1600000000, 0).UTC()
+	alerts := []*Alert{
+		{
+			Labels: []prompbmarshal.Label{
+				{Name: "alertname", Value: "foo"},
+				{Name: "job", Value: "api"},
+			},
+			Annotations: map[string]string{
+				"summary": "bar",
+			},
+			State:      StateFiring,
+			FiredAt:    ts,
+			ValidUntil: ts.Add(time.Hour),
+		},
+		{
+			Labels: []prompbmarshal.Label{
+				{Name: "alertname", Value: "baz"},
+			},
+			State:      StateInactive,
+			FiredAt:    ts,
+			ResolvedAt: ts.Add(time.Minute),
+			ValidUntil: ts.Add(time.Hour),
+		},
+	}
+	if err := am.send(at, alerts, deadline); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(fam.paths) != 1 || fam.paths[0] != "/1:2/api/v2/alerts" {
+		t.Fatalf("unexpected paths: %q", fam.paths)
+	}
+	if len(fam.alerts) != 2 {
+		t.Fatalf("unexpected number of alerts; got %d; want 2", len(fam.alerts))
+	}
+	a := fam.alerts[0]
+	if a.Labels["alertname"] != "foo" || a.Labels["job"] != "api" || a.Annotations["summary"] != "bar" ||
+		!a.StartsAt.Equal(ts) || !a.EndsAt.Equal(ts.Add(time.Hour)) {
+		t.Fatalf("unexpected firing alert: %+v", a)
+	}
+	a = fam.alerts[1]
+	if a.Labels["alertname"] != "baz" || !a.EndsAt.Equal(ts.Add(time.Minute)) {
+		t.Fatalf("unexpected resolved alert: %+v", a)
+	}
+
+	fam.reset(http.StatusInternalServerError)
+	if err := am.send(at, alerts, deadline); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestGroupEvalAlerts(t *testing.T) {
+	fam := newFakeAlertmanager(t)
+	defer fam.srv.Close()
+
+	cfg, err := ParseConfig([]byte(`
+groups:
+- name: test
+  rules:
+  - alert: Foo
+    expr: label_set(time(), "job", "a")
+    annotations:
+      summary: "{{ $labels.job }} is down"
+`))
+	if err != nil {
+		t.Fatalf("cannot parse config: %s", err)
+	}
+	g, err := newGroup(&cfg.Groups[0], "test.yml", time.Minute)
+	if err != nil {
+		t.Fatalf("cannot create group: %s", err)
+	}
+	n := multiNotifier{newAlertmanager(fam.srv.URL)}
+	var tw testWriter
+	ts := time.Unix(1000, 0)
+
+	// Alertmanager errors must result in re-sending on the next evaluation.
+	fam.reset(http.StatusServiceUnavailable)
+	g.eval(ts, &tw, n)
+	if len(tw.tss) != 1 {
+		t.Fatalf("unexpected number of ALERTS series; got %d; want 1", len(tw.tss))
+	}
+	if len(fam.paths) != 1 || len(fam.alerts) != 0 {
+		t.Fatalf("unexpected requests to Alertmanager: %q", fam.paths)
+	}
+
+	fam.reset(http.StatusOK)
+	g.eval(ts.Add(time.Second), &tw, n)
+	if len(fam.alerts) != 1 || fam.alerts[0].Annotations["summary"] != "a is down" {
+		t.Fatalf("unexpected alerts sent: %+v", fam.alerts)
+	}
+
+	// The alert mustn't be re-sent until -ruler.resendDelay.
+	fam.reset(http.StatusOK)
+	g.eval(ts.Add(2*time.Second), &tw, n)
+	if len(fam.paths) != 0 {
+		t.Fatalf("unexpected requests to Alertmanager: %q", fam.paths)
+	}
+	g.eval(ts.Add(*resendDelay+time.Second), &tw, n)
+	if len(fam.alerts) != 1 {
+		t.Fatalf("unexpected number of re-sent alerts; got %d; want 1", len(fam.alerts))
+	}
+}
@@ -0,0 +1,254 @@
+package ruler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/querier"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Rule health values.
+const (
+	healthUnknown = "unknown"
+	healthOK      = "ok"
+	healthErr     = "err"
+)
+
+// rule is a rule evaluated by Group.
+type rule interface {
+	// exec evaluates the rule at ts and returns time series for writing to writer.
+	exec(at *auth.Token, ts time.Time, deadline searchutils.Deadline) ([]prompbmarshal.TimeSeries, error)
+
+	// String returns human-readable rule description for logging.
+	String() string
+}
+
+// RecordingRule evaluates LogQL metric query and stores the results as time series with the given name.
+type RecordingRule struct {
+	Name   string
+	Expr   string
+	Labels map[string]string
+
+	mu sync.Mutex
+	rs ruleState
+
+	metrics *ruleMetrics
+}
+
+// ruleState contains the result of the last rule evaluation.
+type ruleState struct {
+	lastEvaluation time.Time
+	lastDuration   time.Duration
+	lastSamples    int
+	lastError      error
+}
+
+func (rs ruleState) health() string {
+	if rs.lastEvaluation.IsZero() {
+		return healthUnknown
+	}
+	if rs.lastError != nil {
+		return healthErr
+	}
+	return healthOK
+}
+
+// ruleMetrics contains health metrics for a rule.
+type ruleMetrics struct {
+	evaluations        *metrics.Counter
+	evaluationErrors   *metrics.Counter
+	samples            *metrics.Counter
+	lastSamples        *metrics.Counter
+	lastError          *metrics.Counter
+	lastDuration       *metrics.FloatCounter
+	lastEvaluationTime *metrics.FloatCounter
+}
+
+func newRuleMetrics(g *Group, ruleType, name string) *ruleMetrics {
+	labels := fmt.Sprintf(`{accountID="%d",projectID="%d",group=%q,type=%q,rule=%q}`, g.Tenant.AccountID, g.Tenant.ProjectID, g.Name, ruleType, name)
+	return &ruleMetrics{
+		evaluations:        metrics.GetOrCreateCounter(`vm_ruler_rule_evaluations_total` + labels),
+		evaluationErrors:   metrics.GetOrCreateCounter(`vm_ruler_rule_evaluation_errors_total` + labels),
+		samples:            metrics.GetOrCreateCounter(`vm_ruler_rule_samples_total` + labels),
+		lastSamples:        metrics.GetOrCreateCounter(`vm_ruler_rule_last_evaluation_samples` + labels),
+		lastError:          metrics.GetOrCreateCounter(`vm_ruler_rule_last_evaluation_error` + labels),
+		lastDuration:       metrics.GetOrCreateFloatCounter(`vm_ruler_rule_last_evaluation_duration_seconds` + labels),
+		lastEvaluationTime: metrics.GetOrCreateFloatCounter(`vm_ruler_rule_last_evaluation_timestamp_seconds` + labels),
+	}
+}
+
+// update updates rm with the evaluation results from rs.
+func (rm *ruleMetrics) update(rs *ruleState) {
+	rm.evaluations.Inc()
+	rm.lastError.Set(0)
+	if rs.lastError != nil {
+		rm.evaluationErrors.Inc()
+		rm.lastError.Set(1)
+	}
+	rm.samples.Add(rs.lastSamples)
+	rm.lastSamples.Set(uint64(rs.lastSamples))
+	rm.lastDuration.Set(rs.lastDuration.Seconds())
+	rm.lastEvaluationTime.Set(float64(rs.lastEvaluation.UnixNano()) / 1e9)
+}
+
+// exec evaluates rr at the given timestamp and returns the resulting time series.
+func (rr *RecordingRule) exec(at *auth.Token, ts time.Time, deadline searchutils.Deadline) ([]prompbmarshal.TimeSeries, error) {
+	startTime := time.Now()
+	rs, err := execQuery(at, rr.Expr, ts, deadline)
+	var tss []prompbmarshal.TimeSeries
+	if err == nil {
+		tss, err = rr.toTimeSeries(rs, ts)
+	}
+	state := ruleState{
+		lastEvaluation: ts,
+		lastDuration:   time.Since(startTime),
+		lastSamples:    len(tss),
+		lastError:      err,
+	}
+	rr.mu.Lock()
+	rr.rs = state
+	rr.mu.Unlock()
+	if rr.metrics != nil {
+		rr.metrics.update(&state)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tss, nil
+}
+
+// String implements rule interface.
+func (rr *RecordingRule) String() string {
+	return fmt.Sprintf("recording rule %q", rr.Name)
+}
+
+// state returns the result of the last evaluation for rr.
+func (rr *RecordingRule) state() ruleState {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.rs
+}
+
+// toTimeSeries converts instant query results rs to time series named after rr.
+func (rr *RecordingRule) toTimeSeries(rs []netstorage.Result, ts time.Time) ([]prompbmarshal.TimeSeries, error) {
+	timestamp := ts.UnixNano() / 1e6
+	tss := make([]prompbmarshal.TimeSeries, 0, len(rs))
+	seen := make(map[string]struct{}, len(rs))
+	for i := range rs {
+		r := &rs[i]
+		if len(r.Values) == 0 {
+			continue
+		}
+		labels := getResultLabels(r, rr.Labels)
+		labels = append(labels, prompbmarshal.Label{
+			Name:  "__name__",
+			Value: rr.Name,
+		})
+		sortLabels(labels)
+		key := string(marshalLabels(nil, labels))
+		if _, ok := seen[key]; ok {
+			return nil, fmt.Errorf("the query returns multiple series with the same labels %s after applying rule labels", key)
+		}
+		seen[key] = struct{}{}
+		tss = append(tss, prompbmarshal.TimeSeries{
+			Labels: labels,
+			Samples: []prompbmarshal.Sample{{
+				Value:     r.Values[0],
+				Timestamp: timestamp,
+			}},
+		})
+	}
+	return tss, nil
+}
+
+// getResultLabels returns labels for r without metric name, overridden with extraLabels.
+func getResultLabels(r *netstorage.Result, extraLabels map[string]string) []prompbmarshal.Label {
+	mn := &r.MetricName
+	labels := make([]prompbmarshal.Label, 0, len(mn.Tags)+len(extraLabels))
+	for _, tag := range mn.Tags {
+		if _, ok := extraLabels[string(tag.Key)]; ok {
+			continue
+		}
+		labels = append(labels, prompbmarshal.Label{
+			Name:  string(tag.Key),
+			Value: string(tag.Value),
+		})
+	}
+	for name, value := range extraLabels {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return labels
+}
+
+func sortLabels(labels []prompbmarshal.Label) {
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+}
+
+// marshalLabels appends labels in the form `{name="value",...}` to dst and returns the result.
+func marshalLabels(dst []byte, labels []prompbmarshal.Label) []byte {
+	dst = append(dst, '{')
+	for i, label := range labels {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, label.Name...)
+		dst = append(dst, '=')
+		dst = appendQuoted(dst, label.Value)
+	}
+	return append(dst, '}')
+}
+
+// appendQuoted appends s quoted according to Prometheus text exposition format to dst.
+func appendQuoted(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			dst = append(dst, `\\`...)
+		case '"':
+			dst = append(dst, `\"`...)
+		case '\n':
+			dst = append(dst, `\n`...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
+
+// execQuery executes instant LogQL query q for the given tenant at ts.
+func execQuery(at *auth.Token, q string, ts time.Time, deadline searchutils.Deadline) ([]netstorage.Result, error) {
+	timestamp := ts.UnixNano() / 1e6
+	ec := querier.EvalConfig{
+		AuthToken:        at,
+		Start:            timestamp,
+		End:              timestamp,
+		Step:             defaultStep,
+		QuotedRemoteAddr: `"ruler"`,
+		Deadline:         deadline,
+
+		// Partial results would make recording rules undercount and alerting rules falsely resolve alerts,
+		// so the evaluation fails instead. Failed evaluation leaves alert states untouched.
+		DenyPartialResponse: true,
+	}
+	rs, _, err := querier.Exec(&ec, q, true)
+	if err != nil {
+		return nil, fmt.Errorf("error when executing query=%q for time=%d: %w", q, timestamp, err)
+	}
+	return rs, nil
+}
+
+// defaultStep is the step for instant queries in milliseconds. It matches the default step for /loki/api/v1/query.
+const defaultStep = 5 * 60 * 1000
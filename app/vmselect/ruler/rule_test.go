@@ -0,0 +1,126 @@
+package ruler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestRecordingRuleExec(t *testing.T) {
+	at := &auth.Token{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+	ts := time.Unix(1600000000, 0)
+	deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+
+	rr := &RecordingRule{
+		Name: "job:foo:sum",
+		Expr: `label_set(time(), "job", "foo", "instance", "bar")`,
+		Labels: map[string]string{
+			"instance": "baz",
+			"team":     "backend",
+		},
+	}
+	if health := rr.state().health(); health != healthUnknown {
+		t.Fatalf("unexpected health before evaluation; got %q; want %q", health, healthUnknown)
+	}
+	tss, err := rr.exec(at, ts, deadline)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tssExpected := []prompbmarshal.TimeSeries{{
+		Labels: []prompbmarshal.Label{
+			{Name: "__name__", Value: "job:foo:sum"},
+			{Name: "instance", Value: "baz"},
+			{Name: "job", Value: "foo"},
+			{Name: "team", Value: "backend"},
+		},
+		Samples: []prompbmarshal.Sample{{
+			Value:     1600000000,
+			Timestamp: 1600000000000,
+		}},
+	}}
+	if !reflect.DeepEqual(tss, tssExpected) {
+		t.Fatalf("unexpected result\ngot\n%+v\nwant\n%+v", tss, tssExpected)
+	}
+	rs := rr.state()
+	if rs.health() != healthOK || rs.lastSamples != 1 || !rs.lastEvaluation.Equal(ts) {
+		t.Fatalf("unexpected state: %+v", rs)
+	}
+
+	// Evaluation error must be reflected in the rule state.
+	rr.Expr = `sum(`
+	if _, err := rr.exec(at, ts, deadline); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if rs := rr.state(); rs.health() != healthErr || rs.lastError == nil {
+		t.Fatalf("unexpected state: %+v", rs)
+	}
+}
+
+func TestRecordingRuleToTimeSeries(t *testing.T) {
+	newResult := func(value float64, tags ...string) netstorage.Result {
+		var r netstorage.Result
+		r.MetricName.MetricGroup = []byte("orig")
+		for i := 0; i < len(tags); i += 2 {
+			r.MetricName.AddTag(tags[i], tags[i+1])
+		}
+		r.Values = []float64{value}
+		r.Timestamps = []int64{1000}
+		return r
+	}
+	rr := &RecordingRule{
+		Name: "foo",
+		Labels: map[string]string{
+			"env": "prod",
+		},
+	}
+	ts := time.Unix(1, 0)
+
+	tss, err := rr.toTimeSeries([]netstorage.Result{
+		newResult(1, "job", "a"),
+		newResult(2, "job", "b", "env", "dev"),
+		{},
+	}, ts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var result []string
+	for i := range tss {
+		result = append(result, string(marshalLabels(nil, tss[i].Labels)))
+	}
+	resultExpected := []string{
+		`{__name__="foo",env="prod",job="a"}`,
+		`{__name__="foo",env="prod",job="b"}`,
+	}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected labels; got %q; want %q", result, resultExpected)
+	}
+
+	// Results with the same labels after applying rule labels
+	if _, err := rr.toTimeSeries([]netstorage.Result{
+		newResult(1, "job", "a", "env", "dev"),
+		newResult(2, "job", "a", "env", "stage"),
+	}, ts); err == nil {
+		t.Fatalf("expecting non-nil error for duplicate series")
+	}
+}
+
+func TestAppendQuoted(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+		result := string(appendQuoted(nil, s))
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %s; want %s", result, resultExpected)
+		}
+	}
+	f(``, `""`)
+	f(`foo`, `"foo"`)
+	f("a\"b\\c\nd", `"a\"b\\c\nd"`)
+}
@@ -0,0 +1,168 @@
+package ruler
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	rulesPath = flagutil.NewArray("ruler.rulesPath", "Path to file with Prometheus-compatible rule groups containing LogQL expressions. "+
+		"Glob patterns are supported. The ruler is disabled if the flag isn't set. See README.md for details")
+	evaluationInterval = flag.Duration("ruler.evaluationInterval", time.Minute, "Evaluation interval for rule groups without `interval` option")
+	remoteWriteURL     = flag.String("ruler.remoteWriteURL", "", "Prometheus remote write URL for recording rule results, for example http://vminsert:8480/insert/{tenant}/prometheus/api/v1/write . "+
+		"`{tenant}` placeholder is substituted with the group tenant. Basic auth credentials may be passed in the url")
+	outputFile = flag.String("ruler.outputFile", "", "Optional path to local file for appending recording rule results in Prometheus text exposition format. "+
+		"Every line contains vm_account_id and vm_project_id labels with the group tenant")
+	alertmanagerURL = flagutil.NewArray("ruler.alertmanagerURL", "Alertmanager URL for sending alerts from alerting rules, for example http://alertmanager:9093 . "+
+		"`{tenant}` placeholder is substituted with the group tenant. Basic auth credentials may be passed in the url")
+	resendDelay   = flag.Duration("ruler.resendDelay", time.Minute, "Minimum duration between sending the same firing alert to Alertmanager")
+	stateFilePath = flag.String("ruler.stateFile", "", "Optional path to file for persisting alerts state across restarts. "+
+		"The state is saved after every -ruler.evaluationInterval and on graceful shutdown")
+)
+
+var (
+	groups           []*Group
+	stopCh           chan struct{}
+	wg               sync.WaitGroup
+	outputFileWriter *fileWriter
+)
+
+// Init loads rule groups from -ruler.rulesPath, restores alerts from -ruler.stateFile and starts groups evaluation.
+//
+// It must be called after netstorage initialization. Stop must be called when the ruler is no longer needed.
+func Init() error {
+	if len(*rulesPath) == 0 {
+		return nil
+	}
+	gs, err := loadGroups(*rulesPath, *evaluationInterval)
+	if err != nil {
+		return fmt.Errorf("cannot load -ruler.rulesPath: %w", err)
+	}
+	var mw multiWriter
+	if len(*remoteWriteURL) > 0 {
+		mw = append(mw, newRemoteWriter(*remoteWriteURL))
+	}
+	if len(*outputFile) > 0 {
+		fw, err := newFileWriter(*outputFile)
+		if err != nil {
+			return fmt.Errorf("cannot initialize -ruler.outputFile: %w", err)
+		}
+		outputFileWriter = fw
+		mw = append(mw, fw)
+	}
+	var mn multiNotifier
+	for _, u := range *alertmanagerURL {
+		mn = append(mn, newAlertmanager(u))
+	}
+	hasRecordingRules := false
+	hasAlertingRules := false
+	for _, g := range gs {
+		if g.hasRecordingRules() {
+			hasRecordingRules = true
+		}
+		if len(g.alertingRules()) > 0 {
+			hasAlertingRules = true
+		}
+	}
+	if hasRecordingRules && len(mw) == 0 {
+		return fmt.Errorf("-ruler.remoteWriteURL or -ruler.outputFile must be set for storing recording rule results")
+	}
+	if hasAlertingRules && len(mn) == 0 {
+		logger.Warnf("-ruler.alertmanagerURL isn't set, so alerts from alerting rules aren't sent anywhere")
+	}
+	if len(*stateFilePath) > 0 {
+		n, err := restoreState(*stateFilePath, gs)
+		if err != nil {
+			return fmt.Errorf("cannot restore alerts from -ruler.stateFile: %w", err)
+		}
+		logger.Infof("restored %d alerts from -ruler.stateFile=%q", n, *stateFilePath)
+	}
+
+	groups = gs
+	stopCh = make(chan struct{})
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *Group) {
+			defer wg.Done()
+			g.run(stopCh, mw, mn)
+		}(g)
+	}
+	if len(*stateFilePath) > 0 && hasAlertingRules {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runStateSaver(stopCh)
+		}()
+	}
+	logger.Infof("started evaluation of %d rule groups from -ruler.rulesPath=%q", len(groups), *rulesPath)
+	return nil
+}
+
+// Stop stops rule groups evaluation.
+func Stop() {
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	wg.Wait()
+	if outputFileWriter != nil {
+		outputFileWriter.close()
+	}
+}
+
+// runStateSaver periodically saves alerts state to -ruler.stateFile until stopCh is closed.
+func runStateSaver(stopCh <-chan struct{}) {
+	t := time.NewTicker(*evaluationInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stopCh:
+			// Save the final state on graceful shutdown.
+			saveStateLogErrors()
+			return
+		case <-t.C:
+			saveStateLogErrors()
+		}
+	}
+}
+
+func saveStateLogErrors() {
+	if err := saveState(*stateFilePath, groups); err != nil {
+		logger.Errorf("cannot save -ruler.stateFile: %s", err)
+	}
+}
+
+// GetGroups returns rule groups for the given tenant sorted by file and name.
+func GetGroups(at *auth.Token) []*Group {
+	var gs []*Group
+	for _, g := range groups {
+		if g.Tenant.AccountID == at.AccountID && g.Tenant.ProjectID == at.ProjectID {
+			gs = append(gs, g)
+		}
+	}
+	sort.Slice(gs, func(i, j int) bool {
+		if gs[i].File != gs[j].File {
+			return gs[i].File < gs[j].File
+		}
+		return gs[i].Name < gs[j].Name
+	})
+	return gs
+}
+
+// GetAlerts returns pending and firing alerts for the given tenant.
+func GetAlerts(at *auth.Token) []*Alert {
+	var alerts []*Alert
+	for _, g := range GetGroups(at) {
+		for _, ar := range g.alertingRules() {
+			alerts = append(alerts, ar.getAlerts(StatePending, StateFiring)...)
+		}
+	}
+	return alerts
+}
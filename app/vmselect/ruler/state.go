@@ -0,0 +1,171 @@
+package ruler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+// stateFile is the contents of -ruler.stateFile.
+type stateFile struct {
+	Rules []ruleStateEntry `json:"rules"`
+}
+
+// ruleStateEntry contains alerts for the alerting rule.
+//
+// The rule is identified by its group key, name and expression, so alerts aren't restored for modified rules.
+type ruleStateEntry struct {
+	Group  string       `json:"group"`
+	Name   string       `json:"name"`
+	Expr   string       `json:"expr"`
+	Alerts []alertState `json:"alerts"`
+}
+
+// alertState is the persisted state of Alert.
+type alertState struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	State       string            `json:"state"`
+	Value       float64           `json:"value"`
+	ActiveAt    time.Time         `json:"activeAt"`
+	FiredAt     time.Time         `json:"firedAt"`
+	ResolvedAt  time.Time         `json:"resolvedAt"`
+	LastSentAt  time.Time         `json:"lastSentAt"`
+	ValidUntil  time.Time         `json:"validUntil"`
+
+	// UnsentResolve is the previous resolved alert, which resolve notification wasn't sent yet.
+	UnsentResolve *alertState `json:"unsentResolve,omitempty"`
+}
+
+func newAlertState(a *Alert) alertState {
+	labels := make(map[string]string, len(a.Labels))
+	for _, label := range a.Labels {
+		labels[label.Name] = label.Value
+	}
+	as := alertState{
+		Labels:      labels,
+		Annotations: a.Annotations,
+		State:       a.State,
+		Value:       a.Value,
+		ActiveAt:    a.ActiveAt,
+		FiredAt:     a.FiredAt,
+		ResolvedAt:  a.ResolvedAt,
+		LastSentAt:  a.LastSentAt,
+		ValidUntil:  a.ValidUntil,
+	}
+	if a.unsentResolve != nil {
+		unsentResolve := newAlertState(a.unsentResolve)
+		as.UnsentResolve = &unsentResolve
+	}
+	return as
+}
+
+func (as *alertState) toAlert() *Alert {
+	labels := make([]prompbmarshal.Label, 0, len(as.Labels))
+	for name, value := range as.Labels {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	sortLabels(labels)
+	a := &Alert{
+		Labels:      labels,
+		Annotations: as.Annotations,
+		State:       as.State,
+		Value:       as.Value,
+		ActiveAt:    as.ActiveAt,
+		FiredAt:     as.FiredAt,
+		ResolvedAt:  as.ResolvedAt,
+		LastSentAt:  as.LastSentAt,
+		ValidUntil:  as.ValidUntil,
+	}
+	if as.UnsentResolve != nil {
+		a.unsentResolve = as.UnsentResolve.toAlert()
+	}
+	return a
+}
+
+// saveStateLock serializes concurrent saveState calls.
+var saveStateLock sync.Mutex
+
+// saveState atomically saves alerts for alerting rules from groups to the file at path.
+func saveState(path string, groups []*Group) error {
+	var sf stateFile
+	for _, g := range groups {
+		for _, ar := range g.alertingRules() {
+			alerts := ar.getAlerts(StatePending, StateFiring, StateInactive)
+			if len(alerts) == 0 {
+				continue
+			}
+			e := ruleStateEntry{
+				Group: g.key(),
+				Name:  ar.Name,
+				Expr:  ar.Expr,
+			}
+			for _, a := range alerts {
+				e.Alerts = append(e.Alerts, newAlertState(a))
+			}
+			sf.Rules = append(sf.Rules, e)
+		}
+	}
+	data, err := json.Marshal(&sf)
+	if err != nil {
+		return fmt.Errorf("cannot marshal ruler state: %w", err)
+	}
+
+	saveStateLock.Lock()
+	defer saveStateLock.Unlock()
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("cannot write ruler state: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, path, err)
+	}
+	return nil
+}
+
+// restoreState restores alerts for alerting rules from groups from the file at path.
+//
+// It returns the number of restored alerts. Missing file isn't an error.
+func restoreState(path string, groups []*Group) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("cannot read ruler state: %w", err)
+	}
+	var sf stateFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return 0, fmt.Errorf("cannot unmarshal ruler state from %q: %w", path, err)
+	}
+	m := make(map[string][]alertState, len(sf.Rules))
+	for _, e := range sf.Rules {
+		key := e.Group + "\x00" + e.Name + "\x00" + e.Expr
+		m[key] = append(m[key], e.Alerts...)
+	}
+	n := 0
+	for _, g := range groups {
+		for _, ar := range g.alertingRules() {
+			key := g.key() + "\x00" + ar.Name + "\x00" + ar.Expr
+			states := m[key]
+			if len(states) == 0 {
+				continue
+			}
+			alerts := make([]*Alert, 0, len(states))
+			for i := range states {
+				alerts = append(alerts, states[i].toAlert())
+			}
+			ar.restoreAlerts(alerts)
+			n += len(alerts)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,131 @@
+package ruler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveRestoreState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ruler")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "state.json")
+
+	newGroups := func(expr string) []*Group {
+		t.Helper()
+		cfg, err := ParseConfig([]byte(`
+groups:
+- name: test
+  tenant: "3:4"
+  rules:
+  - record: bar
+    expr: "1"
+  - alert: Foo
+    expr: ` + expr + `
+    for: 5m
+`))
+		if err != nil {
+			t.Fatalf("cannot parse config: %s", err)
+		}
+		g, err := newGroup(&cfg.Groups[0], "test.yml", time.Minute)
+		if err != nil {
+			t.Fatalf("cannot create group: %s", err)
+		}
+		return []*Group{g}
+	}
+
+	// Missing state file
+	n, err := restoreState(path, newGroups(`"1"`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("unexpected number of restored alerts; got %d; want 0", n)
+	}
+
+	gs := newGroups(`"1"`)
+	var tw testWriter
+	ts := time.Unix(1600000000, 0).UTC()
+	gs[0].eval(ts, &tw, multiNotifier(nil))
+	gs[0].eval(ts.Add(5*time.Minute), &tw, multiNotifier(nil))
+	alertsExpected := gs[0].alertingRules()[0].getAlerts(StateFiring)
+	if len(alertsExpected) != 1 {
+		t.Fatalf("unexpected number of firing alerts; got %d; want 1", len(alertsExpected))
+	}
+	if err := saveState(path, gs); err != nil {
+		t.Fatalf("cannot save state: %s", err)
+	}
+	// The state file must be overwritten on subsequent saves.
+	if err := saveState(path, gs); err != nil {
+		t.Fatalf("cannot save state: %s", err)
+	}
+
+	gs = newGroups(`"1"`)
+	n, err = restoreState(path, gs)
+	if err != nil {
+		t.Fatalf("cannot restore state: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("unexpected number of restored alerts; got %d; want 1", n)
+	}
+	alerts := gs[0].alertingRules()[0].getAlerts(StateFiring)
+	if !reflect.DeepEqual(alerts, alertsExpected) {
+		t.Fatalf("unexpected restored alerts\ngot\n%+v\nwant\n%+v", alerts, alertsExpected)
+	}
+
+	// Undelivered resolve notification must be restored.
+	ar := gs[0].alertingRules()[0]
+	ar.mu.Lock()
+	for _, a := range ar.alerts {
+		a.unsentResolve = &Alert{
+			Labels:     a.Labels,
+			State:      StateInactive,
+			ActiveAt:   ts.Add(-time.Hour),
+			FiredAt:    ts.Add(-55 * time.Minute),
+			ResolvedAt: ts.Add(-10 * time.Minute),
+			LastSentAt: ts.Add(-20 * time.Minute),
+		}
+	}
+	ar.mu.Unlock()
+	alertsExpected = ar.getAlerts(StateFiring)
+	if err := saveState(path, gs); err != nil {
+		t.Fatalf("cannot save state: %s", err)
+	}
+	gs = newGroups(`"1"`)
+	if _, err := restoreState(path, gs); err != nil {
+		t.Fatalf("cannot restore state: %s", err)
+	}
+	alerts = gs[0].alertingRules()[0].getAlerts(StateFiring)
+	if len(alerts) != 1 || alerts[0].unsentResolve == nil {
+		t.Fatalf("missing undelivered resolve notification in restored alerts: %+v", alerts)
+	}
+	if !reflect.DeepEqual(alerts, alertsExpected) {
+		t.Fatalf("unexpected restored alerts\ngot\n%+v\nwant\n%+v", alerts, alertsExpected)
+	}
+
+	// Alerts mustn't be restored for the modified rule.
+	gs = newGroups(`"2"`)
+	n, err = restoreState(path, gs)
+	if err != nil {
+		t.Fatalf("cannot restore state: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("unexpected number of restored alerts; got %d; want 0", n)
+	}
+
+	// Invalid state file
+	if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+		t.Fatalf("cannot write state file: %s", err)
+	}
+	if _, err := restoreState(path, gs); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
@@ -0,0 +1,191 @@
+package ruler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+)
+
+// writer writes recording rule results.
+type writer interface {
+	write(at *auth.Token, tss []prompbmarshal.TimeSeries, deadline searchutils.Deadline) error
+}
+
+// multiWriter writes recording rule results to all the writers.
+type multiWriter []writer
+
+func (mw multiWriter) write(at *auth.Token, tss []prompbmarshal.TimeSeries, deadline searchutils.Deadline) error {
+	var errs []string
+	for _, w := range mw {
+		if err := w.write(at, tss, deadline); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+var (
+	remoteWriteRequests = metrics.NewCounter(`vm_ruler_remote_write_requests_total`)
+	remoteWriteErrors   = metrics.NewCounter(`vm_ruler_remote_write_errors_total`)
+	remoteWriteSamples  = metrics.NewCounter(`vm_ruler_remote_write_samples_total`)
+	remoteWriteDropped  = metrics.NewCounter(`vm_ruler_remote_write_dropped_samples_total`)
+)
+
+// remoteWriter sends recording rule results to Prometheus remote write endpoint.
+type remoteWriter struct {
+	// url may contain `{tenant}` placeholder, which is substituted with accountID:projectID.
+	url string
+	hc  *http.Client
+
+	retryMinDelay time.Duration
+}
+
+func newRemoteWriter(url string) *remoteWriter {
+	return &remoteWriter{
+		url:           url,
+		hc:            &http.Client{},
+		retryMinDelay: time.Second,
+	}
+}
+
+func (rw *remoteWriter) write(at *auth.Token, tss []prompbmarshal.TimeSeries, deadline searchutils.Deadline) error {
+	wr := prompbmarshal.WriteRequest{
+		Timeseries: tss,
+	}
+	data := snappy.Encode(nil, prompbmarshal.MarshalWriteRequest(nil, &wr))
+	u := strings.Replace(rw.url, "{tenant}", fmt.Sprintf("%d:%d", at.AccountID, at.ProjectID), -1)
+
+	// Retry temporary errors until the deadline for the group evaluation.
+	delay := rw.retryMinDelay
+	for {
+		retriable, err := rw.send(u, data, deadline)
+		if err == nil {
+			remoteWriteSamples.Add(len(tss))
+			return nil
+		}
+		remoteWriteErrors.Inc()
+		if !retriable || time.Now().Add(delay).Unix() > int64(deadline.Deadline()) {
+			remoteWriteDropped.Add(len(tss))
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send sends remote write request with data to u.
+//
+// It returns true if the request may be retried on error.
+func (rw *remoteWriter) send(u string, data []byte, deadline searchutils.Deadline) (bool, error) {
+	remoteWriteRequests.Inc()
+	req, err := http.NewRequest("POST", u, bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("cannot create remote write request to %q: %w", u, err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	hc := *rw.hc
+	hc.Timeout = time.Until(time.Unix(int64(deadline.Deadline()), 0))
+	if hc.Timeout < time.Second {
+		// The group evaluation took too long. Give the remote storage a chance to receive samples anyway.
+		hc.Timeout = time.Second
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send remote write request to %q: %w", u, err)
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retriable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+	return retriable, fmt.Errorf("unexpected status code for remote write request to %q: %d; response: %q", u, resp.StatusCode, body)
+}
+
+var fileWriteErrors = metrics.NewCounter(`vm_ruler_file_write_errors_total`)
+
+// fileWriter appends recording rule results to a local file in Prometheus text exposition format.
+//
+// Every line contains `vm_account_id` and `vm_project_id` labels with the tenant.
+type fileWriter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newFileWriter(path string) (*fileWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file for recording rule results: %w", err)
+	}
+	return &fileWriter{
+		f: f,
+	}, nil
+}
+
+func (fw *fileWriter) write(at *auth.Token, tss []prompbmarshal.TimeSeries, deadline searchutils.Deadline) error {
+	var b []byte
+	for i := range tss {
+		b = appendTimeSeries(b, at, &tss[i])
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if _, err := fw.f.Write(b); err != nil {
+		fileWriteErrors.Inc()
+		return fmt.Errorf("cannot write recording rule results to %q: %w", fw.f.Name(), err)
+	}
+	return nil
+}
+
+func (fw *fileWriter) close() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	_ = fw.f.Close()
+}
+
+// appendTimeSeries appends ts for the given tenant to dst in Prometheus text exposition format.
+func appendTimeSeries(dst []byte, at *auth.Token, ts *prompbmarshal.TimeSeries) []byte {
+	metricName := ""
+	labels := make([]prompbmarshal.Label, 0, len(ts.Labels)+2)
+	for _, label := range ts.Labels {
+		if label.Name == "__name__" {
+			metricName = label.Value
+			continue
+		}
+		labels = append(labels, label)
+	}
+	labels = append(labels, prompbmarshal.Label{
+		Name:  "vm_account_id",
+		Value: strconv.FormatUint(uint64(at.AccountID), 10),
+	}, prompbmarshal.Label{
+		Name:  "vm_project_id",
+		Value: strconv.FormatUint(uint64(at.ProjectID), 10),
+	})
+	for _, s := range ts.Samples {
+		dst = append(dst, metricName...)
+		dst = marshalLabels(dst, labels)
+		dst = append(dst, ' ')
+		dst = strconv.AppendFloat(dst, s.Value, 'g', -1, 64)
+		dst = append(dst, ' ')
+		dst = strconv.AppendInt(dst, s.Timestamp, 10)
+		dst = append(dst, '\n')
+	}
+	return dst
+}
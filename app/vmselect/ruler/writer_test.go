@@ -0,0 +1,214 @@
+package ruler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/golang/snappy"
+)
+
+func newTestTimeSeries(name string, value float64, timestamp int64) prompbmarshal.TimeSeries {
+	return prompbmarshal.TimeSeries{
+		Labels: []prompbmarshal.Label{
+			{Name: "__name__", Value: name},
+			{Name: "job", Value: `a"b`},
+		},
+		Samples: []prompbmarshal.Sample{{
+			Value:     value,
+			Timestamp: timestamp,
+		}},
+	}
+}
+
+func TestRemoteWriter(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	var paths []string
+	var names []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		if ce := r.Header.Get("Content-Encoding"); ce != "snappy" {
+			t.Errorf("unexpected Content-Encoding; got %q; want snappy", ce)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read body: %s", err)
+			return
+		}
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("cannot decode body: %s", err)
+			return
+		}
+		var wr prompb.WriteRequest
+		if err := wr.Unmarshal(data); err != nil {
+			t.Errorf("cannot unmarshal request: %s", err)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		for _, ts := range wr.Timeseries {
+			names = append(names, string(ts.Labels[0].Value))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	rw := newRemoteWriter(srv.URL + "/insert/{tenant}/prometheus/api/v1/write")
+	rw.retryMinDelay = time.Millisecond
+	at := &auth.Token{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+	deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+	tss := []prompbmarshal.TimeSeries{
+		newTestTimeSeries("foo", 1, 1000),
+		newTestTimeSeries("bar", 2, 1000),
+	}
+	if err := rw.write(at, tss, deadline); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if requests != 2 {
+		t.Fatalf("unexpected number of requests; got %d; want 2", requests)
+	}
+	if len(paths) != 1 || paths[0] != "/insert/1:2/prometheus/api/v1/write" {
+		t.Fatalf("unexpected paths: %q", paths)
+	}
+	if len(names) != 2 || names[0] != "foo" || names[1] != "bar" {
+		t.Fatalf("unexpected series: %q", names)
+	}
+
+	// Non-retriable errors
+	rw = newRemoteWriter(srv.URL + "/foo")
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	if err := rw.write(at, tss, deadline); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestRemoteWriterTimeout(t *testing.T) {
+	doneCh := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-doneCh
+	}))
+	defer srv.Close()
+	defer close(doneCh)
+
+	// The request to the stuck remote storage must be canceled at the group evaluation deadline.
+	rw := newRemoteWriter(srv.URL)
+	deadline := searchutils.NewDeadline(time.Now(), time.Second, "")
+	startTime := time.Now()
+	if err := rw.write(&auth.Token{}, []prompbmarshal.TimeSeries{newTestTimeSeries("foo", 1, 1000)}, deadline); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if d := time.Since(startTime); d > 5*time.Second {
+		t.Fatalf("too long remote write duration: %s", d)
+	}
+}
+
+func TestFileWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ruler")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "results.prom")
+	fw, err := newFileWriter(path)
+	if err != nil {
+		t.Fatalf("cannot create file writer: %s", err)
+	}
+	deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+	for i, at := range []*auth.Token{{AccountID: 0}, {AccountID: 12, ProjectID: 34}} {
+		tss := []prompbmarshal.TimeSeries{newTestTimeSeries("foo", float64(i)+0.5, 1600000000000)}
+		if err := fw.write(at, tss, deadline); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	fw.close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read file: %s", err)
+	}
+	resultExpected := `foo{job="a\"b",vm_account_id="0",vm_project_id="0"} 0.5 1600000000000
+foo{job="a\"b",vm_account_id="12",vm_project_id="34"} 1.5 1600000000000
+`
+	if string(data) != resultExpected {
+		t.Fatalf("unexpected file contents\ngot\n%s\nwant\n%s", data, resultExpected)
+	}
+}
+
+type testWriter struct {
+	mu  sync.Mutex
+	tss []prompbmarshal.TimeSeries
+}
+
+func (tw *testWriter) write(at *auth.Token, tss []prompbmarshal.TimeSeries, deadline searchutils.Deadline) error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.tss = append(tw.tss, tss...)
+	return nil
+}
+
+func TestGroupEval(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+groups:
+- name: test
+  tenant: "5"
+  rules:
+  - record: foo
+    expr: label_set(time(), "job", "a")
+  - record: bar
+    expr: label_set(time() * 2, "job", "b")
+`))
+	if err != nil {
+		t.Fatalf("cannot parse config: %s", err)
+	}
+	g, err := newGroup(&cfg.Groups[0], "test.yml", time.Minute)
+	if err != nil {
+		t.Fatalf("cannot create group: %s", err)
+	}
+	var tw testWriter
+	g.eval(time.Unix(1000, 0), &tw, multiNotifier(nil))
+	if len(tw.tss) != 2 {
+		t.Fatalf("unexpected number of series; got %d; want 2", len(tw.tss))
+	}
+	for i, valueExpected := range []float64{1000, 2000} {
+		if v := tw.tss[i].Samples[0].Value; v != valueExpected {
+			t.Fatalf("unexpected value for series #%d; got %v; want %v", i, v, valueExpected)
+		}
+	}
+
+	// run must stop on stopCh close
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		g.run(stopCh, &tw, multiNotifier(nil))
+		close(doneCh)
+	}()
+	close(stopCh)
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for group stop")
+	}
+}
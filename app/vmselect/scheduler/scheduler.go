@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tenantmetrics"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// QueueFullError is returned from Scheduler.Acquire when the tenant queue is full.
+type QueueFullError struct {
+	// MaxQueueLen is the maximum queue length per tenant.
+	MaxQueueLen int
+}
+
+// Error implements error interface.
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("the number of queued requests for the tenant reached %d", e.MaxQueueLen)
+}
+
+// QueueTimeoutError is returned from Scheduler.Acquire when the request couldn't be started during the given timeout.
+type QueueTimeoutError struct {
+	// Timeout is the maximum time the request waited in the queue.
+	Timeout time.Duration
+}
+
+// Error implements error interface.
+func (e *QueueTimeoutError) Error() string {
+	return fmt.Sprintf("the request waited in the queue for more than %s", e.Timeout)
+}
+
+// Scheduler limits the number of concurrently executed requests and fairly shares the available capacity among tenants.
+//
+// Requests exceeding the capacity are queued per tenant. Queued requests are started in round-robin order across tenants,
+// so a tenant with many queued requests cannot starve other tenants.
+type Scheduler struct {
+	capacity    int
+	maxQueueLen int
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	queues  map[tenantKey]*tenantQueue
+
+	// active contains tenant queues with pending requests in round-robin order.
+	active []*tenantQueue
+}
+
+type tenantKey struct {
+	accountID uint32
+	projectID uint32
+}
+
+type tenantQueue struct {
+	key     tenantKey
+	waiters []*waiter
+}
+
+type waiter struct {
+	readyCh chan struct{}
+}
+
+// New returns new Scheduler, which may execute up to capacity concurrent requests
+// and may queue up to maxQueueLen requests per tenant.
+func New(capacity, maxQueueLen int) *Scheduler {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &Scheduler{
+		capacity:    capacity,
+		maxQueueLen: maxQueueLen,
+		queues:      make(map[tenantKey]*tenantQueue),
+	}
+}
+
+// Capacity returns the maximum number of concurrently executed requests.
+func (s *Scheduler) Capacity() int {
+	return s.capacity
+}
+
+// Running returns the number of currently executed requests.
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	n := s.running
+	s.mu.Unlock()
+	return n
+}
+
+// Queued returns the number of currently queued requests.
+func (s *Scheduler) Queued() int {
+	s.mu.Lock()
+	n := s.queued
+	s.mu.Unlock()
+	return n
+}
+
+// Acquire waits until the request for the given at may be executed.
+//
+// The request waits in the tenant queue for up to timeout.
+// *QueueFullError or *QueueTimeoutError is returned if the request cannot be executed.
+// Release must be called after the request is executed if nil error is returned.
+func (s *Scheduler) Acquire(at *auth.Token, timeout time.Duration) error {
+	key := tenantKey{
+		accountID: at.AccountID,
+		projectID: at.ProjectID,
+	}
+	s.mu.Lock()
+	if s.running < s.capacity && s.queued == 0 {
+		// Fast path - there is free capacity.
+		s.running++
+		s.mu.Unlock()
+		return nil
+	}
+
+	// Slow path - queue the request.
+	concurrencyLimitReached.Inc()
+	tq := s.queues[key]
+	if tq == nil {
+		tq = &tenantQueue{
+			key: key,
+		}
+		s.queues[key] = tq
+	}
+	if len(tq.waiters) >= s.maxQueueLen {
+		s.mu.Unlock()
+		queueRejected.Get(at).Inc()
+		return &QueueFullError{
+			MaxQueueLen: s.maxQueueLen,
+		}
+	}
+	w := &waiter{
+		readyCh: make(chan struct{}),
+	}
+	if len(tq.waiters) == 0 {
+		s.active = append(s.active, tq)
+	}
+	tq.waiters = append(tq.waiters, w)
+	s.queued++
+	s.mu.Unlock()
+
+	queueRequests.Get(at).Inc()
+	startTime := time.Now()
+	defer getQueueDurationSummary(at).UpdateDuration(startTime)
+
+	t := timerpool.Get(timeout)
+	select {
+	case <-w.readyCh:
+		timerpool.Put(t)
+		return nil
+	case <-t.C:
+		timerpool.Put(t)
+	}
+
+	s.mu.Lock()
+	select {
+	case <-w.readyCh:
+		// The request has been started concurrently with the timeout.
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	s.removeWaiterLocked(tq, w)
+	s.mu.Unlock()
+	concurrencyLimitTimeout.Inc()
+	queueTimeouts.Get(at).Inc()
+	return &QueueTimeoutError{
+		Timeout: timeout,
+	}
+}
+
+// Release must be called after the request started with Acquire is executed.
+//
+// It passes the released capacity to the first queued request for the next tenant in round-robin order.
+func (s *Scheduler) Release() {
+	s.mu.Lock()
+	if len(s.active) == 0 {
+		s.running--
+		s.mu.Unlock()
+		return
+	}
+	tq := s.active[0]
+	w := tq.waiters[0]
+	tq.waiters[0] = nil
+	tq.waiters = tq.waiters[1:]
+	s.queued--
+	s.active[0] = nil
+	s.active = s.active[1:]
+	if len(tq.waiters) > 0 {
+		// Move the tenant to the end of round-robin queue.
+		s.active = append(s.active, tq)
+	} else {
+		delete(s.queues, tq.key)
+	}
+	// The capacity is passed to w, so s.running remains the same.
+	close(w.readyCh)
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) removeWaiterLocked(tq *tenantQueue, w *waiter) {
+	for i, x := range tq.waiters {
+		if x == w {
+			tq.waiters = append(tq.waiters[:i], tq.waiters[i+1:]...)
+			s.queued--
+			break
+		}
+	}
+	if len(tq.waiters) > 0 {
+		return
+	}
+	for i, x := range s.active {
+		if x == tq {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			break
+		}
+	}
+	delete(s.queues, tq.key)
+}
+
+func getQueueDurationSummary(at *auth.Token) *metrics.Summary {
+	return metrics.GetOrCreateSummary(fmt.Sprintf(`vm_concurrent_select_queue_duration_seconds{accountID="%d",projectID="%d"}`, at.AccountID, at.ProjectID))
+}
+
+var (
+	concurrencyLimitReached = metrics.NewCounter(`vm_concurrent_select_limit_reached_total`)
+	concurrencyLimitTimeout = metrics.NewCounter(`vm_concurrent_select_limit_timeout_total`)
+
+	queueRequests = tenantmetrics.NewCounterMap(`vm_concurrent_select_queued_requests_total`)
+	queueRejected = tenantmetrics.NewCounterMap(`vm_concurrent_select_queue_full_total`)
+	queueTimeouts = tenantmetrics.NewCounterMap(`vm_concurrent_select_queue_timeouts_total`)
+)
@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+)
+
+func TestSchedulerFastPath(t *testing.T) {
+	s := New(2, 10)
+	at := &auth.Token{AccountID: 1}
+	for i := 0; i < 2; i++ {
+		if err := s.Acquire(at, time.Second); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if n := s.Running(); n != 2 {
+		t.Fatalf("unexpected number of running requests; got %d; want 2", n)
+	}
+	s.Release()
+	s.Release()
+	if n := s.Running(); n != 0 {
+		t.Fatalf("unexpected number of running requests; got %d; want 0", n)
+	}
+}
+
+func TestSchedulerQueueTimeout(t *testing.T) {
+	s := New(1, 10)
+	at := &auth.Token{AccountID: 1}
+	if err := s.Acquire(at, time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err := s.Acquire(at, 10*time.Millisecond)
+	var qte *QueueTimeoutError
+	if !errors.As(err, &qte) {
+		t.Fatalf("expecting QueueTimeoutError; got %v", err)
+	}
+	if n := s.Queued(); n != 0 {
+		t.Fatalf("unexpected number of queued requests; got %d; want 0", n)
+	}
+	s.Release()
+	if n := s.Running(); n != 0 {
+		t.Fatalf("unexpected number of running requests; got %d; want 0", n)
+	}
+}
+
+func TestSchedulerQueueFull(t *testing.T) {
+	s := New(1, 1)
+	at := &auth.Token{AccountID: 1}
+	if err := s.Acquire(at, time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	doneCh := make(chan error)
+	go func() {
+		doneCh <- s.Acquire(at, time.Second)
+	}()
+	waitForQueued(t, s, 1)
+
+	// The queue for the tenant is full.
+	err := s.Acquire(at, time.Second)
+	var qfe *QueueFullError
+	if !errors.As(err, &qfe) {
+		t.Fatalf("expecting QueueFullError; got %v", err)
+	}
+
+	// The queue for another tenant is empty.
+	atOther := &auth.Token{AccountID: 2}
+	go func() {
+		doneCh <- s.Acquire(atOther, time.Second)
+	}()
+	waitForQueued(t, s, 2)
+
+	s.Release()
+	if err := <-doneCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.Release()
+	if err := <-doneCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.Release()
+	if n := s.Running(); n != 0 {
+		t.Fatalf("unexpected number of running requests; got %d; want 0", n)
+	}
+}
+
+func TestSchedulerRoundRobin(t *testing.T) {
+	s := New(1, 10)
+	atA := &auth.Token{AccountID: 1}
+	atB := &auth.Token{AccountID: 2}
+	if err := s.Acquire(atA, time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Queue requests in the order A, A, A, B.
+	resultCh := make(chan string, 4)
+	queue := func(at *auth.Token, name string, queued int) {
+		go func() {
+			if err := s.Acquire(at, 5*time.Second); err != nil {
+				resultCh <- err.Error()
+				return
+			}
+			resultCh <- name
+		}()
+		waitForQueued(t, s, queued)
+	}
+	queue(atA, "a1", 1)
+	queue(atA, "a2", 2)
+	queue(atA, "a3", 3)
+	queue(atB, "b1", 4)
+
+	// Requests must be started in round-robin order across tenants.
+	namesExpected := []string{"a1", "b1", "a2", "a3"}
+	for _, nameExpected := range namesExpected {
+		s.Release()
+		name := <-resultCh
+		if name != nameExpected {
+			t.Fatalf("unexpected request started; got %q; want %q", name, nameExpected)
+		}
+	}
+	s.Release()
+	if n := s.Running(); n != 0 {
+		t.Fatalf("unexpected number of running requests; got %d; want 0", n)
+	}
+	if n := s.Queued(); n != 0 {
+		t.Fatalf("unexpected number of queued requests; got %d; want 0", n)
+	}
+}
+
+func waitForQueued(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout when waiting for %d queued requests; got %d", n, s.Queued())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
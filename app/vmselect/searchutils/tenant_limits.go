@@ -0,0 +1,158 @@
+package searchutils
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"gopkg.in/yaml.v2"
+)
+
+var tenantLimitsFile = flag.String("search.tenantLimitsFile", "", "Optional path to YAML file with per-tenant query limits. "+
+	"The file may contain `default` limits for all the tenants and `tenants` section with per-tenant overrides keyed by `accountID[:projectID]`. "+
+	"See README.md for details")
+
+// TenantLimits contains query limits for a tenant.
+//
+// Zero value for any limit means there is no limit.
+type TenantLimits struct {
+	// MaxStreamsPerQuery is the maximum number of log streams a single query may select.
+	MaxStreamsPerQuery int `yaml:"max_streams_per_query"`
+
+	// MaxBytesPerQuery is the maximum number of bytes a single query may read from vmstorage nodes.
+	MaxBytesPerQuery uint64 `yaml:"max_bytes_per_query"`
+
+	// MaxLinesPerQuery is the maximum number of log lines a single query may read from vmstorage nodes.
+	MaxLinesPerQuery uint64 `yaml:"max_lines_per_query"`
+
+	// MaxQueryTimeRange is the maximum time range for a single query such as `30d`.
+	MaxQueryTimeRange string `yaml:"max_query_time_range"`
+
+	// MaxConcurrentQueries is the maximum number of concurrently executed queries.
+	MaxConcurrentQueries int `yaml:"max_concurrent_queries"`
+
+	// RequireEqualityMatcher requires at least a single `label="value"` matcher in every log stream selector.
+	RequireEqualityMatcher bool `yaml:"require_equality_matcher"`
+
+	// maxQueryTimeRangeMs is parsed MaxQueryTimeRange.
+	maxQueryTimeRangeMs int64
+}
+
+// MaxQueryTimeRangeMs returns the maximum time range for a single query in milliseconds.
+func (tl *TenantLimits) MaxQueryTimeRangeMs() int64 {
+	return tl.maxQueryTimeRangeMs
+}
+
+func (tl *TenantLimits) init() error {
+	tl.maxQueryTimeRangeMs = 0
+	if len(tl.MaxQueryTimeRange) > 0 {
+		d, err := logql.PositiveDurationValue(tl.MaxQueryTimeRange, 0)
+		if err != nil {
+			return fmt.Errorf("cannot parse `max_query_time_range`: %w", err)
+		}
+		tl.maxQueryTimeRangeMs = d
+	}
+	return nil
+}
+
+// TenantLimitsConfig contains query limits for all the tenants.
+type TenantLimitsConfig struct {
+	// Default contains limits for tenants without overrides.
+	Default TenantLimits `yaml:"default"`
+
+	// Tenants contains per-tenant overrides keyed by `accountID[:projectID]`.
+	//
+	// Overrides are applied on top of Default limits, so limits missing in overrides are inherited from Default,
+	// while limits explicitly set to zero value are lifted for the tenant.
+	Tenants map[string]yaml.MapSlice `yaml:"tenants"`
+
+	m map[auth.Token]*TenantLimits
+}
+
+// ParseTenantLimitsConfig parses tenant limits config from YAML data.
+func ParseTenantLimitsConfig(data []byte) (*TenantLimitsConfig, error) {
+	var cfg TenantLimitsConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal tenant limits: %w", err)
+	}
+	if err := cfg.Default.init(); err != nil {
+		return nil, fmt.Errorf("invalid `default` limits: %w", err)
+	}
+	cfg.m = make(map[auth.Token]*TenantLimits, len(cfg.Tenants))
+	for key, overrides := range cfg.Tenants {
+		at, err := auth.NewToken(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse tenant %q: %w", key, err)
+		}
+		if _, ok := cfg.m[*at]; ok {
+			return nil, fmt.Errorf("duplicate limits for tenant %q", key)
+		}
+		tl, err := newTenantLimits(&cfg.Default, overrides)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limits for tenant %q: %w", key, err)
+		}
+		cfg.m[*at] = tl
+	}
+	return &cfg, nil
+}
+
+// newTenantLimits returns defaultLimits with the given overrides applied.
+func newTenantLimits(defaultLimits *TenantLimits, overrides yaml.MapSlice) (*TenantLimits, error) {
+	tl := *defaultLimits
+	if len(overrides) > 0 {
+		data, err := yaml.Marshal(overrides)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal overrides: %w", err)
+		}
+		// Only the limits present in overrides are updated in tl.
+		if err := yaml.UnmarshalStrict(data, &tl); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal overrides: %w", err)
+		}
+	}
+	if err := tl.init(); err != nil {
+		return nil, err
+	}
+	return &tl, nil
+}
+
+// GetLimits returns limits for the given at.
+func (cfg *TenantLimitsConfig) GetLimits(at *auth.Token) *TenantLimits {
+	if tl := cfg.m[*at]; tl != nil {
+		return tl
+	}
+	return &cfg.Default
+}
+
+var tenantLimitsConfig atomic.Value
+
+func init() {
+	tenantLimitsConfig.Store(&TenantLimitsConfig{})
+}
+
+// InitTenantLimits loads tenant limits from -search.tenantLimitsFile.
+//
+// It must be called after flag.Parse().
+func InitTenantLimits() error {
+	if len(*tenantLimitsFile) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(*tenantLimitsFile)
+	if err != nil {
+		return fmt.Errorf("cannot read -search.tenantLimitsFile: %w", err)
+	}
+	cfg, err := ParseTenantLimitsConfig(data)
+	if err != nil {
+		return fmt.Errorf("cannot load -search.tenantLimitsFile=%q: %w", *tenantLimitsFile, err)
+	}
+	tenantLimitsConfig.Store(cfg)
+	return nil
+}
+
+// GetTenantLimits returns query limits for the given at.
+func GetTenantLimits(at *auth.Token) *TenantLimits {
+	cfg := tenantLimitsConfig.Load().(*TenantLimitsConfig)
+	return cfg.GetLimits(at)
+}
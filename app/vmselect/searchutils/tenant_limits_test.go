@@ -0,0 +1,125 @@
+package searchutils
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+)
+
+func TestParseTenantLimitsConfigSuccess(t *testing.T) {
+	data := `
+default:
+  max_streams_per_query: 1000
+  max_query_time_range: 30d
+  require_equality_matcher: true
+tenants:
+  "42":
+    max_streams_per_query: 10
+    max_lines_per_query: 1000000
+  "42:1":
+    max_query_time_range: 1h
+    max_concurrent_queries: 2
+    max_bytes_per_query: 1000
+  "43":
+    max_streams_per_query: 0
+    max_query_time_range: ""
+    require_equality_matcher: false
+  "44":
+`
+	cfg, err := ParseTenantLimitsConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(at *auth.Token, tlExpected *TenantLimits) {
+		t.Helper()
+		tl := cfg.GetLimits(at)
+		if tl.MaxStreamsPerQuery != tlExpected.MaxStreamsPerQuery {
+			t.Fatalf("unexpected max_streams_per_query; got %d; want %d", tl.MaxStreamsPerQuery, tlExpected.MaxStreamsPerQuery)
+		}
+		if tl.MaxLinesPerQuery != tlExpected.MaxLinesPerQuery {
+			t.Fatalf("unexpected max_lines_per_query; got %d; want %d", tl.MaxLinesPerQuery, tlExpected.MaxLinesPerQuery)
+		}
+		if tl.MaxBytesPerQuery != tlExpected.MaxBytesPerQuery {
+			t.Fatalf("unexpected max_bytes_per_query; got %d; want %d", tl.MaxBytesPerQuery, tlExpected.MaxBytesPerQuery)
+		}
+		if tl.MaxQueryTimeRangeMs() != tlExpected.maxQueryTimeRangeMs {
+			t.Fatalf("unexpected max_query_time_range; got %d; want %d", tl.MaxQueryTimeRangeMs(), tlExpected.maxQueryTimeRangeMs)
+		}
+		if tl.MaxConcurrentQueries != tlExpected.MaxConcurrentQueries {
+			t.Fatalf("unexpected max_concurrent_queries; got %d; want %d", tl.MaxConcurrentQueries, tlExpected.MaxConcurrentQueries)
+		}
+		if tl.RequireEqualityMatcher != tlExpected.RequireEqualityMatcher {
+			t.Fatalf("unexpected require_equality_matcher; got %v; want %v", tl.RequireEqualityMatcher, tlExpected.RequireEqualityMatcher)
+		}
+	}
+
+	// Default limits
+	f(&auth.Token{AccountID: 1}, &TenantLimits{
+		MaxStreamsPerQuery:     1000,
+		maxQueryTimeRangeMs:    30 * 24 * 3600 * 1000,
+		RequireEqualityMatcher: true,
+	})
+
+	// Overrides with the default limits for unset values
+	f(&auth.Token{AccountID: 42}, &TenantLimits{
+		MaxStreamsPerQuery:     10,
+		MaxLinesPerQuery:       1000000,
+		maxQueryTimeRangeMs:    30 * 24 * 3600 * 1000,
+		RequireEqualityMatcher: true,
+	})
+	f(&auth.Token{AccountID: 42, ProjectID: 1}, &TenantLimits{
+		MaxStreamsPerQuery:     1000,
+		MaxBytesPerQuery:       1000,
+		maxQueryTimeRangeMs:    3600 * 1000,
+		MaxConcurrentQueries:   2,
+		RequireEqualityMatcher: true,
+	})
+
+	// Overrides lifting the default limits
+	f(&auth.Token{AccountID: 43}, &TenantLimits{})
+
+	// Empty overrides
+	f(&auth.Token{AccountID: 44}, &TenantLimits{
+		MaxStreamsPerQuery:     1000,
+		maxQueryTimeRangeMs:    30 * 24 * 3600 * 1000,
+		RequireEqualityMatcher: true,
+	})
+}
+
+func TestParseTenantLimitsConfigFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		cfg, err := ParseTenantLimitsConfig([]byte(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q; got %+v", data, cfg)
+		}
+	}
+
+	// Invalid yaml
+	f(`foo`)
+
+	// Unknown field
+	f(`default: {max_series: 1}`)
+
+	// Invalid tenant
+	f(`tenants: {"foo": {max_streams_per_query: 1}}`)
+	f(`tenants: {"1:2:3": {max_streams_per_query: 1}}`)
+
+	// Duplicate tenant
+	f(`tenants: {"1": {max_streams_per_query: 1}, "1:0": {max_streams_per_query: 2}}`)
+
+	// Invalid time range
+	f(`default: {max_query_time_range: foo}`)
+	f(`tenants: {"1": {max_query_time_range: -1h}}`)
+
+	// Unknown field in overrides
+	f(`tenants: {"1": {max_series: 1}}`)
+}
+
+func TestGetTenantLimitsDefault(t *testing.T) {
+	tl := GetTenantLimits(&auth.Token{AccountID: 123})
+	if tl.MaxStreamsPerQuery != 0 || tl.MaxLinesPerQuery != 0 || tl.MaxBytesPerQuery != 0 || tl.MaxQueryTimeRangeMs() != 0 ||
+		tl.MaxConcurrentQueries != 0 || tl.RequireEqualityMatcher {
+		t.Fatalf("unexpected non-empty limits without -search.tenantLimitsFile: %+v", tl)
+	}
+}
@@ -429,6 +429,13 @@ func registerStorageMetrics(strg *storage.Storage) {
 		return float64(m().SlowMetricNameLoads)
 	})
 
+	metrics.NewGauge(`vm_tail_subscriptions`, func() float64 {
+		return float64(m().TailSubscriptions)
+	})
+	metrics.NewGauge(`vm_tail_dropped_rows_total`, func() float64 {
+		return float64(m().TailDroppedRows)
+	})
+
 	metrics.NewGauge(`vm_timestamps_blocks_merged_total`, func() float64 {
 		return float64(m().TimestampsBlocksMerged)
 	})
@@ -476,6 +476,7 @@ type vmselectRequestCtx struct {
 	dataBuf []byte
 
 	sq   storage.SearchQuery
+	ssq  storage.StreamSearchQuery
 	tfss []*storage.TagFilters
 	sr   storage.Search
 	mb   storage.MetricBlock
@@ -635,8 +636,14 @@ func (s *Server) processVMSelectRequest(ctx *vmselectRequestCtx) error {
 	ctx.deadline = fasttime.UnixTimestamp() + uint64(timeout)
 
 	switch rpcName {
+	case "search_v6":
+		return s.processVMSelectSearchQuery(ctx, true)
 	case "search_v5":
-		return s.processVMSelectSearchQuery(ctx)
+		// Serve search requests from vmselect nodes, which weren't upgraded yet, during rolling upgrade.
+		// search_v5 requests don't contain `limit` and `forward` args.
+		return s.processVMSelectSearchQuery(ctx, false)
+	case "searchStream_v1":
+		return s.processVMSelectSearchStream(ctx)
 	case "labelValues_v2":
 		return s.processVMSelectLabelValues(ctx)
 	case "tagValueSuffixes_v1":
@@ -649,6 +656,12 @@ func (s *Server) processVMSelectRequest(ctx *vmselectRequestCtx) error {
 		return s.processVMSelectSeriesCount(ctx)
 	case "tsdbStatus_v2":
 		return s.processVMSelectTSDBStatus(ctx)
+	case "indexStats_v1":
+		return s.processVMSelectIndexStats(ctx)
+	case "indexVolume_v1":
+		return s.processVMSelectIndexVolume(ctx)
+	case "tail_v1":
+		return s.processVMSelectTail(ctx)
 	case "deleteMetrics_v3":
 		return s.processVMSelectDeleteMetrics(ctx)
 	default:
@@ -947,6 +960,188 @@ func (s *Server) processVMSelectTSDBStatus(ctx *vmselectRequestCtx) error {
 	return nil
 }
 
+func (s *Server) processVMSelectIndexStats(ctx *vmselectRequestCtx) error {
+	vmselectIndexStatsRequests.Inc()
+
+	// Read request
+	if err := ctx.readDataBufBytes(maxSearchQuerySize); err != nil {
+		return fmt.Errorf("cannot read searchQuery: %w", err)
+	}
+	tail, err := ctx.sq.Unmarshal(ctx.dataBuf)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal SearchQuery: %w", err)
+	}
+	if len(tail) > 0 {
+		return fmt.Errorf("unexpected non-zero tail left after unmarshaling SearchQuery: (len=%d) %q", len(tail), tail)
+	}
+
+	// Execute the request
+	if err := ctx.setupTfss(); err != nil {
+		return ctx.writeErrorMessage(err)
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: ctx.sq.MinTimestamp,
+		MaxTimestamp: ctx.sq.MaxTimestamp,
+	}
+	if err := checkTimeRange(s.storage, tr); err != nil {
+		return ctx.writeErrorMessage(err)
+	}
+	stats, err := s.storage.GetIndexStats(ctx.tfss, tr, *maxMetricsPerSearch, ctx.deadline)
+	if err != nil {
+		return ctx.writeErrorMessage(err)
+	}
+
+	// Send an empty error message to vmselect.
+	if err := ctx.writeString(""); err != nil {
+		return fmt.Errorf("cannot send empty error message: %w", err)
+	}
+
+	// Send stats to vmselect.
+	for _, n := range []uint64{stats.Streams, stats.Chunks, stats.Entries, stats.Bytes} {
+		if err := ctx.writeUint64(n); err != nil {
+			return fmt.Errorf("cannot write index stats to vmselect: %w", err)
+		}
+	}
+	return nil
+}
+
+// tailHeartbeatInterval is the interval for sending empty batches to vmselect, so it could detect broken connections.
+const tailHeartbeatInterval = time.Second
+
+// processVMSelectTail sends log rows matching the search query to vmselect as soon as they are added to the storage.
+//
+// Rows are sent in batches until the request deadline. Then an empty data block is sent as the end marker.
+// vmselect may stop the tail earlier by closing the connection.
+func (s *Server) processVMSelectTail(ctx *vmselectRequestCtx) error {
+	vmselectTailRequests.Inc()
+
+	// Read request
+	if err := ctx.readDataBufBytes(maxSearchQuerySize); err != nil {
+		return fmt.Errorf("cannot read searchQuery: %w", err)
+	}
+	tail, err := ctx.sq.Unmarshal(ctx.dataBuf)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal SearchQuery: %w", err)
+	}
+	if len(tail) > 0 {
+		return fmt.Errorf("unexpected non-zero tail left after unmarshaling SearchQuery: (len=%d) %q", len(tail), tail)
+	}
+
+	// Execute the request
+	if err := ctx.setupTfss(); err != nil {
+		return ctx.writeErrorMessage(err)
+	}
+	ts := s.storage.SubscribeTail(ctx.tfss)
+	defer ts.Unsubscribe()
+
+	// Send an empty error message to vmselect.
+	if err := ctx.writeString(""); err != nil {
+		return fmt.Errorf("cannot send empty error message: %w", err)
+	}
+	if err := ctx.bc.Flush(); err != nil {
+		return fmt.Errorf("cannot flush empty error message: %w", err)
+	}
+
+	ticker := time.NewTicker(tailHeartbeatInterval)
+	defer ticker.Stop()
+	d := time.Until(time.Unix(int64(ctx.deadline), 0))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	var tb storage.TailBatch
+	for {
+		select {
+		case <-ts.NotifyCh():
+		case <-ticker.C:
+		case <-t.C:
+			// Send the end marker.
+			return ctx.writeString("")
+		}
+		ts.Read(&tb)
+		ctx.dataBuf = tb.Marshal(ctx.dataBuf[:0])
+		err := ctx.writeDataBufBytes()
+		if err == nil {
+			err = ctx.bc.Flush()
+		}
+		if err != nil {
+			// vmselect stops the tail by closing the connection, so this isn't an error.
+			return io.EOF
+		}
+		vmselectTailRowsSent.Add(len(tb.Rows))
+	}
+}
+
+// maxTargetLabels is the maximum number of labels the index volume may be grouped by.
+const maxTargetLabels = 1024
+
+func (s *Server) processVMSelectIndexVolume(ctx *vmselectRequestCtx) error {
+	vmselectIndexVolumeRequests.Inc()
+
+	// Read request
+	if err := ctx.readDataBufBytes(maxSearchQuerySize); err != nil {
+		return fmt.Errorf("cannot read searchQuery: %w", err)
+	}
+	tail, err := ctx.sq.Unmarshal(ctx.dataBuf)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal SearchQuery: %w", err)
+	}
+	if len(tail) > 0 {
+		return fmt.Errorf("unexpected non-zero tail left after unmarshaling SearchQuery: (len=%d) %q", len(tail), tail)
+	}
+	targetLabelsCount, err := ctx.readUint32()
+	if err != nil {
+		return fmt.Errorf("cannot read the number of target labels: %w", err)
+	}
+	if targetLabelsCount > maxTargetLabels {
+		return fmt.Errorf("too many target labels: %d; mustn't exceed %d", targetLabelsCount, maxTargetLabels)
+	}
+	targetLabels := make([]string, targetLabelsCount)
+	for i := range targetLabels {
+		if err := ctx.readDataBufBytes(maxLabelValueSize); err != nil {
+			return fmt.Errorf("cannot read target label: %w", err)
+		}
+		targetLabels[i] = string(ctx.dataBuf)
+	}
+	step, err := ctx.readUint64()
+	if err != nil {
+		return fmt.Errorf("cannot read step: %w", err)
+	}
+
+	// Execute the request
+	if err := ctx.setupTfss(); err != nil {
+		return ctx.writeErrorMessage(err)
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: ctx.sq.MinTimestamp,
+		MaxTimestamp: ctx.sq.MaxTimestamp,
+	}
+	if err := checkTimeRange(s.storage, tr); err != nil {
+		return ctx.writeErrorMessage(err)
+	}
+	ivs, err := s.storage.GetIndexVolume(ctx.tfss, tr, targetLabels, int64(step), *maxMetricsPerSearch, ctx.deadline)
+	if err != nil {
+		return ctx.writeErrorMessage(err)
+	}
+
+	// Send an empty error message to vmselect.
+	if err := ctx.writeString(""); err != nil {
+		return fmt.Errorf("cannot send empty error message: %w", err)
+	}
+
+	// Send index volume to vmselect.
+	for i := range ivs {
+		ctx.dataBuf = ivs[i].Marshal(ctx.dataBuf[:0])
+		if err := ctx.writeDataBufBytes(); err != nil {
+			return fmt.Errorf("cannot send IndexVolume: %w", err)
+		}
+	}
+
+	// Send 'end of response' marker
+	if err := ctx.writeString(""); err != nil {
+		return fmt.Errorf("cannot send 'end of response' marker")
+	}
+	return nil
+}
+
 func writeTopHeapEntries(ctx *vmselectRequestCtx, a []storage.TopHeapEntry) error {
 	if err := ctx.writeUint64(uint64(len(a))); err != nil {
 		return fmt.Errorf("cannot write topHeapEntries size: %w", err)
@@ -965,7 +1160,10 @@ func writeTopHeapEntries(ctx *vmselectRequestCtx, a []storage.TopHeapEntry) erro
 // maxSearchQuerySize is the maximum size of SearchQuery packet in bytes.
 const maxSearchQuerySize = 1024 * 1024
 
-func (s *Server) processVMSelectSearchQuery(ctx *vmselectRequestCtx) error {
+// processVMSelectSearchQuery processes search request from vmselect.
+//
+// `limit` and `forward` args are read from the request only if hasLimit is set.
+func (s *Server) processVMSelectSearchQuery(ctx *vmselectRequestCtx, hasLimit bool) error {
 	vmselectSearchQueryRequests.Inc()
 
 	// Read search query.
@@ -983,6 +1181,18 @@ func (s *Server) processVMSelectSearchQuery(ctx *vmselectRequestCtx) error {
 	if err != nil {
 		return fmt.Errorf("cannot read `fetchData` bool: %w", err)
 	}
+	var limit uint64
+	var forward byte
+	if hasLimit {
+		limit, err = ctx.readUint64()
+		if err != nil {
+			return fmt.Errorf("cannot read `limit`: %w", err)
+		}
+		forward, err = ctx.readByte()
+		if err != nil {
+			return fmt.Errorf("cannot read `forward` bool: %w", err)
+		}
+	}
 
 	// Setup search.
 	if err := ctx.setupTfss(); err != nil {
@@ -995,39 +1205,133 @@ func (s *Server) processVMSelectSearchQuery(ctx *vmselectRequestCtx) error {
 	if err := checkTimeRange(s.storage, tr); err != nil {
 		return ctx.writeErrorMessage(err)
 	}
-	ctx.sr.Init(s.storage, ctx.tfss, tr, *maxMetricsPerSearch, ctx.deadline)
-	defer ctx.sr.MustClose()
-	if err := ctx.sr.Error(); err != nil {
+	return ctx.searchByPartitions(tr, fetchData, limit, forward, func(tr storage.TimeRange) {
+		ctx.sr.Init(s.storage, ctx.tfss, tr, *maxMetricsPerSearch, ctx.deadline)
+	})
+}
+
+func (s *Server) processVMSelectSearchStream(ctx *vmselectRequestCtx) error {
+	vmselectSearchStreamRequests.Inc()
+
+	// Read search query.
+	if err := ctx.readDataBufBytes(maxSearchQuerySize); err != nil {
+		return fmt.Errorf("cannot read streamSearchQuery: %w", err)
+	}
+	tail, err := ctx.ssq.Unmarshal(ctx.dataBuf)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal StreamSearchQuery: %w", err)
+	}
+	if len(tail) > 0 {
+		return fmt.Errorf("unexpected non-zero tail left after unmarshaling StreamSearchQuery: (len=%d) %q", len(tail), tail)
+	}
+	fetchData, err := ctx.readByte()
+	if err != nil {
+		return fmt.Errorf("cannot read `fetchData` bool: %w", err)
+	}
+	limit, err := ctx.readUint64()
+	if err != nil {
+		return fmt.Errorf("cannot read `limit`: %w", err)
+	}
+	forward, err := ctx.readByte()
+	if err != nil {
+		return fmt.Errorf("cannot read `forward` bool: %w", err)
+	}
+
+	// Setup search.
+	tr := storage.TimeRange{
+		MinTimestamp: ctx.ssq.MinTimestamp,
+		MaxTimestamp: ctx.ssq.MaxTimestamp,
+	}
+	if err := checkTimeRange(s.storage, tr); err != nil {
 		return ctx.writeErrorMessage(err)
 	}
+	return ctx.searchByPartitions(tr, fetchData, limit, forward, func(tr storage.TimeRange) {
+		ctx.sr.InitWithMetricName(s.storage, &ctx.ssq.MetricName, tr, ctx.deadline)
+	})
+}
 
-	// Send empty error message to vmselect.
+// searchByPartitions sends blocks found on the time range tr to vmselect.
+//
+// initSearch must initialize ctx.sr for the given time range.
+// If limit is set, then partitions are searched in the requested direction,
+// so the search is stopped as soon as at least limit rows are found.
+func (ctx *vmselectRequestCtx) searchByPartitions(tr storage.TimeRange, fetchData byte, limit uint64, forward byte, initSearch func(tr storage.TimeRange)) error {
+	trs := []storage.TimeRange{tr}
+	if limit > 0 && tr.MinTimestamp <= tr.MaxTimestamp {
+		// Search partitions in the requested direction, so the search can be stopped
+		// as soon as at least limit rows are found.
+		trs = tr.SplitByPartitions()
+		if forward == 0 {
+			for i, j := 0, len(trs)-1; i < j; i, j = i+1, j-1 {
+				trs[i], trs[j] = trs[j], trs[i]
+			}
+		}
+	}
+	var rowsFound uint64
+	for i := range trs {
+		initSearch(trs[i])
+		if err := ctx.sr.Error(); err != nil {
+			ctx.sr.MustClose()
+			if i == 0 {
+				return ctx.writeErrorMessage(err)
+			}
+			return fmt.Errorf("search error: %w", err)
+		}
+		if i == 0 {
+			// Send empty error message to vmselect.
+			if err := ctx.writeString(""); err != nil {
+				ctx.sr.MustClose()
+				return fmt.Errorf("cannot send empty error message: %w", err)
+			}
+		}
+		n, err := ctx.writeMetricBlocks(trs[i], fetchData)
+		ctx.sr.MustClose()
+		if err != nil {
+			return err
+		}
+		rowsFound += n
+		if limit > 0 && rowsFound >= limit && i+1 < len(trs) {
+			vmselectSearchQueryEarlyStops.Inc()
+			break
+		}
+	}
+
+	// Send 'end of response' marker
 	if err := ctx.writeString(""); err != nil {
-		return fmt.Errorf("cannot send empty error message: %w", err)
+		return fmt.Errorf("cannot send 'end of response' marker")
 	}
+	return nil
+}
 
-	// Send found blocks to vmselect.
+// writeMetricBlocks sends blocks found by ctx.sr to vmselect.
+//
+// It returns the number of rows in the sent blocks, which are fully contained in tr and don't touch its bounds.
+func (ctx *vmselectRequestCtx) writeMetricBlocks(tr storage.TimeRange, fetchData byte) (uint64, error) {
+	var rowsFound uint64
 	for ctx.sr.NextMetricBlock() {
+		br := ctx.sr.MetricBlockRef.BlockRef
 		ctx.mb.MetricName = ctx.sr.MetricBlockRef.MetricName
-		ctx.sr.MetricBlockRef.BlockRef.MustReadBlock(&ctx.mb.Block, fetchData)
+		br.MustReadBlock(&ctx.mb.Block, fetchData)
 
 		vmselectMetricBlocksRead.Inc()
 		vmselectMetricRowsRead.Add(ctx.mb.Block.RowsCount())
 
+		// Blocks partially outside tr may contain less rows than RowsCount inside tr, so they aren't counted.
+		// Blocks touching tr bounds aren't counted too, since vmselect may skip rows at the query bounds
+		// when resuming the query from a cursor.
+		if btr := br.TimeRange(); btr.MinTimestamp > tr.MinTimestamp && btr.MaxTimestamp < tr.MaxTimestamp {
+			rowsFound += uint64(br.RowsCount())
+		}
+
 		ctx.dataBuf = ctx.mb.Marshal(ctx.dataBuf[:0])
 		if err := ctx.writeDataBufBytes(); err != nil {
-			return fmt.Errorf("cannot send MetricBlock: %w", err)
+			return rowsFound, fmt.Errorf("cannot send MetricBlock: %w", err)
 		}
 	}
 	if err := ctx.sr.Error(); err != nil {
-		return fmt.Errorf("search error: %w", err)
+		return rowsFound, fmt.Errorf("search error: %w", err)
 	}
-
-	// Send 'end of response' marker
-	if err := ctx.writeString(""); err != nil {
-		return fmt.Errorf("cannot send 'end of response' marker")
-	}
-	return nil
+	return rowsFound, nil
 }
 
 // checkTimeRange returns true if the given tr is denied for querying.
@@ -1054,7 +1358,13 @@ var (
 	vmselectLabelEntriesRequests     = metrics.NewCounter("vm_vmselect_label_entries_requests_total")
 	vmselectSeriesCountRequests      = metrics.NewCounter("vm_vmselect_series_count_requests_total")
 	vmselectTSDBStatusRequests       = metrics.NewCounter("vm_vmselect_tsdb_status_requests_total")
+	vmselectIndexStatsRequests       = metrics.NewCounter("vm_vmselect_index_stats_requests_total")
+	vmselectIndexVolumeRequests      = metrics.NewCounter("vm_vmselect_index_volume_requests_total")
+	vmselectTailRequests             = metrics.NewCounter("vm_vmselect_tail_requests_total")
+	vmselectTailRowsSent             = metrics.NewCounter("vm_vmselect_tail_rows_sent_total")
 	vmselectSearchQueryRequests      = metrics.NewCounter("vm_vmselect_search_query_requests_total")
+	vmselectSearchQueryEarlyStops    = metrics.NewCounter("vm_vmselect_search_query_early_stops_total")
+	vmselectSearchStreamRequests     = metrics.NewCounter("vm_vmselect_search_stream_requests_total")
 	vmselectMetricBlocksRead         = metrics.NewCounter("vm_vmselect_metric_blocks_read_total")
 	vmselectMetricRowsRead           = metrics.NewCounter("vm_vmselect_metric_rows_read_total")
 )
@@ -14,4 +14,5 @@ require (
 	github.com/valyala/fastjson v1.6.1
 	github.com/valyala/histogram v1.1.2
 	github.com/valyala/quicktemplate v1.6.3
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,361 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/gorilla/websocket"
+)
+
+// Config is the configuration for Client.
+type Config struct {
+	// Addr is vmselect address such as http://vmselect:8481
+	Addr string
+
+	// Tenant is accountID[:projectID]. "0" is used if it is empty.
+	Tenant string
+
+	// Username and Password are optional basic auth credentials.
+	Username string
+	Password string
+
+	// HTTPClient is used for sending requests. http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+}
+
+// Client queries vmselect via Loki-compatible HTTP API.
+//
+// Client is safe for concurrent use.
+type Client struct {
+	addr   string
+	tenant string
+	auth   string
+	hc     *http.Client
+}
+
+// NewClient returns new Client for the given cfg.
+func NewClient(cfg *Config) (*Client, error) {
+	tenant, err := getTenant(cfg.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Addr) == 0 {
+		return nil, fmt.Errorf("missing vmselect address")
+	}
+	hc := cfg.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{
+		addr:   strings.TrimSuffix(cfg.Addr, "/"),
+		tenant: tenant,
+		auth:   getBasicAuth(cfg.Username, cfg.Password),
+		hc:     hc,
+	}, nil
+}
+
+// Tenant returns the tenant for c in the form accountID[:projectID].
+func (c *Client) Tenant() string {
+	return c.tenant
+}
+
+// QueryArgs contains args for Client.Query.
+type QueryArgs struct {
+	Query string
+
+	// Time is the evaluation time. The current time is used if it is zero.
+	Time time.Time
+
+	// Limit is the maximum number of log entries to return. vmselect default is used if it is zero.
+	Limit int
+
+	// Forward returns the oldest log entries instead of the newest ones.
+	Forward bool
+}
+
+// QueryRangeArgs contains args for Client.QueryRange.
+type QueryRangeArgs struct {
+	Query string
+
+	// Start and End is the time range for the query. vmselect defaults are used for zero values.
+	Start time.Time
+	End   time.Time
+
+	// Step is the interval between points for metric queries. vmselect default is used if it is zero.
+	Step time.Duration
+
+	// Limit is the maximum number of log entries to return. vmselect default is used if it is zero.
+	Limit int
+
+	// Forward returns the oldest log entries instead of the newest ones.
+	Forward bool
+
+	// Token resumes the query from QueryResult.NextToken returned by the previous query.
+	Token string
+}
+
+// TailArgs contains args for Client.Tail.
+type TailArgs struct {
+	Query string
+
+	// Start is the start time for log entries sent before live log entries. vmselect default is used if it is zero.
+	Start time.Time
+
+	// Limit is the maximum number of log entries sent before live log entries. vmselect default is used if it is zero.
+	Limit int
+
+	// DelayFor is the delay for live log entries, so entries arriving late are sent in the order of their timestamps.
+	DelayFor time.Duration
+}
+
+// Query executes instant query.
+//
+// See https://grafana.com/docs/loki/latest/api/#get-lokiapiv1query
+func (c *Client) Query(ctx context.Context, qa *QueryArgs) (*QueryResult, error) {
+	args := url.Values{
+		"query": {qa.Query},
+	}
+	setTime(args, "time", qa.Time)
+	setInt(args, "limit", qa.Limit)
+	if qa.Forward {
+		args.Set("direction", "forward")
+	}
+	var qr QueryResult
+	if err := c.get(ctx, "loki/api/v1/query", args, &qr); err != nil {
+		return nil, err
+	}
+	return &qr, nil
+}
+
+// QueryRange executes range query.
+//
+// See https://grafana.com/docs/loki/latest/api/#get-lokiapiv1query_range
+func (c *Client) QueryRange(ctx context.Context, qa *QueryRangeArgs) (*QueryResult, error) {
+	args := url.Values{
+		"query": {qa.Query},
+	}
+	setTime(args, "start", qa.Start)
+	setTime(args, "end", qa.End)
+	if qa.Step > 0 {
+		args.Set("step", strconv.FormatFloat(qa.Step.Seconds(), 'f', -1, 64))
+	}
+	setInt(args, "limit", qa.Limit)
+	if qa.Forward {
+		args.Set("direction", "forward")
+	}
+	if len(qa.Token) > 0 {
+		args.Set("token", qa.Token)
+	}
+	var qr QueryResult
+	if err := c.get(ctx, "loki/api/v1/query_range", args, &qr); err != nil {
+		return nil, err
+	}
+	return &qr, nil
+}
+
+// Labels returns label names on the time range [start..end].
+//
+// vmselect defaults are used for zero start and end.
+func (c *Client) Labels(ctx context.Context, start, end time.Time) ([]string, error) {
+	args := url.Values{}
+	setTime(args, "start", start)
+	setTime(args, "end", end)
+	var labels []string
+	if err := c.get(ctx, "loki/api/v1/labels", args, &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// LabelValues returns values for the label with the given name on the time range [start..end].
+//
+// vmselect defaults are used for zero start and end.
+func (c *Client) LabelValues(ctx context.Context, name string, start, end time.Time) ([]string, error) {
+	args := url.Values{}
+	setTime(args, "start", start)
+	setTime(args, "end", end)
+	var values []string
+	if err := c.get(ctx, "loki/api/v1/label/"+url.PathEscape(name)+"/values", args, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Series returns label sets for streams matching any of matches on the time range [start..end].
+//
+// vmselect defaults are used for zero start and end.
+func (c *Client) Series(ctx context.Context, matches []string, start, end time.Time) ([]map[string]string, error) {
+	args := url.Values{
+		"match[]": matches,
+	}
+	setTime(args, "start", start)
+	setTime(args, "end", end)
+	var series []map[string]string
+	if err := c.get(ctx, "loki/api/v1/series", args, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// Tail calls f for every message received from /loki/api/v1/tail websocket.
+//
+// It returns nil when vmselect closes the connection. It returns the error from f if f fails.
+// The connection is closed when ctx is canceled.
+func (c *Client) Tail(ctx context.Context, ta *TailArgs, f func(tr *TailResponse) error) error {
+	args := url.Values{
+		"query": {ta.Query},
+	}
+	setTime(args, "start", ta.Start)
+	setInt(args, "limit", ta.Limit)
+	if ta.DelayFor > 0 {
+		args.Set("delay_for", strconv.Itoa(int(ta.DelayFor/time.Second)))
+	}
+	u := c.getURL("loki/api/v1/tail", args)
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		u = "wss://" + u[len("https://"):]
+	case strings.HasPrefix(u, "http://"):
+		u = "ws://" + u[len("http://"):]
+	}
+	h := make(http.Header)
+	if len(c.auth) > 0 {
+		h.Set("Authorization", c.auth)
+	}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u, h)
+	if err != nil {
+		if resp != nil {
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+			return fmt.Errorf("cannot connect to %q; status code: %d; response: %q", u, resp.StatusCode, body)
+		}
+		return fmt.Errorf("cannot connect to %q: %w", u, err)
+	}
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-doneCh:
+			_ = conn.Close()
+		}
+	}()
+	for {
+		var tr TailResponse
+		if err := conn.ReadJSON(&tr); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// vmselect closes the connection without close message when -search.maxTailDuration is reached.
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure) || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return fmt.Errorf("cannot read message from %q: %w", u, err)
+		}
+		if err := f(&tr); err != nil {
+			return err
+		}
+	}
+}
+
+// apiResponse is the common envelope for vmselect responses.
+type apiResponse struct {
+	Status    string          `json:"status"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// APIError is returned when vmselect responds with an error.
+type APIError struct {
+	StatusCode int
+	ErrorType  string
+	Message    string
+}
+
+// Error implements error interface.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("status code %d: %s", e.StatusCode, e.Message)
+}
+
+// get sends GET request to vmselect at the given path and unmarshals `data` field from the response to dst.
+func (c *Client) get(ctx context.Context, path string, args url.Values, dst interface{}) error {
+	u := c.getURL(path, args)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request to %q: %w", u, err)
+	}
+	req = req.WithContext(ctx)
+	if len(c.auth) > 0 {
+		req.Header.Set("Authorization", c.auth)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request to %q: %w", u, err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read response from %q: %w", u, err)
+	}
+	var ar apiResponse
+	if err := json.Unmarshal(body, &ar); err != nil {
+		return fmt.Errorf("unexpected response from %q; status code: %d; response: %q", u, resp.StatusCode, body)
+	}
+	if ar.Status != "success" {
+		return fmt.Errorf("error response from %q: %w", u, &APIError{
+			StatusCode: resp.StatusCode,
+			ErrorType:  ar.ErrorType,
+			Message:    ar.Error,
+		})
+	}
+	if err := json.Unmarshal(ar.Data, dst); err != nil {
+		return fmt.Errorf("cannot parse data from %q: %w", u, err)
+	}
+	return nil
+}
+
+func (c *Client) getURL(path string, args url.Values) string {
+	return fmt.Sprintf("%s/select/%s/%s?%s", c.addr, c.tenant, path, args.Encode())
+}
+
+func getTenant(tenant string) (string, error) {
+	if len(tenant) == 0 {
+		return "0", nil
+	}
+	if _, err := auth.NewToken(tenant); err != nil {
+		return "", fmt.Errorf("invalid tenant %q: %w", tenant, err)
+	}
+	return tenant, nil
+}
+
+func getBasicAuth(username, password string) string {
+	if len(username) == 0 && len(password) == 0 {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// setTime sets args[key] to t in nanoseconds if t isn't zero.
+func setTime(args url.Values, key string, t time.Time) {
+	if !t.IsZero() {
+		args.Set(key, strconv.FormatInt(t.UnixNano(), 10))
+	}
+}
+
+// setInt sets args[key] to n if n is positive.
+func setInt(args url.Values, key string, n int) {
+	if n > 0 {
+		args.Set(key, strconv.Itoa(n))
+	}
+}
@@ -0,0 +1,290 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := NewClient(&Config{
+		Addr:   srv.URL,
+		Tenant: "12:34",
+	})
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	return c
+}
+
+func TestNewClientFailure(t *testing.T) {
+	f := func(cfg *Config) {
+		t.Helper()
+		c, err := NewClient(cfg)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if c != nil {
+			t.Fatalf("expecting nil client")
+		}
+	}
+	f(&Config{})
+	f(&Config{
+		Addr:   "http://localhost:8481",
+		Tenant: "foo",
+	})
+	f(&Config{
+		Addr:   "http://localhost:8481",
+		Tenant: "1:2:3",
+	})
+}
+
+func TestQueryResultUnmarshalSuccess(t *testing.T) {
+	f := func(data string, qrExpected *QueryResult) {
+		t.Helper()
+		var qr QueryResult
+		if err := qr.UnmarshalJSON([]byte(data)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		qr.Stats = nil
+		if !reflect.DeepEqual(&qr, qrExpected) {
+			t.Fatalf("unexpected result\ngot\n%#v\nwant\n%#v", &qr, qrExpected)
+		}
+	}
+
+	// streams
+	f(`{"resultType":"streams","result":[{"stream":{"job":"foo"},"values":[["1600000000000000000","line1"],["1600000001000000000","line2"]]}],"stats":{},"nextToken":"abc"}`, &QueryResult{
+		ResultType: ResultTypeStreams,
+		Streams: []Stream{{
+			Labels: map[string]string{"job": "foo"},
+			Entries: []Entry{
+				{Timestamp: time.Unix(1600000000, 0), Line: "line1"},
+				{Timestamp: time.Unix(1600000001, 0), Line: "line2"},
+			},
+		}},
+		NextToken: "abc",
+	})
+
+	// instant streams
+	f(`{"resultType":"streams","result":[{"stream":{},"value":["1600000000000000123","x"]}]}`, &QueryResult{
+		ResultType: ResultTypeStreams,
+		Streams: []Stream{{
+			Labels:  map[string]string{},
+			Entries: []Entry{{Timestamp: time.Unix(1600000000, 123), Line: "x"}},
+		}},
+	})
+
+	// matrix
+	f(`{"resultType":"matrix","result":[{"metric":{"__name__":"foo"},"values":[[1600000000,"1"],[1600000000.5,"2.5"]]}]}`, &QueryResult{
+		ResultType: ResultTypeMatrix,
+		Series: []Series{{
+			Labels: map[string]string{"__name__": "foo"},
+			Samples: []Sample{
+				{Timestamp: time.Unix(1600000000, 0), Value: 1},
+				{Timestamp: time.Unix(1600000000, 5e8), Value: 2.5},
+			},
+		}},
+	})
+
+	// vector
+	f(`{"resultType":"vector","result":[{"metric":{"job":"bar"},"value":[1600000000.123,"42"]}]}`, &QueryResult{
+		ResultType: ResultTypeVector,
+		Series: []Series{{
+			Labels:  map[string]string{"job": "bar"},
+			Samples: []Sample{{Timestamp: time.Unix(1600000000, 123e6), Value: 42}},
+		}},
+	})
+
+	// empty result
+	f(`{"resultType":"matrix","result":[]}`, &QueryResult{
+		ResultType: ResultTypeMatrix,
+		Series:     []Series{},
+	})
+}
+
+func TestQueryResultUnmarshalFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		var qr QueryResult
+		if err := qr.UnmarshalJSON([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error for %s", data)
+		}
+	}
+	f(`[]`)
+	f(`{"resultType":"scalar","result":[]}`)
+	f(`{"resultType":"streams","result":[{"stream":{},"values":[["foo","bar"]]}]}`)
+	f(`{"resultType":"matrix","result":[{"metric":{},"values":[["1","2"]]}]}`)
+	f(`{"resultType":"matrix","result":[{"metric":{},"values":[[1,2]]}]}`)
+	f(`{"resultType":"vector","result":[{"metric":{},"value":[1,"foo"]}]}`)
+}
+
+func TestTailResponseUnmarshal(t *testing.T) {
+	data := `{"streams":[{"stream":{"job":"foo"},"values":[["1600000000000000000","line"]]}],"dropped_entries":[{"labels":{"job":"bar"},"timestamp":"1600000001000000000"}]}`
+	var tr TailResponse
+	if err := tr.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	trExpected := &TailResponse{
+		Streams: []Stream{{
+			Labels:  map[string]string{"job": "foo"},
+			Entries: []Entry{{Timestamp: time.Unix(1600000000, 0), Line: "line"}},
+		}},
+		DroppedEntries: []DroppedEntry{{
+			Labels:    map[string]string{"job": "bar"},
+			Timestamp: time.Unix(1600000001, 0),
+		}},
+	}
+	if !reflect.DeepEqual(&tr, trExpected) {
+		t.Fatalf("unexpected result\ngot\n%#v\nwant\n%#v", &tr, trExpected)
+	}
+}
+
+func TestClientQueryRange(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/select/12:34/loki/api/v1/query_range" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		q := r.URL.Query()
+		for k, v := range map[string]string{
+			"query":     `{job="foo"}`,
+			"start":     "1600000000000000000",
+			"end":       "1600000060000000000",
+			"step":      "15",
+			"limit":     "10",
+			"direction": "forward",
+			"token":     "abc",
+		} {
+			if q.Get(k) != v {
+				t.Errorf("unexpected %s=%q; want %q", k, q.Get(k), v)
+			}
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"foo"},"values":[["1600000000000000000","line"]]}],"stats":{}}}`))
+	})
+	qr, err := c.QueryRange(context.Background(), &QueryRangeArgs{
+		Query:   `{job="foo"}`,
+		Start:   time.Unix(1600000000, 0),
+		End:     time.Unix(1600000060, 0),
+		Step:    15 * time.Second,
+		Limit:   10,
+		Forward: true,
+		Token:   "abc",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(qr.Streams) != 1 || len(qr.Streams[0].Entries) != 1 || qr.Streams[0].Entries[0].Line != "line" {
+		t.Fatalf("unexpected streams: %#v", qr.Streams)
+	}
+}
+
+func TestClientLabelsSeries(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/select/12:34/loki/api/v1/labels":
+			_, _ = w.Write([]byte(`{"status":"success","data":["job","level"]}`))
+		case "/select/12:34/loki/api/v1/label/job/values":
+			_, _ = w.Write([]byte(`{"status":"success","data":["foo","bar"]}`))
+		case "/select/12:34/loki/api/v1/series":
+			if m := r.URL.Query()["match[]"]; !reflect.DeepEqual(m, []string{`{job="foo"}`, `{job="bar"}`}) {
+				t.Errorf("unexpected match[]: %q", m)
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":[{"job":"foo"},{"job":"bar"}]}`))
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+	ctx := context.Background()
+	labels, err := c.Labels(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(labels, []string{"job", "level"}) {
+		t.Fatalf("unexpected labels: %q", labels)
+	}
+	values, err := c.LabelValues(ctx, "job", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(values, []string{"foo", "bar"}) {
+		t.Fatalf("unexpected label values: %q", values)
+	}
+	series, err := c.Series(ctx, []string{`{job="foo"}`, `{job="bar"}`}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	seriesExpected := []map[string]string{{"job": "foo"}, {"job": "bar"}}
+	if !reflect.DeepEqual(series, seriesExpected) {
+		t.Fatalf("unexpected series: %v", series)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status":"error","errorType":"400","error":"cannot parse query"}`))
+	})
+	_, err := c.Query(context.Background(), &QueryArgs{
+		Query: "{",
+	})
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		t.Fatalf("expecting APIError; got %v", err)
+	}
+	if ae.StatusCode != http.StatusBadRequest || ae.Message != "cannot parse query" {
+		t.Fatalf("unexpected error: %#v", ae)
+	}
+}
+
+func TestClientTail(t *testing.T) {
+	var upgrader websocket.Upgrader
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/select/12:34/loki/api/v1/tail" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if delayFor := r.URL.Query().Get("delay_for"); delayFor != "2" {
+			t.Errorf("unexpected delay_for=%q; want 2", delayFor)
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("cannot upgrade connection: %s", err)
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		for i := 0; i < 3; i++ {
+			msg := `{"streams":[{"stream":{"job":"foo"},"values":[["1600000000000000000","line"]]}],"dropped_entries":[]}`
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				t.Errorf("cannot write message: %s", err)
+				return
+			}
+		}
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	})
+	n := 0
+	err := c.Tail(context.Background(), &TailArgs{
+		Query:    `{job="foo"}`,
+		DelayFor: 2 * time.Second,
+	}, func(tr *TailResponse) error {
+		if len(tr.Streams) != 1 || tr.Streams[0].Entries[0].Line != "line" {
+			t.Fatalf("unexpected message: %#v", tr)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("unexpected number of messages; got %d; want 3", n)
+	}
+}
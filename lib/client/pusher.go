@@ -0,0 +1,386 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/lokipb"
+	"github.com/golang/snappy"
+)
+
+// ErrPusherClosed is returned by Pusher.Push after Pusher.Close call.
+var ErrPusherClosed = errors.New("pusher is closed")
+
+// PusherConfig is the configuration for Pusher.
+type PusherConfig struct {
+	// Addr is vminsert address such as http://vminsert:8480
+	Addr string
+
+	// Tenant is accountID[:projectID]. "0" is used if it is empty.
+	Tenant string
+
+	// Username and Password are optional basic auth credentials.
+	Username string
+	Password string
+
+	// HTTPClient is used for sending requests. http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+
+	// MaxBatchSize is the maximum size in bytes of log lines and labels per request. 1MB is used if it is zero.
+	MaxBatchSize int
+
+	// FlushInterval is the maximum duration log entries are buffered before sending. 1s is used if it is zero.
+	FlushInterval time.Duration
+
+	// QueueSize is the maximum number of batches waiting for sending. 10 is used if it is zero.
+	//
+	// Push blocks when the queue is full, so the pushing side is slowed down to the sending rate.
+	QueueSize int
+
+	// Concurrency is the number of concurrent requests to vminsert. 1 is used if it is zero.
+	//
+	// Batches may be delivered out of order if it exceeds 1.
+	Concurrency int
+
+	// MaxRetries is the maximum number of retries for a batch failed with network error, 429 or 5xx status code.
+	// 10 is used if it is zero. Negative value disables retries.
+	MaxRetries int
+
+	// RetryMinDelay and RetryMaxDelay are the bounds for the exponentially growing delay between retries.
+	// 100ms and 10s are used if they are zero.
+	RetryMinDelay time.Duration
+	RetryMaxDelay time.Duration
+
+	// OnError is called for every batch dropped after unsuccessful retries. It may be nil.
+	OnError func(err error)
+}
+
+// PusherStats contains stats for Pusher.
+type PusherStats struct {
+	// EntriesPushed is the number of log entries accepted by vminsert.
+	EntriesPushed uint64
+
+	// EntriesDropped is the number of log entries dropped after unsuccessful retries or canceled Push calls.
+	EntriesDropped uint64
+
+	// Requests is the number of requests to vminsert including retries.
+	Requests uint64
+
+	// RequestErrors is the number of failed requests to vminsert.
+	RequestErrors uint64
+}
+
+// Pusher sends log entries to vminsert via /loki/api/v1/push in batches.
+//
+// Pusher is safe for concurrent use. Close must be called in order to send the buffered log entries.
+type Pusher struct {
+	cfg  PusherConfig
+	url  string
+	auth string
+	hc   *http.Client
+
+	mu     sync.Mutex
+	b      *pushBatch
+	closed bool
+
+	// inflight tracks Push and flush calls, which may send batches to queue.
+	inflight sync.WaitGroup
+
+	queue    chan *pushBatch
+	stopCh   chan struct{}
+	flusherW sync.WaitGroup
+	sendersW sync.WaitGroup
+
+	closeOnce sync.Once
+
+	entriesPushed  uint64
+	entriesDropped uint64
+	requests       uint64
+	requestErrors  uint64
+}
+
+// NewPusher returns new Pusher for the given cfg.
+func NewPusher(cfg *PusherConfig) (*Pusher, error) {
+	tenant, err := getTenant(cfg.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Addr) == 0 {
+		return nil, fmt.Errorf("missing vminsert address")
+	}
+	c := *cfg
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	if c.MaxBatchSize <= 0 {
+		c.MaxBatchSize = 1024 * 1024
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 10
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 1
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 10
+	}
+	if c.RetryMinDelay <= 0 {
+		c.RetryMinDelay = 100 * time.Millisecond
+	}
+	if c.RetryMaxDelay <= 0 {
+		c.RetryMaxDelay = 10 * time.Second
+	}
+	p := &Pusher{
+		cfg:    c,
+		url:    fmt.Sprintf("%s/insert/%s/loki/api/v1/push", strings.TrimSuffix(c.Addr, "/"), tenant),
+		auth:   getBasicAuth(c.Username, c.Password),
+		hc:     c.HTTPClient,
+		b:      newPushBatch(),
+		queue:  make(chan *pushBatch, c.QueueSize),
+		stopCh: make(chan struct{}),
+	}
+	p.flusherW.Add(1)
+	go func() {
+		defer p.flusherW.Done()
+		p.runFlusher()
+	}()
+	for i := 0; i < c.Concurrency; i++ {
+		p.sendersW.Add(1)
+		go func() {
+			defer p.sendersW.Done()
+			for b := range p.queue {
+				p.send(b)
+			}
+		}()
+	}
+	return p, nil
+}
+
+// Push adds log entry with the given labels, timestamp and line to p.
+//
+// labels must be in the form `{name="value", ...}`. See FormatLabels.
+// Push blocks until the batch is queued for sending if the batch is full and the queue is full.
+// Log entries from the full batch are dropped if ctx is canceled while waiting.
+func (p *Pusher) Push(ctx context.Context, labels string, timestamp time.Time, line string) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPusherClosed
+	}
+	p.b.add(labels, timestamp, line)
+	if p.b.size < p.cfg.MaxBatchSize {
+		p.mu.Unlock()
+		return nil
+	}
+	b := p.b
+	p.b = newPushBatch()
+	p.inflight.Add(1)
+	p.mu.Unlock()
+	defer p.inflight.Done()
+
+	select {
+	case p.queue <- b:
+		return nil
+	case <-ctx.Done():
+		atomic.AddUint64(&p.entriesDropped, uint64(b.entries))
+		return fmt.Errorf("cannot queue %d log entries for sending: %w", b.entries, ctx.Err())
+	}
+}
+
+// Close sends the buffered log entries and stops p.
+//
+// It waits until all the queued batches are sent or dropped after unsuccessful retries.
+// It is safe calling Close multiple times.
+func (p *Pusher) Close() {
+	p.closeOnce.Do(p.close)
+}
+
+func (p *Pusher) close() {
+	close(p.stopCh)
+	p.flusherW.Wait()
+
+	p.mu.Lock()
+	p.closed = true
+	b := p.b
+	p.b = nil
+	p.mu.Unlock()
+
+	p.inflight.Wait()
+	if b.entries > 0 {
+		p.queue <- b
+	}
+	close(p.queue)
+	p.sendersW.Wait()
+}
+
+// Stats returns stats for p.
+func (p *Pusher) Stats() PusherStats {
+	return PusherStats{
+		EntriesPushed:  atomic.LoadUint64(&p.entriesPushed),
+		EntriesDropped: atomic.LoadUint64(&p.entriesDropped),
+		Requests:       atomic.LoadUint64(&p.requests),
+		RequestErrors:  atomic.LoadUint64(&p.requestErrors),
+	}
+}
+
+func (p *Pusher) runFlusher() {
+	t := time.NewTicker(p.cfg.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-t.C:
+		}
+		p.mu.Lock()
+		if p.b.entries == 0 {
+			p.mu.Unlock()
+			continue
+		}
+		b := p.b
+		p.b = newPushBatch()
+		p.mu.Unlock()
+
+		select {
+		case p.queue <- b:
+		case <-p.stopCh:
+			// Close sends the batch.
+			p.mu.Lock()
+			p.b.merge(b)
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// send sends b to vminsert with retries.
+func (p *Pusher) send(b *pushBatch) {
+	data := snappy.Encode(nil, b.wr.MarshalProtobuf(nil))
+	delay := p.cfg.RetryMinDelay
+	for retries := 0; ; retries++ {
+		retriable, err := p.post(data)
+		if err == nil {
+			atomic.AddUint64(&p.entriesPushed, uint64(b.entries))
+			return
+		}
+		atomic.AddUint64(&p.requestErrors, 1)
+		if !retriable || retries >= p.cfg.MaxRetries {
+			atomic.AddUint64(&p.entriesDropped, uint64(b.entries))
+			if p.cfg.OnError != nil {
+				p.cfg.OnError(fmt.Errorf("dropping %d log entries after %d retries: %w", b.entries, retries, err))
+			}
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if delay > p.cfg.RetryMaxDelay {
+			delay = p.cfg.RetryMaxDelay
+		}
+	}
+}
+
+// post sends data to vminsert.
+//
+// It returns true if the request may be retried on error.
+func (p *Pusher) post(data []byte) (bool, error) {
+	atomic.AddUint64(&p.requests, 1)
+	req, err := http.NewRequest("POST", p.url, bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("cannot create request to %q: %w", p.url, err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if len(p.auth) > 0 {
+		req.Header.Set("Authorization", p.auth)
+	}
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send request to %q: %w", p.url, err)
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retriable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+	return retriable, fmt.Errorf("unexpected status code from %q: %d; response: %q", p.url, resp.StatusCode, body)
+}
+
+// FormatLabels returns labels in the form `{name="value", ...}` suitable for Pusher.Push.
+//
+// Labels are sorted by name.
+func FormatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[name]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// pushBatch holds log entries for a single request to vminsert.
+type pushBatch struct {
+	wr      lokipb.WriteRequest
+	streams map[string]int
+	entries int
+	size    int
+}
+
+func newPushBatch() *pushBatch {
+	return &pushBatch{
+		streams: make(map[string]int),
+	}
+}
+
+func (b *pushBatch) add(labels string, timestamp time.Time, line string) {
+	idx, ok := b.streams[labels]
+	if !ok {
+		idx = len(b.wr.Streams)
+		b.streams[labels] = idx
+		b.wr.Streams = append(b.wr.Streams, lokipb.Stream{
+			Labels: labels,
+		})
+		b.size += len(labels)
+	}
+	s := &b.wr.Streams[idx]
+	s.Entries = append(s.Entries, lokipb.Entry{
+		Timestamp: timestamp,
+		Line:      line,
+	})
+	b.entries++
+	// Account for the timestamp and protobuf overhead.
+	b.size += len(line) + 16
+}
+
+func (b *pushBatch) merge(src *pushBatch) {
+	for i := range src.wr.Streams {
+		s := &src.wr.Streams[i]
+		for _, e := range s.Entries {
+			b.add(s.Labels, e.Timestamp, e.Line)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/lokipb"
+	"github.com/golang/snappy"
+)
+
+func TestFormatLabels(t *testing.T) {
+	f := func(labels map[string]string, resultExpected string) {
+		t.Helper()
+		result := FormatLabels(labels)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %s; want %s", result, resultExpected)
+		}
+	}
+	f(nil, `{}`)
+	f(map[string]string{"job": "foo"}, `{job="foo"}`)
+	f(map[string]string{"job": "foo", "instance": `a"b`}, `{instance="a\"b", job="foo"}`)
+}
+
+// pushServer collects log entries sent to /insert/*/loki/api/v1/push.
+type pushServer struct {
+	mu      sync.Mutex
+	entries map[string][]string
+	paths   map[string]bool
+}
+
+func (ps *pushServer) handle(w http.ResponseWriter, r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return err
+	}
+	var wr lokipb.WriteRequest
+	if err := wr.Unmarshal(data); err != nil {
+		return err
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.entries == nil {
+		ps.entries = make(map[string][]string)
+		ps.paths = make(map[string]bool)
+	}
+	ps.paths[r.URL.Path] = true
+	for _, s := range wr.Streams {
+		for _, e := range s.Entries {
+			ps.entries[s.Labels] = append(ps.entries[s.Labels], e.Line)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func TestPusher(t *testing.T) {
+	var ps pushServer
+	var failures uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail every other request in order to verify retries.
+		if atomic.AddUint32(&failures, 1)%2 == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		if err := ps.handle(w, r); err != nil {
+			t.Errorf("cannot handle request: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewPusher(&PusherConfig{
+		Addr:          srv.URL,
+		Tenant:        "5",
+		MaxBatchSize:  1000,
+		RetryMinDelay: time.Millisecond,
+		OnError: func(err error) {
+			t.Errorf("unexpected error: %s", err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot create pusher: %s", err)
+	}
+	ctx := context.Background()
+	ts := time.Unix(1600000000, 0)
+	for i := 0; i < 100; i++ {
+		labels := `{job="foo"}`
+		if i%2 == 1 {
+			labels = `{job="bar"}`
+		}
+		if err := p.Push(ctx, labels, ts.Add(time.Duration(i)*time.Millisecond), "some log line"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	p.Close()
+
+	if err := p.Push(ctx, `{job="foo"}`, ts, "line"); err != ErrPusherClosed {
+		t.Fatalf("unexpected error after Close; got %v; want %v", err, ErrPusherClosed)
+	}
+	if n := len(ps.entries[`{job="foo"}`]); n != 50 {
+		t.Fatalf("unexpected number of entries for foo; got %d; want 50", n)
+	}
+	if n := len(ps.entries[`{job="bar"}`]); n != 50 {
+		t.Fatalf("unexpected number of entries for bar; got %d; want 50", n)
+	}
+	if !ps.paths["/insert/5/loki/api/v1/push"] || len(ps.paths) != 1 {
+		t.Fatalf("unexpected request paths: %v", ps.paths)
+	}
+	stats := p.Stats()
+	if stats.EntriesPushed != 100 || stats.EntriesDropped != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.RequestErrors == 0 || stats.Requests != 2*stats.RequestErrors {
+		t.Fatalf("unexpected request stats: %+v", stats)
+	}
+}
+
+func TestPusherFlushInterval(t *testing.T) {
+	var ps pushServer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := ps.handle(w, r); err != nil {
+			t.Errorf("cannot handle request: %s", err)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewPusher(&PusherConfig{
+		Addr:          srv.URL,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("cannot create pusher: %s", err)
+	}
+	defer p.Close()
+	if err := p.Push(context.Background(), `{job="foo"}`, time.Now(), "line"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Stats().EntriesPushed == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("log entry wasn't flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !ps.paths["/insert/0/loki/api/v1/push"] {
+		t.Fatalf("unexpected request paths: %v", ps.paths)
+	}
+}
+
+func TestPusherDropOnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	var errs uint32
+	p, err := NewPusher(&PusherConfig{
+		Addr: srv.URL,
+		OnError: func(err error) {
+			atomic.AddUint32(&errs, 1)
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot create pusher: %s", err)
+	}
+	if err := p.Push(context.Background(), `{job="foo"}`, time.Now(), "line"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p.Close()
+
+	// Subsequent Close calls must be no-op.
+	p.Close()
+
+	// 4xx errors must not be retried.
+	stats := p.Stats()
+	if stats.EntriesDropped != 1 || stats.Requests != 1 || errs != 1 {
+		t.Fatalf("unexpected stats: %+v; errors: %d", stats, errs)
+	}
+}
+
+func TestPusherBackpressure(t *testing.T) {
+	unblockCh := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblockCh
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	p, err := NewPusher(&PusherConfig{
+		Addr:         srv.URL,
+		MaxBatchSize: 1,
+		QueueSize:    1,
+	})
+	if err != nil {
+		t.Fatalf("cannot create pusher: %s", err)
+	}
+
+	// The first batch is blocked in the sender, the second batch fills the queue,
+	// so the third Push must block until ctx is canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var pushErr error
+	for i := 0; i < 3 && pushErr == nil; i++ {
+		pushErr = p.Push(ctx, `{job="foo"}`, time.Now(), "line")
+	}
+	if !errors.Is(pushErr, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error; got %v; want %v", pushErr, context.DeadlineExceeded)
+	}
+	close(unblockCh)
+	p.Close()
+
+	stats := p.Stats()
+	if stats.EntriesPushed != 2 || stats.EntriesDropped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
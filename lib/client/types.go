@@ -0,0 +1,203 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Result types for QueryResult.
+const (
+	ResultTypeStreams = "streams"
+	ResultTypeMatrix  = "matrix"
+	ResultTypeVector  = "vector"
+)
+
+// QueryResult is the result for Client.Query and Client.QueryRange.
+type QueryResult struct {
+	// ResultType is one of ResultType* constants.
+	ResultType string
+
+	// Streams contains log streams for log queries.
+	Streams []Stream
+
+	// Series contains time series for metric queries.
+	Series []Series
+
+	// NextToken is set if more log entries are available for the range query.
+	// It may be passed to QueryRangeArgs.Token in order to resume the query.
+	NextToken string
+
+	// Stats contains query execution stats.
+	Stats json.RawMessage
+}
+
+// Stream is a log stream.
+type Stream struct {
+	Labels  map[string]string
+	Entries []Entry
+}
+
+// Entry is a log entry.
+type Entry struct {
+	Timestamp time.Time
+	Line      string
+}
+
+// Series is a time series returned by metric query.
+type Series struct {
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Sample is a time series sample.
+type Sample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// TailResponse is a message sent by /loki/api/v1/tail.
+type TailResponse struct {
+	Streams        []Stream
+	DroppedEntries []DroppedEntry
+}
+
+// DroppedEntry is a log entry dropped by vmselect, since the client didn't keep up with the ingestion rate.
+type DroppedEntry struct {
+	Labels    map[string]string
+	Timestamp time.Time
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (qr *QueryResult) UnmarshalJSON(data []byte) error {
+	var v struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+		Stats      json.RawMessage `json:"stats"`
+		NextToken  string          `json:"nextToken"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*qr = QueryResult{
+		ResultType: v.ResultType,
+		NextToken:  v.NextToken,
+		Stats:      v.Stats,
+	}
+	switch v.ResultType {
+	case ResultTypeStreams:
+		if err := json.Unmarshal(v.Result, &qr.Streams); err != nil {
+			return fmt.Errorf("cannot parse streams: %w", err)
+		}
+	case ResultTypeMatrix, ResultTypeVector:
+		if err := json.Unmarshal(v.Result, &qr.Series); err != nil {
+			return fmt.Errorf("cannot parse %s: %w", v.ResultType, err)
+		}
+	default:
+		return fmt.Errorf("unsupported resultType %q", v.ResultType)
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Stream) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+		Value  *[2]string        `json:"value"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	values := v.Values
+	if v.Value != nil {
+		values = append(values, *v.Value)
+	}
+	s.Labels = v.Stream
+	s.Entries = make([]Entry, len(values))
+	for i, value := range values {
+		t, err := parseTimestampNanos(value[0])
+		if err != nil {
+			return err
+		}
+		s.Entries[i] = Entry{
+			Timestamp: t,
+			Line:      value[1],
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Series) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Metric map[string]string `json:"metric"`
+		Values [][2]interface{}  `json:"values"`
+		Value  *[2]interface{}   `json:"value"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	values := v.Values
+	if v.Value != nil {
+		values = append(values, *v.Value)
+	}
+	s.Labels = v.Metric
+	s.Samples = make([]Sample, len(values))
+	for i, value := range values {
+		secs, ok := value[0].(float64)
+		if !ok {
+			return fmt.Errorf("unexpected timestamp %v; want a number", value[0])
+		}
+		str, ok := value[1].(string)
+		if !ok {
+			return fmt.Errorf("unexpected value %v; want a string", value[1])
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse value %q: %w", str, err)
+		}
+		s.Samples[i] = Sample{
+			Timestamp: time.Unix(0, int64(math.Round(secs*1e3))*1e6),
+			Value:     f,
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (tr *TailResponse) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Streams        []Stream `json:"streams"`
+		DroppedEntries []struct {
+			Labels    map[string]string `json:"labels"`
+			Timestamp string            `json:"timestamp"`
+		} `json:"dropped_entries"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	tr.Streams = v.Streams
+	tr.DroppedEntries = make([]DroppedEntry, len(v.DroppedEntries))
+	for i, de := range v.DroppedEntries {
+		t, err := parseTimestampNanos(de.Timestamp)
+		if err != nil {
+			return err
+		}
+		tr.DroppedEntries[i] = DroppedEntry{
+			Labels:    de.Labels,
+			Timestamp: t,
+		}
+	}
+	return nil
+}
+
+func parseTimestampNanos(s string) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse timestamp %q: %w", s, err)
+	}
+	return time.Unix(0, n), nil
+}
@@ -0,0 +1,208 @@
+package loglevel
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/valyala/fastjson"
+)
+
+// Canonical log levels returned by Detect and Normalize.
+//
+// They match the values of `detected_level` label in Loki.
+const (
+	Critical = "critical"
+	Error    = "error"
+	Warn     = "warn"
+	Info     = "info"
+	Debug    = "debug"
+	Trace    = "trace"
+	Unknown  = "unknown"
+)
+
+// levelKeys contains keys, which may hold log level in JSON and logfmt lines.
+var levelKeys = []string{"level", "lvl", "severity", "loglevel", "log_level"}
+
+// Detect returns the canonical log level for the given line.
+//
+// The level is detected from the following patterns in the order of their priority:
+//
+//   - JSON `level`, `severity` and similar keys, including numeric levels;
+//   - logfmt `level=` and similar keys;
+//   - syslog priority such as `<34>` at the beginning of the line;
+//   - bracketed tokens such as `[WARN]`.
+//
+// Unknown is returned if the level cannot be detected.
+func Detect(line []byte) string {
+	line = bytes.TrimLeft(line, " \t")
+	if len(line) == 0 {
+		return Unknown
+	}
+	if line[0] == '{' {
+		if level := detectJSON(line); level != Unknown {
+			return level
+		}
+	}
+	if level := detectLogfmt(line); level != Unknown {
+		return level
+	}
+	if line[0] == '<' {
+		if level := detectSyslog(line); level != Unknown {
+			return level
+		}
+	}
+	return detectBracketed(line)
+}
+
+// Normalize returns the canonical log level for s.
+//
+// Unknown is returned if s isn't a known log level.
+func Normalize(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "emerg", "emergency", "alert", "crit", "critical", "fatal", "panic":
+		return Critical
+	case "err", "eror", "error":
+		return Error
+	case "warn", "warning":
+		return Warn
+	case "info", "inf", "information", "informational", "notice":
+		return Info
+	case "debug", "dbg":
+		return Debug
+	case "trace", "trc":
+		return Trace
+	default:
+		return Unknown
+	}
+}
+
+var jsonParserPool fastjson.ParserPool
+
+func detectJSON(line []byte) string {
+	p := jsonParserPool.Get()
+	defer jsonParserPool.Put(p)
+	v, err := p.ParseBytes(line)
+	if err != nil {
+		return Unknown
+	}
+	o, err := v.Object()
+	if err != nil {
+		return Unknown
+	}
+	for _, key := range levelKeys {
+		v := o.Get(key)
+		if v == nil {
+			continue
+		}
+		switch v.Type() {
+		case fastjson.TypeString:
+			if level := Normalize(bytesutil.ToUnsafeString(v.GetStringBytes())); level != Unknown {
+				return level
+			}
+		case fastjson.TypeNumber:
+			if level := normalizeNumeric(v.GetInt()); level != Unknown {
+				return level
+			}
+		}
+	}
+	return Unknown
+}
+
+// normalizeNumeric returns the canonical log level for numeric levels used by pino and bunyan loggers.
+func normalizeNumeric(n int) string {
+	switch {
+	case n >= 60:
+		return Critical
+	case n >= 50:
+		return Error
+	case n >= 40:
+		return Warn
+	case n >= 30:
+		return Info
+	case n >= 20:
+		return Debug
+	case n >= 10:
+		return Trace
+	default:
+		return Unknown
+	}
+}
+
+func detectLogfmt(line []byte) string {
+	s := bytesutil.ToUnsafeString(line)
+	for _, key := range levelKeys {
+		n := 0
+		for {
+			m := strings.Index(s[n:], key)
+			if m < 0 {
+				break
+			}
+			start := n + m
+			end := start + len(key)
+			n = end
+			if start > 0 && s[start-1] != ' ' && s[start-1] != '\t' {
+				continue
+			}
+			if end >= len(s) || s[end] != '=' {
+				continue
+			}
+			value := s[end+1:]
+			if len(value) > 0 && value[0] == '"' {
+				if k := strings.IndexByte(value[1:], '"'); k >= 0 {
+					value = value[1 : k+1]
+				}
+			} else if k := strings.IndexAny(value, " \t"); k >= 0 {
+				value = value[:k]
+			}
+			if level := Normalize(value); level != Unknown {
+				return level
+			}
+		}
+	}
+	return Unknown
+}
+
+// detectSyslog returns log level from syslog priority at the beginning of line.
+//
+// See https://tools.ietf.org/html/rfc5424#section-6.2.1
+func detectSyslog(line []byte) string {
+	n := bytes.IndexByte(line, '>')
+	if n < 2 || n > 4 {
+		return Unknown
+	}
+	pri, err := strconv.Atoi(bytesutil.ToUnsafeString(line[1:n]))
+	if err != nil || pri < 0 || pri > 191 {
+		return Unknown
+	}
+	switch pri % 8 {
+	case 0, 1, 2:
+		return Critical
+	case 3:
+		return Error
+	case 4:
+		return Warn
+	case 5, 6:
+		return Info
+	default:
+		return Debug
+	}
+}
+
+func detectBracketed(line []byte) string {
+	for {
+		n := bytes.IndexByte(line, '[')
+		if n < 0 {
+			return Unknown
+		}
+		line = line[n+1:]
+		m := bytes.IndexByte(line, ']')
+		if m < 0 {
+			return Unknown
+		}
+		if level := Normalize(bytesutil.ToUnsafeString(line[:m])); level != Unknown {
+			return level
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package loglevel
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	f := func(line, levelExpected string) {
+		t.Helper()
+		level := Detect([]byte(line))
+		if level != levelExpected {
+			t.Fatalf("unexpected level for %q; got %q; want %q", line, level, levelExpected)
+		}
+	}
+	f("", Unknown)
+	f("foo bar", Unknown)
+
+	// JSON
+	f(`{"level":"WARN","msg":"foo"}`, Warn)
+	f(`{"msg":"foo","severity":"error"}`, Error)
+	f(`{"lvl":"dbg"}`, Debug)
+	f(`{"level":30,"msg":"pino"}`, Info)
+	f(`{"level":60}`, Critical)
+	f(`{"level":"foo","severity":"fatal"}`, Critical)
+	f(`{"msg":"[ERROR] inside json"}`, Error)
+	f(`{"msg":"foo"}`, Unknown)
+	f(`{"level":`, Unknown)
+
+	// logfmt
+	f(`ts=2020-10-10T10:10:10Z level=info msg="foo bar"`, Info)
+	f(`level=warning`, Warn)
+	f(`msg="foo" level="error"`, Error)
+	f(`caller=foo.go:10 lvl=debug`, Debug)
+	f(`loglevel=TRACE msg=foo`, Trace)
+	f(`mylevel=error`, Unknown)
+	f(`level=foo`, Unknown)
+
+	// syslog
+	f(`<34>Oct 11 22:14:15 mymachine su: 'su root' failed`, Critical)
+	f(`<11>foo`, Error)
+	f(`<12>foo`, Warn)
+	f(`<13>foo`, Info)
+	f(`<15>foo`, Debug)
+	f(`<999>foo`, Unknown)
+
+	// bracketed tokens
+	f(`2020-10-10 10:10:10 [WARN] disk is almost full`, Warn)
+	f(`[main] [error] cannot open file`, Error)
+	f(`[INFO] started`, Info)
+	f(`[main] started`, Unknown)
+	f(`[INFO started`, Unknown)
+}
+
+func TestNormalize(t *testing.T) {
+	f := func(s, levelExpected string) {
+		t.Helper()
+		level := Normalize(s)
+		if level != levelExpected {
+			t.Fatalf("unexpected level for %q; got %q; want %q", s, level, levelExpected)
+		}
+	}
+	f("", Unknown)
+	f("foo", Unknown)
+	f("FATAL", Critical)
+	f("emerg", Critical)
+	f("Err", Error)
+	f("warning", Warn)
+	f(" notice ", Info)
+	f("DEBUG", Debug)
+	f("trace", Trace)
+}
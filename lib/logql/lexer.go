@@ -83,6 +83,12 @@ again:
 	case '{', '}', '[', ']', '(', ')', ',':
 		token = s[:1]
 		goto tokenFoundLabel
+	case '|':
+		if len(s) == 1 || (s[1] != '=' && s[1] != '~') {
+			// Pipeline stage separator such as `| json`.
+			token = s[:1]
+			goto tokenFoundLabel
+		}
 	}
 	if isIdentPrefix(s) {
 		token = scanIdent(s)
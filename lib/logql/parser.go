@@ -106,6 +106,10 @@ func removeParensExpr(e Expr) Expr {
 		re.Expr = removeParensExpr(re.Expr)
 		return re
 	}
+	if pe, ok := e.(*PipelineExpr); ok {
+		pe.Expr = removeParensExpr(pe.Expr)
+		return pe
+	}
 	if be, ok := e.(*BinaryOpExpr); ok {
 		be.Left = removeParensExpr(be.Left)
 		be.Right = removeParensExpr(be.Right)
@@ -146,6 +150,10 @@ func simplifyConstants(e Expr) Expr {
 		re.Expr = simplifyConstants(re.Expr)
 		return re
 	}
+	if pe, ok := e.(*PipelineExpr); ok {
+		pe.Expr = simplifyConstants(pe.Expr)
+		return pe
+	}
 	if ae, ok := e.(*AggrFuncExpr); ok {
 		simplifyConstantsInplace(ae.Args)
 		return ae
@@ -379,7 +387,30 @@ func (p *parser) parseExpr() (Expr, error) {
 			return nil, err
 		}
 		be.Right = e2
+		if re, ok := e2.(*RollupExpr); ok && IsBinaryOpLineFilter(be.Op) {
+			if _, ok := re.Expr.(*StringExpr); ok {
+				// `{app="foo"} |= "bar" [5m]` is a rollup over line filter instead of line filter over rollup.
+				be.Right = re.Expr
+				reNew := *re
+				reNew.Expr = balanceBinaryOp(&be)
+				e = &reNew
+				continue
+			}
+		}
 		e = balanceBinaryOp(&be)
+		if IsBinaryOpLineFilter(be.Op) && p.lex.Token == "|" {
+			// Pipeline stages after line filters such as `{app="foo"} |= "bar" | json`.
+			e, err = p.parsePipelineExpr(e)
+			if err != nil {
+				return nil, err
+			}
+			if p.lex.Token == "[" || isOffset(p.lex.Token) {
+				e, err = p.parseRollupExpr(e)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
 }
 
@@ -415,6 +446,12 @@ func (p *parser) parseSingleExpr() (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := e.(*MetricExpr); ok && p.lex.Token == "|" {
+		e, err = p.parsePipelineExpr(e)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if p.lex.Token != "[" && !isOffset(p.lex.Token) {
 		// There is no rollup expression.
 		return e, nil
@@ -673,12 +710,18 @@ func expandWithExpr(was []*withArgExpr, e Expr) (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
+		modifierArgs, err := expandModifierArgs(was, t.Modifier.Args)
+		if err != nil {
+			return nil, err
+		}
 		wa := getWithArgExpr(was, t.Name)
 		if wa == nil {
 			fe := &FuncExpr{
-				Name: t.Name,
-				Args: args,
+				Name:     t.Name,
+				Args:     args,
+				Modifier: t.Modifier,
 			}
+			fe.Modifier.Args = modifierArgs
 			return fe, nil
 		}
 		return expandWithExprExt(was, wa, args)
@@ -750,6 +793,14 @@ func expandWithExpr(was []*withArgExpr, e Expr) (Expr, error) {
 		re := *t
 		re.Expr = eNew
 		return &re, nil
+	case *PipelineExpr:
+		eNew, err := expandWithExpr(was, t.Expr)
+		if err != nil {
+			return nil, err
+		}
+		pe := *t
+		pe.Expr = eNew
+		return &pe, nil
 	case *withExpr:
 		wasNew := make([]*withArgExpr, 0, len(was)+len(t.Was))
 		wasNew = append(wasNew, was...)
@@ -1007,6 +1058,13 @@ func (p *parser) parseFuncExpr() (*FuncExpr, error) {
 		return nil, err
 	}
 	fe.Args = args
+
+	// Range aggregations may have optional grouping suffix such as `by (...)` or `without (...)`.
+	if IsRollupFunc(fe.Name) && isAggrFuncModifier(p.lex.Token) {
+		if err := p.parseModifierExpr(&fe.Modifier); err != nil {
+			return nil, err
+		}
+	}
 	return &fe, nil
 }
 
@@ -1340,7 +1398,7 @@ func (p *parser) parseIdentExpr() (Expr, error) {
 			return p.parseAggrFuncExpr()
 		}
 		return p.parseFuncExpr()
-	case "{", "[", ")", ",":
+	case "{", "[", ")", ",", "|":
 		p.lex.Prev()
 		return p.parseMetricExpr()
 	default:
@@ -1528,12 +1586,21 @@ type FuncExpr struct {
 
 	// Args contains function args.
 	Args []Expr
+
+	// Modifier is optional grouping modifier for range aggregations such as `by (...)` or `without (...)`.
+	//
+	// Example: `quantile_over_time(0.99, {app="api"} | json | unwrap latency_ms [5m]) by (route)`.
+	Modifier ModifierExpr
 }
 
 // AppendString appends string representation of fe to dst and returns the result.
 func (fe *FuncExpr) AppendString(dst []byte) []byte {
 	dst = appendEscapedIdent(dst, fe.Name)
 	dst = appendStringArgListExpr(dst, fe.Args)
+	if fe.Modifier.Op != "" {
+		dst = append(dst, ' ')
+		dst = fe.Modifier.AppendString(dst)
+	}
 	return dst
 }
 
@@ -422,6 +422,29 @@ func TestParseSuccess(t *testing.T) {
 	   hitRate(cacheHits, cacheMisses)`,
 		`sum(rate(cacheHits{job="foo", instance="bar"})) by (job, instance) / (sum(rate(cacheHits{job="foo", instance="bar"})) by (job, instance) + sum(rate(cacheMisses{job="foo", instance="bar"})) by (job, instance))`)
 	another(`with(y=123,z=5) union(with(y=3,f(x)=x*y) f(2) + f(3), with(x=5,y=2) x*y*z)`, `union(15, 50)`)
+
+	// rollup over line filters
+	another(`count_over_time({app="api"} |= "error" [5m])`, `count_over_time(({app="api"} |= "error")[5m])`)
+	another(`bytes_over_time({app="api"} |= "error" |~ "timeout" [1m] offset 5m)`, `bytes_over_time((({app="api"} |= "error") |~ "timeout")[1m] offset 5m)`)
+	same(`bytes_rate(({app="api"} != "debug")[5m])`)
+	same(`sum(bytes_over_time({app="api"}[1h])) by (app)`)
+
+	// pipelineExpr
+	same(`{app="api"} | json`)
+	same(`{app="api"} | logfmt`)
+	same(`{app="api"} | json | unwrap latency_ms`)
+	same(`{app="api"} | json | unwrap latency_ms[5m]`)
+	another(`{app="api"}|json|unwrap latency_ms [5m]`, `{app="api"} | json | unwrap latency_ms[5m]`)
+	another(`{app="api"} | JSON | unwrap Bytes(size)`, `{app="api"} | json | unwrap bytes(size)`)
+	same(`{app="api"} | logfmt | unwrap duration(elapsed)`)
+	same(`{app="api"} | logfmt | unwrap duration_seconds(elapsed)`)
+	same(`{app="api"} |= "error" | json`)
+	another(`{app="api"} |= "error" |~ "timeout" | json | unwrap latency_ms[1m]`, `({app="api"} |= "error") |~ "timeout" | json | unwrap latency_ms[1m]`)
+	same(`quantile_over_time(0.99, {app="api"} | json | unwrap latency_ms[5m]) by (route)`)
+	same(`sum_over_time({app="api"} | logfmt | unwrap bytes(size)[1m])`)
+	same(`count_over_time({app="api"} |~ "err.+" | json[5m]) without (level)`)
+	same(`sum(rate({app="api"} | json[5m])) by (level)`)
+	another(`with (sel = {app="api"}) avg_over_time(sel | json | unwrap x [5m]) by (route)`, `avg_over_time({app="api"} | json | unwrap x[5m]) by (route)`)
 }
 
 func TestParseError(t *testing.T) {
@@ -702,4 +725,16 @@ func TestParseError(t *testing.T) {
 	f(`with (f(x) = sum(m) by (x)) f((xx(), {foo="bar"}))`)
 	f(`with (f(x) = m + on (x) n) f(xx())`)
 	f(`with (f(x) = m + on (a) group_right (x) n) f(xx())`)
+
+	// invalid pipelineExpr
+	f(`{app="api"} |`)
+	f(`{app="api"} | foobar`)
+	f(`{app="api"} | json |`)
+	f(`{app="api"} | unwrap`)
+	f(`{app="api"} | unwrap "x"`)
+	f(`{app="api"} | unwrap foo(x)`)
+	f(`{app="api"} | unwrap bytes(x`)
+	f(`{app="api"} | unwrap bytes()`)
+	f(`{app="api"} | unwrap x | json`)
+	f(`abs({app="api"}) by (x)`)
 }
@@ -0,0 +1,161 @@
+package logql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PipelineExpr represents log pipeline such as `{app="api"} |= "foo" | json | unwrap latency_ms`.
+//
+// See https://grafana.com/docs/loki/latest/logql/#log-pipeline
+type PipelineExpr struct {
+	// Expr is the log stream selector with optional line filters.
+	Expr Expr
+
+	// Stages contains pipeline stages in the order they must be applied.
+	Stages []*StageExpr
+}
+
+// AppendString appends string representation of pe to dst and returns the result.
+func (pe *PipelineExpr) AppendString(dst []byte) []byte {
+	dst = pe.Expr.AppendString(dst)
+	for _, se := range pe.Stages {
+		dst = append(dst, " | "...)
+		dst = se.AppendString(dst)
+	}
+	return dst
+}
+
+// Unwrap returns `unwrap` stage from pe or nil if pe doesn't contain `unwrap` stage.
+func (pe *PipelineExpr) Unwrap() *StageExpr {
+	if len(pe.Stages) == 0 {
+		return nil
+	}
+	se := pe.Stages[len(pe.Stages)-1]
+	if se.Name != "unwrap" {
+		return nil
+	}
+	return se
+}
+
+// StageExpr represents a single stage from log pipeline, i.e. `json`, `logfmt` or `unwrap bytes(size)`.
+type StageExpr struct {
+	// Name is the stage name.
+	Name string
+
+	// Label contains label name for `unwrap` stage.
+	Label string
+
+	// Conv contains optional conversion func for `unwrap` stage, i.e. `duration`, `duration_seconds` or `bytes`.
+	Conv string
+}
+
+// AppendString appends string representation of se to dst and returns the result.
+func (se *StageExpr) AppendString(dst []byte) []byte {
+	dst = append(dst, se.Name...)
+	if se.Name != "unwrap" {
+		return dst
+	}
+	dst = append(dst, ' ')
+	if len(se.Conv) == 0 {
+		return appendEscapedIdent(dst, se.Label)
+	}
+	dst = append(dst, se.Conv...)
+	dst = append(dst, '(')
+	dst = appendEscapedIdent(dst, se.Label)
+	dst = append(dst, ')')
+	return dst
+}
+
+var pipelineStages = map[string]bool{
+	"json":   true,
+	"logfmt": true,
+	"unwrap": true,
+}
+
+var unwrapConvs = map[string]bool{
+	"duration":         true,
+	"duration_seconds": true,
+	"bytes":            true,
+}
+
+// IsBinaryOpLineFilter returns true if op is line filter operator such as `|=`, `!=`, `|~` or `!~`.
+func IsBinaryOpLineFilter(op string) bool {
+	switch op {
+	case "|=", "!=", "|~", "!~":
+		return true
+	default:
+		return false
+	}
+}
+
+// parsePipelineExpr parses `| stage1 | ... | stageN` suffix for e.
+func (p *parser) parsePipelineExpr(e Expr) (*PipelineExpr, error) {
+	pe := &PipelineExpr{
+		Expr: e,
+	}
+	for p.lex.Token == "|" {
+		if err := p.lex.Next(); err != nil {
+			return nil, err
+		}
+		se, err := p.parseStageExpr()
+		if err != nil {
+			return nil, err
+		}
+		if len(pe.Stages) > 0 && pe.Stages[len(pe.Stages)-1].Name == "unwrap" {
+			return nil, fmt.Errorf(`PipelineExpr: unexpected stage %q after "unwrap"; "unwrap" must be the last stage`, se.Name)
+		}
+		pe.Stages = append(pe.Stages, se)
+	}
+	return pe, nil
+}
+
+func (p *parser) parseStageExpr() (*StageExpr, error) {
+	if !isIdentPrefix(p.lex.Token) {
+		return nil, fmt.Errorf(`StageExpr: unexpected token %q; want "ident"`, p.lex.Token)
+	}
+	var se StageExpr
+	se.Name = strings.ToLower(unescapeIdent(p.lex.Token))
+	if !pipelineStages[se.Name] {
+		return nil, fmt.Errorf(`StageExpr: unsupported stage %q; supported stages: json, logfmt, unwrap`, se.Name)
+	}
+	if err := p.lex.Next(); err != nil {
+		return nil, err
+	}
+	if se.Name != "unwrap" {
+		return &se, nil
+	}
+	if !isIdentPrefix(p.lex.Token) {
+		return nil, fmt.Errorf(`StageExpr: unexpected token %q after "unwrap"; want "ident"`, p.lex.Token)
+	}
+	ident := unescapeIdent(p.lex.Token)
+	if err := p.lex.Next(); err != nil {
+		return nil, err
+	}
+	if p.lex.Token != "(" {
+		se.Label = ident
+		return &se, nil
+	}
+	conv := strings.ToLower(ident)
+	if !unwrapConvs[conv] {
+		return nil, fmt.Errorf(`StageExpr: unsupported conversion func %q for "unwrap"; supported funcs: duration, duration_seconds, bytes`, ident)
+	}
+	se.Conv = conv
+	if err := p.lex.Next(); err != nil {
+		return nil, err
+	}
+	if !isIdentPrefix(p.lex.Token) {
+		return nil, fmt.Errorf(`StageExpr: unexpected token %q inside %s(); want "ident"`, p.lex.Token, se.Conv)
+	}
+	se.Label = unescapeIdent(p.lex.Token)
+	if err := p.lex.Next(); err != nil {
+		return nil, err
+	}
+	if p.lex.Token != ")" {
+		return nil, fmt.Errorf(`StageExpr: unexpected token %q; want ")"`, p.lex.Token)
+	}
+	if err := p.lex.Next(); err != nil {
+		return nil, err
+	}
+	return &se, nil
+}
@@ -71,6 +71,11 @@ var rollupFuncs = map[string]bool{
 	"mode_over_time": true,
 
 	"rate_over_sum": true,
+
+	// Log range funcs, which are calculated over log line sizes.
+	// See https://grafana.com/docs/loki/latest/logql/#range-vector-aggregation
+	"bytes_over_time": true,
+	"bytes_rate":      true,
 }
 
 // IsRollupFunc returns whether funcName is known rollup function.
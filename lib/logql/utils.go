@@ -26,6 +26,9 @@ func VisitAll(e Expr, f func(expr Expr)) {
 		for _, arg := range expr.Args {
 			VisitAll(arg, f)
 		}
+		if expr.Modifier.Op != "" {
+			VisitAll(&expr.Modifier, f)
+		}
 	case *AggrFuncExpr:
 		for _, arg := range expr.Args {
 			VisitAll(arg, f)
@@ -33,6 +36,8 @@ func VisitAll(e Expr, f func(expr Expr)) {
 		VisitAll(&expr.Modifier, f)
 	case *RollupExpr:
 		VisitAll(expr.Expr, f)
+	case *PipelineExpr:
+		VisitAll(expr.Expr, f)
 	}
 	f(e)
 }
@@ -0,0 +1,102 @@
+package lokipb
+
+// MarshalProtobuf appends protobuf-encoded m to dst and returns the result.
+func (m *WriteRequest) MarshalProtobuf(dst []byte) []byte {
+	for i := range m.Streams {
+		s := &m.Streams[i]
+		dst = appendTag(dst, 1, 2)
+		dst = appendVarint(dst, uint64(s.size()))
+		dst = s.marshalProtobuf(dst)
+	}
+	return dst
+}
+
+func (m *Stream) size() int {
+	n := 0
+	if len(m.Labels) > 0 {
+		n += 1 + sizeVarint(uint64(len(m.Labels))) + len(m.Labels)
+	}
+	for i := range m.Entries {
+		es := m.Entries[i].size()
+		n += 1 + sizeVarint(uint64(es)) + es
+	}
+	return n
+}
+
+func (m *Stream) marshalProtobuf(dst []byte) []byte {
+	if len(m.Labels) > 0 {
+		dst = appendTag(dst, 1, 2)
+		dst = appendVarint(dst, uint64(len(m.Labels)))
+		dst = append(dst, m.Labels...)
+	}
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		dst = appendTag(dst, 2, 2)
+		dst = appendVarint(dst, uint64(e.size()))
+		dst = e.marshalProtobuf(dst)
+	}
+	return dst
+}
+
+func (m *Entry) size() int {
+	ts := timestampSize(m.Timestamp.Unix(), int32(m.Timestamp.Nanosecond()))
+	n := 1 + sizeVarint(uint64(ts)) + ts
+	if len(m.Line) > 0 {
+		n += 1 + sizeVarint(uint64(len(m.Line))) + len(m.Line)
+	}
+	return n
+}
+
+func (m *Entry) marshalProtobuf(dst []byte) []byte {
+	secs := m.Timestamp.Unix()
+	nanos := int32(m.Timestamp.Nanosecond())
+	dst = appendTag(dst, 1, 2)
+	dst = appendVarint(dst, uint64(timestampSize(secs, nanos)))
+	if secs != 0 {
+		dst = appendTag(dst, 1, 0)
+		dst = appendVarint(dst, uint64(secs))
+	}
+	if nanos != 0 {
+		dst = appendTag(dst, 2, 0)
+		dst = appendVarint(dst, uint64(nanos))
+	}
+	if len(m.Line) > 0 {
+		dst = appendTag(dst, 2, 2)
+		dst = appendVarint(dst, uint64(len(m.Line)))
+		dst = append(dst, m.Line...)
+	}
+	return dst
+}
+
+// timestampSize returns the size of google.protobuf.Timestamp message with the given secs and nanos.
+func timestampSize(secs int64, nanos int32) int {
+	n := 0
+	if secs != 0 {
+		n += 1 + sizeVarint(uint64(secs))
+	}
+	if nanos != 0 {
+		n += 1 + sizeVarint(uint64(nanos))
+	}
+	return n
+}
+
+func appendTag(dst []byte, fieldNum, wireType int) []byte {
+	return appendVarint(dst, uint64(fieldNum<<3|wireType))
+}
+
+func appendVarint(dst []byte, v uint64) []byte {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
+
+func sizeVarint(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
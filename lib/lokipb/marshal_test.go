@@ -0,0 +1,43 @@
+package lokipb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteRequestMarshalUnmarshal(t *testing.T) {
+	f := func(wr *WriteRequest) {
+		t.Helper()
+		data := wr.MarshalProtobuf(nil)
+		var wr2 WriteRequest
+		if err := wr2.Unmarshal(data); err != nil {
+			t.Fatalf("cannot unmarshal WriteRequest: %s", err)
+		}
+		if len(wr.Streams) == 0 && len(wr2.Streams) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(wr2.Streams, wr.Streams) {
+			t.Fatalf("unexpected WriteRequest after unmarshaling\ngot\n%+v\nwant\n%+v", wr2.Streams, wr.Streams)
+		}
+	}
+	f(&WriteRequest{})
+	f(&WriteRequest{
+		Streams: []Stream{
+			{
+				Labels: `{job="api"}`,
+				Entries: []Entry{
+					{Timestamp: time.Unix(1600000000, 123456789).UTC(), Line: "foo"},
+					{Timestamp: time.Unix(1600000001, 0).UTC(), Line: ""},
+					{Timestamp: time.Unix(0, 0).UTC(), Line: string(make([]byte, 1000))},
+				},
+			},
+			{
+				Labels: `{job="db", instance="a"}`,
+				Entries: []Entry{
+					{Timestamp: time.Unix(-100, 5).UTC(), Line: "bar"},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,144 @@
+package querytracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tracer represents a span in query trace.
+//
+// The root Tracer is created with New. Child spans are created with NewChild.
+// Every span must be finished with Donef.
+//
+// All the Tracer methods may be called on nil Tracer, which means that tracing is disabled.
+// This allows passing nil Tracer to functions without additional checks for the disabled tracing.
+// NewChild, Printf and AppendJSON may be called from concurrently running goroutines.
+type Tracer struct {
+	message   string
+	startTime time.Time
+	doneTime  time.Time
+
+	mu       sync.Mutex
+	children []*Tracer
+}
+
+// New returns new root Tracer with the given message if enabled is set.
+//
+// nil is returned if enabled isn't set.
+func New(enabled bool, format string, args ...interface{}) *Tracer {
+	if !enabled {
+		return nil
+	}
+	return &Tracer{
+		message:   fmt.Sprintf(format, args...),
+		startTime: time.Now(),
+	}
+}
+
+// Enabled returns true if t is non-nil, i.e. tracing is enabled.
+func (t *Tracer) Enabled() bool {
+	return t != nil
+}
+
+// NewChild adds new child span with the given message to t and returns it.
+//
+// Donef must be called on the returned child when the traced work is finished.
+func (t *Tracer) NewChild(format string, args ...interface{}) *Tracer {
+	if t == nil {
+		return nil
+	}
+	child := &Tracer{
+		message:   fmt.Sprintf(format, args...),
+		startTime: time.Now(),
+	}
+	t.mu.Lock()
+	t.children = append(t.children, child)
+	t.mu.Unlock()
+	return child
+}
+
+// Donef finishes t and appends the given message to t message.
+func (t *Tracer) Donef(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	if len(format) > 0 {
+		t.message += ": " + fmt.Sprintf(format, args...)
+	}
+	t.doneTime = time.Now()
+}
+
+// Printf adds finished child span with the given message and zero duration to t.
+func (t *Tracer) Printf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	child := &Tracer{
+		message:   fmt.Sprintf(format, args...),
+		startTime: now,
+		doneTime:  now,
+	}
+	t.mu.Lock()
+	t.children = append(t.children, child)
+	t.mu.Unlock()
+}
+
+// Duration returns t duration.
+//
+// The duration is calculated until the current time if t isn't finished yet.
+func (t *Tracer) Duration() time.Duration {
+	if t == nil {
+		return 0
+	}
+	doneTime := t.doneTime
+	if doneTime.IsZero() {
+		doneTime = time.Now()
+	}
+	return doneTime.Sub(t.startTime)
+}
+
+// AppendJSON appends JSON representation of t to dst and returns the result.
+//
+// null is appended if t is nil.
+func (t *Tracer) AppendJSON(dst []byte) []byte {
+	if t == nil {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, `{"duration_msec":`...)
+	dst = strconv.AppendFloat(dst, float64(t.Duration())/1e6, 'f', 3, 64)
+	dst = append(dst, `,"message":`...)
+	dst = appendJSONString(dst, t.message)
+	t.mu.Lock()
+	children := append([]*Tracer{}, t.children...)
+	t.mu.Unlock()
+	if len(children) > 0 {
+		dst = append(dst, `,"children":[`...)
+		for i, child := range children {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = child.AppendJSON(dst)
+		}
+		dst = append(dst, ']')
+	}
+	dst = append(dst, '}')
+	return dst
+}
+
+// String returns JSON representation of t.
+func (t *Tracer) String() string {
+	return string(t.AppendJSON(nil))
+}
+
+func appendJSONString(dst []byte, s string) []byte {
+	data, err := json.Marshal(s)
+	if err != nil {
+		// This shouldn't happen for strings.
+		return strconv.AppendQuote(dst, s)
+	}
+	return append(dst, data...)
+}
@@ -0,0 +1,72 @@
+package querytracer
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+type traceJSON struct {
+	DurationMsec float64     `json:"duration_msec"`
+	Message      string      `json:"message"`
+	Children     []traceJSON `json:"children"`
+}
+
+func TestTracerDisabled(t *testing.T) {
+	qt := New(false, "test")
+	if qt != nil {
+		t.Fatalf("expecting nil Tracer")
+	}
+	if qt.Enabled() {
+		t.Fatalf("nil Tracer mustn't be enabled")
+	}
+	qtChild := qt.NewChild("child %d", 1)
+	qtChild.Printf("message")
+	qtChild.Donef("done")
+	qt.Donef("done")
+	if s := qt.String(); s != "null" {
+		t.Fatalf("unexpected JSON for nil Tracer; got %q; want %q", s, "null")
+	}
+}
+
+func TestTracerEnabled(t *testing.T) {
+	qt := New(true, "query %q", "foo\nbar")
+	if !qt.Enabled() {
+		t.Fatalf("Tracer must be enabled")
+	}
+	qtChild := qt.NewChild("child %d", 1)
+	qtChild.Printf("message %s", "x")
+	qtChild.Donef("rows=%d", 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			qtChild := qt.NewChild("parallel child %d", n)
+			qtChild.Donef("")
+		}(i)
+	}
+	wg.Wait()
+	qt.Donef("done")
+
+	var tj traceJSON
+	if err := json.Unmarshal([]byte(qt.String()), &tj); err != nil {
+		t.Fatalf("cannot parse trace JSON %s: %s", qt.String(), err)
+	}
+	if tj.Message != "query \"foo\\nbar\": done" {
+		t.Fatalf("unexpected message; got %q", tj.Message)
+	}
+	if len(tj.Children) != 6 {
+		t.Fatalf("unexpected number of children; got %d; want %d", len(tj.Children), 6)
+	}
+	child := tj.Children[0]
+	if child.Message != "child 1: rows=10" {
+		t.Fatalf("unexpected child message; got %q", child.Message)
+	}
+	if len(child.Children) != 1 || child.Children[0].Message != "message x" || child.Children[0].DurationMsec != 0 {
+		t.Fatalf("unexpected child children: %+v", child.Children)
+	}
+	if tj.DurationMsec < child.DurationMsec {
+		t.Fatalf("root duration %v cannot be smaller than child duration %v", tj.DurationMsec, child.DurationMsec)
+	}
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+// IndexStats contains stats for /loki/api/v1/index/stats.
+type IndexStats struct {
+	// Streams is the number of streams with at least a single block on the selected time range.
+	Streams uint64
+
+	// Chunks is the number of blocks intersecting the selected time range.
+	Chunks uint64
+
+	// Entries is the number of rows in the selected blocks.
+	Entries uint64
+
+	// Bytes is the size of the selected blocks on disk.
+	Bytes uint64
+}
+
+// Add adds src stats to is.
+func (is *IndexStats) Add(src *IndexStats) {
+	is.Streams += src.Streams
+	is.Chunks += src.Chunks
+	is.Entries += src.Entries
+	is.Bytes += src.Bytes
+}
+
+// GetIndexStats returns stats for blocks matching tfss on the given tr.
+//
+// The stats are calculated from block headers without reading block data, so Entries
+// includes all the rows for blocks, which intersect tr, while Bytes contains the size of compressed blocks.
+func (s *Storage) GetIndexStats(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) (*IndexStats, error) {
+	tsids, err := s.searchTSIDs(tfss, tr, maxMetrics, deadline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot search TSIDs for tagFilters=%s on the time range %s: %w", tfss, &tr, err)
+	}
+
+	var ts tableSearch
+	ts.Init(s.tb, tsids, tr)
+	defer ts.MustClose()
+
+	var stats IndexStats
+	var prevMetricID uint64
+	loops := 0
+	for ts.NextBlock() {
+		if loops&paceLimiterSlowIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(deadline); err != nil {
+				return nil, err
+			}
+		}
+		loops++
+		bh := &ts.BlockRef.bh
+		// Blocks are sorted by TSID, so blocks for the same stream go one after another.
+		if stats.Streams == 0 || bh.TSID.MetricID != prevMetricID {
+			stats.Streams++
+			prevMetricID = bh.TSID.MetricID
+		}
+		stats.Chunks++
+		stats.Entries += uint64(bh.RowsCount)
+		stats.Bytes += uint64(bh.TimestampsBlockSize) + uint64(bh.ValuesBlockSize)
+	}
+	if err := ts.Error(); err != nil {
+		return nil, fmt.Errorf("error when searching blocks for tagFilters=%s on the time range %s: %w", tfss, &tr, err)
+	}
+	return &stats, nil
+}
+
+// IndexVolume contains the volume of log rows for a group of streams.
+type IndexVolume struct {
+	// MetricName contains labels the streams are grouped by.
+	MetricName MetricName
+
+	// Timestamp is the start of the time bucket for the volume.
+	//
+	// It is set only if the volume is requested with non-zero step.
+	Timestamp int64
+
+	// Entries is the number of rows in the blocks for the group.
+	Entries uint64
+
+	// Bytes is the size of the blocks for the group on disk.
+	Bytes uint64
+}
+
+// Marshal appends marshaled iv to dst and returns the result.
+func (iv *IndexVolume) Marshal(dst []byte) []byte {
+	metricName := iv.MetricName.MarshalNoAccountIDProjectID(nil)
+	dst = encoding.MarshalBytes(dst, metricName)
+	dst = encoding.MarshalVarInt64(dst, iv.Timestamp)
+	dst = encoding.MarshalVarUint64(dst, iv.Entries)
+	dst = encoding.MarshalVarUint64(dst, iv.Bytes)
+	return dst
+}
+
+// Unmarshal unmarshals iv from src and returns the tail.
+func (iv *IndexVolume) Unmarshal(src []byte) ([]byte, error) {
+	tail, metricName, err := encoding.UnmarshalBytes(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal MetricName: %w", err)
+	}
+	if err := iv.MetricName.UnmarshalNoAccountIDProjectID(metricName); err != nil {
+		return src, fmt.Errorf("cannot unmarshal MetricName from %q: %w", metricName, err)
+	}
+	src = tail
+
+	tail, timestamp, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal Timestamp: %w", err)
+	}
+	iv.Timestamp = timestamp
+	src = tail
+
+	tail, entries, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal Entries: %w", err)
+	}
+	iv.Entries = entries
+	src = tail
+
+	tail, bytes, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal Bytes: %w", err)
+	}
+	iv.Bytes = bytes
+	return tail, nil
+}
+
+// GetIndexVolume returns the volume of log rows in blocks matching tfss on the given tr.
+//
+// The volume is grouped by targetLabels. Streams missing all the targetLabels are grouped into a single group with empty labels.
+// If step is positive, then the volume is additionally grouped by time buckets with step duration starting from tr.MinTimestamp.
+// Every block is accounted in the bucket containing its first row.
+//
+// The volume is calculated from block headers without reading block data. See GetIndexStats for details.
+func (s *Storage) GetIndexVolume(tfss []*TagFilters, tr TimeRange, targetLabels []string, step int64, maxMetrics int, deadline uint64) ([]IndexVolume, error) {
+	tsids, err := s.searchTSIDs(tfss, tr, maxMetrics, deadline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot search TSIDs for tagFilters=%s on the time range %s: %w", tfss, &tr, err)
+	}
+
+	var ts tableSearch
+	ts.Init(s.tb, tsids, tr)
+	defer ts.MustClose()
+
+	m := make(map[string]*IndexVolume)
+	var mn MetricName
+	var metricName, groupKey, key []byte
+	var prevMetricID uint64
+	hasStream := false
+	skipStream := false
+	loops := 0
+	for ts.NextBlock() {
+		if loops&paceLimiterSlowIterationsMask == 0 {
+			if err := checkSearchDeadlineAndPace(deadline); err != nil {
+				return nil, err
+			}
+		}
+		loops++
+		bh := &ts.BlockRef.bh
+		// Blocks are sorted by TSID, so the group for the stream is calculated only once.
+		if !hasStream || bh.TSID.MetricID != prevMetricID {
+			hasStream = true
+			prevMetricID = bh.TSID.MetricID
+			metricName, err = s.searchMetricName(metricName[:0], bh.TSID.MetricID, bh.TSID.AccountID, bh.TSID.ProjectID)
+			if err != nil {
+				if err == io.EOF {
+					// Skip missing metricName for bh.TSID.MetricID like Search does.
+					skipStream = true
+					continue
+				}
+				return nil, fmt.Errorf("cannot find metricName for metricID=%d: %w", bh.TSID.MetricID, err)
+			}
+			skipStream = false
+			if err := mn.Unmarshal(metricName); err != nil {
+				return nil, fmt.Errorf("cannot unmarshal metricName %q: %w", metricName, err)
+			}
+			mn.RemoveTagsOn(targetLabels)
+			mn.sortTags()
+			groupKey = mn.MarshalNoAccountIDProjectID(groupKey[:0])
+		}
+		if skipStream {
+			continue
+		}
+		timestamp := int64(0)
+		if step > 0 {
+			timestamp = tr.MinTimestamp
+			if bh.MinTimestamp > tr.MinTimestamp {
+				timestamp += (bh.MinTimestamp - tr.MinTimestamp) / step * step
+			}
+		}
+		key = encoding.MarshalInt64(append(key[:0], groupKey...), timestamp)
+		iv := m[string(key)]
+		if iv == nil {
+			iv = &IndexVolume{
+				Timestamp: timestamp,
+			}
+			iv.MetricName.CopyFrom(&mn)
+			m[string(key)] = iv
+		}
+		iv.Entries += uint64(bh.RowsCount)
+		iv.Bytes += uint64(bh.TimestampsBlockSize) + uint64(bh.ValuesBlockSize)
+	}
+	if err := ts.Error(); err != nil {
+		return nil, fmt.Errorf("error when searching blocks for tagFilters=%s on the time range %s: %w", tfss, &tr, err)
+	}
+	ivs := make([]IndexVolume, 0, len(m))
+	for _, iv := range m {
+		ivs = append(ivs, *iv)
+	}
+	return ivs, nil
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorageGetIndexStats(t *testing.T) {
+	path := "TestStorageGetIndexStats"
+	st, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage %q: %s", path, err)
+	}
+	defer func() {
+		st.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove storage %q: %s", path, err)
+		}
+	}()
+
+	const rowsCount = 1000
+	const seriesCount = 10
+	mrs := make([]MetricRow, rowsCount)
+	startTimestamp := timestampFromTime(time.Now()) - rowsCount
+	for i := range mrs {
+		var mn MetricName
+		mn.AccountID = uint32(i % 2)
+		mn.AddTag("job", fmt.Sprintf("job-%d", i%3))
+		mn.AddTag("instance", fmt.Sprintf("host-%d", i%seriesCount))
+		mr := &mrs[i]
+		mr.MetricNameRaw = mn.marshalRaw(nil)
+		mr.Timestamp = startTimestamp + int64(i)
+		mr.Value = []byte(fmt.Sprintf("line %d", i))
+	}
+	if err := st.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	// Re-open the storage in order to flush all the pending cached data.
+	st.MustClose()
+	st, err = OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage %q: %s", path, err)
+	}
+
+	tr := TimeRange{
+		MinTimestamp: startTimestamp,
+		MaxTimestamp: startTimestamp + rowsCount,
+	}
+	f := func(accountID uint32, job string, streamsExpected, entriesExpected uint64) {
+		t.Helper()
+		tfs := NewTagFilters(accountID, 0)
+		if err := tfs.Add([]byte("job"), []byte(job), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		stats, err := st.GetIndexStats([]*TagFilters{tfs}, tr, 1e5, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if stats.Streams != streamsExpected {
+			t.Fatalf("unexpected streams for job=~%q; got %d; want %d", job, stats.Streams, streamsExpected)
+		}
+		if stats.Entries != entriesExpected {
+			t.Fatalf("unexpected entries for job=~%q; got %d; want %d", job, stats.Entries, entriesExpected)
+		}
+		if stats.Chunks < stats.Streams {
+			t.Fatalf("chunks=%d cannot be smaller than streams=%d for job=~%q", stats.Chunks, stats.Streams, job)
+		}
+		if entriesExpected > 0 && stats.Bytes == 0 {
+			t.Fatalf("expecting non-zero bytes for job=~%q", job)
+		}
+	}
+	// Every account contains 5 hosts, while every host is written with every job.
+	f(0, "job-0", 5, 167)
+	f(1, "job-0", 5, 167)
+	f(0, "job-.*", 15, 500)
+	f(1, "job-.*", 15, 500)
+	f(0, "missing-job", 0, 0)
+}
+
+func TestIndexStatsAdd(t *testing.T) {
+	var stats IndexStats
+	stats.Add(&IndexStats{Streams: 1, Chunks: 2, Entries: 3, Bytes: 4})
+	stats.Add(&IndexStats{Streams: 10, Chunks: 20, Entries: 30, Bytes: 40})
+	statsExpected := IndexStats{Streams: 11, Chunks: 22, Entries: 33, Bytes: 44}
+	if stats != statsExpected {
+		t.Fatalf("unexpected stats; got %+v; want %+v", stats, statsExpected)
+	}
+}
+
+func TestStorageGetIndexVolume(t *testing.T) {
+	path := "TestStorageGetIndexVolume"
+	st, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage %q: %s", path, err)
+	}
+	defer func() {
+		st.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove storage %q: %s", path, err)
+		}
+	}()
+
+	const rowsCount = 1200
+	const seriesCount = 12
+	mrs := make([]MetricRow, rowsCount)
+	startTimestamp := timestampFromTime(time.Now()) - rowsCount
+	for i := range mrs {
+		var mn MetricName
+		mn.AddTag("job", fmt.Sprintf("job-%d", i%3))
+		mn.AddTag("instance", fmt.Sprintf("host-%d", i%seriesCount))
+		mr := &mrs[i]
+		mr.MetricNameRaw = mn.marshalRaw(nil)
+		mr.Timestamp = startTimestamp + int64(i)
+		mr.Value = []byte(fmt.Sprintf("line %d", i))
+	}
+	if err := st.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	// Re-open the storage in order to flush all the pending cached data.
+	st.MustClose()
+	st, err = OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage %q: %s", path, err)
+	}
+
+	tr := TimeRange{
+		MinTimestamp: startTimestamp,
+		MaxTimestamp: startTimestamp + rowsCount,
+	}
+	f := func(targetLabels []string, step int64, resultExpected map[string]uint64) {
+		t.Helper()
+		tfs := NewTagFilters(0, 0)
+		if err := tfs.Add([]byte("job"), []byte("job-.*"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		ivs, err := st.GetIndexVolume([]*TagFilters{tfs}, tr, targetLabels, step, 1e5, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := make(map[string]uint64)
+		for i := range ivs {
+			iv := &ivs[i]
+			if iv.Bytes == 0 {
+				t.Fatalf("expecting non-zero bytes for %s", &iv.MetricName)
+			}
+			if step == 0 && iv.Timestamp != 0 {
+				t.Fatalf("unexpected non-zero timestamp for %s: %d", &iv.MetricName, iv.Timestamp)
+			}
+			if step > 0 && (iv.Timestamp < tr.MinTimestamp || (iv.Timestamp-tr.MinTimestamp)%step != 0) {
+				t.Fatalf("timestamp=%d for %s isn't aligned to step=%d from %d", iv.Timestamp, &iv.MetricName, step, tr.MinTimestamp)
+			}
+			result[string(iv.MetricName.GetTagValue("job"))] += iv.Entries
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected entries for targetLabels=%q, step=%d; got %v; want %v", targetLabels, step, result, resultExpected)
+		}
+	}
+	f([]string{"job"}, 0, map[string]uint64{
+		"job-0": 400,
+		"job-1": 400,
+		"job-2": 400,
+	})
+	f([]string{"job"}, 100, map[string]uint64{
+		"job-0": 400,
+		"job-1": 400,
+		"job-2": 400,
+	})
+	f([]string{"job", "instance"}, 0, map[string]uint64{
+		"job-0": 400,
+		"job-1": 400,
+		"job-2": 400,
+	})
+	f([]string{"missing"}, 0, map[string]uint64{
+		"": 1200,
+	})
+	f(nil, 0, map[string]uint64{
+		"": 1200,
+	})
+}
+
+func TestIndexVolumeMarshalUnmarshal(t *testing.T) {
+	var iv IndexVolume
+	iv.MetricName.AddTag("job", "api")
+	iv.MetricName.AddTag("instance", "host-1")
+	iv.Timestamp = 1234567
+	iv.Entries = 42
+	iv.Bytes = 98765
+	data := iv.Marshal(nil)
+
+	var iv2 IndexVolume
+	tail, err := iv2.Unmarshal(append(data, "tail"...))
+	if err != nil {
+		t.Fatalf("cannot unmarshal IndexVolume: %s", err)
+	}
+	if string(tail) != "tail" {
+		t.Fatalf("unexpected tail; got %q; want %q", tail, "tail")
+	}
+	if !reflect.DeepEqual(&iv, &iv2) {
+		t.Fatalf("unexpected IndexVolume after unmarshaling;\ngot\n%+v\nwant\n%+v", &iv2, &iv)
+	}
+	if _, err := iv2.Unmarshal(data[:len(data)-1]); err == nil {
+		t.Fatalf("expecting non-nil error when unmarshaling truncated IndexVolume")
+	}
+}
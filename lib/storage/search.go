@@ -51,6 +51,19 @@ func (br *BlockRef) MustReadBlock(dst *Block, fetchData uint8) {
 	}
 }
 
+// RowsCount returns the number of rows in the block referred by br.
+func (br *BlockRef) RowsCount() int {
+	return int(br.bh.RowsCount)
+}
+
+// TimeRange returns the time range for the rows in the block referred by br.
+func (br *BlockRef) TimeRange() TimeRange {
+	return TimeRange{
+		MinTimestamp: br.bh.MinTimestamp,
+		MaxTimestamp: br.bh.MaxTimestamp,
+	}
+}
+
 // MetricBlockRef contains reference to time series block for a single metric.
 type MetricBlockRef struct {
 	// The metric name
@@ -184,10 +197,41 @@ func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMet
 	if err == nil {
 		err = storage.prefetchMetricNames(tsids, deadline)
 	}
-	// It is ok to call Init on error from storage.searchTSIDs.
+	return s.initTableSearch(storage, tsids, err)
+}
+
+// InitWithMetricName initializes s from the given storage, mn and tr.
+//
+// Only blocks for the time series with the given mn are searched. TSIDs for mn are obtained
+// via MetricName -> TSID lookup, so the search doesn't depend on the number of time series matching tag filters.
+//
+// MustClose must be called when the search is done.
+//
+// InitWithMetricName returns the number of found TSIDs for mn.
+func (s *Search) InitWithMetricName(storage *Storage, mn *MetricName, tr TimeRange, deadline uint64) int {
+	if s.needClosing {
+		logger.Panicf("BUG: missing MustClose call before the next call to InitWithMetricName")
+	}
+
+	s.reset()
+	s.tr = tr
+	s.deadline = deadline
+	s.needClosing = true
+
+	mn.sortTags()
+	metricName := mn.Marshal(nil)
+	tsids, err := storage.searchTSIDsByMetricName(metricName)
+	if err != nil {
+		err = fmt.Errorf("cannot search TSIDs for %s: %w", mn, err)
+	}
+	return s.initTableSearch(storage, tsids, err)
+}
+
+func (s *Search) initTableSearch(storage *Storage, tsids []TSID, err error) int {
+	// It is ok to call Init on error from TSIDs search.
 	// Init must be called before returning because it will fail
 	// on Seach.MustClose otherwise.
-	s.ts.Init(storage.tb, tsids, tr)
+	s.ts.Init(storage.tb, tsids, s.tr)
 
 	if err != nil {
 		s.err = err
@@ -428,6 +472,79 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 	return src, nil
 }
 
+// StreamSearchQuery is used for sending search queries for a single time series from vmselect to vmstorage.
+type StreamSearchQuery struct {
+	AccountID    uint32
+	ProjectID    uint32
+	MinTimestamp int64
+	MaxTimestamp int64
+
+	// MetricName is the name of the time series to search.
+	MetricName MetricName
+}
+
+// String returns string representation of the stream search query.
+func (ssq *StreamSearchQuery) String() string {
+	return fmt.Sprintf("AccountID=%d, ProjectID=%d, MinTimestamp=%s, MaxTimestamp=%s, MetricName=%s",
+		ssq.AccountID, ssq.ProjectID, timestampToTime(ssq.MinTimestamp), timestampToTime(ssq.MaxTimestamp), &ssq.MetricName)
+}
+
+// Marshal appends marshaled ssq to dst and returns the result.
+func (ssq *StreamSearchQuery) Marshal(dst []byte) []byte {
+	dst = encoding.MarshalUint32(dst, ssq.AccountID)
+	dst = encoding.MarshalUint32(dst, ssq.ProjectID)
+	dst = encoding.MarshalVarInt64(dst, ssq.MinTimestamp)
+	dst = encoding.MarshalVarInt64(dst, ssq.MaxTimestamp)
+	ssq.MetricName.sortTags()
+	metricName := ssq.MetricName.MarshalNoAccountIDProjectID(nil)
+	dst = encoding.MarshalBytes(dst, metricName)
+	return dst
+}
+
+// Unmarshal unmarshals ssq from src and returns the tail.
+//
+// AccountID and ProjectID for ssq.MetricName are set to ssq.AccountID and ssq.ProjectID.
+func (ssq *StreamSearchQuery) Unmarshal(src []byte) ([]byte, error) {
+	if len(src) < 4 {
+		return src, fmt.Errorf("cannot unmarshal AccountID: too short src len: %d; must be at least %d bytes", len(src), 4)
+	}
+	ssq.AccountID = encoding.UnmarshalUint32(src)
+	src = src[4:]
+
+	if len(src) < 4 {
+		return src, fmt.Errorf("cannot unmarshal ProjectID: too short src len: %d; must be at least %d bytes", len(src), 4)
+	}
+	ssq.ProjectID = encoding.UnmarshalUint32(src)
+	src = src[4:]
+
+	tail, minTs, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal MinTimestamp: %w", err)
+	}
+	ssq.MinTimestamp = minTs
+	src = tail
+
+	tail, maxTs, err := encoding.UnmarshalVarInt64(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal MaxTimestamp: %w", err)
+	}
+	ssq.MaxTimestamp = maxTs
+	src = tail
+
+	tail, metricName, err := encoding.UnmarshalBytes(src)
+	if err != nil {
+		return src, fmt.Errorf("cannot unmarshal MetricName: %w", err)
+	}
+	if err := ssq.MetricName.UnmarshalNoAccountIDProjectID(metricName); err != nil {
+		return src, fmt.Errorf("cannot unmarshal MetricName: %w", err)
+	}
+	ssq.MetricName.AccountID = ssq.AccountID
+	ssq.MetricName.ProjectID = ssq.ProjectID
+	src = tail
+
+	return src, nil
+}
+
 func checkSearchDeadlineAndPace(deadline uint64) error {
 	if fasttime.UnixTimestamp() > deadline {
 		return ErrDeadlineExceeded
@@ -298,3 +298,123 @@ func mrsToString(mrs []MetricRow) string {
 	}
 	return bb.String()
 }
+
+func TestStreamSearchQueryMarshalUnmarshal(t *testing.T) {
+	f := func(ssq *StreamSearchQuery) {
+		t.Helper()
+		buf := ssq.Marshal(nil)
+		var ssq2 StreamSearchQuery
+		tail, err := ssq2.Unmarshal(buf)
+		if err != nil {
+			t.Fatalf("cannot unmarshal StreamSearchQuery: %s", err)
+		}
+		if len(tail) > 0 {
+			t.Fatalf("unexpected tail left after StreamSearchQuery unmarshaling; tail (len=%d): %q", len(tail), tail)
+		}
+		if ssq2.String() != ssq.String() {
+			t.Fatalf("unexpected StreamSearchQuery unmarshaled;\ngot\n%s\nwant\n%s", &ssq2, ssq)
+		}
+		if ssq2.MetricName.AccountID != ssq.AccountID || ssq2.MetricName.ProjectID != ssq.ProjectID {
+			t.Fatalf("unexpected tenant for MetricName; got %d:%d; want %d:%d",
+				ssq2.MetricName.AccountID, ssq2.MetricName.ProjectID, ssq.AccountID, ssq.ProjectID)
+		}
+	}
+	f(&StreamSearchQuery{})
+	ssq := &StreamSearchQuery{
+		AccountID:    12,
+		ProjectID:    34,
+		MinTimestamp: -1,
+		MaxTimestamp: 1600000000000,
+	}
+	ssq.MetricName.AccountID = 12
+	ssq.MetricName.ProjectID = 34
+	ssq.MetricName.MetricGroup = []byte("foo")
+	ssq.MetricName.AddTag("job", "api")
+	ssq.MetricName.AddTag("instance", "host:1234")
+	f(ssq)
+
+	// Invalid data
+	buf := ssq.Marshal(nil)
+	for i := 0; i < len(buf); i++ {
+		var ssq2 StreamSearchQuery
+		if _, err := ssq2.Unmarshal(buf[:i]); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling truncated StreamSearchQuery with len=%d", i)
+		}
+	}
+}
+
+func TestSearchWithMetricName(t *testing.T) {
+	path := "TestSearchWithMetricName"
+	st, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage %q: %s", path, err)
+	}
+	defer func() {
+		st.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove storage %q: %s", path, err)
+		}
+	}()
+
+	const rowsCount = 1000
+	const seriesCount = 10
+	mrs := make([]MetricRow, rowsCount)
+	startTimestamp := timestampFromTime(time.Now()) - rowsCount
+	for i := range mrs {
+		var mn MetricName
+		mn.AccountID = uint32(i % 2)
+		mn.AddTag("job", "api")
+		mn.AddTag("instance", fmt.Sprintf("host-%d", i%seriesCount))
+		mr := &mrs[i]
+		mr.MetricNameRaw = mn.marshalRaw(nil)
+		mr.Timestamp = startTimestamp + int64(i)
+		mr.Value = []byte(fmt.Sprintf("line %d", i))
+	}
+	if err := st.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	// Re-open the storage in order to flush all the pending cached data.
+	st.MustClose()
+	st, err = OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot re-open storage %q: %s", path, err)
+	}
+
+	tr := TimeRange{
+		MinTimestamp: startTimestamp,
+		MaxTimestamp: startTimestamp + rowsCount,
+	}
+	f := func(accountID uint32, instance string, rowsExpected int) {
+		t.Helper()
+		var mn MetricName
+		mn.AccountID = accountID
+		mn.AddTag("instance", instance)
+		mn.AddTag("job", "api")
+		var s Search
+		s.InitWithMetricName(st, &mn, tr, noDeadline)
+		defer s.MustClose()
+		var b Block
+		rows := 0
+		for s.NextMetricBlock() {
+			var mnFound MetricName
+			if err := mnFound.Unmarshal(s.MetricBlockRef.MetricName); err != nil {
+				t.Fatalf("cannot unmarshal metric name: %s", err)
+			}
+			if mnFound.String() != mn.String() {
+				t.Fatalf("unexpected metric name found; got %s; want %s", &mnFound, &mn)
+			}
+			s.MetricBlockRef.BlockRef.MustReadBlock(&b, 2)
+			rows += b.RowsCount()
+		}
+		if err := s.Error(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if rows != rowsExpected {
+			t.Fatalf("unexpected number of rows found for %s; got %d; want %d", &mn, rows, rowsExpected)
+		}
+	}
+	f(0, "host-0", rowsCount/seriesCount)
+	f(1, "host-1", rowsCount/seriesCount)
+	f(1, "host-0", 0)
+	f(0, "missing-host", 0)
+}
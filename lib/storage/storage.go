@@ -106,6 +106,12 @@ type Storage struct {
 	// which may be in the process of flushing to disk by concurrently running
 	// snapshot process.
 	snapshotLock sync.Mutex
+
+	// tailSubs contains []*TailSubscription, which receive newly added rows.
+	//
+	// tailSubsLock serializes tailSubs updates.
+	tailSubs     atomic.Value
+	tailSubsLock sync.Mutex
 }
 
 type pendingHourMetricIDEntry struct {
@@ -355,6 +361,9 @@ type Metrics struct {
 	SlowPerDayIndexInserts uint64
 	SlowMetricNameLoads    uint64
 
+	TailSubscriptions uint64
+	TailDroppedRows   uint64
+
 	TimestampsBlocksMerged uint64
 	TimestampsBytesSaved   uint64
 
@@ -424,6 +433,10 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.SlowPerDayIndexInserts += atomic.LoadUint64(&s.slowPerDayIndexInserts)
 	m.SlowMetricNameLoads += atomic.LoadUint64(&s.slowMetricNameLoads)
 
+	subs, _ := s.tailSubs.Load().([]*TailSubscription)
+	m.TailSubscriptions += uint64(len(subs))
+	m.TailDroppedRows = atomic.LoadUint64(&tailDroppedRows)
+
 	m.TimestampsBlocksMerged = atomic.LoadUint64(&timestampsBlocksMerged)
 	m.TimestampsBytesSaved = atomic.LoadUint64(&timestampsBytesSaved)
 
@@ -903,6 +916,38 @@ var (
 	searchTSIDsConcurrencyCh = make(chan struct{}, runtime.GOMAXPROCS(-1)*2)
 )
 
+// searchTSIDsByMetricName returns sorted TSIDs for the given canonical metricName.
+//
+// TSIDs are searched in the current and the previous indexDB, since the time series may have
+// different TSIDs before and after indexDB rotation.
+func (s *Storage) searchTSIDsByMetricName(metricName []byte) ([]TSID, error) {
+	var tsids []TSID
+	idb := s.idb()
+	var tsid TSID
+	if err := idb.getTSIDByNameNoCreate(&tsid, metricName); err == nil {
+		tsids = append(tsids, tsid)
+	} else if err != io.EOF {
+		return nil, err
+	}
+	var errExt error
+	idb.doExtDB(func(extDB *indexDB) {
+		var tsid TSID
+		err := extDB.getTSIDByNameNoCreate(&tsid, metricName)
+		if err == nil {
+			if len(tsids) == 0 || tsids[0].MetricID != tsid.MetricID {
+				tsids = append(tsids, tsid)
+			}
+		} else if err != io.EOF {
+			errExt = err
+		}
+	})
+	if errExt != nil {
+		return nil, errExt
+	}
+	sort.Slice(tsids, func(i, j int) bool { return tsids[i].Less(&tsids[j]) })
+	return tsids, nil
+}
+
 // prefetchMetricNames pre-fetches metric names for the given tsids into metricID->metricName cache.
 //
 // It is expected that all the tsdis have the same (accountID, projectID)
@@ -1164,16 +1209,36 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 	}
 
 	// Add rows to the storage.
+	// Rows accepted by the storage are tracked only if there are tail subscriptions.
+	var accepted []bool
+	if s.hasTailSubscriptions() {
+		accepted = make([]bool, len(mrs))
+	}
 	var err error
 	rr := getRawRowsWithSize(len(mrs))
-	rr.rows, err = s.add(rr.rows, mrs, precisionBits)
+	rr.rows, err = s.add(rr.rows, mrs, accepted, precisionBits)
 	putRawRows(rr)
 
 	<-addRowsConcurrencyCh
 
+	if err == nil && accepted != nil {
+		// Publish only the rows accepted by the storage, so tail subscribers don't receive rows, which cannot be found by search.
+		s.publishTailRows(getAcceptedRows(mrs, accepted))
+	}
 	return err
 }
 
+// getAcceptedRows returns rows from mrs with the corresponding accepted items set.
+func getAcceptedRows(mrs []MetricRow, accepted []bool) []MetricRow {
+	dst := make([]MetricRow, 0, len(mrs))
+	for i := range mrs {
+		if accepted[i] {
+			dst = append(dst, mrs[i])
+		}
+	}
+	return dst
+}
+
 var (
 	// Limit the concurrency for data ingestion to GOMAXPROCS, since this operation
 	// is CPU bound, so there is no sense in running more than GOMAXPROCS concurrent
@@ -1182,7 +1247,15 @@ var (
 	addRowsTimeout       = 30 * time.Second
 )
 
-func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]rawRow, error) {
+// add adds mrs to s.
+//
+// If accepted isn't nil, then accepted[i] is set for every mrs[i] added to s.
+func (s *Storage) add(rows []rawRow, mrs []MetricRow, accepted []bool, precisionBits uint8) ([]rawRow, error) {
+	markAccepted := func(idx int) {
+		if accepted != nil {
+			accepted[idx] = true
+		}
+	}
 	idb := s.idb()
 	rowsLen := len(rows)
 	if n := rowsLen + len(mrs) - cap(rows); n > 0 {
@@ -1235,6 +1308,7 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 			// Fast path - the current mr contains the same metric name as the previous mr, so it contains the same TSID.
 			// This path should trigger on bulk imports when many rows contain the same MetricNameRaw.
 			r.TSID = prevTSID
+			markAccepted(i)
 			continue
 		}
 		if s.getTSIDFromCache(&r.TSID, mr.MetricNameRaw) {
@@ -1244,6 +1318,7 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 			// See Storage.DeleteMetrics code for details.
 			prevTSID = r.TSID
 			prevMetricNameRaw = mr.MetricNameRaw
+			markAccepted(i)
 			continue
 		}
 
@@ -1253,7 +1328,7 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 		if pmrs == nil {
 			pmrs = getPendingMetricRows()
 		}
-		if err := pmrs.addRow(mr); err != nil {
+		if err := pmrs.addRow(mr, i); err != nil {
 			// Do not stop adding rows on error - just skip invalid row.
 			// This guarantees that invalid rows don't prevent
 			// from adding valid rows into the storage.
@@ -1284,6 +1359,7 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 				// Fast path - the current mr contains the same metric name as the previous mr, so it contains the same TSID.
 				// This path should trigger on bulk imports when many rows contain the same MetricNameRaw.
 				r.TSID = prevTSID
+				markAccepted(pmr.idx)
 				continue
 			}
 			if s.getTSIDFromCache(&r.TSID, mr.MetricNameRaw) {
@@ -1293,6 +1369,7 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 				// See Storage.DeleteMetrics code for details.
 				prevTSID = r.TSID
 				prevMetricNameRaw = mr.MetricNameRaw
+				markAccepted(pmr.idx)
 				continue
 			}
 			slowInsertsCount++
@@ -1307,6 +1384,7 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 				continue
 			}
 			s.putTSIDToCache(&r.TSID, mr.MetricNameRaw)
+			markAccepted(pmr.idx)
 		}
 		idb.putIndexSearch(is)
 		putPendingMetricRows(pmrs)
@@ -1333,6 +1411,9 @@ func (s *Storage) add(rows []rawRow, mrs []MetricRow, precisionBits uint8) ([]ra
 type pendingMetricRow struct {
 	MetricName []byte
 	mr         MetricRow
+
+	// idx is the index of mr in the rows passed to Storage.add.
+	idx int
 }
 
 type pendingMetricRows struct {
@@ -1356,7 +1437,7 @@ func (pmrs *pendingMetricRows) reset() {
 	pmrs.mn.Reset()
 }
 
-func (pmrs *pendingMetricRows) addRow(mr *MetricRow) error {
+func (pmrs *pendingMetricRows) addRow(mr *MetricRow, idx int) error {
 	// Do not spend CPU time on re-calculating canonical metricName during bulk import
 	// of many rows for the same metric.
 	if string(mr.MetricNameRaw) != string(pmrs.lastMetricNameRaw) {
@@ -1372,6 +1453,7 @@ func (pmrs *pendingMetricRows) addRow(mr *MetricRow) error {
 	pmrs.pmrs = append(pmrs.pmrs, pendingMetricRow{
 		MetricName: pmrs.lastMetricName,
 		mr:         *mr,
+		idx:        idx,
 	})
 	return nil
 }
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+// maxTailBufferSize is the maximum size of log rows buffered per tail subscription until they are read by the subscriber.
+//
+// Rows exceeding the limit are dropped, since the subscriber doesn't keep up with the ingestion rate.
+const maxTailBufferSize = 4 * 1024 * 1024
+
+// maxTailDroppedRows is the maximum number of dropped rows reported per TailBatch.
+const maxTailDroppedRows = 1000
+
+var tailDroppedRows uint64
+
+// TailRow is a log row published to tail subscription.
+type TailRow struct {
+	// MetricName contains marshaled MetricName for the row. It must be decoded with MetricName.Unmarshal.
+	MetricName []byte
+
+	Timestamp int64
+
+	// Data contains the log line. It is empty for dropped rows.
+	Data []byte
+}
+
+// TailBatch contains log rows published to tail subscription.
+type TailBatch struct {
+	// Rows contains log rows in the order they were added to the storage.
+	Rows []TailRow
+
+	// Dropped contains rows dropped because the subscriber didn't keep up with the ingestion rate.
+	//
+	// Up to maxTailDroppedRows rows are stored per batch.
+	Dropped []TailRow
+
+	// buf holds MetricName and Data for Rows and Dropped.
+	buf []byte
+}
+
+// Reset resets tb.
+func (tb *TailBatch) Reset() {
+	tb.Rows = tb.Rows[:0]
+	tb.Dropped = tb.Dropped[:0]
+	tb.buf = tb.buf[:0]
+}
+
+// Len returns the number of rows and dropped rows in tb.
+func (tb *TailBatch) Len() int {
+	return len(tb.Rows) + len(tb.Dropped)
+}
+
+func (tb *TailBatch) addRow(metricName []byte, timestamp int64, data []byte) {
+	bufLen := len(tb.buf)
+	tb.buf = append(tb.buf, metricName...)
+	tb.buf = append(tb.buf, data...)
+	tb.Rows = append(tb.Rows, TailRow{
+		MetricName: tb.buf[bufLen : bufLen+len(metricName)],
+		Timestamp:  timestamp,
+		Data:       tb.buf[bufLen+len(metricName):],
+	})
+}
+
+func (tb *TailBatch) addDropped(metricName []byte, timestamp int64) {
+	bufLen := len(tb.buf)
+	tb.buf = append(tb.buf, metricName...)
+	tb.Dropped = append(tb.Dropped, TailRow{
+		MetricName: tb.buf[bufLen:],
+		Timestamp:  timestamp,
+	})
+}
+
+// Marshal appends marshaled tb to dst and returns the result.
+func (tb *TailBatch) Marshal(dst []byte) []byte {
+	dst = encoding.MarshalVarUint64(dst, uint64(len(tb.Rows)))
+	for i := range tb.Rows {
+		r := &tb.Rows[i]
+		dst = encoding.MarshalBytes(dst, r.MetricName)
+		dst = encoding.MarshalVarInt64(dst, r.Timestamp)
+		dst = encoding.MarshalBytes(dst, r.Data)
+	}
+	dst = encoding.MarshalVarUint64(dst, uint64(len(tb.Dropped)))
+	for i := range tb.Dropped {
+		r := &tb.Dropped[i]
+		dst = encoding.MarshalBytes(dst, r.MetricName)
+		dst = encoding.MarshalVarInt64(dst, r.Timestamp)
+	}
+	return dst
+}
+
+// Unmarshal unmarshals tb from src.
+//
+// tb doesn't refer to src after returning from the function.
+func (tb *TailBatch) Unmarshal(src []byte) error {
+	tb.Reset()
+	tail, rowsCount, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal rows count: %w", err)
+	}
+	src = tail
+	for i := uint64(0); i < rowsCount; i++ {
+		tail, metricName, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal MetricName for row #%d: %w", i, err)
+		}
+		src = tail
+		tail, timestamp, err := encoding.UnmarshalVarInt64(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal timestamp for row #%d: %w", i, err)
+		}
+		src = tail
+		tail, data, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal data for row #%d: %w", i, err)
+		}
+		src = tail
+		tb.addRow(metricName, timestamp, data)
+	}
+	tail, droppedCount, err := encoding.UnmarshalVarUint64(src)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal dropped rows count: %w", err)
+	}
+	src = tail
+	for i := uint64(0); i < droppedCount; i++ {
+		tail, metricName, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal MetricName for dropped row #%d: %w", i, err)
+		}
+		src = tail
+		tail, timestamp, err := encoding.UnmarshalVarInt64(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal timestamp for dropped row #%d: %w", i, err)
+		}
+		src = tail
+		tb.addDropped(metricName, timestamp)
+	}
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected non-empty tail left after unmarshaling TailBatch; len(tail)=%d", len(src))
+	}
+	return nil
+}
+
+// TailSubscription receives log rows matching tag filters as soon as they are added to the storage.
+//
+// Unsubscribe must be called when the subscription is no longer needed.
+type TailSubscription struct {
+	s *Storage
+
+	accountID uint32
+	projectID uint32
+	tfss      [][]*tagFilter
+
+	notifyCh chan struct{}
+
+	mu sync.Mutex
+	kb bytesutil.ByteBuffer
+	tb TailBatch
+}
+
+// SubscribeTail returns new subscription for log rows matching any of tfss, which are added to s after the call.
+//
+// All the tfss must belong to the same tenant.
+func (s *Storage) SubscribeTail(tfss []*TagFilters) *TailSubscription {
+	ts := &TailSubscription{
+		s:        s,
+		notifyCh: make(chan struct{}, 1),
+	}
+	for _, tfs := range tfss {
+		ts.accountID = tfs.accountID
+		ts.projectID = tfs.projectID
+		tfsPtrs := make([]*tagFilter, len(tfs.tfs))
+		for i := range tfs.tfs {
+			tfsPtrs[i] = &tfs.tfs[i]
+		}
+		ts.tfss = append(ts.tfss, tfsPtrs)
+	}
+
+	s.tailSubsLock.Lock()
+	subs, _ := s.tailSubs.Load().([]*TailSubscription)
+	subsNew := append([]*TailSubscription{}, subs...)
+	subsNew = append(subsNew, ts)
+	s.tailSubs.Store(subsNew)
+	s.tailSubsLock.Unlock()
+	return ts
+}
+
+// Unsubscribe stops publishing log rows to ts.
+func (ts *TailSubscription) Unsubscribe() {
+	s := ts.s
+	s.tailSubsLock.Lock()
+	subs, _ := s.tailSubs.Load().([]*TailSubscription)
+	subsNew := make([]*TailSubscription, 0, len(subs))
+	for _, sub := range subs {
+		if sub != ts {
+			subsNew = append(subsNew, sub)
+		}
+	}
+	s.tailSubs.Store(subsNew)
+	s.tailSubsLock.Unlock()
+}
+
+// NotifyCh returns a channel, which receives a notification when new log rows are published to ts.
+func (ts *TailSubscription) NotifyCh() <-chan struct{} {
+	return ts.notifyCh
+}
+
+// Read moves log rows published to ts since the previous call to dst.
+func (ts *TailSubscription) Read(dst *TailBatch) {
+	dst.Reset()
+	ts.mu.Lock()
+	ts.tb, *dst = *dst, ts.tb
+	ts.mu.Unlock()
+}
+
+func (ts *TailSubscription) match(mn *MetricName) (bool, error) {
+	if mn.AccountID != ts.accountID || mn.ProjectID != ts.projectID {
+		return false, nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, tfs := range ts.tfss {
+		ok, err := matchTagFilters(mn, tfs, &ts.kb)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (ts *TailSubscription) add(metricName []byte, timestamp int64, data []byte) {
+	ts.mu.Lock()
+	if len(ts.tb.buf)+len(metricName)+len(data) > maxTailBufferSize {
+		if len(ts.tb.Dropped) < maxTailDroppedRows {
+			ts.tb.addDropped(metricName, timestamp)
+		}
+		atomic.AddUint64(&tailDroppedRows, 1)
+	} else {
+		ts.tb.addRow(metricName, timestamp, data)
+	}
+	ts.mu.Unlock()
+
+	select {
+	case ts.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// hasTailSubscriptions returns true if s has tail subscriptions.
+func (s *Storage) hasTailSubscriptions() bool {
+	subs, _ := s.tailSubs.Load().([]*TailSubscription)
+	return len(subs) > 0
+}
+
+// publishTailRows publishes mrs to tail subscriptions for s.
+func (s *Storage) publishTailRows(mrs []MetricRow) {
+	subs, _ := s.tailSubs.Load().([]*TailSubscription)
+	if len(subs) == 0 {
+		// Fast path - there are no tail subscriptions.
+		return
+	}
+	mn := GetMetricName()
+	defer PutMetricName(mn)
+	var metricNameBuf []byte
+	var prevMetricNameRaw []byte
+	matched := make([]bool, len(subs))
+	for i := range mrs {
+		mr := &mrs[i]
+		if len(mr.Value) == 0 {
+			continue
+		}
+		if prevMetricNameRaw == nil || string(mr.MetricNameRaw) != string(prevMetricNameRaw) {
+			prevMetricNameRaw = mr.MetricNameRaw
+			if err := mn.unmarshalRaw(mr.MetricNameRaw); err != nil {
+				// Invalid rows are reported by Storage.add.
+				for j := range matched {
+					matched[j] = false
+				}
+				continue
+			}
+			mn.sortTags()
+			metricNameBuf = mn.Marshal(metricNameBuf[:0])
+			for j, ts := range subs {
+				ok, err := ts.match(mn)
+				matched[j] = ok && err == nil
+			}
+		}
+		for j, ts := range subs {
+			if matched[j] {
+				ts.add(metricNameBuf, mr.Timestamp, mr.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTailBatchMarshalUnmarshal(t *testing.T) {
+	f := func(tb *TailBatch) {
+		t.Helper()
+		data := tb.Marshal(nil)
+		var tb2 TailBatch
+		if err := tb2.Unmarshal(data); err != nil {
+			t.Fatalf("cannot unmarshal TailBatch: %s", err)
+		}
+		if tb2.Len() != tb.Len() {
+			t.Fatalf("unexpected number of rows; got %d; want %d", tb2.Len(), tb.Len())
+		}
+		data2 := tb2.Marshal(nil)
+		if string(data2) != string(data) {
+			t.Fatalf("unexpected marshaled TailBatch after unmarshaling;\ngot\n%X\nwant\n%X", data2, data)
+		}
+	}
+	var tb TailBatch
+	f(&tb)
+	tb.addRow([]byte("foo"), 123, []byte("line 1"))
+	f(&tb)
+	tb.addRow([]byte("bar"), -456, nil)
+	tb.addDropped([]byte("baz"), 789)
+	f(&tb)
+
+	// Unmarshal must fail on truncated data.
+	data := tb.Marshal(nil)
+	for i := 0; i < len(data); i++ {
+		var tb2 TailBatch
+		if err := tb2.Unmarshal(data[:i]); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling truncated data %X", data[:i])
+		}
+	}
+}
+
+func TestStorageSubscribeTail(t *testing.T) {
+	path := "TestStorageSubscribeTail"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+
+	newRow := func(accountID, projectID uint32, job string, timestamp int64, line string) MetricRow {
+		mn := &MetricName{
+			AccountID: accountID,
+			ProjectID: projectID,
+			Tags: []Tag{
+				{[]byte("job"), []byte(job)},
+			},
+		}
+		return MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     timestamp,
+			Value:         []byte(line),
+		}
+	}
+
+	tfs := NewTagFilters(1, 2)
+	if err := tfs.Add([]byte("job"), []byte("foo"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	ts := s.SubscribeTail([]*TagFilters{tfs})
+	if n := getTailSubscriptions(s); n != 1 {
+		t.Fatalf("unexpected number of tail subscriptions; got %d; want 1", n)
+	}
+
+	timestamp := time.Now().UnixNano() / 1e6
+	mrs := []MetricRow{
+		newRow(1, 2, "foo", timestamp, "line 1"),
+		newRow(1, 2, "bar", timestamp+1, "line 2"),
+		newRow(1, 3, "foo", timestamp+2, "line 3"),
+		newRow(1, 2, "foo", timestamp+3, "line 4"),
+		newRow(1, 2, "foo", timestamp+4, ""),
+		// Rows rejected by the storage mustn't be published.
+		newRow(1, 2, "foo", timestamp+3*24*3600*1000, "line 5"),
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	select {
+	case <-ts.NotifyCh():
+	default:
+		t.Fatalf("missing notification for published rows")
+	}
+	var tb TailBatch
+	ts.Read(&tb)
+	var lines []string
+	for _, r := range tb.Rows {
+		var mn MetricName
+		if err := mn.Unmarshal(r.MetricName); err != nil {
+			t.Fatalf("cannot unmarshal MetricName: %s", err)
+		}
+		lines = append(lines, fmt.Sprintf("%d/%d %s %d %s", mn.AccountID, mn.ProjectID, mn.GetTagValue("job"), r.Timestamp-timestamp, r.Data))
+	}
+	linesExpected := []string{
+		"1/2 foo 0 line 1",
+		"1/2 foo 3 line 4",
+	}
+	if !reflect.DeepEqual(lines, linesExpected) {
+		t.Fatalf("unexpected rows;\ngot\n%q\nwant\n%q", lines, linesExpected)
+	}
+	if len(tb.Dropped) > 0 {
+		t.Fatalf("unexpected dropped rows: %d", len(tb.Dropped))
+	}
+
+	// The next Read must return nothing.
+	ts.Read(&tb)
+	if tb.Len() > 0 {
+		t.Fatalf("unexpected rows after the second Read: %d", tb.Len())
+	}
+
+	// Rows exceeding maxTailBufferSize must be dropped.
+	line := string(make([]byte, 1024*1024))
+	mrs = mrs[:0]
+	for i := 0; i < 6; i++ {
+		mrs = append(mrs, newRow(1, 2, "foo", timestamp+int64(i), line))
+	}
+	s.publishTailRows(mrs)
+	ts.Read(&tb)
+	if len(tb.Rows) != 3 {
+		t.Fatalf("unexpected number of rows; got %d; want 3", len(tb.Rows))
+	}
+	if len(tb.Dropped) != 3 {
+		t.Fatalf("unexpected number of dropped rows; got %d; want 3", len(tb.Dropped))
+	}
+	if tb.Dropped[0].Timestamp != timestamp+3 {
+		t.Fatalf("unexpected timestamp for the first dropped row; got %d; want %d", tb.Dropped[0].Timestamp, timestamp+3)
+	}
+
+	ts.Unsubscribe()
+	if n := getTailSubscriptions(s); n != 0 {
+		t.Fatalf("unexpected number of tail subscriptions after Unsubscribe; got %d; want 0", n)
+	}
+	s.publishTailRows(mrs)
+	ts.Read(&tb)
+	if tb.Len() > 0 {
+		t.Fatalf("unexpected rows after Unsubscribe: %d", tb.Len())
+	}
+}
+
+func getTailSubscriptions(s *Storage) uint64 {
+	var m Metrics
+	s.UpdateMetrics(&m)
+	return m.TailSubscriptions
+}
@@ -62,6 +62,25 @@ func (tr *TimeRange) fromPartitionTime(t time.Time) {
 	tr.MaxTimestamp = maxTime.Unix()*1e3 - 1
 }
 
+// SplitByPartitions splits tr into time ranges, so each time range belongs to a distinct partition.
+//
+// The returned time ranges are sorted in ascending order.
+func (tr *TimeRange) SplitByPartitions() []TimeRange {
+	var trs []TimeRange
+	minTimestamp := tr.MinTimestamp
+	for minTimestamp <= tr.MaxTimestamp {
+		var ptr TimeRange
+		ptr.fromPartitionTimestamp(minTimestamp)
+		ptr.MinTimestamp = minTimestamp
+		if ptr.MaxTimestamp > tr.MaxTimestamp {
+			ptr.MaxTimestamp = tr.MaxTimestamp
+		}
+		trs = append(trs, ptr)
+		minTimestamp = ptr.MaxTimestamp + 1
+	}
+	return trs
+}
+
 const msecPerDay = 24 * 3600 * 1000
 
 const msecPerHour = 3600 * 1000
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -52,3 +53,57 @@ func testTimeRangeFromPartition(t *testing.T, initialTime time.Time) {
 		t.Fatalf("unexpected nextY, nextM; got %d, %d; want %d, %d+1;\nnextTime=%s\nmaxTime=%s", nextY, nextM, maxY, maxM, nextTime, maxTime)
 	}
 }
+
+func TestTimeRangeSplitByPartitions(t *testing.T) {
+	f := func(tr TimeRange, trsExpected []TimeRange) {
+		t.Helper()
+		trs := tr.SplitByPartitions()
+		if !reflect.DeepEqual(trs, trsExpected) {
+			t.Fatalf("unexpected time ranges for %s;\ngot\n%v\nwant\n%v", &tr, trs, trsExpected)
+		}
+	}
+	ts := func(s string) int64 {
+		t.Helper()
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", s, err)
+		}
+		return timestampFromTime(tm)
+	}
+
+	// Empty time range
+	f(TimeRange{
+		MinTimestamp: ts("2020-05-10T00:00:00Z"),
+		MaxTimestamp: ts("2020-05-09T00:00:00Z"),
+	}, nil)
+
+	// Single partition
+	f(TimeRange{
+		MinTimestamp: ts("2020-05-10T00:00:00Z"),
+		MaxTimestamp: ts("2020-05-20T00:00:00Z"),
+	}, []TimeRange{
+		{
+			MinTimestamp: ts("2020-05-10T00:00:00Z"),
+			MaxTimestamp: ts("2020-05-20T00:00:00Z"),
+		},
+	})
+
+	// Multiple partitions
+	f(TimeRange{
+		MinTimestamp: ts("2020-11-10T00:00:00Z"),
+		MaxTimestamp: ts("2021-01-01T00:00:00Z"),
+	}, []TimeRange{
+		{
+			MinTimestamp: ts("2020-11-10T00:00:00Z"),
+			MaxTimestamp: ts("2020-12-01T00:00:00Z") - 1,
+		},
+		{
+			MinTimestamp: ts("2020-12-01T00:00:00Z"),
+			MaxTimestamp: ts("2021-01-01T00:00:00Z") - 1,
+		},
+		{
+			MinTimestamp: ts("2021-01-01T00:00:00Z"),
+			MaxTimestamp: ts("2021-01-01T00:00:00Z"),
+		},
+	})
+}